@@ -0,0 +1,64 @@
+// Command gc_orphans removes upload files that no gallery image or rental
+// item references anymore. It reports only unless -dry-run=false.
+//
+//	go run ./cmd/gc_orphans                       # report
+//	go run ./cmd/gc_orphans -dry-run=false        # quarantine orphans
+//	go run ./cmd/gc_orphans -dry-run=false -quarantine=false -grace 24h
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/joho/godotenv"
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/services"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", true, "only report orphan files")
+	quarantine := flag.Bool("quarantine", true, "move orphans to uploads/quarantine/ instead of deleting them")
+	grace := flag.Duration("grace", services.DefaultOrphanGracePeriod, "keep files and soft-deleted rows younger than this")
+	flag.Parse()
+
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using system environment variables")
+	}
+
+	if err := services.InitBlobStore(); err != nil {
+		log.Fatal("Failed to configure blob store:", err)
+	}
+
+	// Initialize database
+	if err := database.Connect(); err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+
+	report, err := services.CollectOrphanFiles(context.Background(), services.OrphanGCOptions{
+		DryRun:      *dryRun,
+		GracePeriod: *grace,
+		Quarantine:  *quarantine,
+	})
+	if err != nil {
+		log.Fatal("Orphan collection failed:", err)
+	}
+
+	for _, orphan := range report.Orphans {
+		fmt.Printf("%s\t%d bytes\t%s\n", orphan.Key, orphan.Size, orphan.ModTime.Format("2006-01-02 15:04"))
+	}
+
+	fmt.Printf("Scanned %d files: %d referenced, %d kept for soft-deleted rows, %d recent, %d orphans (%d bytes)\n",
+		report.Scanned, report.Referenced, report.SoftDeleted, report.Recent, len(report.Orphans), report.OrphanBytes)
+
+	switch {
+	case report.DryRun:
+		fmt.Println("Dry run: nothing was removed")
+	case report.Quarantine:
+		fmt.Printf("Quarantined %d files, %d failed\n", report.Removed, report.Failed)
+	default:
+		fmt.Printf("Deleted %d files, %d failed\n", report.Removed, report.Failed)
+	}
+}
@@ -0,0 +1,96 @@
+// Command migrate_blobs copies media files from one blob backend to another,
+// e.g. from the local disk to an S3 bucket before switching BLOB_BACKEND.
+// Both backends are configured from the same environment as the server.
+//
+//	go run ./cmd/migrate_blobs -from local -to s3 -dry-run
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/mazong/angel_event/internal/services"
+)
+
+func main() {
+	from := flag.String("from", "local", "source backend (local or s3)")
+	to := flag.String("to", "s3", "destination backend (local or s3)")
+	prefixes := flag.String("prefix", "uploads/,storage/", "comma-separated key prefixes to copy")
+	overwrite := flag.Bool("overwrite", false, "copy files that already exist at the destination")
+	dryRun := flag.Bool("dry-run", false, "list what would be copied without copying")
+	flag.Parse()
+
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using system environment variables")
+	}
+
+	if *from == *to {
+		log.Fatal("Source and destination backends must differ")
+	}
+
+	src, err := services.NewBlobStore(*from)
+	if err != nil {
+		log.Fatal("Failed to configure source:", err)
+	}
+	dst, err := services.NewBlobStore(*to)
+	if err != nil {
+		log.Fatal("Failed to configure destination:", err)
+	}
+
+	ctx := context.Background()
+	copied, skipped, failed := 0, 0, 0
+
+	for _, prefix := range strings.Split(*prefixes, ",") {
+		err := src.List(ctx, strings.TrimSpace(prefix), func(info services.BlobInfo) error {
+			if !*overwrite {
+				existing, err := dst.Stat(ctx, info.Key)
+				if err == nil && existing.Size == info.Size {
+					skipped++
+					return nil
+				}
+				if err != nil && !errors.Is(err, services.ErrBlobNotFound) {
+					return err
+				}
+			}
+
+			if *dryRun {
+				fmt.Printf("would copy %s (%d bytes)\n", info.Key, info.Size)
+				copied++
+				return nil
+			}
+
+			if err := copyBlob(ctx, src, dst, info); err != nil {
+				log.Printf("Failed to copy %s: %v", info.Key, err)
+				failed++
+				return nil
+			}
+			fmt.Printf("copied %s\n", info.Key)
+			copied++
+			return nil
+		})
+		if err != nil {
+			log.Fatalf("Failed to list %s: %v", prefix, err)
+		}
+	}
+
+	fmt.Printf("Blob migration completed: %d copied, %d skipped, %d failed\n", copied, skipped, failed)
+	if failed > 0 {
+		log.Fatal("Some files could not be copied")
+	}
+}
+
+func copyBlob(ctx context.Context, src, dst services.BlobStore, info services.BlobInfo) error {
+	r, meta, err := src.Get(ctx, info.Key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return dst.Put(ctx, info.Key, r, meta.Size, meta.ContentType)
+}
@@ -3,6 +3,9 @@ package main
 import (
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -22,6 +25,21 @@ func main() {
 		log.Println("No .env file found, using system environment variables")
 	}
 
+	// Write logs to a rotated file instead of the terminal when configured
+	logFile, err := services.OpenLogFile()
+	if err != nil {
+		log.Fatal("Failed to open log file:", err)
+	}
+	if logFile != nil {
+		defer logFile.Close()
+		log.SetOutput(logFile)
+	}
+
+	// Configure file storage (local disk or S3-compatible bucket)
+	if err := services.InitBlobStore(); err != nil {
+		log.Fatal("Failed to configure blob store:", err)
+	}
+
 	// Initialize database
 	if err := database.Connect(); err != nil {
 		log.Fatal("Failed to connect to database:", err)
@@ -40,6 +58,43 @@ func main() {
 	// Scan storage for new images
 	services.ScanStorage()
 
+	// Render missing or outdated watermarked variants
+	go func() {
+		if _, _, err := services.RegenerateGalleryVariants(false); err != nil {
+			log.Printf("Variant generation failed: %v", err)
+		}
+	}()
+
+	// Background jobs; schedules are cron specs or intervals (see
+	// services.ScheduleEnv), and "off" leaves a job to manual runs
+	maildirSpec := ""
+	if os.Getenv("INBOUND_MAILDIR") != "" {
+		maildirSpec = services.ScheduleEnv("INBOUND_MAILDIR_INTERVAL", "@every 1m")
+	}
+	orphanGrace := services.ParseDurationEnv("ORPHAN_GC_GRACE", services.DefaultOrphanGracePeriod)
+	jobs := []services.Job{
+		// Quarantine unreferenced upload files
+		{Name: "orphan_gc", Spec: services.ScheduleEnv("ORPHAN_GC_INTERVAL", "0 4 * * *"), Run: services.OrphanGCJob(orphanGrace)},
+		// Pick up photos added to the storage folders since boot
+		{Name: "storage_scan", Spec: services.ScheduleEnv("STORAGE_SCAN_INTERVAL", "@every 6h"), Run: services.StorageScanJob},
+		// Block dates from the owner's external calendars
+		{Name: "calendar_sync", Spec: services.ScheduleEnv("CALENDAR_IMPORT_INTERVAL", "@every 1h"), RunAtStart: true, Run: services.CalendarImportJob},
+		// Expire lapsed date holds and offer freed slots to the waitlist
+		{Name: "date_holds", Spec: services.ScheduleEnv("DATE_HOLD_SWEEP_INTERVAL", "@every 1m"), Run: services.DateHoldJob},
+		// Ingest client replies delivered to the local maildir
+		{Name: "maildir", Spec: maildirSpec, RunAtStart: true, Run: services.MaildirJob},
+		// Purge and archive per the retention policies
+		{Name: "retention", Spec: services.ScheduleEnv("RETENTION_INTERVAL", "30 3 * * *"), Run: services.RetentionJob},
+		// Email event reminders, balance reminders and thank-yous
+		{Name: "automations", Spec: services.ScheduleEnv("AUTOMATIONS_INTERVAL", "0 9 * * *"), Run: services.AutomationJob},
+	}
+	for _, job := range jobs {
+		if err := services.Jobs().Register(job); err != nil {
+			log.Fatal("Failed to register job:", err)
+		}
+	}
+	services.Jobs().Start()
+
 	// Hash default admin password if needed
 	// detailed synchronization of admin password
 	var user models.User
@@ -60,11 +115,15 @@ func main() {
 	app := fiber.New(fiber.Config{
 		AppName:      "Angel Event API",
 		ServerHeader: "Angel Event",
+		BodyLimit:    services.MaxUploadBodySize,
+		// Behind a reverse proxy, client IPs for rate limits come from this
+		// header (for example X-Forwarded-For)
+		ProxyHeader: os.Getenv("PROXY_HEADER"),
 	})
 
 	// Middleware
 	app.Use(recover.New())
-	app.Use(logger.New())
+	app.Use(logger.New(logger.Config{Output: log.Writer()}))
 
 	// CORS configuration
 	allowOrigins := os.Getenv("FRONTEND_URL")
@@ -76,7 +135,7 @@ func main() {
 
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     allowOrigins,
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization",
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-Album-Password",
 		AllowMethods:     "GET, POST, PUT, DELETE, OPTIONS",
 		AllowCredentials: true,
 	}))
@@ -89,27 +148,62 @@ func main() {
 		})
 	})
 
-	// Public Uploads and Storage
-	app.Static("/uploads", "./uploads")
-	app.Static("/storage", "../storage")
+	// Public Uploads and Storage. Gallery originals (/uploads/gallery and the
+	// /storage event folders) are private: the public gets watermarked
+	// variants, originals go through admin or album-token routes.
+	for _, prefix := range services.PublicBlobPrefixes {
+		if local, ok := services.Blobs().(*services.LocalBlobStore); ok {
+			dir, err := local.Path(prefix)
+			if err != nil {
+				log.Fatal("Invalid public media prefix:", err)
+			}
+			app.Static("/"+prefix, dir)
+		} else {
+			app.Get("/"+prefix+"/*", handlers.RedirectToBlob)
+		}
+	}
 
 	// API routes
 	api := app.Group("/api")
 
+	// Signed links to private files of the local store
+	api.Get("/blobs/*", handlers.ServeSignedBlob)
+
+	// Raw emails forwarded by the mail provider (shared secret)
+	api.Post("/inbound/email", handlers.ReceiveInboundEmail)
+
 	// Public routes
 	public := api.Group("/public")
+	public.Get("/form-token", handlers.GetFormToken)
 	public.Post("/contact", handlers.SubmitContactForm)
 	public.Post("/bookings", handlers.CreateBooking)
 	public.Post("/bookings", handlers.CreateBooking)
 	public.Get("/bookings/availability", handlers.CheckAvailability)
 	public.Get("/availabilities", handlers.GetPublicAvailabilities)
+	public.Post("/holds", handlers.CreateDateHold)
+	public.Get("/holds/:token", handlers.GetDateHold)
+	public.Delete("/holds/:token", handlers.ReleaseDateHold)
+	public.Post("/waitlist", handlers.JoinWaitlist)
+	public.Delete("/waitlist/:token", handlers.LeaveWaitlist)
 	public.Get("/testimonials", handlers.GetTestimonials)
 	public.Post("/testimonials", handlers.CreateTestimonial)
+	public.Get("/testimonials/ratings", handlers.GetTestimonialRatings)
+	public.Get("/reviews/:token", handlers.GetReviewInvitation)
+	public.Post("/reviews/:token", handlers.SubmitReview)
 	public.Post("/newsletter/subscribe", handlers.SubscribeNewsletter)
 	public.Get("/gallery", handlers.GetGalleryImages)
 	public.Get("/gallery/random", handlers.GetRandomGalleryImages)
 	public.Get("/rentals", handlers.GetRentalItems)
 	public.Get("/categories", handlers.GetCategories)
+	public.Get("/albums/:token", handlers.GetSharedAlbum)
+	public.Get("/albums/:token/download", handlers.DownloadSharedAlbum)
+	// POST lets a browser form send the password of a protected album
+	public.Post("/albums/:token/download", handlers.DownloadSharedAlbum)
+	public.Get("/albums/:token/images/:imageId/original", handlers.GetSharedAlbumOriginal)
+	public.Get("/calendar/:token.ics", handlers.GetCalendarFeedICS)
+	public.Get("/albums/:token/proofing", handlers.GetAlbumProofing)
+	public.Put("/albums/:token/images/:imageId/proofing", handlers.UpdateProofingItem)
+	public.Post("/albums/:token/selection", handlers.SubmitProofingSelection)
 
 	// Auth routes
 	auth := api.Group("/auth")
@@ -127,15 +221,65 @@ func main() {
 	admin.Get("/bookings", handlers.GetBookings)
 	admin.Get("/bookings/:id", handlers.GetBooking)
 	admin.Put("/bookings/:id/status", handlers.UpdateBookingStatus)
+	admin.Get("/bookings/:id/payments", handlers.GetBookingPayments)
+	admin.Post("/bookings/:id/payments", handlers.CreateBookingPayment)
+	admin.Get("/bookings/:id/review-link", handlers.GetBookingReviewLink)
+	admin.Delete("/bookings/:id/payments/:paymentId", handlers.DeleteBookingPayment)
 	admin.Get("/availabilities", handlers.GetAvailabilities)
 	admin.Post("/availabilities", handlers.UpdateAvailability)
+	admin.Get("/availability/resolve", handlers.ResolveAvailability)
+	admin.Get("/holds", handlers.GetDateHolds)
+	admin.Get("/waitlist", handlers.GetWaitlist)
+	admin.Get("/waitlist/demand", handlers.GetWaitlistDemand)
+	admin.Delete("/waitlist/:id", handlers.DeleteWaitlistEntry)
+	admin.Get("/availability-rules", handlers.GetAvailabilityRules)
+	admin.Post("/availability-rules", handlers.CreateAvailabilityRule)
+	admin.Put("/availability-rules/:id", handlers.UpdateAvailabilityRule)
+	admin.Delete("/availability-rules/:id", handlers.DeleteAvailabilityRule)
 
 	// Clients
 	admin.Get("/clients", handlers.GetClients)
+	admin.Get("/clients/duplicates", handlers.GetDuplicateClients)
 	admin.Get("/clients/:id", handlers.GetClient)
 	admin.Put("/clients/:id", handlers.UpdateClient)
 	admin.Delete("/clients/:id", handlers.DeleteClient)
 	admin.Post("/clients/:id/email", handlers.SendClientEmail)
+	admin.Get("/clients/:id/timeline", handlers.GetClientTimeline)
+	admin.Post("/clients/:id/notes", handlers.CreateClientNote)
+	admin.Put("/clients/:id/notes/:noteId", handlers.UpdateClientNote)
+	admin.Delete("/clients/:id/notes/:noteId", handlers.DeleteClientNote)
+	admin.Put("/clients/:id/tags", handlers.SetClientTags)
+	admin.Post("/clients/:id/contacts", handlers.CreateClientContact)
+	admin.Put("/clients/:id/contacts/:contactId", handlers.UpdateClientContact)
+	admin.Delete("/clients/:id/contacts/:contactId", handlers.DeleteClientContact)
+	admin.Get("/clients/:id/duplicates", handlers.GetClientDuplicates)
+	admin.Post("/clients/:id/merge", handlers.MergeClient)
+	admin.Get("/clients/:id/export", handlers.ExportClientData)
+	admin.Post("/clients/:id/erase", handlers.EraseClientData)
+	admin.Get("/privacy/actions", handlers.GetPrivacyActions)
+	admin.Get("/tags", handlers.GetTags)
+	admin.Put("/tags/:id", handlers.UpdateTag)
+	admin.Delete("/tags/:id", handlers.DeleteTag)
+
+	// Contact inquiries
+	admin.Get("/inquiries", handlers.GetInquiries)
+	admin.Get("/inquiries/:id", handlers.GetInquiry)
+	admin.Put("/inquiries/:id/status", handlers.UpdateInquiryStatus)
+	admin.Post("/inquiries/:id/reply", handlers.ReplyToInquiry)
+	admin.Post("/inquiries/:id/convert", handlers.ConvertInquiry)
+	admin.Delete("/inquiries/:id", handlers.DeleteInquiry)
+
+	// Emails received from clients
+	admin.Get("/inbound-emails", handlers.GetInboundEmails)
+	admin.Get("/inbound-emails/:id", handlers.GetInboundEmail)
+	admin.Put("/inbound-emails/:id/assign", handlers.AssignInboundEmail)
+	admin.Get("/inbound-emails/:id/attachments/:attachmentId", handlers.GetInboundAttachment)
+	admin.Delete("/inbound-emails/:id", handlers.DeleteInboundEmail)
+
+	// Suspected spam held back from public forms
+	admin.Get("/quarantine", handlers.GetQuarantinedSubmissions)
+	admin.Post("/quarantine/:id/release", handlers.ReleaseQuarantinedSubmission)
+	admin.Delete("/quarantine/:id", handlers.DiscardQuarantinedSubmission)
 
 	// Testimonials
 	admin.Get("/testimonials", handlers.GetTestimonials)
@@ -149,11 +293,53 @@ func main() {
 	admin.Post("/newsletter/send", handlers.SendNewsletter)
 
 	// Gallery
+	admin.Get("/gallery", handlers.GetAdminGalleryImages)
 	admin.Post("/gallery", handlers.CreateGalleryImage)
 	admin.Put("/gallery/:id", handlers.UpdateGalleryImage)
 	admin.Delete("/gallery/:id", handlers.DeleteGalleryImage)
 	admin.Post("/gallery/scan", handlers.ScanStorageFolder)
 	admin.Get("/gallery/categories", handlers.GetGalleryCategories)
+	admin.Get("/gallery/:id/original", handlers.GetGalleryImageOriginal)
+	admin.Post("/gallery/variants/regenerate", handlers.RegenerateGalleryVariants)
+	admin.Get("/calendar-feeds", handlers.GetCalendarFeeds)
+	admin.Post("/calendar-feeds", handlers.CreateCalendarFeed)
+	admin.Post("/calendar-feeds/:id/regenerate-token", handlers.RegenerateCalendarFeedToken)
+	admin.Delete("/calendar-feeds/:id", handlers.DeleteCalendarFeed)
+	admin.Get("/calendar-imports", handlers.GetCalendarImports)
+	admin.Post("/calendar-imports", handlers.CreateCalendarImport)
+	admin.Put("/calendar-imports/:id", handlers.UpdateCalendarImport)
+	admin.Post("/calendar-imports/:id/sync", handlers.SyncCalendarImport)
+	admin.Delete("/calendar-imports/:id", handlers.DeleteCalendarImport)
+	admin.Post("/maintenance/orphans", handlers.CollectOrphanFiles)
+	admin.Get("/retention/policies", handlers.GetRetentionPolicies)
+	admin.Put("/retention/policies/:entity", handlers.UpdateRetentionPolicy)
+	admin.Get("/retention/runs", handlers.GetRetentionRuns)
+	admin.Post("/retention/run", handlers.RunRetention)
+	admin.Get("/automations", handlers.GetAutomations)
+	admin.Post("/automations", handlers.CreateAutomation)
+	admin.Get("/automations/sends", handlers.GetAutomationSends)
+	admin.Put("/automations/:id", handlers.UpdateAutomation)
+	admin.Delete("/automations/:id", handlers.DeleteAutomation)
+	admin.Get("/jobs", handlers.GetJobs)
+	admin.Get("/jobs/runs", handlers.GetJobRuns)
+	admin.Post("/jobs/:name/run", handlers.TriggerJob)
+	admin.Get("/watermark", handlers.GetWatermarkSetting)
+	admin.Put("/watermark", handlers.UpdateWatermarkSetting)
+	admin.Post("/watermark/logo", handlers.UploadWatermarkLogo)
+	admin.Get("/gallery/directories", handlers.GetCategoryDirectories)
+	admin.Post("/gallery/directories", handlers.SaveCategoryDirectory)
+	admin.Delete("/gallery/directories/:id", handlers.DeleteCategoryDirectory)
+
+	// Albums
+	admin.Get("/albums", handlers.GetAlbums)
+	admin.Get("/albums/:id", handlers.GetAlbum)
+	admin.Post("/albums", handlers.CreateAlbum)
+	admin.Put("/albums/:id", handlers.UpdateAlbum)
+	admin.Delete("/albums/:id", handlers.DeleteAlbum)
+	admin.Put("/albums/:id/images", handlers.SetAlbumImages)
+	admin.Post("/albums/:id/token", handlers.RegenerateAlbumToken)
+	admin.Get("/proofing/selections", handlers.GetProofingSelections)
+	admin.Get("/proofing/selections/:id", handlers.GetProofingSelection)
 
 	// Site Content
 	admin.Get("/content", handlers.GetSiteContent)
@@ -175,6 +361,23 @@ func main() {
 		port = "8081"
 	}
 
+	// Stop taking requests on SIGINT or SIGTERM, then let running jobs
+	// finish
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+		<-quit
+		log.Println("Shutting down...")
+		if err := app.ShutdownWithTimeout(10 * time.Second); err != nil {
+			log.Printf("Server shutdown failed: %v", err)
+		}
+	}()
+
 	log.Printf("🚀 Server starting on port %s", port)
-	log.Fatal(app.Listen(":" + port))
+	if err := app.Listen(":" + port); err != nil {
+		log.Fatal(err)
+	}
+
+	services.Jobs().Stop(30 * time.Second)
+	log.Println("Server stopped")
 }
@@ -0,0 +1,70 @@
+// Command sync_calendars syncs imported calendars into availability once,
+// the same way the server does periodically:
+//
+//	go run ./cmd/sync_calendars
+//	go run ./cmd/sync_calendars -id 3
+//
+// The sync itself is tested against the fixtures under testdata/calendars
+// in internal/services/calendar_import_test.go.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/joho/godotenv"
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"github.com/mazong/angel_event/internal/services"
+)
+
+func main() {
+	id := flag.Uint("id", 0, "sync only this calendar import")
+	flag.Parse()
+
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using system environment variables")
+	}
+
+	if err := services.InitBlobStore(); err != nil {
+		log.Fatal("Failed to configure blob store:", err)
+	}
+
+	// Initialize database
+	if err := database.Connect(); err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+
+	var imports []models.CalendarImport
+	query := database.DB.Order("id ASC")
+	if *id != 0 {
+		query = query.Where("id = ?", *id)
+	} else {
+		query = query.Where("enabled = ?", true)
+	}
+	if err := query.Find(&imports).Error; err != nil {
+		log.Fatal("Failed to load calendar imports:", err)
+	}
+
+	failed := 0
+	for i := range imports {
+		imp := &imports[i]
+		result, err := services.SyncCalendarImport(context.Background(), imp)
+		if err != nil {
+			fmt.Printf("%d\t%s\terror: %v\n", imp.ID, imp.Name, err)
+			failed++
+			continue
+		}
+		if result.NotModified {
+			fmt.Printf("%d\t%s\tnot modified\n", imp.ID, imp.Name)
+			continue
+		}
+		fmt.Printf("%d\t%s\t%d busy dates: %d added, %d updated, %d removed, %d kept manual, %d blocked\n",
+			imp.ID, imp.Name, result.Busy, result.Added, result.Updated, result.Removed, result.Skipped, result.Blocked)
+	}
+
+	fmt.Printf("Synced %d calendars, %d failed\n", len(imports)-failed, failed)
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/mazong/angel_event/internal/database"
 	"github.com/mazong/angel_event/internal/models"
+	"github.com/mazong/angel_event/internal/services"
 )
 
 func main() {
@@ -26,24 +27,22 @@ func main() {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
+	if err := database.Migrate(); err != nil {
+		log.Fatal("Failed to migrate database:", err)
+	}
+
 	storagePath := "../../../storage"
 
-	// Map folder names to GalleryCategory
-	categoryMap := map[string]models.GalleryCategory{
-		"marryme":     models.CategoryMarryMe,
-		"weeding":     models.CategoryWedding,
-		"wedding":     models.CategoryWedding,
-		"birthday":    models.CategoryBirthday,
-		"baby shower": models.CategoryBabyShower,
-		"bapteme":     models.CategoryBapteme,
-		"congrats":    models.CategoryCongrats,
-		"loveroom":    models.CategoryLoveroom,
+	// Folder names are mapped to gallery categories in the database
+	resolver, err := services.NewGalleryCategoryResolver()
+	if err != nil {
+		log.Fatal("Failed to load gallery categories:", err)
 	}
 
 	importedCount := 0
 	skippedCount := 0
 
-	err := filepath.Walk(storagePath, func(path string, info os.FileInfo, err error) error {
+	err = filepath.Walk(storagePath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -62,9 +61,9 @@ func main() {
 
 			// Determine category from parent folder
 			dir := filepath.Base(filepath.Dir(path))
-			category, exists := categoryMap[dir]
-			if !exists {
-				category = models.CategoryBirthday // Default fallback
+			categoryID, err := resolver.Resolve(dir)
+			if err != nil {
+				return err
 			}
 
 			// Construct public URL - storage folder is served at /storage
@@ -79,7 +78,7 @@ func main() {
 					Title:         info.Name(),
 					Description:   fmt.Sprintf("Image de %s", dir),
 					ImageURL:      publicURL,
-					Category:      category,
+					CategoryID:    categoryID,
 					FileName:      info.Name(),
 					IsFromStorage: true,
 				}
@@ -87,7 +86,7 @@ func main() {
 					return err
 				}
 				importedCount++
-				fmt.Printf("Imported: %s (category: %s)\n", info.Name(), category)
+				fmt.Printf("Imported: %s (category #%d)\n", info.Name(), categoryID)
 			} else {
 				skippedCount++
 			}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/mazong/angel_event/internal/models"
 	"gorm.io/driver/sqlite"
@@ -21,8 +22,13 @@ func Connect() error {
 	}
 
 	var err error
+	// SQL statements go to the standard logger, so they follow LOG_FILE
 	DB, err = gorm.Open(sqlite.Open(dbPath), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+		Logger: logger.New(log.New(log.Writer(), "\r\n", log.LstdFlags), logger.Config{
+			SlowThreshold: 200 * time.Millisecond,
+			LogLevel:      dbLogLevel(),
+			Colorful:      os.Getenv("LOG_FILE") == "",
+		}),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to connect to database: %w", err)
@@ -32,6 +38,21 @@ func Connect() error {
 	return nil
 }
 
+// dbLogLevel reads DB_LOG_LEVEL: silent, error, warn or info (the default,
+// which logs every statement)
+func dbLogLevel() logger.LogLevel {
+	switch os.Getenv("DB_LOG_LEVEL") {
+	case "silent":
+		return logger.Silent
+	case "error":
+		return logger.Error
+	case "warn":
+		return logger.Warn
+	default:
+		return logger.Info
+	}
+}
+
 // Migrate runs database migrations
 func Migrate() error {
 	err := DB.AutoMigrate(
@@ -39,22 +60,222 @@ func Migrate() error {
 		&models.Client{},
 		&models.Booking{},
 		&models.Availability{},
+		&models.AvailabilityRule{},
+		&models.DateHold{},
+		&models.WaitlistEntry{},
+		&models.QuarantinedSubmission{},
+		&models.Inquiry{},
+		&models.InquiryMessage{},
+		&models.InboundEmail{},
+		&models.InboundAttachment{},
+		&models.BookingStatusChange{},
+		&models.Payment{},
+		&models.ClientNote{},
+		&models.Tag{},
+		&models.ClientContact{},
+		&models.PrivacyAction{},
+		&models.RetentionPolicy{},
+		&models.RetentionRun{},
+		&models.JobRun{},
+		&models.JobLease{},
+		&models.Automation{},
+		&models.AutomationSend{},
 		&models.Testimonial{},
+		&models.ReviewInvitation{},
 		&models.Newsletter{},
 		&models.GalleryImage{},
 		&models.SiteContent{},
 		&models.EmailLog{},
 		&models.Category{},
 		&models.RentalItem{},
+		&models.CategoryDirectory{},
+		&models.Album{},
+		&models.AlbumImage{},
+		&models.ProofingItem{},
+		&models.ProofingSelection{},
+		&models.ProofingSelectionImage{},
+		&models.WatermarkSetting{},
+		&models.CalendarFeed{},
+		&models.CalendarImport{},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to migrate database: %w", err)
 	}
 
+	if err := migrateGalleryCategories(); err != nil {
+		return fmt.Errorf("failed to migrate gallery categories: %w", err)
+	}
+
+	if err := migrateDateColumns(); err != nil {
+		return fmt.Errorf("failed to migrate date columns: %w", err)
+	}
+
 	log.Println("Database migrated successfully")
 	return nil
 }
 
+// seedGalleryCategories creates the default gallery categories and their
+// storage directory mappings if none exist yet
+func seedGalleryCategories() error {
+	var galleryCatCount int64
+	DB.Model(&models.Category{}).Where("type = ?", "gallery").Count(&galleryCatCount)
+	if galleryCatCount == 0 {
+		categories := []models.Category{
+			{Name: "Mariage", Slug: "wedding", Type: "gallery"},
+			{Name: "Demande en Mariage", Slug: "marryme", Type: "gallery"},
+			{Name: "Anniversaire", Slug: "birthday", Type: "gallery"},
+			{Name: "Baby Shower", Slug: "baby_shower", Type: "gallery"},
+			{Name: "Baptême", Slug: "bapteme", Type: "gallery"},
+			{Name: "Love Room", Slug: "loveroom", Type: "gallery"},
+			{Name: "Félicitations", Slug: "congrats", Type: "gallery"},
+		}
+		if err := DB.Create(&categories).Error; err != nil {
+			return fmt.Errorf("failed to seed gallery categories: %w", err)
+		}
+		log.Println("Default gallery categories seeded")
+	}
+
+	// Seed default storage directory mappings
+	var dirCount int64
+	DB.Model(&models.CategoryDirectory{}).Count(&dirCount)
+	if dirCount == 0 {
+		var cats []models.Category
+		DB.Where("type = ?", "gallery").Find(&cats)
+		catMap := make(map[string]uint)
+		for _, c := range cats {
+			catMap[c.Slug] = c.ID
+		}
+
+		defaultDirs := map[string]string{
+			"weeding":     "wedding",
+			"wedding":     "wedding",
+			"marryme":     "marryme",
+			"birthday":    "birthday",
+			"baby shower": "baby_shower",
+			"baby_shower": "baby_shower",
+			"bapteme":     "bapteme",
+			"loveroom":    "loveroom",
+			"congrats":    "congrats",
+		}
+
+		var dirs []models.CategoryDirectory
+		for dir, slug := range defaultDirs {
+			if id, ok := catMap[slug]; ok {
+				dirs = append(dirs, models.CategoryDirectory{Directory: dir, CategoryID: id})
+			}
+		}
+		if len(dirs) > 0 {
+			if err := DB.Create(&dirs).Error; err != nil {
+				return fmt.Errorf("failed to seed category directories: %w", err)
+			}
+			log.Println("Default category directories seeded")
+		}
+	}
+
+	return nil
+}
+
+// dateColumns hold models.Date values, stored as "YYYY-MM-DD"
+var dateColumns = map[string][]string{
+	"bookings":           {"event_date"},
+	"availabilities":     {"date"},
+	"availability_rules": {"start_date", "end_date"},
+}
+
+// migrateDateColumns rewrites dates stored as timestamps by earlier versions
+// ("2026-12-24 00:00:00+00:00") to plain dates, keeping their calendar day
+func migrateDateColumns() error {
+	for table, columns := range dateColumns {
+		for _, column := range columns {
+			result := DB.Exec(fmt.Sprintf(
+				"UPDATE %s SET %s = substr(%s, 1, 10) WHERE length(%s) > 10",
+				table, column, column, column))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				log.Printf("Converted %d %s.%s values to dates", result.RowsAffected, table, column)
+			}
+		}
+	}
+	return nil
+}
+
+// migrateGalleryCategories links gallery images still using the legacy
+// string category to Category rows, creating missing gallery categories.
+func migrateGalleryCategories() error {
+	if err := seedGalleryCategories(); err != nil {
+		return err
+	}
+
+	var slugs []string
+	if err := DB.Model(&models.GalleryImage{}).
+		Where("(category_id IS NULL OR category_id = 0) AND category IS NOT NULL AND category != ''").
+		Distinct().
+		Pluck("category", &slugs).Error; err != nil {
+		return err
+	}
+
+	for _, slug := range slugs {
+		category, err := GalleryCategoryForSlug(slug, slug)
+		if err != nil {
+			return err
+		}
+
+		if err := DB.Model(&models.GalleryImage{}).
+			Where("(category_id IS NULL OR category_id = 0) AND category = ?", slug).
+			Update("category_id", category.ID).Error; err != nil {
+			return err
+		}
+		log.Printf("Gallery images in %q linked to category #%d", slug, category.ID)
+	}
+
+	return nil
+}
+
+// GalleryCategoryForSlug returns the gallery category of a slug, creating
+// it with name if needed. Slugs are unique across category types and
+// deleted rows, so a rental or deleted category holding the slug gets the
+// gallery one a "-gallery" suffix instead of being linked to gallery images.
+func GalleryCategoryForSlug(slug, name string) (models.Category, error) {
+	var category models.Category
+	for _, candidate := range []string{slug, slug + "-gallery"} {
+		var existing []models.Category
+		if err := DB.Unscoped().Where("slug = ?", candidate).Limit(1).Find(&existing).Error; err != nil {
+			return category, err
+		}
+		if len(existing) == 0 {
+			category = models.Category{Name: name, Slug: candidate, Type: "gallery"}
+			return category, DB.Create(&category).Error
+		}
+		if existing[0].Type == "gallery" && !existing[0].DeletedAt.Valid {
+			return existing[0], nil
+		}
+	}
+	return category, fmt.Errorf("no gallery category available for slug %q", slug)
+}
+
+// defaultRetentionPolicies keep deleted clients 30 days, other deleted
+// rows 90 days, email logs 2 years, rotated server logs 30 days and job
+// history 14 days, and archive completed bookings a year after the event
+var defaultRetentionPolicies = []models.RetentionPolicy{
+	{Entity: models.RetentionDeletedClients, Days: 30, Enabled: true},
+	{Entity: models.RetentionDeletedRecords, Days: 90, Enabled: true},
+	{Entity: models.RetentionEmailLogs, Days: 730, Enabled: true},
+	{Entity: models.RetentionCompletedBookings, Days: 365, Enabled: true},
+	{Entity: models.RetentionServerLogs, Days: 30, Enabled: true},
+	{Entity: models.RetentionJobRuns, Days: 14, Enabled: true},
+}
+
+// defaultAutomations remind clients of their event a week before and of
+// the balance due ten days before, and thank them with a review request two
+// days after their booking is completed
+var defaultAutomations = []models.Automation{
+	{Name: "Event reminder", Template: models.TemplateEventReminder, Trigger: models.TriggerBeforeEvent, Days: 7, Statuses: "confirmed,paid", Enabled: true},
+	{Name: "Balance due", Template: models.TemplateBalanceDue, Trigger: models.TriggerBeforeEvent, Days: 10, Statuses: "confirmed,paid", Enabled: true},
+	{Name: "Thank you", Template: models.TemplateThankYou, Trigger: models.TriggerAfterStatus, Days: 2, Statuses: "completed", Enabled: true},
+}
+
 // SeedDefaultData creates initial data if needed
 func SeedDefaultData() error {
 	// Check if admin user exists
@@ -88,9 +309,9 @@ func SeedDefaultData() error {
 		log.Printf("Default admin user created: %s", adminEmail)
 	}
 
-	// Seed default categories
+	// Seed default rental categories
 	var catCount int64
-	DB.Model(&models.Category{}).Count(&catCount)
+	DB.Model(&models.Category{}).Where("type = ?", "rental").Count(&catCount)
 	if catCount == 0 {
 		categories := []models.Category{
 			{Name: "Centre de table", Slug: "centerpiece", Type: "rental"},
@@ -105,6 +326,40 @@ func SeedDefaultData() error {
 		log.Println("Default categories seeded")
 	}
 
+	// Seed default watermark settings
+	var watermarkCount int64
+	DB.Model(&models.WatermarkSetting{}).Count(&watermarkCount)
+	if watermarkCount == 0 {
+		setting := models.WatermarkSetting{
+			Enabled:  true,
+			Text:     "Angel Event",
+			Position: models.WatermarkBottomRight,
+			Opacity:  0.5,
+			Scale:    0.2,
+			Version:  1,
+		}
+		if err := DB.Create(&setting).Error; err != nil {
+			return fmt.Errorf("failed to seed watermark settings: %w", err)
+		}
+		log.Println("Default watermark settings seeded")
+	}
+
+	// Seed default retention policies, adding those of new entities
+	for _, policy := range defaultRetentionPolicies {
+		if err := DB.Where("entity = ?", policy.Entity).FirstOrCreate(&policy).Error; err != nil {
+			return fmt.Errorf("failed to seed retention policies: %w", err)
+		}
+	}
+
+	// Seed default automations on first run only, so deleted ones stay gone
+	var automationCount int64
+	DB.Model(&models.Automation{}).Count(&automationCount)
+	if automationCount == 0 {
+		if err := DB.Create(&defaultAutomations).Error; err != nil {
+			return fmt.Errorf("failed to seed automations: %w", err)
+		}
+	}
+
 	// Seed default site content
 	var contentCount int64
 	DB.Model(&models.SiteContent{}).Count(&contentCount)
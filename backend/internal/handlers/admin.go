@@ -3,9 +3,10 @@ package handlers
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"log"
+	"path"
 	"strconv"
 	"strings"
 	"time"
@@ -13,26 +14,81 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/mazong/angel_event/internal/database"
 	"github.com/mazong/angel_event/internal/models"
+	"github.com/mazong/angel_event/internal/services"
+	"gorm.io/gorm"
 )
 
-// GetClients returns all clients
+// clientSortFields lists the sortable client fields
+var clientSortFields = SortFields{
+	"created_at": "created_at",
+	"name":       "name",
+	"email":      "email",
+}
+
+// GetClients returns a page of clients with their booking counts and tags,
+// filtered by ?search=, ?source= and ?tag=
 func GetClients(c *fiber.Ctx) error {
 	var clients []models.Client
 
-	query := database.DB.Preload("Bookings")
+	query := database.DB.Model(&models.Client{})
 
 	// Search by name or email
 	if search := c.Query("search"); search != "" {
 		query = query.Where("name LIKE ? OR email LIKE ?", "%"+search+"%", "%"+search+"%")
 	}
+	if source := c.Query("source"); source != "" {
+		query = query.Where("source = ?", source)
+	}
+	if tag := c.Query("tag"); tag != "" {
+		query = query.Where("id IN (?)", database.DB.Table("client_tags").
+			Select("client_tags.client_id").
+			Joins("JOIN tags ON tags.id = client_tags.tag_id").
+			Where("tags.name = ?", strings.ToLower(tag)))
+	}
+	query = query.Preload("Tags")
 
-	if err := query.Order("created_at DESC").Find(&clients).Error; err != nil {
+	req, err := parsePageRequest(c, "clients", clientSortFields, "-created_at")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	page, err := paginate(query, req, &clients)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch clients",
 		})
 	}
 
-	return c.JSON(clients)
+	// Count bookings for the page in one query instead of preloading them all
+	if len(clients) > 0 {
+		ids := make([]uint, len(clients))
+		for i, client := range clients {
+			ids[i] = client.ID
+		}
+
+		var counts []struct {
+			ClientID uint
+			Count    int64
+		}
+		database.DB.Model(&models.Booking{}).
+			Select("client_id, COUNT(*) AS count").
+			Where("client_id IN ?", ids).
+			Group("client_id").
+			Scan(&counts)
+
+		countMap := make(map[uint]int64)
+		for _, row := range counts {
+			countMap[row.ClientID] = row.Count
+		}
+		for i := range clients {
+			clients[i].BookingCount = countMap[clients[i].ID]
+		}
+		page.Data = clients
+	}
+
+	return c.JSON(page)
 }
 
 // GetClient returns a single client with bookings
@@ -45,7 +101,7 @@ func GetClient(c *fiber.Ctx) error {
 	}
 
 	var client models.Client
-	if err := database.DB.Preload("Bookings").First(&client, id).Error; err != nil {
+	if err := database.DB.Preload("Bookings").Preload("Tags").Preload("Contacts").First(&client, id).Error; err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "Client not found",
 		})
@@ -54,29 +110,39 @@ func GetClient(c *fiber.Ctx) error {
 	return c.JSON(client)
 }
 
+// ClientRequest holds the client fields an admin edits; tags, contacts,
+// sources and erasure have their own endpoints
+type ClientRequest struct {
+	Name  string `json:"name" validate:"required,max=100"`
+	Email string `json:"email" validate:"required,email,max=255"`
+	Phone string `json:"phone" validate:"phone"`
+	Notes string `json:"notes" validate:"max=5000"`
+}
+
 // UpdateClient updates client information
 func UpdateClient(c *fiber.Ctx) error {
-	id, err := strconv.Atoi(c.Params("id"))
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid client ID",
-		})
+	client, err := loadWritableClient(c)
+	if client == nil {
+		return err
 	}
 
-	var client models.Client
-	if err := database.DB.First(&client, id).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Client not found",
-		})
+	var req ClientRequest
+	if verr := bindRequest(c, &req); verr != nil {
+		return verr.Send(c)
 	}
 
-	if err := c.BodyParser(&client); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
+	if !strings.EqualFold(req.Email, client.Email) && emailTaken(req.Email, client.ID) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "This email belongs to another client; merge the clients instead",
 		})
 	}
 
-	if err := database.DB.Save(&client).Error; err != nil {
+	if err := database.DB.Model(client).Updates(map[string]interface{}{
+		"name":  req.Name,
+		"email": req.Email,
+		"phone": req.Phone,
+		"notes": req.Notes,
+	}).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to update client",
 		})
@@ -139,9 +205,15 @@ func SendClientEmail(c *fiber.Ctx) error {
 			"error": "Client not found",
 		})
 	}
+	if client.ErasedAt != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "This client's data was erased",
+		})
+	}
 
 	// Send email
-	if err := emailService.SendEmail(client.Email, req.Subject, req.Message); err != nil {
+	replyTo := services.ReplyAddress(services.ReplyClient, client.ID)
+	if err := emailService.SendEmailReplyTo(client.Email, req.Subject, req.Message, replyTo); err != nil {
 		// Log failed email
 		database.DB.Create(&models.EmailLog{
 			To:       client.Email,
@@ -171,41 +243,60 @@ func SendClientEmail(c *fiber.Ctx) error {
 	})
 }
 
-// GetTestimonials returns testimonials
+// testimonialSortFields lists the sortable testimonial fields
+var testimonialSortFields = SortFields{
+	"created_at": "created_at",
+	"rating":     "rating",
+}
+
+// GetTestimonials returns a page of testimonials, filtered by ?verified=
+// and ?event_type=
 func GetTestimonials(c *fiber.Ctx) error {
 	var testimonials []models.Testimonial
 
-	query := database.DB.Preload("Client")
+	query := database.DB.Model(&models.Testimonial{})
 
-	// Public endpoint only shows approved testimonials
+	// Public endpoint only shows approved testimonials, without the client
 	if c.Locals("user_id") == nil {
 		query = query.Where("approved = ?", true)
+	} else {
+		query = query.Preload("Client")
 	}
 
-	if err := query.Order("created_at DESC").Find(&testimonials).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to fetch testimonials",
-		})
+	if c.Query("verified") != "" {
+		query = query.Where("verified = ?", c.QueryBool("verified"))
+	}
+	if eventType := c.Query("event_type"); eventType != "" {
+		query = query.Where("event_type = ?", eventType)
 	}
 
-	return c.JSON(testimonials)
+	return respondPage(c, query, "testimonials", testimonialSortFields, "-created_at", &testimonials, "Failed to fetch testimonials")
 }
 
-// CreateTestimonial creates a new testimonial
+// CreateTestimonialRequest is a testimonial submitted by the public
+type CreateTestimonialRequest struct {
+	Name      string `json:"name" validate:"required,max=100"`
+	Email     string `json:"email" validate:"email,max=255"` // optional, ties the testimonial to a known client
+	Content   string `json:"content" validate:"required,min=10,max=2000"`
+	Rating    int    `json:"rating" validate:"required,min=1,max=5"`
+	EventType string `json:"event_type" validate:"oneof=proposal wedding birthday baby_shower corporate other"`
+	Language  string `json:"language" validate:"oneof=fr en"`
+	SpamFields
+}
+
+// CreateTestimonial creates a new testimonial, pending approval (public)
 func CreateTestimonial(c *fiber.Ctx) error {
-	var testimonial models.Testimonial
-	if err := c.BodyParser(&testimonial); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+	var req CreateTestimonialRequest
+	if verr := bindRequest(c, &req); verr != nil {
+		return verr.Send(c)
 	}
 
-	// Public submissions need approval
-	if c.Locals("user_id") == nil {
-		testimonial.Approved = false
+	if done, err := screenSubmission(c, services.FormTestimonial, &req, req.Email, req.Name, req.Content); done {
+		return err
 	}
 
-	if err := database.DB.Create(&testimonial).Error; err != nil {
+	testimonial, err := createTestimonial(&req)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create testimonial",
 		})
@@ -214,6 +305,30 @@ func CreateTestimonial(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusCreated).JSON(testimonial)
 }
 
+// createTestimonial stores a submitted testimonial
+func createTestimonial(req *CreateTestimonialRequest) (*models.Testimonial, error) {
+	// Public submissions need approval
+	testimonial := models.Testimonial{
+		Name:      req.Name,
+		Content:   req.Content,
+		Rating:    req.Rating,
+		EventType: models.EventType(req.EventType),
+		Approved:  false,
+	}
+
+	// Never create clients from testimonials, only link existing ones
+	if req.Email != "" {
+		if client, err := services.FindClientByEmail(database.DB, req.Email); err == nil {
+			testimonial.ClientID = &client.ID
+		}
+	}
+
+	if err := database.DB.Create(&testimonial).Error; err != nil {
+		return nil, err
+	}
+	return &testimonial, nil
+}
+
 // UpdateTestimonial updates a testimonial
 func UpdateTestimonial(c *fiber.Ctx) error {
 	id, err := strconv.Atoi(c.Params("id"))
@@ -230,11 +345,17 @@ func UpdateTestimonial(c *fiber.Ctx) error {
 		})
 	}
 
+	// Verification comes from the review link only
+	verified, bookingID, clientID := testimonial.Verified, testimonial.BookingID, testimonial.ClientID
 	if err := c.BodyParser(&testimonial); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid request body",
 		})
 	}
+	testimonial.Verified, testimonial.BookingID = verified, bookingID
+	if verified {
+		testimonial.ClientID = clientID
+	}
 
 	if err := database.DB.Save(&testimonial).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -267,21 +388,38 @@ func DeleteTestimonial(c *fiber.Ctx) error {
 
 // Newsletter handlers
 
+// SubscribeNewsletterRequest is a newsletter signup
+type SubscribeNewsletterRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Name     string `json:"name" validate:"max=100"`
+	Language string `json:"language" validate:"oneof=fr en"`
+	SpamFields
+}
+
 // SubscribeNewsletter subscribes an email to newsletter
 func SubscribeNewsletter(c *fiber.Ctx) error {
-	type SubscribeRequest struct {
-		Email    string `json:"email"`
-		Name     string `json:"name"`
-		Language string `json:"language"`
+	var req SubscribeNewsletterRequest
+	if verr := bindRequest(c, &req); verr != nil {
+		return verr.Send(c)
 	}
 
-	var req SubscribeRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
+	if done, err := screenSubmission(c, services.FormNewsletter, &req, req.Email, req.Name); done {
+		return err
+	}
+
+	if err := subscribeNewsletter(&req); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to subscribe",
 		})
 	}
 
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Successfully subscribed to newsletter",
+	})
+}
+
+// subscribeNewsletter stores a subscriber with a fresh unsubscribe token
+func subscribeNewsletter(req *SubscribeNewsletterRequest) error {
 	// Generate unsubscribe token
 	token := make([]byte, 16)
 	rand.Read(token)
@@ -295,35 +433,28 @@ func SubscribeNewsletter(c *fiber.Ctx) error {
 		UnsubToken: unsubToken,
 	}
 
-	if err := database.DB.Create(&newsletter).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to subscribe",
-		})
-	}
+	return database.DB.Create(&newsletter).Error
+}
 
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"message": "Successfully subscribed to newsletter",
-	})
+// subscriberSortFields lists the sortable newsletter subscriber fields
+var subscriberSortFields = SortFields{
+	"created_at": "created_at",
+	"email":      "email",
+	"name":       "name",
 }
 
-// GetNewsletterSubscribers returns all subscribers (admin)
+// GetNewsletterSubscribers returns a page of subscribers (admin)
 func GetNewsletterSubscribers(c *fiber.Ctx) error {
 	var subscribers []models.Newsletter
 
-	query := database.DB
+	query := database.DB.Model(&models.Newsletter{})
 
 	// Filter by active status
 	if active := c.Query("active"); active != "" {
 		query = query.Where("active = ?", active == "true")
 	}
 
-	if err := query.Order("created_at DESC").Find(&subscribers).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to fetch subscribers",
-		})
-	}
-
-	return c.JSON(subscribers)
+	return respondPage(c, query, "newsletters", subscriberSortFields, "-created_at", &subscribers, "Failed to fetch subscribers")
 }
 
 // SendNewsletter sends newsletter to all active subscribers
@@ -435,34 +566,158 @@ func DeleteNewsletterSubscriber(c *fiber.Ctx) error {
 
 // Gallery handlers
 
-// GetGalleryImages returns gallery images
-func GetGalleryImages(c *fiber.Ctx) error {
-	var images []models.GalleryImage
+// galleryImageSortFields lists the sortable gallery image fields
+var galleryImageSortFields = SortFields{
+	"sort_order": "sort_order",
+	"created_at": "created_at",
+	"title":      "title",
+}
 
-	query := database.DB
+// galleryImageQuery applies the filters shared by the public and admin
+// gallery lists: ?category_id=, ?category= (slug) and ?featured=true
+func galleryImageQuery(c *fiber.Ctx) *gorm.DB {
+	query := database.DB.Model(&models.GalleryImage{})
 
-	// Filter by category
-	if category := c.Query("category"); category != "" {
-		query = query.Where("category = ?", category)
+	// Filter by category_id
+	if categoryID := c.Query("category_id"); categoryID != "" {
+		query = query.Where("gallery_images.category_id = ?", categoryID)
 	}
 
-	// Filter by event type
-	if eventType := c.Query("event_type"); eventType != "" {
-		query = query.Where("event_type = ?", eventType)
+	// Filter by category slug
+	if categorySlug := c.Query("category"); categorySlug != "" {
+		query = query.Joins("Category").Where("Category.slug = ?", categorySlug)
 	}
 
 	// Featured only
 	if featured := c.Query("featured"); featured == "true" {
-		query = query.Where("featured = ?", true)
+		query = query.Where("gallery_images.featured = ?", true)
+	}
+
+	return query.Preload("Category")
+}
+
+// GetGalleryImages returns a page of gallery images (public)
+func GetGalleryImages(c *fiber.Ctx) error {
+	var images []models.GalleryImage
+
+	// Only images with a watermarked variant can be shown publicly
+	query := galleryImageQuery(c).Where("gallery_images.public_url != ''")
+
+	req, err := parsePageRequest(c, "gallery_images", galleryImageSortFields, "sort_order")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	page, err := paginate(query, req, &images)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch gallery images",
+		})
+	}
+
+	publicGalleryImages(images)
+	page.Data = images
+
+	return c.JSON(page)
+}
+
+// GetAdminGalleryImages returns a page of all gallery images, including
+// those whose watermarked variant is not generated yet, filtered like the
+// public list and by ?search= on title and description (admin)
+func GetAdminGalleryImages(c *fiber.Ctx) error {
+	var images []models.GalleryImage
+
+	query := galleryImageQuery(c)
+	if search := c.Query("search"); search != "" {
+		like := "%" + search + "%"
+		query = query.Where("gallery_images.title LIKE ? OR gallery_images.description LIKE ?", like, like)
+	}
+
+	req, err := parsePageRequest(c, "gallery_images", galleryImageSortFields, "-created_at")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
 	}
 
-	if err := query.Order("sort_order ASC, created_at DESC").Find(&images).Error; err != nil {
+	page, err := paginate(query, req, &images)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch gallery images",
 		})
 	}
 
-	return c.JSON(images)
+	signGalleryOriginals(images)
+	page.Data = images
+
+	return c.JSON(page)
+}
+
+// publicGalleryImages replaces original URLs with the watermarked variants,
+// since originals are not served publicly
+func publicGalleryImages(images []models.GalleryImage) {
+	for i := range images {
+		images[i].ImageURL = images[i].PublicURL
+	}
+}
+
+// originalURLTTL is how long a signed link to an original stays valid
+const originalURLTTL = 10 * time.Minute
+
+// signGalleryOriginals replaces original URLs with short-lived signed URLs,
+// so the admin can preview images that have no watermarked variant yet
+func signGalleryOriginals(images []models.GalleryImage) {
+	for i := range images {
+		key, err := services.BlobKeyForURL(images[i].ImageURL)
+		if err != nil {
+			continue
+		}
+		if signed, err := services.Blobs().SignedURL(key, originalURLTTL); err == nil {
+			images[i].ImageURL = signed
+		}
+	}
+}
+
+// GetGalleryImageOriginal serves the full resolution original (admin)
+func GetGalleryImageOriginal(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid image ID",
+		})
+	}
+
+	var image models.GalleryImage
+	if err := database.DB.First(&image, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Image not found",
+		})
+	}
+
+	return sendGalleryOriginal(c, image)
+}
+
+// sendGalleryOriginal redirects to a short-lived signed URL of the original
+// file of a gallery image
+func sendGalleryOriginal(c *fiber.Ctx, image models.GalleryImage) error {
+	key, err := services.BlobKeyForURL(image.ImageURL)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Original file not found",
+		})
+	}
+
+	signed, err := services.Blobs().SignedURL(key, originalURLTTL)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to sign original URL",
+		})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	return c.Redirect(signed, fiber.StatusFound)
 }
 
 // CreateGalleryImage creates a new gallery image
@@ -484,31 +739,10 @@ func CreateGalleryImage(c *fiber.Ctx) error {
 	}
 	file := files[0]
 
-	// Validate file type
-	ext := strings.ToLower(filepath.Ext(file.Filename))
-	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" && ext != ".gif" && ext != ".webp" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid file type. Allowed: jpg, jpeg, png, gif, webp",
-		})
-	}
-
-	// Create uploads directory if not exists
-	uploadDir := "./uploads/gallery"
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create upload directory",
-		})
-	}
-
-	// Generate unique filename
-	filename := fmt.Sprintf("%d%s", time.Now().UnixNano(), ext)
-	filePath := filepath.Join(uploadDir, filename)
-
-	// Save file
-	if err := c.SaveFile(file, filePath); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to save file",
-		})
+	// Validate and save the file
+	upload, err := services.SaveImageUpload(c.UserContext(), file, services.GalleryUploads)
+	if err != nil {
+		return uploadErrorResponse(c, err)
 	}
 
 	// Create database record
@@ -517,27 +751,90 @@ func CreateGalleryImage(c *fiber.Ctx) error {
 		title = file.Filename
 	}
 
+	categoryID, err := resolveGalleryCategoryID(c.FormValue("category_id"), c.FormValue("category"))
+	if err != nil {
+		services.Blobs().Delete(c.UserContext(), upload.Key)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid gallery category",
+		})
+	}
+
 	image := models.GalleryImage{
 		Title:         title,
 		Description:   c.FormValue("description"),
-		Category:      models.GalleryCategory(c.FormValue("category")),
+		CategoryID:    categoryID,
 		Featured:      c.FormValue("featured") == "true",
-		ImageURL:      "/uploads/gallery/" + filename,
-		FileName:      filename,
+		ImageURL:      upload.URL,
+		FileName:      upload.FileName,
 		IsFromStorage: false,
 	}
 
 	if err := database.DB.Create(&image).Error; err != nil {
 		// Cleanup file if db fails
-		os.Remove(filePath)
+		services.Blobs().Delete(c.UserContext(), upload.Key)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create gallery image record",
 		})
 	}
 
+	// Render the public watermarked variants right away
+	if setting, err := services.GetWatermarkSetting(); err == nil {
+		if err := services.GenerateGalleryVariants(&image, setting); err != nil {
+			log.Printf("Failed to generate variants for gallery image %d: %v", image.ID, err)
+		}
+	}
+
+	database.DB.Preload("Category").First(&image, image.ID)
+
 	return c.Status(fiber.StatusCreated).JSON(image)
 }
 
+// uploadErrorResponse reports a failed image upload, showing validation
+// messages to the user and hiding internal errors
+func uploadErrorResponse(c *fiber.Ctx, err error) error {
+	var uploadErr *services.UploadError
+	if errors.As(err, &uploadErr) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": uploadErr.Message,
+		})
+	}
+
+	log.Printf("Failed to save upload: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Failed to save file",
+	})
+}
+
+// resolveGalleryCategoryID returns the gallery category referenced by ID or slug
+func resolveGalleryCategoryID(idStr, slug string) (uint, error) {
+	var category models.Category
+	query := database.DB.Where("type = ?", "gallery")
+	if idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			return 0, err
+		}
+		query = query.Where("id = ?", id)
+	} else {
+		query = query.Where("slug = ?", slug)
+	}
+
+	if err := query.First(&category).Error; err != nil {
+		return 0, err
+	}
+	return category.ID, nil
+}
+
+// GalleryImageRequest represents a gallery image update; the files and
+// their URLs are managed by the upload and watermark pipeline only
+type GalleryImageRequest struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	CategoryID  *uint   `json:"category_id"`
+	Featured    *bool   `json:"featured"`
+	SortOrder   *int    `json:"sort_order"`
+}
+
 // UpdateGalleryImage updates a gallery image
 func UpdateGalleryImage(c *fiber.Ctx) error {
 	id, err := strconv.Atoi(c.Params("id"))
@@ -554,17 +851,41 @@ func UpdateGalleryImage(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := c.BodyParser(&image); err != nil {
+	var req GalleryImageRequest
+	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid request body",
 		})
 	}
 
+	if req.Title != nil {
+		image.Title = *req.Title
+	}
+	if req.Description != nil {
+		image.Description = *req.Description
+	}
+	if req.CategoryID != nil {
+		categoryID, err := resolveGalleryCategoryID(strconv.FormatUint(uint64(*req.CategoryID), 10), "")
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid gallery category",
+			})
+		}
+		image.CategoryID = categoryID
+	}
+	if req.Featured != nil {
+		image.Featured = *req.Featured
+	}
+	if req.SortOrder != nil {
+		image.SortOrder = *req.SortOrder
+	}
+
 	if err := database.DB.Save(&image).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to update image",
 		})
 	}
+	database.DB.First(&image.Category, image.CategoryID)
 
 	return c.JSON(image)
 }
@@ -591,76 +912,60 @@ func DeleteGalleryImage(c *fiber.Ctx) error {
 
 // ScanStorageFolder scans the storage folder and imports images
 func ScanStorageFolder(c *fiber.Ctx) error {
-	storagePath := "../storage" // Relative to backend directory
-
-	// Map folder names to GalleryCategory
-	categoryMap := map[string]models.GalleryCategory{
-		"marryme":     models.CategoryMarryMe,
-		"weeding":     models.CategoryWedding,
-		"wedding":     models.CategoryWedding,
-		"birthday":    models.CategoryBirthday,
-		"baby shower": models.CategoryBabyShower,
-		"bapteme":     models.CategoryBapteme,
-		"congrats":    models.CategoryCongrats,
-		"loveroom":    models.CategoryLoveroom,
+	// Folder names are mapped to gallery categories in the database
+	resolver, err := services.NewGalleryCategoryResolver()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load gallery categories",
+		})
 	}
 
 	importedCount := 0
 	skippedCount := 0
 
-	err := filepath.Walk(storagePath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	err = services.Blobs().List(c.UserContext(), "storage/", func(info services.BlobInfo) error {
+		name := path.Base(info.Key)
+
+		// Skip hidden files
+		if strings.HasPrefix(name, ".") {
+			return nil
 		}
 
-		if !info.IsDir() {
-			// Skip hidden files
-			if strings.HasPrefix(info.Name(), ".") {
-				return nil
-			}
+		// Only process image files
+		ext := strings.ToLower(path.Ext(name))
+		if ext != ".jpg" && ext != ".jpeg" && ext != ".png" && ext != ".gif" && ext != ".webp" {
+			return nil
+		}
 
-			// Only process image files
-			ext := strings.ToLower(filepath.Ext(info.Name()))
-			if ext != ".jpg" && ext != ".jpeg" && ext != ".png" && ext != ".gif" && ext != ".webp" {
-				return nil
-			}
+		// Determine category from parent folder
+		dir := path.Base(path.Dir(info.Key))
+		categoryID, err := resolver.Resolve(dir)
+		if err != nil {
+			return err
+		}
 
-			// Determine category from parent folder
-			dir := filepath.Base(filepath.Dir(path))
-			category, exists := categoryMap[dir]
-			if !exists {
-				category = models.CategoryBirthday // Default fallback
-			}
+		// Construct public URL - storage keys are served at /storage
+		// URL-encode the path to handle spaces and special characters
+		publicURL := strings.ReplaceAll("/"+info.Key, " ", "%20")
 
-			// Construct public URL - storage folder is served at /storage
-			// URL-encode the path to handle spaces and special characters
-			relPath, _ := filepath.Rel(storagePath, path)
-			// Split path and encode each component
-			pathParts := strings.Split(relPath, string(filepath.Separator))
-			for i, part := range pathParts {
-				pathParts[i] = strings.ReplaceAll(part, " ", "%20")
+		// Check if image already exists
+		var count int64
+		database.DB.Model(&models.GalleryImage{}).Where("image_url = ?", publicURL).Count(&count)
+		if count == 0 {
+			image := models.GalleryImage{
+				Title:         name,
+				Description:   fmt.Sprintf("Image de %s", dir),
+				ImageURL:      publicURL,
+				CategoryID:    categoryID,
+				FileName:      name,
+				IsFromStorage: true,
 			}
-			publicURL := "/storage/" + strings.Join(pathParts, "/")
-
-			// Check if image already exists
-			var count int64
-			database.DB.Model(&models.GalleryImage{}).Where("image_url = ?", publicURL).Count(&count)
-			if count == 0 {
-				image := models.GalleryImage{
-					Title:         info.Name(),
-					Description:   fmt.Sprintf("Image de %s", dir),
-					ImageURL:      publicURL,
-					Category:      category,
-					FileName:      info.Name(),
-					IsFromStorage: true,
-				}
-				if err := database.DB.Create(&image).Error; err != nil {
-					return err
-				}
-				importedCount++
-			} else {
-				skippedCount++
+			if err := database.DB.Create(&image).Error; err != nil {
+				return err
 			}
+			importedCount++
+		} else {
+			skippedCount++
 		}
 		return nil
 	})
@@ -671,6 +976,11 @@ func ScanStorageFolder(c *fiber.Ctx) error {
 		})
 	}
 
+	// Imported images get their public variants in the background
+	if importedCount > 0 {
+		go regenerateVariants(false)
+	}
+
 	return c.JSON(fiber.Map{
 		"message":  "Storage folder scanned successfully",
 		"imported": importedCount,
@@ -678,32 +988,26 @@ func ScanStorageFolder(c *fiber.Ctx) error {
 	})
 }
 
-// GetGalleryCategories returns all categories with image counts
+// GetGalleryCategories returns all gallery categories with image counts
 func GetGalleryCategories(c *fiber.Ctx) error {
 	type CategoryStats struct {
+		ID       uint   `json:"id"`
 		Category string `json:"category"`
+		Name     string `json:"name"`
 		Count    int64  `json:"count"`
 	}
 
-	var stats []CategoryStats
+	stats := []CategoryStats{}
 
-	// Get count for each category
-	categories := []models.GalleryCategory{
-		models.CategoryWedding,
-		models.CategoryMarryMe,
-		models.CategoryBirthday,
-		models.CategoryBabyShower,
-		models.CategoryBapteme,
-		models.CategoryLoveroom,
-		models.CategoryCongrats,
-	}
-
-	for _, cat := range categories {
-		var count int64
-		database.DB.Model(&models.GalleryImage{}).Where("category = ?", cat).Count(&count)
-		stats = append(stats, CategoryStats{
-			Category: string(cat),
-			Count:    count,
+	if err := database.DB.Model(&models.Category{}).
+		Select("categories.id, categories.slug AS category, categories.name, COUNT(gallery_images.id) AS count").
+		Joins("LEFT JOIN gallery_images ON gallery_images.category_id = categories.id AND gallery_images.deleted_at IS NULL").
+		Where("categories.type = ?", "gallery").
+		Group("categories.id").
+		Order("categories.name ASC").
+		Scan(&stats).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch gallery categories",
 		})
 	}
 
@@ -0,0 +1,609 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"github.com/mazong/angel_event/internal/services"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// albumTokenBytes is the size of album share tokens (256 bits)
+const albumTokenBytes = 32
+
+// albumSortFields lists the sortable album fields
+var albumSortFields = SortFields{
+	"created_at": "created_at",
+	"title":      "title",
+}
+
+// AlbumRequest represents an album creation or update request
+type AlbumRequest struct {
+	Title          *string    `json:"title"`
+	Description    *string    `json:"description"`
+	BookingID      *uint      `json:"booking_id"`
+	CoverImageID   *uint      `json:"cover_image_id"`
+	Password       *string    `json:"password"` // empty string removes the password
+	ExpiresAt      *time.Time `json:"expires_at"`
+	ClearExpiresAt bool       `json:"clear_expires_at"`
+}
+
+// SharedAlbumImage is an album image as seen through a share link:
+// watermarked variants for display plus a token-protected original
+type SharedAlbumImage struct {
+	models.GalleryImage
+	OriginalURL string `json:"original_url"`
+}
+
+// SharedAlbumResponse is the public view of a shared album
+type SharedAlbumResponse struct {
+	Title       string             `json:"title"`
+	Description string             `json:"description"`
+	CoverImage  *SharedAlbumImage  `json:"cover_image,omitempty"`
+	ExpiresAt   *time.Time         `json:"expires_at,omitempty"`
+	Images      []SharedAlbumImage `json:"images"`
+}
+
+// GetAlbums returns a page of albums (admin)
+func GetAlbums(c *fiber.Ctx) error {
+	var albums []models.Album
+
+	query := database.DB.Model(&models.Album{}).Preload("CoverImage")
+
+	if bookingID := c.Query("booking_id"); bookingID != "" {
+		query = query.Where("booking_id = ?", bookingID)
+	}
+
+	req, err := parsePageRequest(c, "albums", albumSortFields, "-created_at")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	page, err := paginate(query, req, &albums)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch albums",
+		})
+	}
+
+	for i := range albums {
+		albums[i].HasPassword = albums[i].PasswordHash != ""
+	}
+	page.Data = albums
+
+	return c.JSON(page)
+}
+
+// GetAlbum returns an album with its ordered images (admin)
+func GetAlbum(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid album ID",
+		})
+	}
+
+	var album models.Album
+	if err := database.DB.
+		Preload("Booking.Client").
+		Preload("CoverImage").
+		Preload("Images", func(db *gorm.DB) *gorm.DB { return db.Order("position ASC") }).
+		Preload("Images.GalleryImage").
+		First(&album, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Album not found",
+		})
+	}
+	album.HasPassword = album.PasswordHash != ""
+
+	return c.JSON(album)
+}
+
+// CreateAlbum creates an album with a fresh share token (admin)
+func CreateAlbum(c *fiber.Ctx) error {
+	var req AlbumRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Title == nil || *req.Title == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Title is required",
+		})
+	}
+
+	token, err := services.RandomToken(albumTokenBytes)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate share token",
+		})
+	}
+
+	album := models.Album{ShareToken: token}
+	if msg := applyAlbumRequest(&album, req); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	if err := database.DB.Create(&album).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create album",
+		})
+	}
+	album.HasPassword = album.PasswordHash != ""
+
+	return c.Status(fiber.StatusCreated).JSON(album)
+}
+
+// UpdateAlbum updates album details, password and expiry (admin)
+func UpdateAlbum(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid album ID",
+		})
+	}
+
+	var album models.Album
+	if err := database.DB.First(&album, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Album not found",
+		})
+	}
+
+	var req AlbumRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if msg := applyAlbumRequest(&album, req); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	if err := database.DB.Save(&album).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update album",
+		})
+	}
+	album.HasPassword = album.PasswordHash != ""
+
+	return c.JSON(album)
+}
+
+// applyAlbumRequest copies the provided fields onto the album and returns
+// a validation message if a reference is invalid
+func applyAlbumRequest(album *models.Album, req AlbumRequest) string {
+	if req.Title != nil {
+		album.Title = *req.Title
+	}
+	if req.Description != nil {
+		album.Description = *req.Description
+	}
+
+	if req.BookingID != nil {
+		if *req.BookingID == 0 {
+			album.BookingID = nil
+		} else {
+			var count int64
+			database.DB.Model(&models.Booking{}).Where("id = ?", *req.BookingID).Count(&count)
+			if count == 0 {
+				return "Booking not found"
+			}
+			album.BookingID = req.BookingID
+		}
+	}
+
+	if req.CoverImageID != nil {
+		if *req.CoverImageID == 0 {
+			album.CoverImageID = nil
+		} else {
+			var count int64
+			database.DB.Model(&models.GalleryImage{}).Where("id = ?", *req.CoverImageID).Count(&count)
+			if count == 0 {
+				return "Cover image not found"
+			}
+			album.CoverImageID = req.CoverImageID
+		}
+	}
+
+	if req.Password != nil {
+		if *req.Password == "" {
+			album.PasswordHash = ""
+		} else {
+			hashed, err := HashPassword(*req.Password)
+			if err != nil {
+				return "Invalid password"
+			}
+			album.PasswordHash = hashed
+		}
+	}
+
+	if req.ClearExpiresAt {
+		album.ExpiresAt = nil
+	} else if req.ExpiresAt != nil {
+		album.ExpiresAt = req.ExpiresAt
+	}
+
+	return ""
+}
+
+// DeleteAlbum deletes an album; its images stay in the gallery (admin)
+func DeleteAlbum(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid album ID",
+		})
+	}
+
+	if err := database.DB.Delete(&models.Album{}, id).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete album",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Album deleted successfully",
+	})
+}
+
+// SetAlbumImages replaces the ordered image set of an album (admin)
+func SetAlbumImages(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid album ID",
+		})
+	}
+
+	type ImagesRequest struct {
+		ImageIDs []uint `json:"image_ids"`
+	}
+
+	var req ImagesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	var album models.Album
+	if err := database.DB.First(&album, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Album not found",
+		})
+	}
+
+	// Keep the first occurrence of each image, in the requested order
+	seen := make(map[uint]bool)
+	var imageIDs []uint
+	for _, imageID := range req.ImageIDs {
+		if !seen[imageID] {
+			seen[imageID] = true
+			imageIDs = append(imageIDs, imageID)
+		}
+	}
+
+	var count int64
+	database.DB.Model(&models.GalleryImage{}).Where("id IN ?", imageIDs).Count(&count)
+	if int(count) != len(imageIDs) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Some images do not exist",
+		})
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("album_id = ?", album.ID).Delete(&models.AlbumImage{}).Error; err != nil {
+			return err
+		}
+
+		entries := make([]models.AlbumImage, len(imageIDs))
+		for i, imageID := range imageIDs {
+			entries[i] = models.AlbumImage{AlbumID: album.ID, GalleryImageID: imageID, Position: i}
+		}
+		if len(entries) > 0 {
+			if err := tx.Create(&entries).Error; err != nil {
+				return err
+			}
+		}
+
+		// Drop a cover that is no longer part of the album
+		if album.CoverImageID != nil && !seen[*album.CoverImageID] {
+			return tx.Model(&album).Update("cover_image_id", nil).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update album images",
+		})
+	}
+
+	return GetAlbum(c)
+}
+
+// RegenerateAlbumToken issues a new share token, revoking the old link (admin)
+func RegenerateAlbumToken(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid album ID",
+		})
+	}
+
+	var album models.Album
+	if err := database.DB.First(&album, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Album not found",
+		})
+	}
+
+	token, err := services.RandomToken(albumTokenBytes)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate share token",
+		})
+	}
+
+	album.ShareToken = token
+	if err := database.DB.Save(&album).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update album",
+		})
+	}
+	album.HasPassword = album.PasswordHash != ""
+
+	return c.JSON(album)
+}
+
+// albumAccessError denies access to a shared album
+type albumAccessError struct {
+	status           int
+	message          string
+	passwordRequired bool
+}
+
+func (e *albumAccessError) Error() string {
+	return e.message
+}
+
+// Send writes the denial as the response
+func (e *albumAccessError) Send(c *fiber.Ctx) error {
+	if e.status == fiber.StatusTooManyRequests {
+		return tooManyRequests(c, "rate_limited")
+	}
+	body := fiber.Map{"error": e.message}
+	if e.passwordRequired {
+		body["password_required"] = true
+	}
+	return c.Status(e.status).JSON(body)
+}
+
+// sharedAlbumPassword reads the album password from the X-Album-Password
+// header or the password field of the body. The URL is not accepted: it
+// ends up in access logs, browser history and Referer headers.
+func sharedAlbumPassword(c *fiber.Ctx) string {
+	if password := c.Get("X-Album-Password"); password != "" {
+		return password
+	}
+	var body struct {
+		Password string `json:"password" form:"password"`
+	}
+	if len(c.Body()) > 0 {
+		c.BodyParser(&body)
+	}
+	return body.Password
+}
+
+// loadSharedAlbum finds the album for the share token in the URL and checks
+// its expiry and password. Wrong passwords are answered after a delay that
+// grows with the failures on the album, and lock out the IP sending them.
+func loadSharedAlbum(c *fiber.Ctx) (*models.Album, *albumAccessError) {
+	token := c.Params("token")
+	var album models.Album
+	if err := database.DB.Where("share_token = ?", token).First(&album).Error; err != nil {
+		return nil, &albumAccessError{status: fiber.StatusNotFound, message: "Album not found"}
+	}
+
+	if album.ExpiresAt != nil && time.Now().After(*album.ExpiresAt) {
+		return nil, &albumAccessError{status: fiber.StatusGone, message: "This album link has expired"}
+	}
+
+	if album.PasswordHash != "" {
+		password := sharedAlbumPassword(c)
+		if password == "" {
+			return nil, &albumAccessError{status: fiber.StatusUnauthorized, message: "Password required", passwordRequired: true}
+		}
+		if services.AlbumPasswordLocked(token, c.IP()) {
+			return nil, &albumAccessError{status: fiber.StatusTooManyRequests, message: "Too many wrong passwords"}
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(album.PasswordHash), []byte(password)); err != nil {
+			time.Sleep(services.RecordAlbumPasswordFailure(token, c.IP()))
+			return nil, &albumAccessError{status: fiber.StatusUnauthorized, message: "Invalid password", passwordRequired: true}
+		}
+	}
+
+	return &album, nil
+}
+
+// sharedAlbumImages returns the album's gallery images in album order
+func sharedAlbumImages(albumID uint) ([]models.GalleryImage, error) {
+	var images []models.GalleryImage
+	err := database.DB.
+		Joins("JOIN album_images ON album_images.gallery_image_id = gallery_images.id").
+		Where("album_images.album_id = ?", albumID).
+		Order("album_images.position ASC").
+		Find(&images).Error
+	return images, err
+}
+
+// GetSharedAlbum returns a shared album and only its images (public)
+func GetSharedAlbum(c *fiber.Ctx) error {
+	album, denied := loadSharedAlbum(c)
+	if denied != nil {
+		return denied.Send(c)
+	}
+
+	images, err := sharedAlbumImages(album.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch album images",
+		})
+	}
+
+	publicGalleryImages(images)
+
+	response := SharedAlbumResponse{
+		Title:       album.Title,
+		Description: album.Description,
+		ExpiresAt:   album.ExpiresAt,
+		Images:      make([]SharedAlbumImage, len(images)),
+	}
+	for i, image := range images {
+		response.Images[i] = SharedAlbumImage{
+			GalleryImage: image,
+			OriginalURL:  fmt.Sprintf("/api/public/albums/%s/images/%d/original", album.ShareToken, image.ID),
+		}
+		if album.CoverImageID != nil && image.ID == *album.CoverImageID {
+			response.CoverImage = &response.Images[i]
+		}
+	}
+
+	return c.JSON(response)
+}
+
+// GetSharedAlbumOriginal serves the original of one album image (public)
+func GetSharedAlbumOriginal(c *fiber.Ctx) error {
+	album, denied := loadSharedAlbum(c)
+	if denied != nil {
+		return denied.Send(c)
+	}
+
+	imageID, err := strconv.Atoi(c.Params("imageId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid image ID",
+		})
+	}
+
+	var image models.GalleryImage
+	if err := database.DB.
+		Joins("JOIN album_images ON album_images.gallery_image_id = gallery_images.id").
+		Where("album_images.album_id = ? AND gallery_images.id = ?", album.ID, imageID).
+		First(&image).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Image not found in this album",
+		})
+	}
+
+	return sendGalleryOriginal(c, image)
+}
+
+// DownloadSharedAlbum streams a ZIP of the album's original files (public).
+// Files are copied straight into the response so memory stays flat
+// regardless of the album size.
+func DownloadSharedAlbum(c *fiber.Ctx) error {
+	album, denied := loadSharedAlbum(c)
+	if denied != nil {
+		return denied.Send(c)
+	}
+
+	images, err := sharedAlbumImages(album.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch album images",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="album-%d.zip"`, album.ID))
+
+	// The request context is recycled once the handler returns
+	ctx := context.Background()
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		zw := zip.NewWriter(w)
+		names := make(map[string]int)
+
+		for i, image := range images {
+			key, err := services.BlobKeyForURL(image.ImageURL)
+			if err != nil {
+				log.Printf("Album %d: skipping image %d: %v", album.ID, image.ID, err)
+				continue
+			}
+
+			err = writeZipEntry(ctx, zw, key, zipEntryName(i, key, names))
+			if errors.Is(err, services.ErrBlobNotFound) {
+				log.Printf("Album %d: skipping image %d: %v", album.ID, image.ID, err)
+				continue
+			}
+			if err != nil {
+				log.Printf("Album %d: failed to add image %d: %v", album.ID, image.ID, err)
+				return
+			}
+			w.Flush()
+		}
+
+		if err := zw.Close(); err != nil {
+			log.Printf("Album %d: failed to finish archive: %v", album.ID, err)
+		}
+		w.Flush()
+	})
+
+	return nil
+}
+
+// zipEntryName prefixes file names with their album position and
+// de-duplicates names coming from different folders
+func zipEntryName(index int, key string, names map[string]int) string {
+	name := fmt.Sprintf("%03d-%s", index+1, path.Base(key))
+	names[name]++
+	if n := names[name]; n > 1 {
+		ext := path.Ext(name)
+		name = fmt.Sprintf("%s-%d%s", name[:len(name)-len(ext)], n, ext)
+	}
+	return name
+}
+
+// writeZipEntry copies a blob into the archive without recompressing it
+func writeZipEntry(ctx context.Context, zw *zip.Writer, key, name string) error {
+	r, info, err := services.Blobs().Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store, // photos are already compressed
+		Modified: info.ModTime,
+	}
+
+	entry, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, r)
+	return err
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestSharedAlbumPassword(t *testing.T) {
+	useTestDB(t)
+	t.Setenv("ALBUM_PASSWORD_MAX_DELAY", "off")
+	app := newTestApp()
+	app.Get("/albums/:token", GetSharedAlbum)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	album := models.Album{Title: "Wedding", ShareToken: "album-password-test", PasswordHash: string(hash)}
+	if err := database.DB.Create(&album).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(ip, path, password string) int {
+		t.Helper()
+		header := map[string]string{}
+		if password != "" {
+			header["X-Album-Password"] = password
+		}
+		status, _ := send(t, app, http.MethodGet, path, ip, nil, header)
+		return status
+	}
+	path := "/albums/" + album.ShareToken
+
+	if status := get("203.0.113.1", path, ""); status != http.StatusUnauthorized {
+		t.Errorf("without a password = %d, want 401", status)
+	}
+	// Passwords in the URL end up in logs: ignored
+	if status := get("203.0.113.1", path+"?password=s3cret", ""); status != http.StatusUnauthorized {
+		t.Errorf("password in the query = %d, want 401", status)
+	}
+
+	// Someone with the link guessing from one IP is locked out after
+	// ALBUM_PASSWORD_CLIENT_LIMIT (5) failures, even with the right password
+	for i := 0; i < 5; i++ {
+		if status := get("203.0.113.2", path, fmt.Sprintf("guess%d", i)); status != http.StatusUnauthorized {
+			t.Fatalf("wrong password %d = %d, want 401", i, status)
+		}
+	}
+	if status := get("203.0.113.2", path, "s3cret"); status != http.StatusTooManyRequests {
+		t.Errorf("after 5 failures = %d, want 429", status)
+	}
+
+	// The client with the password is not locked out by those failures
+	if status := get("203.0.113.3", path, "s3cret"); status != http.StatusOK {
+		t.Errorf("right password from another IP = %d, want 200", status)
+	}
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"github.com/mazong/angel_event/internal/services"
+)
+
+// SpamFields are the anti-spam fields public forms send along
+type SpamFields struct {
+	// Website is a honeypot: hidden from people, filled by bots
+	Website string `json:"website"`
+	// FormToken comes from GET /api/public/form-token when the form is shown
+	FormToken string `json:"form_token"`
+}
+
+func (f *SpamFields) spamFields() *SpamFields { return f }
+
+// spamScreened is a request carrying SpamFields
+type spamScreened interface {
+	spamFields() *SpamFields
+}
+
+// screenSubmission applies the rate limits and spam filters to a bound
+// request. When it returns done, the response is written: a 429 for rate
+// limits, or a 202 once a suspicious submission is quarantined, which bots
+// cannot tell from success. text lists the free-text fields to score.
+func screenSubmission(c *fiber.Ctx, form string, req spamScreened, email string, text ...string) (done bool, err error) {
+	fields := req.spamFields()
+	sub := &services.Submission{
+		Form:      form,
+		IP:        c.IP(),
+		Email:     email,
+		Text:      text,
+		Honeypot:  fields.Website,
+		FormToken: fields.FormToken,
+	}
+
+	if err := services.CheckSubmissionRate(sub); err != nil {
+		return true, tooManyRequests(c, "rate_limited")
+	}
+
+	verdict := services.ScoreSubmission(sub)
+	if !verdict.Suspicious() {
+		return false, nil
+	}
+
+	if _, err := services.QuarantineSubmission(sub, verdict, req); err != nil {
+		log.Printf("Failed to quarantine %s submission: %v", form, err)
+		return true, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to process submission",
+		})
+	}
+
+	return true, c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Submission received",
+	})
+}
+
+// tooManyRequests sends a 429 with a localized message for code
+func tooManyRequests(c *fiber.Ctx, code string) error {
+	message := localize(locale(c), code, "")
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"code":    code,
+		"message": message,
+		"error":   message,
+	})
+}
+
+// GetFormToken returns a token to send with the next form submission (public)
+func GetFormToken(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(fiber.Map{
+		"form_token": services.IssueFormToken(),
+	})
+}
+
+// quarantineSortFields lists the sortable quarantine fields
+var quarantineSortFields = SortFields{
+	"created_at": "created_at",
+	"score":      "score",
+}
+
+// GetQuarantinedSubmissions returns a page of quarantined submissions,
+// pending by default, filtered by ?form= and ?status= (admin)
+func GetQuarantinedSubmissions(c *fiber.Ctx) error {
+	var submissions []models.QuarantinedSubmission
+
+	query := database.DB.Model(&models.QuarantinedSubmission{}).
+		Where("status = ?", c.Query("status", string(models.QuarantinePending)))
+	if form := c.Query("form"); form != "" {
+		query = query.Where("form = ?", form)
+	}
+
+	return respondPage(c, query, "quarantined_submissions", quarantineSortFields, "-created_at", &submissions, "Failed to fetch quarantined submissions")
+}
+
+// loadPendingSubmission finds a quarantined submission still awaiting review
+func loadPendingSubmission(c *fiber.Ctx) (*models.QuarantinedSubmission, error) {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid submission ID",
+		})
+	}
+
+	var q models.QuarantinedSubmission
+	if err := database.DB.Where("status = ?", models.QuarantinePending).First(&q, id).Error; err != nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Pending submission not found",
+		})
+	}
+	return &q, nil
+}
+
+// ReleaseQuarantinedSubmission processes a quarantined submission as if it
+// had just been sent, emails included (admin)
+func ReleaseQuarantinedSubmission(c *fiber.Ctx) error {
+	q, err := loadPendingSubmission(c)
+	if q == nil {
+		return err
+	}
+
+	result, err := replaySubmission(q)
+	if errors.Is(err, errInvalidPayload) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": "Stored submission cannot be processed",
+		})
+	}
+	if err != nil {
+		return availabilityErrorResponse(c, err, "Failed to release submission")
+	}
+
+	markReviewed(q, models.QuarantineReleased)
+
+	return c.JSON(fiber.Map{
+		"submission": q,
+		"result":     result,
+		"message":    "Submission released",
+	})
+}
+
+// DiscardQuarantinedSubmission confirms a quarantined submission as spam (admin)
+func DiscardQuarantinedSubmission(c *fiber.Ctx) error {
+	q, err := loadPendingSubmission(c)
+	if q == nil {
+		return err
+	}
+
+	markReviewed(q, models.QuarantineDiscarded)
+
+	return c.JSON(fiber.Map{
+		"message": "Submission discarded",
+	})
+}
+
+func markReviewed(q *models.QuarantinedSubmission, status models.QuarantineStatus) {
+	now := time.Now()
+	q.Status = status
+	q.ReviewedAt = &now
+	database.DB.Model(q).Updates(map[string]interface{}{
+		"status":      status,
+		"reviewed_at": now,
+	})
+}
+
+var errInvalidPayload = errors.New("invalid quarantined payload")
+
+// replaySubmission runs the processing of the form a submission came from
+func replaySubmission(q *models.QuarantinedSubmission) (interface{}, error) {
+	decode := func(req interface{}) error {
+		if err := json.Unmarshal([]byte(q.Payload), req); err != nil {
+			return errInvalidPayload
+		}
+		return nil
+	}
+
+	switch q.Form {
+	case services.FormContact:
+		var req ContactFormRequest
+		if err := decode(&req); err != nil {
+			return nil, err
+		}
+		return nil, submitContactForm(&req)
+
+	case services.FormBooking:
+		var req CreateBookingRequest
+		if err := decode(&req); err != nil {
+			return nil, err
+		}
+		eventDate, err := models.ParseDate(req.EventDate)
+		if err != nil {
+			return nil, errInvalidPayload
+		}
+		// The date may have passed or filled up while quarantined
+		if eventDate.Before(services.Today()) {
+			return nil, services.ErrDateUnavailable
+		}
+		return createBooking(eventDate, &req)
+
+	case services.FormTestimonial:
+		var req CreateTestimonialRequest
+		if err := decode(&req); err != nil {
+			return nil, err
+		}
+		return createTestimonial(&req)
+
+	case services.FormNewsletter:
+		var req SubscribeNewsletterRequest
+		if err := decode(&req); err != nil {
+			return nil, err
+		}
+		return nil, subscribeNewsletter(&req)
+
+	case services.FormWaitlist:
+		var req WaitlistRequest
+		if err := decode(&req); err != nil {
+			return nil, err
+		}
+		date, err := models.ParseDate(req.Date)
+		if err != nil {
+			return nil, errInvalidPayload
+		}
+		entry, _, err := joinWaitlist(date, &req)
+		return entry, err
+	}
+
+	return nil, errInvalidPayload
+}
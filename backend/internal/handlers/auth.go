@@ -62,6 +62,14 @@ func Login(c *fiber.Ctx) error {
 	})
 }
 
+// currentUserID returns the authenticated staff user, nil on public routes
+func currentUserID(c *fiber.Ctx) *uint {
+	if id, ok := c.Locals("user_id").(uint); ok {
+		return &id
+	}
+	return nil
+}
+
 // GetCurrentUser returns the currently authenticated user
 func GetCurrentUser(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(uint)
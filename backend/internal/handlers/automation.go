@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"github.com/mazong/angel_event/internal/services"
+	"gorm.io/gorm"
+)
+
+// automationSendSortFields lists the sortable automation send fields
+var automationSendSortFields = SortFields{
+	"created_at": "created_at",
+}
+
+// AutomationRequest creates or replaces an automation
+type AutomationRequest struct {
+	Name     string `json:"name" validate:"required,max=100"`
+	Template string `json:"template" validate:"required,oneof=event_reminder balance_due thank_you"`
+	Trigger  string `json:"trigger" validate:"required,oneof=before_event after_event after_status"`
+	Days     int    `json:"days" validate:"min=0,max=365"`
+	Statuses string `json:"statuses" validate:"required,max=100"`
+	Enabled  *bool  `json:"enabled"`
+}
+
+// bindAutomation validates the request into automation, writing the error
+// response when it returns false
+func bindAutomation(c *fiber.Ctx, automation *models.Automation) (bool, error) {
+	var req AutomationRequest
+	if verr := bindRequest(c, &req); verr != nil {
+		return false, verr.Send(c)
+	}
+
+	statuses, err := services.ParseBookingStatuses(req.Statuses)
+	if err != nil {
+		return false, fieldError(c, "statuses", "booking_statuses").Send(c)
+	}
+	if models.AutomationTrigger(req.Trigger) == models.TriggerAfterStatus && len(statuses) != 1 {
+		return false, fieldError(c, "statuses", "single_status").Send(c)
+	}
+
+	automation.Name = req.Name
+	automation.Template = models.AutomationTemplate(req.Template)
+	automation.Trigger = models.AutomationTrigger(req.Trigger)
+	automation.Days = req.Days
+	automation.Statuses = services.FormatBookingStatuses(statuses)
+	if req.Enabled != nil {
+		automation.Enabled = *req.Enabled
+	}
+	return true, nil
+}
+
+// GetAutomations returns the automations (admin)
+func GetAutomations(c *fiber.Ctx) error {
+	var automations []models.Automation
+	if err := database.DB.Order("id").Find(&automations).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch automations",
+		})
+	}
+
+	return c.JSON(automations)
+}
+
+// CreateAutomation adds an automation, enabled unless enabled is false (admin)
+func CreateAutomation(c *fiber.Ctx) error {
+	automation := models.Automation{Enabled: true}
+	if ok, err := bindAutomation(c, &automation); !ok {
+		return err
+	}
+
+	if err := database.DB.Create(&automation).Error; err != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "An automation with this name already exists",
+		})
+	}
+	if !automation.Enabled {
+		// The column default would otherwise enable it
+		database.DB.Model(&automation).Update("enabled", false)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(automation)
+}
+
+// UpdateAutomation replaces an automation (admin)
+func UpdateAutomation(c *fiber.Ctx) error {
+	var automation models.Automation
+	if err := database.DB.First(&automation, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Automation not found",
+		})
+	}
+
+	if ok, err := bindAutomation(c, &automation); !ok {
+		return err
+	}
+
+	if err := database.DB.Save(&automation).Error; err != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "An automation with this name already exists",
+		})
+	}
+
+	return c.JSON(automation)
+}
+
+// DeleteAutomation deletes an automation and its send history (admin)
+func DeleteAutomation(c *fiber.Ctx) error {
+	var automation models.Automation
+	if err := database.DB.First(&automation, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Automation not found",
+		})
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("automation_id = ?", automation.ID).Delete(&models.AutomationSend{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&automation).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete automation",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Automation deleted successfully",
+	})
+}
+
+// GetAutomationSends returns a page of the emails sent by automations,
+// filtered by ?automation_id=, ?booking_id= and ?status= (sent or failed)
+// (admin)
+func GetAutomationSends(c *fiber.Ctx) error {
+	query := database.DB.Model(&models.AutomationSend{})
+	if id := c.QueryInt("automation_id"); id > 0 {
+		query = query.Where("automation_id = ?", id)
+	}
+	if id := c.QueryInt("booking_id"); id > 0 {
+		query = query.Where("booking_id = ?", id)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var sends []models.AutomationSend
+	return respondPage(c, query, "automation_sends", automationSendSortFields, "-created_at", &sends,
+		"Failed to fetch automation sends")
+}
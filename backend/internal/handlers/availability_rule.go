@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"github.com/mazong/angel_event/internal/services"
+)
+
+// AvailabilityRuleRequest creates or replaces an availability rule
+type AvailabilityRuleRequest struct {
+	Name      string `json:"name"`
+	Weekdays  string `json:"weekdays"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	Yearly    bool   `json:"yearly"`
+	Available bool   `json:"available"`
+	MaxEvents int    `json:"max_events"`
+	Priority  int    `json:"priority"`
+}
+
+// toRule validates the request into rule, returning a user-facing message
+func (req *AvailabilityRuleRequest) toRule(rule *models.AvailabilityRule) string {
+	if req.Name == "" {
+		return "Name is required"
+	}
+
+	weekdays, err := services.ParseWeekdays(req.Weekdays)
+	if err != nil {
+		return "Weekdays must be a comma-separated list of 0 (Sunday) to 6 (Saturday)"
+	}
+
+	parseDate := func(s string) (*models.Date, bool) {
+		if s == "" {
+			return nil, true
+		}
+		d, err := models.ParseDate(s)
+		if err != nil {
+			return nil, false
+		}
+		return &d, true
+	}
+	start, ok := parseDate(req.StartDate)
+	if !ok {
+		return "Invalid start date format"
+	}
+	end, ok := parseDate(req.EndDate)
+	if !ok {
+		return "Invalid end date format"
+	}
+	// Yearly ranges may wrap over the new year
+	if !req.Yearly && start != nil && end != nil && end.Before(*start) {
+		return "End date must not be before start date"
+	}
+
+	if req.Available && req.MaxEvents < 1 {
+		return "Max events must be at least 1 for open dates"
+	}
+	if req.MaxEvents < 0 {
+		return "Max events must not be negative"
+	}
+
+	rule.Name = req.Name
+	rule.Weekdays = services.FormatWeekdays(weekdays)
+	rule.StartDate = start
+	rule.EndDate = end
+	rule.Yearly = req.Yearly
+	rule.Available = req.Available
+	rule.MaxEvents = req.MaxEvents
+	rule.Priority = req.Priority
+	return ""
+}
+
+// GetAvailabilityRules returns all rules, highest priority first (admin)
+func GetAvailabilityRules(c *fiber.Ctx) error {
+	var rules []models.AvailabilityRule
+	if err := database.DB.Order("priority DESC, id DESC").Find(&rules).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch availability rules",
+		})
+	}
+
+	return c.JSON(rules)
+}
+
+// CreateAvailabilityRule adds a rule (admin)
+func CreateAvailabilityRule(c *fiber.Ctx) error {
+	var req AvailabilityRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	var rule models.AvailabilityRule
+	if msg := req.toRule(&rule); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	if err := database.DB.Create(&rule).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create availability rule",
+		})
+	}
+
+	go processWaitlists()
+
+	return c.Status(fiber.StatusCreated).JSON(rule)
+}
+
+// UpdateAvailabilityRule replaces a rule (admin)
+func UpdateAvailabilityRule(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid rule ID",
+		})
+	}
+
+	var rule models.AvailabilityRule
+	if err := database.DB.First(&rule, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Availability rule not found",
+		})
+	}
+
+	var req AvailabilityRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if msg := req.toRule(&rule); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	if err := database.DB.Save(&rule).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update availability rule",
+		})
+	}
+
+	go processWaitlists()
+
+	return c.JSON(rule)
+}
+
+// DeleteAvailabilityRule removes a rule (admin)
+func DeleteAvailabilityRule(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid rule ID",
+		})
+	}
+
+	if err := database.DB.Delete(&models.AvailabilityRule{}, id).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete availability rule",
+		})
+	}
+
+	go processWaitlists()
+
+	return c.JSON(fiber.Map{
+		"message": "Availability rule deleted successfully",
+	})
+}
+
+// ResolveAvailability returns the effective availability of each date in
+// ?from=&to=, with the rule or override that decided it (admin)
+func ResolveAvailability(c *fiber.Ctx) error {
+	from, err := models.ParseDate(c.Query("from"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid from date format",
+		})
+	}
+	to, err := models.ParseDate(c.Query("to", c.Query("from")))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid to date format",
+		})
+	}
+
+	days, err := services.ResolveAvailability(from, to)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(days)
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mazong/angel_event/internal/services"
+)
+
+// ServeSignedBlob serves a blob of the local store through a signed URL
+// produced by LocalBlobStore.SignedURL (public, signature checked)
+func ServeSignedBlob(c *fiber.Ctx) error {
+	local, ok := services.Blobs().(*services.LocalBlobStore)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Not found",
+		})
+	}
+
+	key, err := url.PathUnescape(c.Params("*"))
+	if err != nil || !local.VerifySignature(key, c.Query("expires"), c.Query("signature")) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Invalid or expired link",
+		})
+	}
+
+	p, err := local.Path(key)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Not found",
+		})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	return c.SendFile(p)
+}
+
+// RedirectToBlob sends clients of a public media path to the blob store
+// when it is not the local filesystem (public)
+func RedirectToBlob(c *fiber.Ctx) error {
+	key, err := services.BlobKeyForURL(c.Path())
+	if err != nil || !services.IsPublicBlob(key) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Not found",
+		})
+	}
+
+	target := services.Blobs().URL(key)
+	if target == "" || strings.HasPrefix(target, "/") {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Not found",
+		})
+	}
+	return c.Redirect(target, fiber.StatusFound)
+}
@@ -1,112 +1,182 @@
 package handlers
 
 import (
-	"fmt"
 	"strconv"
-	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/mazong/angel_event/internal/database"
 	"github.com/mazong/angel_event/internal/models"
 	"github.com/mazong/angel_event/internal/services"
+	"gorm.io/gorm"
 )
 
 var emailService = services.NewEmailService()
 
 // CreateBookingRequest represents a booking creation request
 type CreateBookingRequest struct {
-	Name            string  `json:"name"`
-	Email           string  `json:"email"`
-	Phone           string  `json:"phone"`
-	EventDate       string  `json:"event_date"`
-	EventType       string  `json:"event_type"`
-	EventLocation   string  `json:"event_location"`
-	GuestCount      int     `json:"guest_count"`
-	Budget          float64 `json:"budget"`
-	Message         string  `json:"message"`
-	SpecialRequests string  `json:"special_requests"`
-	Language        string  `json:"language"`
-	RentalItemIDs   []uint  `json:"rental_item_ids"`
+	Name            string  `json:"name" validate:"required,max=100"`
+	Email           string  `json:"email" validate:"required,email"`
+	Phone           string  `json:"phone" validate:"phone"`
+	EventDate       string  `json:"event_date" validate:"required,date"`
+	EventType       string  `json:"event_type" validate:"required,oneof=proposal wedding birthday baby_shower corporate other"`
+	EventLocation   string  `json:"event_location" validate:"max=255"`
+	GuestCount      int     `json:"guest_count" validate:"min=0,max=10000"`
+	Budget          float64 `json:"budget" validate:"min=0,max=1000000"`
+	Message         string  `json:"message" validate:"max=5000"`
+	SpecialRequests string  `json:"special_requests" validate:"max=5000"`
+	Language        string  `json:"language" validate:"oneof=fr en"`
+	RentalItemIDs   []uint  `json:"rental_item_ids" validate:"max=50"`
+	// HoldToken converts a date hold taken earlier in the booking flow
+	HoldToken string `json:"hold_token" validate:"max=128"`
+	ClientSourceFields
+	SpamFields
+}
+
+// checkBookingAvailability verifies the date and rental items can still be
+// booked, counting on the client's hold when one is presented. It returns
+// the hold and the rental items to attach. Call it under the availability lock.
+func checkBookingAvailability(date models.Date, req *CreateBookingRequest) (*models.DateHold, []models.RentalItem, error) {
+	var hold *models.DateHold
+	if req.HoldToken != "" {
+		h, err := services.FindActiveHold(req.HoldToken)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !h.Date.Equal(date) {
+			return nil, nil, services.ErrHoldNotActive
+		}
+		hold = h
+	} else {
+		// Rules, date overrides and remaining capacity
+		day, err := services.ResolveDate(date)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !day.Available {
+			return nil, nil, services.ErrDateUnavailable
+		}
+	}
+
+	// The items held come with the hold unless the client picked others
+	ids := req.RentalItemIDs
+	var holdID uint
+	if hold != nil {
+		holdID = hold.ID
+		if len(ids) == 0 {
+			for _, item := range hold.RentalItems {
+				ids = append(ids, item.ID)
+			}
+		}
+	}
+
+	items, err := services.LoadRentalItems(ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := services.CheckRentalStock(date, items, holdID); err != nil {
+		return nil, nil, err
+	}
+
+	return hold, items, nil
 }
 
 // CreateBooking creates a new booking
 func CreateBooking(c *fiber.Ctx) error {
 	var req CreateBookingRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+	if verr := bindRequest(c, &req); verr != nil {
+		return verr.Send(c)
 	}
 
 	// Parse event date
-	eventDate, err := time.Parse("2006-01-02", req.EventDate)
+	eventDate, err := models.ParseDate(req.EventDate)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid date format",
-		})
+		return fieldError(c, "event_date", "date").Send(c)
+	}
+	if eventDate.Before(services.Today()) {
+		return fieldError(c, "event_date", "past_date").Send(c)
 	}
 
-	// Check availability
-	var availability models.Availability
-	result := database.DB.Where("date = ?", eventDate.Format("2006-01-02")).First(&availability)
+	if done, err := screenSubmission(c, services.FormBooking, &req, req.Email,
+		req.Name, req.EventLocation, req.Message, req.SpecialRequests); done {
+		return err
+	}
 
-	if result.Error == nil && !availability.Available {
-		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
-			"error": "Cette date n'est pas disponible",
-		})
+	booking, err := createBooking(eventDate, &req)
+	if err != nil {
+		return availabilityErrorResponse(c, err, "Failed to create booking")
 	}
 
-	// Find or create client
-	var client models.Client
-	result = database.DB.Where("email = ?", req.Email).First(&client)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"booking": booking,
+		"message": "Booking created successfully",
+	})
+}
 
-	if result.Error != nil {
-		// Create new client
-		client = models.Client{
-			Name:  req.Name,
-			Email: req.Email,
-			Phone: req.Phone,
+// createBooking books a validated request and sends the confirmation and
+// admin emails
+func createBooking(eventDate models.Date, req *CreateBookingRequest) (*models.Booking, error) {
+	// Check availability and create the booking under the availability
+	// lock, so the last slot of a date cannot be taken twice
+	var (
+		client  *models.Client
+		booking models.Booking
+	)
+	err := services.WithAvailabilityLock(func() error {
+		hold, rentalItems, err := checkBookingAvailability(eventDate, req)
+		if err != nil {
+			return err
 		}
-		if err := database.DB.Create(&client).Error; err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to create client",
-			})
+
+		// Find or create client with the name and phone given now; booking
+		// turns a prospect into a customer
+		client, err = services.FindOrCreateClient(database.DB, services.ClientDetails{
+			Name:         req.Name,
+			Email:        req.Email,
+			Phone:        req.Phone,
+			Source:       models.ClientSource(req.Source),
+			SourceDetail: req.SourceDetail,
+		}, false, true)
+		if err != nil {
+			return err
+		}
+		if err := services.PromoteProspect(database.DB, client); err != nil {
+			return err
 		}
-	}
 
-	// Calculate deposit (30% of budget)
-	depositAmount := req.Budget * 0.30
-
-	// Create booking
-	booking := models.Booking{
-		ClientID:        client.ID,
-		EventDate:       eventDate,
-		EventType:       models.EventType(req.EventType),
-		EventLocation:   req.EventLocation,
-		GuestCount:      req.GuestCount,
-		Budget:          req.Budget,
-		Message:         req.Message,
-		SpecialRequests: req.SpecialRequests,
-		Status:          models.BookingStatusPending,
-		TotalAmount:     req.Budget,
-		DepositAmount:   depositAmount,
-	}
-
-	// Associate rental items if selected
-	if len(req.RentalItemIDs) > 0 {
-		var rentalItems []models.RentalItem
-		if err := database.DB.Where("id IN ?", req.RentalItemIDs).Find(&rentalItems).Error; err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to fetch rental items",
-			})
+		// Calculate deposit (30% of budget)
+		depositAmount := req.Budget * 0.30
+
+		booking = models.Booking{
+			ClientID:        client.ID,
+			EventDate:       eventDate,
+			EventType:       models.EventType(req.EventType),
+			EventLocation:   req.EventLocation,
+			GuestCount:      req.GuestCount,
+			Budget:          req.Budget,
+			Message:         req.Message,
+			SpecialRequests: req.SpecialRequests,
+			Status:          models.BookingStatusPending,
+			TotalAmount:     req.Budget,
+			DepositAmount:   depositAmount,
+			Language:        req.Language,
+			RentalItems:     rentalItems,
 		}
-		booking.RentalItems = rentalItems
-	}
 
-	if err := database.DB.Create(&booking).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create booking",
+		return database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&booking).Error; err != nil {
+				return err
+			}
+			if err := services.RecordStatusChange(tx, &booking, "", nil); err != nil {
+				return err
+			}
+			if hold != nil {
+				return services.ConvertDateHold(tx, hold, booking.ID)
+			}
+			return nil
 		})
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	// Send confirmation email to client
@@ -114,8 +184,9 @@ func CreateBooking(c *fiber.Ctx) error {
 		client.Email,
 		client.Name,
 		string(booking.EventType),
-		eventDate.Format("2 January 2006"),
+		eventDate.Time().Format("2 January 2006"),
 		req.Language,
+		services.ReplyAddress(services.ReplyBooking, booking.ID),
 	)
 
 	// Send notification email to admin
@@ -124,7 +195,7 @@ func CreateBooking(c *fiber.Ctx) error {
 		client.Email,
 		client.Phone,
 		string(booking.EventType),
-		eventDate.Format("2 January 2006"),
+		eventDate.Time().Format("2 January 2006"),
 		req.EventLocation,
 		req.GuestCount,
 		req.Budget,
@@ -140,38 +211,58 @@ func CreateBooking(c *fiber.Ctx) error {
 		ClientID: &client.ID,
 	})
 
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"booking": booking,
-		"message": "Booking created successfully",
-	})
+	return &booking, nil
+}
+
+// bookingSortFields lists the sortable booking fields
+var bookingSortFields = SortFields{
+	"event_date":   "event_date",
+	"created_at":   "created_at",
+	"status":       "status",
+	"total_amount": "total_amount",
+	"guest_count":  "guest_count",
 }
 
-// GetBookings returns all bookings (admin only)
+// GetBookings returns a page of bookings, hiding archived ones unless
+// ?archived=true (admin only)
 func GetBookings(c *fiber.Ctx) error {
 	var bookings []models.Booking
 
-	query := database.DB.Preload("Client").Preload("RentalItems")
+	query := database.DB.Model(&models.Booking{}).Preload("Client").Preload("RentalItems")
 
 	// Filter by status if provided
 	if status := c.Query("status"); status != "" {
 		query = query.Where("status = ?", status)
 	}
 
+	// Archived bookings are listed with ?archived=true only
+	if c.QueryBool("archived") {
+		query = query.Where("archived_at IS NOT NULL")
+	} else {
+		query = query.Where("archived_at IS NULL")
+	}
+
 	// Filter by date range
 	if startDate := c.Query("start_date"); startDate != "" {
-		query = query.Where("event_date >= ?", startDate)
+		date, err := models.ParseDate(startDate)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid start_date format",
+			})
+		}
+		query = query.Where("event_date >= ?", date)
 	}
 	if endDate := c.Query("end_date"); endDate != "" {
-		query = query.Where("event_date <= ?", endDate)
-	}
-
-	if err := query.Order("event_date DESC").Find(&bookings).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to fetch bookings",
-		})
+		date, err := models.ParseDate(endDate)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid end_date format",
+			})
+		}
+		query = query.Where("event_date <= ?", date)
 	}
 
-	return c.JSON(bookings)
+	return respondPage(c, query, "bookings", bookingSortFields, "-event_date", &bookings, "Failed to fetch bookings")
 }
 
 // GetBooking returns a single booking
@@ -221,15 +312,43 @@ func UpdateBookingStatus(c *fiber.Ctx) error {
 		})
 	}
 
+	cancelled := booking.Status != models.BookingStatusCancelled &&
+		models.BookingStatus(req.Status) == models.BookingStatusCancelled
+
+	previous := booking.Status
 	booking.Status = models.BookingStatus(req.Status)
 	booking.AdminNotes = req.AdminNotes
+	if booking.Status != models.BookingStatusCompleted {
+		// A reopened booking comes back to the list
+		booking.ArchivedAt = nil
+	}
 
-	if err := database.DB.Save(&booking).Error; err != nil {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&booking).Error; err != nil {
+			return err
+		}
+		if err := services.RecordStatusChange(tx, &booking, previous, currentUserID(c)); err != nil {
+			return err
+		}
+		// A completed booking gets its review link, sent with the thank-you
+		if booking.Status == models.BookingStatusCompleted {
+			if _, err := services.IssueReviewInvitation(tx, &booking); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to update booking",
 		})
 	}
 
+	// A cancellation frees a slot for the waitlist
+	if cancelled {
+		go processWaitlist(booking.EventDate)
+	}
+
 	return c.JSON(booking)
 }
 
@@ -242,37 +361,26 @@ func CheckAvailability(c *fiber.Ctx) error {
 		})
 	}
 
-	date, err := time.Parse("2006-01-02", dateStr)
+	date, err := models.ParseDate(dateStr)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid date format",
 		})
 	}
 
-	var availability models.Availability
-	result := database.DB.Where("date = ?", date.Format("2006-01-02")).First(&availability)
-
-	if result.Error != nil {
-		// No specific availability set, assume available
-		return c.JSON(fiber.Map{
-			"available": true,
-			"date":      dateStr,
+	day, err := services.ResolveDate(date)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check availability",
 		})
 	}
 
-	// Check if max events reached
-	var bookingCount int64
-	database.DB.Model(&models.Booking{}).
-		Where("event_date = ? AND status != ?", date.Format("2006-01-02"), models.BookingStatusCancelled).
-		Count(&bookingCount)
-
-	available := availability.Available && int(bookingCount) < availability.MaxEvents
-
 	return c.JSON(fiber.Map{
-		"available":  available,
+		"available":  day.Available,
 		"date":       dateStr,
-		"max_events": availability.MaxEvents,
-		"booked":     bookingCount,
+		"max_events": day.MaxEvents,
+		"booked":     day.Booked,
+		"remaining":  day.Remaining,
 	})
 }
 
@@ -280,13 +388,15 @@ func CheckAvailability(c *fiber.Ctx) error {
 func GetAvailabilities(c *fiber.Ctx) error {
 	var availabilities []models.Availability
 
-	// Get month parameter
-	month := c.Query("month", time.Now().Format("2006-01"))
-
-	startDate := fmt.Sprintf("%s-01", month)
-	endDate := fmt.Sprintf("%s-31", month)
+	// Get month parameter, defaulting to the current business month
+	first, last, err := models.MonthRange(c.Query("month", services.CurrentMonth()))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid month format",
+		})
+	}
 
-	if err := database.DB.Where("date >= ? AND date <= ?", startDate, endDate).
+	if err := database.DB.Where("date >= ? AND date <= ?", first, last).
 		Order("date ASC").
 		Find(&availabilities).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -313,12 +423,18 @@ func UpdateAvailability(c *fiber.Ctx) error {
 		})
 	}
 
+	date, err := models.ParseDate(req.Date)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid date format",
+		})
+	}
+
 	var availability models.Availability
-	result := database.DB.Where("date = ?", req.Date).First(&availability)
+	result := database.DB.Where("date = ?", date).First(&availability)
 
 	if result.Error != nil {
 		// Create new
-		date, _ := time.Parse("2006-01-02", req.Date)
 		availability = models.Availability{
 			Date:      date,
 			Available: req.Available,
@@ -330,11 +446,18 @@ func UpdateAvailability(c *fiber.Ctx) error {
 				"error": "Failed to create availability",
 			})
 		}
+		// GORM writes the column default for a false Available on create
+		if !req.Available {
+			database.DB.Model(&availability).Update("available", false)
+		}
 	} else {
-		// Update existing
+		// Update existing; editing an imported date turns it into a manual
+		// override that later calendar syncs leave alone
 		availability.Available = req.Available
 		availability.MaxEvents = req.MaxEvents
 		availability.Notes = req.Notes
+		availability.Source = models.AvailabilitySourceManual
+		availability.CalendarImportID = nil
 		if err := database.DB.Save(&availability).Error; err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Failed to update availability",
@@ -342,5 +465,8 @@ func UpdateAvailability(c *fiber.Ctx) error {
 		}
 	}
 
+	// Raised capacity may go to the waitlist
+	go processWaitlist(date)
+
 	return c.JSON(availability)
 }
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"github.com/mazong/angel_event/internal/services"
+)
+
+// calendarTokenBytes is the size of calendar feed tokens (256 bits)
+const calendarTokenBytes = 32
+
+// calendarFeedResponse adds the subscription URL to a feed
+type calendarFeedResponse struct {
+	models.CalendarFeed
+	URL string `json:"url"`
+}
+
+func newCalendarFeedResponse(c *fiber.Ctx, feed models.CalendarFeed) calendarFeedResponse {
+	return calendarFeedResponse{
+		CalendarFeed: feed,
+		URL:          fmt.Sprintf("%s/api/public/calendar/%s.ics", c.BaseURL(), feed.Token),
+	}
+}
+
+// GetCalendarFeeds returns all calendar feeds (admin)
+func GetCalendarFeeds(c *fiber.Ctx) error {
+	var feeds []models.CalendarFeed
+	if err := database.DB.Order("created_at ASC").Find(&feeds).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch calendar feeds",
+		})
+	}
+
+	response := make([]calendarFeedResponse, len(feeds))
+	for i, feed := range feeds {
+		response[i] = newCalendarFeedResponse(c, feed)
+	}
+
+	return c.JSON(response)
+}
+
+// CreateCalendarFeed creates a feed with a fresh token (admin)
+func CreateCalendarFeed(c *fiber.Ctx) error {
+	type FeedRequest struct {
+		Name string                  `json:"name"`
+		Kind models.CalendarFeedKind `json:"kind"`
+	}
+
+	var req FeedRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Kind != models.CalendarFeedBookings && req.Kind != models.CalendarFeedAvailability {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Kind must be bookings or availability",
+		})
+	}
+	if req.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Name is required",
+		})
+	}
+
+	token, err := services.RandomToken(calendarTokenBytes)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate feed token",
+		})
+	}
+
+	feed := models.CalendarFeed{Name: req.Name, Kind: req.Kind, Token: token}
+	if err := database.DB.Create(&feed).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create calendar feed",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(newCalendarFeedResponse(c, feed))
+}
+
+// RegenerateCalendarFeedToken replaces the token, invalidating the old URL (admin)
+func RegenerateCalendarFeedToken(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid feed ID",
+		})
+	}
+
+	var feed models.CalendarFeed
+	if err := database.DB.First(&feed, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Calendar feed not found",
+		})
+	}
+
+	token, err := services.RandomToken(calendarTokenBytes)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate feed token",
+		})
+	}
+
+	feed.Token = token
+	if err := database.DB.Save(&feed).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update calendar feed",
+		})
+	}
+
+	return c.JSON(newCalendarFeedResponse(c, feed))
+}
+
+// DeleteCalendarFeed revokes a feed (admin)
+func DeleteCalendarFeed(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid feed ID",
+		})
+	}
+
+	// Hard delete so the token can never be served again
+	if err := database.DB.Unscoped().Delete(&models.CalendarFeed{}, id).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete calendar feed",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Calendar feed deleted successfully",
+	})
+}
+
+// GetCalendarFeedICS serves a feed as an iCalendar file (public, token-protected)
+func GetCalendarFeedICS(c *fiber.Ctx) error {
+	var feed models.CalendarFeed
+	if err := database.DB.Where("token = ?", c.Params("token")).First(&feed).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Calendar feed not found",
+		})
+	}
+
+	var (
+		events []services.ICalEvent
+		name   string
+		err    error
+	)
+	switch feed.Kind {
+	case models.CalendarFeedAvailability:
+		events, err = services.AvailabilityCalendarEvents()
+		name = "Angel Event - Dates bloquées"
+	default:
+		events, err = services.BookingCalendarEvents()
+		name = "Angel Event - Réservations"
+	}
+	if err != nil {
+		log.Printf("Failed to build calendar feed %d: %v", feed.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to build calendar feed",
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := services.WriteICalendar(&buf, name, events); err != nil {
+		log.Printf("Failed to write calendar feed %d: %v", feed.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to build calendar feed",
+		})
+	}
+
+	now := time.Now()
+	database.DB.Model(&feed).UpdateColumn("last_accessed_at", &now)
+
+	c.Set(fiber.HeaderContentType, "text/calendar; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`inline; filename="angel-event-%s.ics"`, feed.Kind))
+	c.Set(fiber.HeaderCacheControl, "private, max-age=300")
+
+	return c.Send(buf.Bytes())
+}
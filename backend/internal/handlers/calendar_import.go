@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"github.com/mazong/angel_event/internal/services"
+)
+
+// calendarImportResponse returns an import with the outcome of its latest sync
+type calendarImportResponse struct {
+	models.CalendarImport
+	Sync *services.CalendarImportResult `json:"sync,omitempty"`
+}
+
+// GetCalendarImports returns all imported calendars (admin)
+func GetCalendarImports(c *fiber.Ctx) error {
+	var imports []models.CalendarImport
+	if err := database.DB.Order("created_at ASC").Find(&imports).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch calendar imports",
+		})
+	}
+
+	return c.JSON(imports)
+}
+
+// CreateCalendarImport subscribes to a calendar URL, or imports an uploaded
+// .ics file sent as multipart "file", then syncs it right away (admin)
+func CreateCalendarImport(c *fiber.Ctx) error {
+	type ImportRequest struct {
+		Name string `json:"name" form:"name"`
+		URL  string `json:"url" form:"url"`
+	}
+
+	var req ImportRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if req.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Name is required",
+		})
+	}
+
+	imp := models.CalendarImport{Name: req.Name, Enabled: true}
+	if file, err := c.FormFile("file"); err == nil {
+		key, err := services.SaveCalendarUpload(c.Context(), file)
+		if err != nil {
+			return uploadErrorResponse(c, err)
+		}
+		imp.FileKey = key
+	} else {
+		url, err := services.NormalizeCalendarURL(req.URL)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "A valid calendar URL or .ics file is required",
+			})
+		}
+		imp.URL = url
+	}
+
+	if err := database.DB.Create(&imp).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create calendar import",
+		})
+	}
+
+	// A failed first sync is recorded on the import, not a creation error
+	result, _ := services.SyncCalendarImport(c.Context(), &imp)
+	database.DB.First(&imp, imp.ID)
+
+	return c.Status(fiber.StatusCreated).JSON(calendarImportResponse{CalendarImport: imp, Sync: result})
+}
+
+// UpdateCalendarImport renames, re-targets or pauses an import (admin)
+func UpdateCalendarImport(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid import ID",
+		})
+	}
+
+	var imp models.CalendarImport
+	if err := database.DB.First(&imp, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Calendar import not found",
+		})
+	}
+
+	type ImportRequest struct {
+		Name    *string `json:"name"`
+		URL     *string `json:"url"`
+		Enabled *bool   `json:"enabled"`
+	}
+
+	var req ImportRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Name != nil && *req.Name != "" {
+		imp.Name = *req.Name
+	}
+	if req.URL != nil {
+		if imp.FileKey != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Uploaded calendars have no URL",
+			})
+		}
+		url, err := services.NormalizeCalendarURL(*req.URL)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if url != imp.URL {
+			imp.URL = url
+			imp.ETag = ""
+			imp.LastModified = ""
+		}
+	}
+	if req.Enabled != nil {
+		imp.Enabled = *req.Enabled
+	}
+
+	if err := database.DB.Save(&imp).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update calendar import",
+		})
+	}
+
+	// A paused calendar no longer blocks dates; other calendars may claim them
+	if !imp.Enabled {
+		if err := services.RemoveCalendarImportDates(imp.ID); err != nil {
+			log.Printf("Failed to unblock dates of calendar import %d: %v", imp.ID, err)
+		}
+		go services.SyncCalendarImports(context.Background())
+	}
+
+	return c.JSON(imp)
+}
+
+// SyncCalendarImport syncs one import now (admin)
+func SyncCalendarImport(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid import ID",
+		})
+	}
+
+	var imp models.CalendarImport
+	if err := database.DB.First(&imp, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Calendar import not found",
+		})
+	}
+
+	// A manual sync always downloads the full calendar
+	imp.ETag = ""
+	imp.LastModified = ""
+
+	result, err := services.SyncCalendarImport(c.Context(), &imp)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "Calendar sync failed: " + err.Error(),
+		})
+	}
+
+	database.DB.First(&imp, imp.ID)
+	return c.JSON(calendarImportResponse{CalendarImport: imp, Sync: result})
+}
+
+// DeleteCalendarImport removes an import and unblocks its upcoming dates (admin)
+func DeleteCalendarImport(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid import ID",
+		})
+	}
+
+	var imp models.CalendarImport
+	if err := database.DB.First(&imp, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Calendar import not found",
+		})
+	}
+
+	if err := services.RemoveCalendarImportDates(imp.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to unblock imported dates",
+		})
+	}
+
+	if err := database.DB.Delete(&imp).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete calendar import",
+		})
+	}
+
+	if imp.FileKey != "" {
+		if err := services.Blobs().Delete(context.Background(), imp.FileKey); err != nil {
+			log.Printf("Failed to delete calendar file %s: %v", imp.FileKey, err)
+		}
+	}
+
+	// Other calendars may block the released dates
+	go services.SyncCalendarImports(context.Background())
+
+	return c.JSON(fiber.Map{
+		"message": "Calendar import deleted successfully",
+	})
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"strconv"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/mazong/angel_event/internal/database"
@@ -100,3 +101,85 @@ func DeleteCategory(c *fiber.Ctx) error {
 		"message": "Category deleted successfully",
 	})
 }
+
+// GetCategoryDirectories returns the storage folder to gallery category mappings
+func GetCategoryDirectories(c *fiber.Ctx) error {
+	var dirs []models.CategoryDirectory
+	if err := database.DB.Preload("Category").Order("directory ASC").Find(&dirs).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch category directories",
+		})
+	}
+
+	return c.JSON(dirs)
+}
+
+// SaveCategoryDirectory creates or updates the mapping for a storage folder
+func SaveCategoryDirectory(c *fiber.Ctx) error {
+	type DirectoryRequest struct {
+		Directory  string `json:"directory"`
+		CategoryID uint   `json:"category_id"`
+	}
+
+	var req DirectoryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	directory := strings.ToLower(strings.TrimSpace(req.Directory))
+	if directory == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Directory is required",
+		})
+	}
+
+	var category models.Category
+	if err := database.DB.Where("type = ?", "gallery").First(&category, req.CategoryID).Error; err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Gallery category not found",
+		})
+	}
+
+	var mapping models.CategoryDirectory
+	result := database.DB.Where("directory = ?", directory).First(&mapping)
+	mapping.Directory = directory
+	mapping.CategoryID = category.ID
+
+	if result.Error != nil {
+		if err := database.DB.Create(&mapping).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to create category directory",
+			})
+		}
+	} else if err := database.DB.Save(&mapping).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update category directory",
+		})
+	}
+
+	mapping.Category = category
+	return c.JSON(mapping)
+}
+
+// DeleteCategoryDirectory removes a storage folder mapping
+func DeleteCategoryDirectory(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid directory ID",
+		})
+	}
+
+	// Hard delete so the directory name can be mapped again
+	if err := database.DB.Unscoped().Delete(&models.CategoryDirectory{}, id).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete category directory",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Category directory deleted successfully",
+	})
+}
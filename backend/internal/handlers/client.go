@@ -0,0 +1,372 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"github.com/mazong/angel_event/internal/services"
+	"gorm.io/gorm"
+)
+
+// ClientSourceFields tell how a client found us, on public forms
+type ClientSourceFields struct {
+	Source string `json:"source" validate:"oneof=instagram facebook google referral website wedding_fair other"`
+	// SourceDetail names the referrer, campaign or fair
+	SourceDetail string `json:"source_detail" validate:"max=200"`
+}
+
+// loadClient finds the client of the :id parameter, writing the error
+// response when it returns nil
+func loadClient(c *fiber.Ctx) (*models.Client, error) {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid client ID",
+		})
+	}
+
+	var client models.Client
+	if err := database.DB.First(&client, id).Error; err != nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Client not found",
+		})
+	}
+	return &client, nil
+}
+
+// loadWritableClient is loadClient for handlers writing to the client:
+// erased clients are refused with a 409, so that nothing puts personal
+// data back on them
+func loadWritableClient(c *fiber.Ctx) (*models.Client, error) {
+	client, err := loadClient(c)
+	if client == nil {
+		return nil, err
+	}
+	if client.ErasedAt != nil {
+		return nil, c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": services.ErrClientErased.Error(),
+		})
+	}
+	return client, nil
+}
+
+// SetClientTagsRequest lists the tag names of a client
+type SetClientTagsRequest struct {
+	Tags []string `json:"tags" validate:"max=20"`
+}
+
+// GetTags returns every client tag with the number of clients carrying it
+// (admin)
+func GetTags(c *fiber.Ctx) error {
+	type TagCount struct {
+		models.Tag
+		ClientCount int64 `json:"client_count"`
+	}
+
+	var tags []TagCount
+	if err := database.DB.Model(&models.Tag{}).
+		Select("tags.*, COUNT(clients.id) AS client_count").
+		Joins("LEFT JOIN client_tags ON client_tags.tag_id = tags.id").
+		Joins("LEFT JOIN clients ON clients.id = client_tags.client_id AND clients.deleted_at IS NULL").
+		Group("tags.id").
+		Order("tags.name").
+		Scan(&tags).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch tags",
+		})
+	}
+
+	return c.JSON(tags)
+}
+
+// UpdateTag renames or recolors a tag (admin)
+func UpdateTag(c *fiber.Ctx) error {
+	var tag models.Tag
+	if err := database.DB.First(&tag, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Tag not found",
+		})
+	}
+
+	type UpdateTagRequest struct {
+		Name  string `json:"name" validate:"required,max=50"`
+		Color string `json:"color" validate:"max=20"`
+	}
+
+	var req UpdateTagRequest
+	if verr := bindRequest(c, &req); verr != nil {
+		return verr.Send(c)
+	}
+
+	tag.Name = strings.ToLower(req.Name)
+	tag.Color = req.Color
+	if err := database.DB.Save(&tag).Error; err != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "A tag with this name already exists",
+		})
+	}
+
+	return c.JSON(tag)
+}
+
+// DeleteTag removes a tag from every client (admin)
+func DeleteTag(c *fiber.Ctx) error {
+	var tag models.Tag
+	if err := database.DB.First(&tag, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Tag not found",
+		})
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM client_tags WHERE tag_id = ?", tag.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&tag).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete tag",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Tag deleted successfully",
+	})
+}
+
+// SetClientTags replaces the tags of a client, creating unknown tags (admin)
+func SetClientTags(c *fiber.Ctx) error {
+	client, err := loadWritableClient(c)
+	if client == nil {
+		return err
+	}
+
+	var req SetClientTagsRequest
+	if verr := bindRequest(c, &req); verr != nil {
+		return verr.Send(c)
+	}
+
+	tags := []models.Tag{}
+	seen := make(map[string]bool)
+	for _, name := range req.Tags {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		tag := models.Tag{Name: name}
+		if err := database.DB.Where("name = ?", name).FirstOrCreate(&tag).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to save tags",
+			})
+		}
+		tags = append(tags, tag)
+	}
+
+	if err := database.DB.Model(client).Association("Tags").Replace(tags); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save tags",
+		})
+	}
+
+	return c.JSON(tags)
+}
+
+// ClientContactRequest describes a secondary contact of a client
+type ClientContactRequest struct {
+	Role  string `json:"role" validate:"required,oneof=partner family planner other"`
+	Name  string `json:"name" validate:"required,max=100"`
+	Email string `json:"email" validate:"email,max=255"`
+	Phone string `json:"phone" validate:"phone"`
+}
+
+// emailTaken tells whether an address already reaches another client, as
+// its own email or one of its contacts
+func emailTaken(email string, clientID uint) bool {
+	if email == "" {
+		return false
+	}
+	client, err := services.FindClientByEmail(database.DB, email)
+	return err == nil && client.ID != clientID
+}
+
+// CreateClientContact adds a secondary contact, such as a partner, to a
+// client (admin)
+func CreateClientContact(c *fiber.Ctx) error {
+	client, err := loadWritableClient(c)
+	if client == nil {
+		return err
+	}
+
+	var req ClientContactRequest
+	if verr := bindRequest(c, &req); verr != nil {
+		return verr.Send(c)
+	}
+
+	if emailTaken(req.Email, client.ID) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "This email belongs to another client; merge the clients instead",
+		})
+	}
+
+	contact := models.ClientContact{
+		ClientID: client.ID,
+		Role:     models.ContactRole(req.Role),
+		Name:     req.Name,
+		Email:    req.Email,
+		Phone:    req.Phone,
+	}
+	if err := database.DB.Create(&contact).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create contact",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(contact)
+}
+
+// loadClientContact finds the contact :contactId of the client :id, which
+// must not be erased
+func loadClientContact(c *fiber.Ctx) (*models.ClientContact, error) {
+	client, err := loadWritableClient(c)
+	if client == nil {
+		return nil, err
+	}
+
+	var contact models.ClientContact
+	if err := database.DB.Where("client_id = ?", client.ID).
+		First(&contact, c.Params("contactId")).Error; err != nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Contact not found",
+		})
+	}
+	return &contact, nil
+}
+
+// UpdateClientContact edits a secondary contact (admin)
+func UpdateClientContact(c *fiber.Ctx) error {
+	contact, err := loadClientContact(c)
+	if contact == nil {
+		return err
+	}
+
+	var req ClientContactRequest
+	if verr := bindRequest(c, &req); verr != nil {
+		return verr.Send(c)
+	}
+
+	if !strings.EqualFold(req.Email, contact.Email) && emailTaken(req.Email, contact.ClientID) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "This email belongs to another client; merge the clients instead",
+		})
+	}
+
+	contact.Role = models.ContactRole(req.Role)
+	contact.Name = req.Name
+	contact.Email = req.Email
+	contact.Phone = req.Phone
+	if err := database.DB.Save(contact).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update contact",
+		})
+	}
+
+	return c.JSON(contact)
+}
+
+// DeleteClientContact removes a secondary contact (admin)
+func DeleteClientContact(c *fiber.Ctx) error {
+	contact, err := loadClientContact(c)
+	if contact == nil {
+		return err
+	}
+
+	if err := database.DB.Delete(contact).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete contact",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Contact deleted successfully",
+	})
+}
+
+// GetDuplicateClients lists the pairs of clients that are likely the same
+// person or couple, scoring at least ?min_score= (0.6 by default) (admin)
+func GetDuplicateClients(c *fiber.Ctx) error {
+	pairs, err := services.FindDuplicateClients(0, duplicateMinScore(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find duplicates",
+		})
+	}
+	return c.JSON(pairs)
+}
+
+// GetClientDuplicates lists the likely duplicates of one client (admin)
+func GetClientDuplicates(c *fiber.Ctx) error {
+	client, err := loadClient(c)
+	if client == nil {
+		return err
+	}
+
+	pairs, err := services.FindDuplicateClients(client.ID, duplicateMinScore(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find duplicates",
+		})
+	}
+	return c.JSON(pairs)
+}
+
+func duplicateMinScore(c *fiber.Ctx) float64 {
+	score := c.QueryFloat("min_score", services.DefaultDuplicateScore)
+	if score <= 0 || score > 1 {
+		return services.DefaultDuplicateScore
+	}
+	return score
+}
+
+// MergeClient merges the client of source_id into the client :id, which
+// keeps its identity and receives the source's bookings, testimonials,
+// emails and history (admin)
+func MergeClient(c *fiber.Ctx) error {
+	target, err := loadWritableClient(c)
+	if target == nil {
+		return err
+	}
+
+	type MergeRequest struct {
+		SourceID uint `json:"source_id" validate:"required"`
+	}
+
+	var req MergeRequest
+	if verr := bindRequest(c, &req); verr != nil {
+		return verr.Send(c)
+	}
+
+	merged, err := services.MergeClients(database.DB, target.ID, req.SourceID, currentUserID(c))
+	switch {
+	case errors.Is(err, services.ErrSameClient):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Client not found",
+		})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to merge clients",
+		})
+	}
+
+	return c.JSON(merged)
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"github.com/mazong/angel_event/internal/services"
+)
+
+func TestUpdateClient(t *testing.T) {
+	useTestDB(t)
+	app := newTestApp()
+	app.Put("/clients/:id", UpdateClient)
+
+	ana := models.Client{Name: "Ana", Email: "ana@example.com", Source: models.SourceInstagram}
+	bob := models.Client{Name: "Bob", Email: "bob@example.com"}
+	for _, client := range []*models.Client{&ana, &bob} {
+		if err := database.DB.Create(client).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := fmt.Sprintf("/clients/%d", ana.ID)
+
+	status, _ := send(t, app, http.MethodPut, path, "192.0.2.1", map[string]interface{}{
+		"name":  "Ana",
+		"email": "BOB@example.com",
+	}, nil)
+	if status != http.StatusConflict {
+		t.Errorf("taking another client's email = %d, want 409", status)
+	}
+
+	// Only the editable fields are taken from the body
+	status, body := send(t, app, http.MethodPut, path, "192.0.2.1", map[string]interface{}{
+		"id":        bob.ID,
+		"name":      "Ana Silva",
+		"email":     "ana.silva@example.com",
+		"phone":     "+33 6 12 34 56 78",
+		"source":    "google",
+		"erased_at": "2026-01-01T00:00:00Z",
+	}, nil)
+	if status != http.StatusOK || body["name"] != "Ana Silva" {
+		t.Fatalf("update = %d %v, want 200 with the new name", status, body)
+	}
+
+	var stored models.Client
+	database.DB.First(&stored, ana.ID)
+	if stored.Name != "Ana Silva" || stored.Email != "ana.silva@example.com" {
+		t.Errorf("stored client = %+v, want the new name and email", stored)
+	}
+	if stored.Source != models.SourceInstagram || stored.ErasedAt != nil {
+		t.Errorf("stored source %q, erased_at %v: want them unchanged", stored.Source, stored.ErasedAt)
+	}
+	var other models.Client
+	database.DB.First(&other, bob.ID)
+	if other.Name != "Bob" {
+		t.Errorf("the body's id updated client %d: %+v", bob.ID, other)
+	}
+
+	status, _ = send(t, app, http.MethodPut, path, "192.0.2.1", map[string]interface{}{"name": "Ana"}, nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("update without an email = %d, want 400", status)
+	}
+}
+
+func TestErasedClientWrites(t *testing.T) {
+	useTestDB(t)
+	app := newTestApp()
+	app.Put("/clients/:id", UpdateClient)
+	app.Put("/clients/:id/tags", SetClientTags)
+	app.Post("/clients/:id/contacts", CreateClientContact)
+	app.Put("/clients/:id/contacts/:contactId", UpdateClientContact)
+	app.Post("/clients/:id/notes", CreateClientNote)
+	app.Put("/clients/:id/notes/:noteId", UpdateClientNote)
+
+	client := models.Client{Name: "Ana", Email: "ana@example.com"}
+	if err := database.DB.Create(&client).Error; err != nil {
+		t.Fatal(err)
+	}
+	contact := models.ClientContact{ClientID: client.ID, Role: models.ContactPartner, Name: "Bruno"}
+	note := models.ClientNote{ClientID: client.ID, Body: "Prefers calls"}
+	database.DB.Create(&contact)
+	database.DB.Create(&note)
+	if _, err := services.EraseClient(client.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	base := fmt.Sprintf("/clients/%d", client.ID)
+	writes := []struct {
+		method, path string
+		body         map[string]interface{}
+	}{
+		{http.MethodPut, base, map[string]interface{}{"name": "Ana", "email": "ana@example.com", "erased_at": nil}},
+		{http.MethodPut, base + "/tags", map[string]interface{}{"tags": []string{"vip"}}},
+		{http.MethodPost, base + "/contacts", map[string]interface{}{"role": "partner", "name": "Bruno", "email": "bruno@example.com"}},
+		{http.MethodPut, fmt.Sprintf("%s/contacts/%d", base, contact.ID), map[string]interface{}{"role": "partner", "name": "Bruno"}},
+		{http.MethodPost, base + "/notes", map[string]interface{}{"body": "Ana Silva, 06 12 34 56 78"}},
+		{http.MethodPut, fmt.Sprintf("%s/notes/%d", base, note.ID), map[string]interface{}{"body": "Ana Silva"}},
+	}
+	for _, w := range writes {
+		if status, body := send(t, app, w.method, w.path, "192.0.2.2", w.body, nil); status != http.StatusConflict {
+			t.Errorf("%s %s on an erased client = %d %v, want 409", w.method, w.path, status, body)
+		}
+	}
+
+	var stored models.Client
+	database.DB.First(&stored, client.ID)
+	if stored.ErasedAt == nil || stored.Name == "Ana" {
+		t.Errorf("erased client was restored: %+v", stored)
+	}
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"github.com/mazong/angel_event/internal/services"
+)
+
+// availabilityErrorResponse maps capacity and hold errors to localized 409
+// responses, hold caps to a 429, a lock held by another instance to a 503,
+// and anything else to a 500 with the given message
+func availabilityErrorResponse(c *fiber.Ctx, err error, message string) error {
+	var rentalErr *services.RentalUnavailableError
+	switch {
+	case errors.Is(err, services.ErrDateUnavailable):
+		return conflict(c, "date_unavailable")
+	case errors.Is(err, services.ErrDateAvailable):
+		return conflict(c, "date_available")
+	case errors.Is(err, services.ErrTooManyHolds):
+		return tooManyRequests(c, "too_many_holds")
+	case errors.Is(err, services.ErrHoldNotActive):
+		return conflict(c, "hold_expired")
+	case errors.Is(err, services.ErrAvailabilityBusy):
+		text := localize(locale(c), "availability_busy", "")
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"code":    "availability_busy",
+			"message": text,
+			"error":   text,
+		})
+	case errors.As(err, &rentalErr):
+		text := localize(locale(c), "rental_unavailable", "")
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"code":    "rental_unavailable",
+			"message": text,
+			"error":   text,
+			"items":   rentalErr.Items,
+		})
+	}
+
+	log.Printf("%s: %v", message, err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": message,
+	})
+}
+
+// CreateDateHold reserves a date, and optionally rental items, while the
+// client completes the booking (public)
+func CreateDateHold(c *fiber.Ctx) error {
+	type HoldRequest struct {
+		Date          string `json:"date" validate:"required,date"`
+		Email         string `json:"email" validate:"email"`
+		RentalItemIDs []uint `json:"rental_item_ids" validate:"max=50"`
+	}
+
+	var req HoldRequest
+	if verr := bindRequest(c, &req); verr != nil {
+		return verr.Send(c)
+	}
+
+	date, err := models.ParseDate(req.Date)
+	if err != nil {
+		return fieldError(c, "date", "date").Send(c)
+	}
+	if date.Before(services.Today()) {
+		return fieldError(c, "date", "past_date").Send(c)
+	}
+
+	// Holds take capacity without any text to score: they only go through
+	// the submission rate limits, then the active hold caps
+	if err := services.CheckSubmissionRate(&services.Submission{
+		Form:  services.FormDateHold,
+		IP:    c.IP(),
+		Email: req.Email,
+	}); err != nil {
+		return tooManyRequests(c, "rate_limited")
+	}
+
+	hold, err := services.CreateDateHold(date, req.RentalItemIDs, req.Email, c.IP())
+	if err != nil {
+		return availabilityErrorResponse(c, err, "Failed to create hold")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(hold)
+}
+
+// GetDateHold returns a hold and its remaining time (public, token-protected)
+func GetDateHold(c *fiber.Ctx) error {
+	var hold models.DateHold
+	if err := database.DB.Preload("RentalItems").
+		Where("token = ?", c.Params("token")).First(&hold).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Hold not found",
+		})
+	}
+
+	// Lapsed holds may not have been swept yet
+	if hold.Status == models.DateHoldActive && !hold.ExpiresAt.After(time.Now()) {
+		hold.Status = models.DateHoldExpired
+	}
+
+	remaining := 0
+	if hold.Status == models.DateHoldActive {
+		remaining = int(time.Until(hold.ExpiresAt).Seconds())
+	}
+
+	return c.JSON(fiber.Map{
+		"hold":              hold,
+		"remaining_seconds": remaining,
+	})
+}
+
+// ReleaseDateHold gives a held date back before it expires (public, token-protected)
+func ReleaseDateHold(c *fiber.Ctx) error {
+	hold, err := services.ReleaseDateHold(c.Params("token"))
+	if err != nil {
+		if errors.Is(err, services.ErrHoldNotActive) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Hold not found or no longer active",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to release hold",
+		})
+	}
+
+	// The freed slot may go to the waitlist
+	go processWaitlist(hold.Date)
+
+	return c.JSON(fiber.Map{
+		"message": "Hold released successfully",
+	})
+}
+
+// dateHoldSortFields lists the sortable hold fields
+var dateHoldSortFields = SortFields{
+	"created_at": "created_at",
+	"date":       "date",
+	"expires_at": "expires_at",
+	"status":     "status",
+}
+
+// GetDateHolds returns a page of holds, optionally filtered by ?status=
+// (admin)
+func GetDateHolds(c *fiber.Ctx) error {
+	var holds []models.DateHold
+
+	query := database.DB.Model(&models.DateHold{}).Preload("RentalItems")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	return respondPage(c, query, "date_holds", dateHoldSortFields, "-created_at", &holds, "Failed to fetch holds")
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+)
+
+func TestCreateDateHold(t *testing.T) {
+	useTestDB(t)
+	app := newTestApp()
+	app.Post("/holds", CreateDateHold)
+	app.Get("/holds", GetDateHolds)
+
+	date := models.NewDate(2099, 10, 10)
+	if err := database.DB.Create(&models.Availability{Date: date, Available: true, MaxEvents: 10}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	hold := func(ip, email string) (int, map[string]interface{}) {
+		t.Helper()
+		return send(t, app, http.MethodPost, "/holds", ip, map[string]interface{}{
+			"date":  "2099-10-10",
+			"email": email,
+		}, map[string]string{"Accept-Language": "en"})
+	}
+
+	// DATE_HOLD_MAX_PER_EMAIL (2) active holds per email
+	for i := 0; i < 2; i++ {
+		if status, body := hold(fmt.Sprintf("198.51.100.3%d", i), "ana@example.com"); status != http.StatusCreated || body["token"] == nil {
+			t.Fatalf("hold %d = %d %v, want 201 with a token", i, status, body)
+		}
+	}
+	status, body := hold("198.51.100.32", "ana@example.com")
+	if status != http.StatusTooManyRequests || body["code"] != "too_many_holds" {
+		t.Errorf("third hold for the email = %d %v, want 429 too_many_holds", status, body)
+	}
+
+	// Capacity conflicts answer in the client's language
+	database.DB.Model(&models.Availability{}).Where("date = ?", date).Update("available", false)
+	status, body = hold("198.51.100.33", "bob@example.com")
+	if status != http.StatusConflict || body["code"] != "date_unavailable" || body["message"] != "This date is not available" {
+		t.Errorf("hold on a blocked date = %d %v, want an English date_unavailable 409", status, body)
+	}
+
+	// The admin list is paged like the other lists
+	status, body = send(t, app, http.MethodGet, "/holds?limit=1&sort=created_at", "192.0.2.1", nil, nil)
+	if status != http.StatusOK {
+		t.Fatalf("list = %d %v", status, body)
+	}
+	pagination, _ := body["pagination"].(map[string]interface{})
+	if data, _ := body["data"].([]interface{}); len(data) != 1 || pagination["total"] != float64(2) || pagination["has_more"] != true {
+		t.Errorf("list = %v, want the first of 2 holds", body)
+	}
+	if status, _ := send(t, app, http.MethodGet, "/holds?sort=ip", "192.0.2.1", nil, nil); status != http.StatusBadRequest {
+		t.Errorf("sorting on a field outside the whitelist = %d, want 400", status)
+	}
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"github.com/mazong/angel_event/internal/services"
+	"gorm.io/gorm"
+)
+
+// inboundAttachmentURLTTL is how long attachment download links stay valid
+const inboundAttachmentURLTTL = originalURLTTL
+
+// ReceiveInboundEmail ingests a raw RFC 822 message posted by a mail
+// provider webhook. The body is the message itself, or a multipart form
+// with the message in an "email" field or file. The provider authenticates
+// with INBOUND_EMAIL_SECRET in the X-Inbound-Secret header or ?secret=.
+func ReceiveInboundEmail(c *fiber.Ctx) error {
+	secret := os.Getenv("INBOUND_EMAIL_SECRET")
+	if secret == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Inbound email is not enabled",
+		})
+	}
+	given := c.Get("X-Inbound-Secret", c.Query("secret"))
+	if subtle.ConstantTimeCompare([]byte(given), []byte(secret)) != 1 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid inbound secret",
+		})
+	}
+
+	raw, err := inboundMessage(c)
+	if err != nil || len(raw) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Missing email message",
+		})
+	}
+
+	email, err := services.IngestEmail(raw, models.InboundWebhook)
+	switch {
+	case errors.Is(err, services.ErrDuplicateEmail):
+		// Providers retry until they get a success
+		return c.JSON(fiber.Map{
+			"message": "Email already received",
+		})
+	case errors.Is(err, services.ErrInvalidEmail):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case err != nil:
+		log.Printf("Failed to ingest inbound email: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to store email",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"id":         email.ID,
+		"matched_by": email.MatchedBy,
+		"client_id":  email.ClientID,
+	})
+}
+
+// inboundMessage returns the raw message of a webhook request
+func inboundMessage(c *fiber.Ctx) ([]byte, error) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		// Not a form: the body is the message
+		return c.Body(), nil
+	}
+
+	if values := form.Value["email"]; len(values) > 0 {
+		return []byte(values[0]), nil
+	}
+	files := form.File["email"]
+	if len(files) == 0 {
+		return nil, errors.New("no email field")
+	}
+	f, err := files[0].Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// inboundEmailSortFields lists the sortable inbound email fields
+var inboundEmailSortFields = SortFields{
+	"created_at": "created_at",
+	"sent_at":    "sent_at",
+	"from_email": "from_email",
+}
+
+// GetInboundEmails returns a page of received emails, filtered by
+// ?client_id=, ?booking_id=, ?matched_by= (unmatched lists the emails to
+// assign) and ?search= on sender or subject (admin)
+func GetInboundEmails(c *fiber.Ctx) error {
+	var emails []models.InboundEmail
+
+	query := database.DB.Model(&models.InboundEmail{}).Preload("Client").Preload("Attachments")
+	if clientID := c.QueryInt("client_id"); clientID > 0 {
+		query = query.Where("client_id = ?", clientID)
+	}
+	if bookingID := c.QueryInt("booking_id"); bookingID > 0 {
+		query = query.Where("booking_id = ?", bookingID)
+	}
+	if matchedBy := c.Query("matched_by"); matchedBy != "" {
+		query = query.Where("matched_by = ?", matchedBy)
+	}
+	if search := c.Query("search"); search != "" {
+		like := "%" + search + "%"
+		query = query.Where("from_email LIKE ? OR from_name LIKE ? OR subject LIKE ?", like, like, like)
+	}
+
+	return respondPage(c, query, "inbound_emails", inboundEmailSortFields, "-created_at", &emails, "Failed to fetch emails")
+}
+
+// loadInboundEmail finds the email of the :id parameter, writing the error
+// response when it returns nil
+func loadInboundEmail(c *fiber.Ctx, preload ...string) (*models.InboundEmail, error) {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid email ID",
+		})
+	}
+
+	query := database.DB
+	for _, p := range preload {
+		query = query.Preload(p)
+	}
+
+	var email models.InboundEmail
+	if err := query.First(&email, id).Error; err != nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Email not found",
+		})
+	}
+	return &email, nil
+}
+
+// GetInboundEmail returns a received email with its client, booking and
+// attachments (admin)
+func GetInboundEmail(c *fiber.Ctx) error {
+	email, err := loadInboundEmail(c, "Client", "Booking", "Attachments")
+	if email == nil {
+		return err
+	}
+	return c.JSON(email)
+}
+
+// AssignInboundEmail ties a received email to a client, and optionally one
+// of the client's bookings, by hand (admin)
+func AssignInboundEmail(c *fiber.Ctx) error {
+	email, err := loadInboundEmail(c)
+	if email == nil {
+		return err
+	}
+
+	type AssignRequest struct {
+		ClientID  uint  `json:"client_id" validate:"required"`
+		BookingID *uint `json:"booking_id"`
+	}
+
+	var req AssignRequest
+	if verr := bindRequest(c, &req); verr != nil {
+		return verr.Send(c)
+	}
+
+	if err := services.AssignInboundEmail(email, req.ClientID, req.BookingID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Client or booking not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to assign email",
+		})
+	}
+
+	return c.JSON(email)
+}
+
+// GetInboundAttachment redirects to a short-lived signed URL of an
+// attachment of a received email (admin)
+func GetInboundAttachment(c *fiber.Ctx) error {
+	email, err := loadInboundEmail(c)
+	if email == nil {
+		return err
+	}
+
+	var attachment models.InboundAttachment
+	if err := database.DB.Where("inbound_email_id = ?", email.ID).
+		First(&attachment, c.Params("attachmentId")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Attachment not found",
+		})
+	}
+
+	signed, err := services.Blobs().SignedURL(attachment.BlobKey, inboundAttachmentURLTTL)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to sign attachment URL",
+		})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	return c.Redirect(signed, fiber.StatusFound)
+}
+
+// DeleteInboundEmail soft deletes a received email (admin)
+func DeleteInboundEmail(c *fiber.Ctx) error {
+	email, err := loadInboundEmail(c)
+	if email == nil {
+		return err
+	}
+
+	if err := database.DB.Delete(email).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete email",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Email deleted successfully",
+	})
+}
@@ -0,0 +1,373 @@
+package handlers
+
+import (
+	"errors"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"github.com/mazong/angel_event/internal/services"
+	"gorm.io/gorm"
+)
+
+// recordInquiry stores a contact form submission under its client, creating
+// a prospect for unknown emails
+func recordInquiry(req *ContactFormRequest) (*models.Inquiry, error) {
+	var inquiry models.Inquiry
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		client, err := services.FindOrCreateClient(tx, services.ClientDetails{
+			Name:         req.Name,
+			Email:        req.Email,
+			Phone:        req.Phone,
+			Source:       models.ClientSource(req.Source),
+			SourceDetail: req.SourceDetail,
+		}, true, false)
+		if err != nil {
+			return err
+		}
+
+		inquiry = models.Inquiry{
+			ClientID:      client.ID,
+			Name:          req.Name,
+			Email:         req.Email,
+			Phone:         req.Phone,
+			Subject:       req.Subject,
+			Message:       req.Message,
+			Status:        models.InquiryNew,
+			LastMessageAt: time.Now(),
+		}
+		return tx.Create(&inquiry).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &inquiry, nil
+}
+
+// inquirySortFields lists the sortable inquiry fields
+var inquirySortFields = SortFields{
+	"created_at":      "created_at",
+	"last_message_at": "last_message_at",
+	"status":          "status",
+}
+
+// GetInquiries returns a page of inquiries, filtered by ?status= and
+// ?search= on name, email or subject (admin)
+func GetInquiries(c *fiber.Ctx) error {
+	var inquiries []models.Inquiry
+
+	query := database.DB.Model(&models.Inquiry{}).Preload("Client")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if search := c.Query("search"); search != "" {
+		like := "%" + search + "%"
+		query = query.Where("name LIKE ? OR email LIKE ? OR subject LIKE ?", like, like, like)
+	}
+
+	return respondPage(c, query, "inquiries", inquirySortFields, "-last_message_at", &inquiries, "Failed to fetch inquiries")
+}
+
+// loadInquiry finds the inquiry of the :id parameter, writing the error
+// response when it returns nil
+func loadInquiry(c *fiber.Ctx, preload ...string) (*models.Inquiry, error) {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid inquiry ID",
+		})
+	}
+
+	query := database.DB
+	for _, p := range preload {
+		query = query.Preload(p)
+	}
+
+	var inquiry models.Inquiry
+	if err := query.First(&inquiry, id).Error; err != nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Inquiry not found",
+		})
+	}
+	return &inquiry, nil
+}
+
+// GetInquiry returns an inquiry with its client, booking and thread (admin)
+func GetInquiry(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid inquiry ID",
+		})
+	}
+
+	var inquiry models.Inquiry
+	if err := database.DB.Preload("Client").Preload("Booking").
+		Preload("Messages", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at ASC, id ASC")
+		}).
+		First(&inquiry, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Inquiry not found",
+		})
+	}
+
+	return c.JSON(inquiry)
+}
+
+// UpdateInquiryStatus moves an inquiry to new, replied or closed; inquiries
+// become converted only through ConvertInquiry (admin)
+func UpdateInquiryStatus(c *fiber.Ctx) error {
+	inquiry, err := loadInquiry(c)
+	if inquiry == nil {
+		return err
+	}
+
+	type StatusRequest struct {
+		Status string `json:"status" validate:"required,oneof=new replied closed"`
+	}
+
+	var req StatusRequest
+	if verr := bindRequest(c, &req); verr != nil {
+		return verr.Send(c)
+	}
+
+	if inquiry.Status == models.InquiryConverted {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Inquiry was already converted into a booking",
+		})
+	}
+
+	inquiry.Status = models.InquiryStatus(req.Status)
+	if err := database.DB.Model(inquiry).Update("status", inquiry.Status).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update inquiry",
+		})
+	}
+
+	return c.JSON(inquiry)
+}
+
+// ReplyToInquiry emails the client and adds the reply to the thread (admin)
+func ReplyToInquiry(c *fiber.Ctx) error {
+	inquiry, err := loadInquiry(c)
+	if inquiry == nil {
+		return err
+	}
+
+	type ReplyRequest struct {
+		Subject string `json:"subject" validate:"max=200"`
+		Message string `json:"message" validate:"required,max=20000"`
+	}
+
+	var req ReplyRequest
+	if verr := bindRequest(c, &req); verr != nil {
+		return verr.Send(c)
+	}
+
+	subject := req.Subject
+	if subject == "" {
+		subject = inquiryReplySubject(inquiry)
+	}
+
+	// Admins write plain text; keep its line breaks in the HTML email
+	body := strings.ReplaceAll(html.EscapeString(req.Message), "\n", "<br>\n")
+
+	emailLog := models.EmailLog{
+		To:       inquiry.Email,
+		Subject:  subject,
+		Type:     "inquiry_reply",
+		Status:   "sent",
+		ClientID: &inquiry.ClientID,
+	}
+	replyTo := services.ReplyAddress(services.ReplyInquiry, inquiry.ID)
+	if err := emailService.SendEmailReplyTo(inquiry.Email, subject, body, replyTo); err != nil {
+		emailLog.Status = "failed"
+		emailLog.Error = err.Error()
+		database.DB.Create(&emailLog)
+
+		log.Printf("Failed to send reply to inquiry %d: %v", inquiry.ID, err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "Failed to send email",
+		})
+	}
+
+	message := models.InquiryMessage{
+		InquiryID: inquiry.ID,
+		Direction: models.MessageOutbound,
+		Subject:   subject,
+		Body:      req.Message,
+		UserID:    currentUserID(c),
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&emailLog).Error; err != nil {
+			return err
+		}
+		message.EmailLogID = &emailLog.ID
+		if err := tx.Create(&message).Error; err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{"last_message_at": message.CreatedAt}
+		if inquiry.Status == models.InquiryNew {
+			updates["status"] = models.InquiryReplied
+		}
+		return tx.Model(inquiry).Updates(updates).Error
+	})
+	if err != nil {
+		// The email went out; only the thread is incomplete
+		log.Printf("Failed to record reply to inquiry %d: %v", inquiry.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Email sent but failed to record reply",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(message)
+}
+
+// inquiryReplySubject answers the inquiry's subject, or a generic one
+func inquiryReplySubject(inquiry *models.Inquiry) string {
+	if inquiry.Subject == "" {
+		return "Votre demande - Angel Event"
+	}
+	if strings.HasPrefix(strings.ToLower(inquiry.Subject), "re:") {
+		return inquiry.Subject
+	}
+	return "Re: " + inquiry.Subject
+}
+
+// ConvertInquiryRequest describes the booking an inquiry turns into
+type ConvertInquiryRequest struct {
+	EventDate     string  `json:"event_date" validate:"required,date"`
+	EventType     string  `json:"event_type" validate:"required,oneof=proposal wedding birthday baby_shower corporate other"`
+	EventLocation string  `json:"event_location" validate:"max=255"`
+	GuestCount    int     `json:"guest_count" validate:"min=0,max=10000"`
+	Budget        float64 `json:"budget" validate:"min=0,max=1000000"`
+	AdminNotes    string  `json:"admin_notes" validate:"max=5000"`
+	Language      string  `json:"language" validate:"oneof=fr en"`
+}
+
+// errInquiryConverted is returned when an inquiry is converted twice
+var errInquiryConverted = errors.New("inquiry already converted")
+
+// ConvertInquiry creates a pending booking for the inquiry's client, with
+// the inquiry message as the booking message (admin)
+func ConvertInquiry(c *fiber.Ctx) error {
+	inquiry, err := loadInquiry(c, "Client")
+	if inquiry == nil {
+		return err
+	}
+
+	var req ConvertInquiryRequest
+	if verr := bindRequest(c, &req); verr != nil {
+		return verr.Send(c)
+	}
+
+	eventDate, err := models.ParseDate(req.EventDate)
+	if err != nil {
+		return fieldError(c, "event_date", "date").Send(c)
+	}
+	if eventDate.Before(services.Today()) {
+		return fieldError(c, "event_date", "past_date").Send(c)
+	}
+
+	if inquiry.Status == models.InquiryConverted {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Inquiry was already converted into a booking",
+		})
+	}
+
+	var booking models.Booking
+	err = services.WithAvailabilityLock(func() error {
+		day, err := services.ResolveDate(eventDate)
+		if err != nil {
+			return err
+		}
+		if !day.Available {
+			return services.ErrDateUnavailable
+		}
+
+		return database.DB.Transaction(func(tx *gorm.DB) error {
+			booking = models.Booking{
+				ClientID:      inquiry.ClientID,
+				EventDate:     eventDate,
+				EventType:     models.EventType(req.EventType),
+				EventLocation: req.EventLocation,
+				GuestCount:    req.GuestCount,
+				Budget:        req.Budget,
+				Message:       inquiry.Message,
+				Status:        models.BookingStatusPending,
+				TotalAmount:   req.Budget,
+				DepositAmount: req.Budget * 0.30,
+				AdminNotes:    req.AdminNotes,
+				Language:      req.Language,
+			}
+			if err := tx.Create(&booking).Error; err != nil {
+				return err
+			}
+			if err := services.RecordStatusChange(tx, &booking, "", currentUserID(c)); err != nil {
+				return err
+			}
+
+			if inquiry.Client != nil {
+				if err := services.PromoteProspect(tx, inquiry.Client); err != nil {
+					return err
+				}
+			}
+
+			// Another request may have converted it since it was loaded;
+			// the rollback then drops this booking
+			result := tx.Model(inquiry).
+				Where("status <> ?", models.InquiryConverted).
+				Updates(map[string]interface{}{
+					"status":     models.InquiryConverted,
+					"booking_id": booking.ID,
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errInquiryConverted
+			}
+			inquiry.Status = models.InquiryConverted
+			inquiry.BookingID = &booking.ID
+			return nil
+		})
+	})
+	if errors.Is(err, errInquiryConverted) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Inquiry was already converted into a booking",
+		})
+	}
+	if err != nil {
+		return availabilityErrorResponse(c, err, "Failed to convert inquiry")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"inquiry": inquiry,
+		"booking": booking,
+	})
+}
+
+// DeleteInquiry soft deletes an inquiry (admin)
+func DeleteInquiry(c *fiber.Ctx) error {
+	inquiry, err := loadInquiry(c)
+	if inquiry == nil {
+		return err
+	}
+
+	if err := database.DB.Delete(inquiry).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete inquiry",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Inquiry deleted successfully",
+	})
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"github.com/mazong/angel_event/internal/services"
+)
+
+// jobRunSortFields lists the sortable job run fields
+var jobRunSortFields = SortFields{
+	"started_at":  "started_at",
+	"duration_ms": "duration_ms",
+}
+
+// GetJobs lists the background jobs with their schedule, next run and
+// last run (admin)
+func GetJobs(c *fiber.Ctx) error {
+	jobs, err := services.Jobs().List()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch jobs",
+		})
+	}
+
+	return c.JSON(jobs)
+}
+
+// TriggerJob runs the job :name now in the background and returns its run
+// record (admin)
+func TriggerJob(c *fiber.Ctx) error {
+	run, err := services.Jobs().Trigger(c.Params("name"))
+	switch {
+	case errors.Is(err, services.ErrUnknownJob):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Job not found",
+		})
+	case errors.Is(err, services.ErrJobRunning), errors.Is(err, services.ErrSchedulerStopped):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to start job",
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(run)
+}
+
+// GetJobRuns returns a page of the job run history, filtered by ?job= and
+// ?status= (running, succeeded or failed) (admin)
+func GetJobRuns(c *fiber.Ctx) error {
+	query := database.DB.Model(&models.JobRun{})
+	if job := c.Query("job"); job != "" {
+		query = query.Where("job = ?", job)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var runs []models.JobRun
+	return respondPage(c, query, "job_runs", jobRunSortFields, "-started_at", &runs, "Failed to fetch job runs")
+}
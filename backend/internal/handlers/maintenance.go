@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mazong/angel_event/internal/services"
+)
+
+// CollectOrphanFiles reports unreferenced upload files and, unless
+// ?dry_run=false, only reports. Orphans are quarantined unless
+// ?quarantine=false. (admin)
+func CollectOrphanFiles(c *fiber.Ctx) error {
+	grace := services.DefaultOrphanGracePeriod
+	if hours := c.QueryInt("grace_hours", -1); hours >= 0 {
+		grace = time.Duration(hours) * time.Hour
+	}
+
+	report, err := services.CollectOrphanFiles(c.UserContext(), services.OrphanGCOptions{
+		DryRun:      c.QueryBool("dry_run", true),
+		GracePeriod: grace,
+		Quarantine:  c.QueryBool("quarantine", true),
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to collect orphan files",
+		})
+	}
+
+	return c.JSON(report)
+}
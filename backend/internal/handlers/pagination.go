@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// SortFields whitelists the sortable fields of a list endpoint,
+// mapping the public field name to its database column
+type SortFields map[string]string
+
+// PageRequest holds the pagination parameters of a list request
+type PageRequest struct {
+	Limit  int
+	Offset int
+	Cursor *pageCursor
+	Sort   string // database column
+	Desc   bool
+	table  string
+}
+
+// PageInfo describes the returned page
+type PageInfo struct {
+	Total      int64  `json:"total"`
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset"`
+	Sort       string `json:"sort"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Page is the response envelope shared by all list endpoints
+type Page struct {
+	Data       interface{} `json:"data"`
+	Pagination PageInfo    `json:"pagination"`
+}
+
+// pageCursor is the decoded form of an opaque cursor: the sort value
+// and ID of the last row of the previous page. Lists merging several
+// tables, like the client timeline, add the type of the row.
+type pageCursor struct {
+	Sort  string      `json:"s"`
+	Desc  bool        `json:"d,omitempty"`
+	Value interface{} `json:"v"`
+	Time  bool        `json:"t,omitempty"`
+	Type  string      `json:"y,omitempty"`
+	ID    uint        `json:"i"`
+}
+
+// parsePageRequest reads limit, offset, cursor and sort from the query string.
+// sort accepts a whitelisted field, prefixed with "-" for descending order.
+func parsePageRequest(c *fiber.Ctx, table string, fields SortFields, defaultSort string) (PageRequest, error) {
+	req := PageRequest{
+		Limit:  c.QueryInt("limit", defaultPageLimit),
+		Offset: c.QueryInt("offset", 0),
+		table:  table,
+	}
+
+	if req.Limit <= 0 {
+		req.Limit = defaultPageLimit
+	}
+	if req.Limit > maxPageLimit {
+		req.Limit = maxPageLimit
+	}
+	if req.Offset < 0 {
+		req.Offset = 0
+	}
+
+	sort := c.Query("sort", defaultSort)
+	if strings.HasPrefix(sort, "-") {
+		req.Desc = true
+		sort = strings.TrimPrefix(sort, "-")
+	}
+	column, ok := fields[sort]
+	if !ok {
+		return req, fmt.Errorf("invalid sort field %q", sort)
+	}
+	req.Sort = column
+
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := decodeCursor(raw)
+		if err != nil {
+			return req, err
+		}
+		// A cursor is only valid for the ordering it was issued with
+		if cursor.Sort != req.Sort || cursor.Desc != req.Desc {
+			return req, errors.New("cursor does not match sort order")
+		}
+		req.Cursor = cursor
+		req.Offset = 0
+	}
+
+	return req, nil
+}
+
+// paginate counts the filtered query, fetches one page into dest
+// (a pointer to a slice of models) and builds the response envelope
+func paginate(query *gorm.DB, req PageRequest, dest interface{}) (Page, error) {
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return Page{}, err
+	}
+
+	direction, cmp := "ASC", ">"
+	if req.Desc {
+		direction, cmp = "DESC", "<"
+	}
+	column := req.table + "." + req.Sort
+	idColumn := req.table + ".id"
+
+	query = query.Session(&gorm.Session{})
+	if req.Cursor != nil {
+		query = query.Where(
+			fmt.Sprintf("(%s %s ? OR (%s = ? AND %s %s ?))", column, cmp, column, idColumn, cmp),
+			req.Cursor.Value, req.Cursor.Value, req.Cursor.ID,
+		)
+	} else if req.Offset > 0 {
+		query = query.Offset(req.Offset)
+	}
+
+	// Fetch one extra row to know whether another page exists
+	if err := query.Order(fmt.Sprintf("%s %s, %s %s", column, direction, idColumn, direction)).
+		Limit(req.Limit + 1).
+		Find(dest).Error; err != nil {
+		return Page{}, err
+	}
+
+	sort := req.Sort
+	if req.Desc {
+		sort = "-" + sort
+	}
+	info := PageInfo{
+		Total:  total,
+		Limit:  req.Limit,
+		Offset: req.Offset,
+		Sort:   sort,
+	}
+
+	rows := reflect.ValueOf(dest).Elem()
+	if rows.Len() > req.Limit {
+		info.HasMore = true
+		rows.Set(rows.Slice(0, req.Limit))
+
+		cursor, err := buildCursor(query, req, rows.Index(req.Limit-1))
+		if err != nil {
+			return Page{}, err
+		}
+		info.NextCursor = cursor
+	}
+
+	return Page{Data: rows.Interface(), Pagination: info}, nil
+}
+
+// buildCursor encodes the sort value and ID of the given row
+func buildCursor(query *gorm.DB, req PageRequest, row reflect.Value) (string, error) {
+	stmt := &gorm.Statement{DB: query}
+	if err := stmt.Parse(row.Addr().Interface()); err != nil {
+		return "", err
+	}
+
+	sortField := stmt.Schema.LookUpField(req.Sort)
+	idField := stmt.Schema.LookUpField("id")
+	if sortField == nil || idField == nil {
+		return "", fmt.Errorf("unknown cursor field %q", req.Sort)
+	}
+
+	ctx := context.Background()
+	value, _ := sortField.ValueOf(ctx, row)
+	id, _ := idField.ValueOf(ctx, row)
+
+	cursor := pageCursor{Sort: req.Sort, Desc: req.Desc, Value: value}
+	if t, ok := value.(time.Time); ok {
+		cursor.Value = t.Format(time.RFC3339Nano)
+		cursor.Time = true
+	}
+	if v, ok := id.(uint); ok {
+		cursor.ID = v
+	}
+	return encodeCursor(cursor)
+}
+
+// encodeCursor returns the opaque form of a cursor
+func encodeCursor(cursor pageCursor) (string, error) {
+	raw, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// decodeCursor parses an opaque cursor issued by buildCursor
+func decodeCursor(raw string) (*pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	// Times must be bound as time.Time to compare like stored values
+	if cursor.Time {
+		s, _ := cursor.Value.(string)
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+		cursor.Value = t
+	}
+
+	return &cursor, nil
+}
+
+// respondPage parses pagination parameters, runs the query and writes the
+// envelope, answering 400 on bad parameters and 500 on query errors
+func respondPage(c *fiber.Ctx, query *gorm.DB, table string, fields SortFields, defaultSort string, dest interface{}, errMsg string) error {
+	req, err := parsePageRequest(c, table, fields, defaultSort)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	page, err := paginate(query, req, dest)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": errMsg,
+		})
+	}
+
+	return c.JSON(page)
+}
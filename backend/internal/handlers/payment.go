@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"github.com/mazong/angel_event/internal/services"
+)
+
+// loadBooking finds the booking of the :id parameter, writing the error
+// response when it returns nil
+func loadBooking(c *fiber.Ctx) (*models.Booking, error) {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid booking ID",
+		})
+	}
+
+	var booking models.Booking
+	if err := database.DB.First(&booking, id).Error; err != nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Booking not found",
+		})
+	}
+	return &booking, nil
+}
+
+// GetBookingPayments lists the payments of a booking with the amount still
+// due (admin)
+func GetBookingPayments(c *fiber.Ctx) error {
+	booking, err := loadBooking(c)
+	if booking == nil {
+		return err
+	}
+
+	var payments []models.Payment
+	if err := database.DB.Where("booking_id = ?", booking.ID).
+		Order("paid_on ASC, id ASC").Find(&payments).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch payments",
+		})
+	}
+
+	paid := services.TotalPaid(payments)
+
+	return c.JSON(fiber.Map{
+		"payments":     payments,
+		"total_paid":   paid,
+		"total_amount": booking.TotalAmount,
+		"balance_due":  booking.TotalAmount - paid,
+	})
+}
+
+// CreatePaymentRequest records a payment; paid_on defaults to today
+type CreatePaymentRequest struct {
+	Amount    float64 `json:"amount" validate:"required,min=0.01,max=1000000"`
+	Kind      string  `json:"kind" validate:"required,oneof=deposit balance refund"`
+	Method    string  `json:"method" validate:"required,oneof=cash e_transfer card cheque other"`
+	PaidOn    string  `json:"paid_on" validate:"date"`
+	Reference string  `json:"reference" validate:"max=100"`
+}
+
+// CreateBookingPayment records a payment received, or refunded, for a
+// booking (admin)
+func CreateBookingPayment(c *fiber.Ctx) error {
+	booking, err := loadBooking(c)
+	if booking == nil {
+		return err
+	}
+
+	var req CreatePaymentRequest
+	if verr := bindRequest(c, &req); verr != nil {
+		return verr.Send(c)
+	}
+
+	paidOn := services.Today()
+	if req.PaidOn != "" {
+		if paidOn, err = models.ParseDate(req.PaidOn); err != nil {
+			return fieldError(c, "paid_on", "date").Send(c)
+		}
+	}
+
+	payment := models.Payment{
+		BookingID: booking.ID,
+		ClientID:  booking.ClientID,
+		Amount:    req.Amount,
+		Kind:      models.PaymentKind(req.Kind),
+		Method:    models.PaymentMethod(req.Method),
+		PaidOn:    paidOn,
+		Reference: req.Reference,
+		UserID:    currentUserID(c),
+	}
+	if err := database.DB.Create(&payment).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record payment",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(payment)
+}
+
+// DeleteBookingPayment soft deletes a payment recorded by mistake (admin)
+func DeleteBookingPayment(c *fiber.Ctx) error {
+	var payment models.Payment
+	if err := database.DB.Where("booking_id = ?", c.Params("id")).
+		First(&payment, c.Params("paymentId")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Payment not found",
+		})
+	}
+
+	if err := database.DB.Delete(&payment).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete payment",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Payment deleted successfully",
+	})
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"github.com/mazong/angel_event/internal/services"
+	"gorm.io/gorm"
+)
+
+// privacyActionSortFields lists the sortable privacy audit fields
+var privacyActionSortFields = SortFields{
+	"created_at": "created_at",
+	"client_id":  "client_id",
+}
+
+// loadAnyClient finds the client of the :id parameter, deleted or not,
+// since a deleted client's records are still held
+func loadAnyClient(c *fiber.Ctx) (*models.Client, error) {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid client ID",
+		})
+	}
+
+	var client models.Client
+	if err := database.DB.Unscoped().First(&client, id).Error; err != nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Client not found",
+		})
+	}
+	return &client, nil
+}
+
+// ExportClientData answers an access request with a ZIP of JSON files
+// holding everything tied to the client, deleted records and received
+// attachments included (admin)
+func ExportClientData(c *fiber.Ctx) error {
+	client, err := loadAnyClient(c)
+	if client == nil {
+		return err
+	}
+
+	export, err := services.CollectClientData(client.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to collect client data",
+		})
+	}
+
+	if _, err := services.RecordPrivacyAction(database.DB, models.PrivacyExport, client.ID,
+		currentUserID(c), export.Counts()); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record the export",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="client-%d-data.zip"`, client.ID))
+
+	// The request context is recycled once the handler returns
+	ctx := context.Background()
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := services.WriteClientExport(ctx, w, export); err != nil {
+			log.Printf("Client %d export: %v", client.ID, err)
+		}
+		w.Flush()
+	})
+
+	return nil
+}
+
+// EraseClientData answers a deletion request by anonymizing the client
+// across bookings, emails, testimonials, the newsletter and the rest of its
+// history, keeping financial records under a pseudonym. The body must
+// repeat the client's email as {"confirm": "..."} (admin)
+func EraseClientData(c *fiber.Ctx) error {
+	client, err := loadAnyClient(c)
+	if client == nil {
+		return err
+	}
+
+	type EraseRequest struct {
+		Confirm string `json:"confirm" validate:"required"`
+	}
+
+	var req EraseRequest
+	if verr := bindRequest(c, &req); verr != nil {
+		return verr.Send(c)
+	}
+	if client.ErasedAt == nil && !strings.EqualFold(strings.TrimSpace(req.Confirm), client.Email) {
+		return fieldError(c, "confirm", "confirm_mismatch").Send(c)
+	}
+
+	action, err := services.EraseClient(client.ID, currentUserID(c))
+	switch {
+	case errors.Is(err, services.ErrClientErased):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Client not found",
+		})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to erase client data",
+		})
+	}
+
+	return c.JSON(action)
+}
+
+// GetPrivacyActions returns a page of the privacy audit trail, filtered by
+// ?client_id= and ?action= (export or erasure) (admin)
+func GetPrivacyActions(c *fiber.Ctx) error {
+	query := database.DB.Model(&models.PrivacyAction{})
+	if clientID := c.QueryInt("client_id"); clientID > 0 {
+		query = query.Where("client_id = ?", clientID)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+
+	var actions []models.PrivacyAction
+	return respondPage(c, query, "privacy_actions", privacyActionSortFields, "-created_at", &actions,
+		"Failed to fetch privacy actions")
+}
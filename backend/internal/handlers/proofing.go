@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"github.com/mazong/angel_event/internal/services"
+	"gorm.io/gorm"
+)
+
+// selectionSortFields lists the sortable proofing selection fields
+var selectionSortFields = SortFields{
+	"created_at": "created_at",
+}
+
+// GetAlbumProofing returns the client's favorites and comments for a shared
+// album, plus its latest submitted selection (public)
+func GetAlbumProofing(c *fiber.Ctx) error {
+	album, denied := loadSharedAlbum(c)
+	if denied != nil {
+		return denied.Send(c)
+	}
+
+	var items []models.ProofingItem
+	if err := database.DB.Where("album_id = ?", album.ID).Find(&items).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch proofing",
+		})
+	}
+
+	var latest *models.ProofingSelection
+	var selection models.ProofingSelection
+	if err := database.DB.Preload("Images").
+		Where("album_id = ?", album.ID).
+		Order("created_at DESC").
+		First(&selection).Error; err == nil {
+		latest = &selection
+	}
+
+	return c.JSON(fiber.Map{
+		"items":            items,
+		"latest_selection": latest,
+	})
+}
+
+// UpdateProofingItem sets the favorite flag and/or comment of an album image (public)
+func UpdateProofingItem(c *fiber.Ctx) error {
+	album, denied := loadSharedAlbum(c)
+	if denied != nil {
+		return denied.Send(c)
+	}
+
+	imageID, err := strconv.Atoi(c.Params("imageId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid image ID",
+		})
+	}
+
+	type ProofingRequest struct {
+		Favorite *bool   `json:"favorite"`
+		Comment  *string `json:"comment" validate:"max=1000"`
+	}
+
+	var req ProofingRequest
+	if verr := bindRequest(c, &req); verr != nil {
+		return verr.Send(c)
+	}
+
+	// Only images of this album can be proofed through its link
+	var count int64
+	database.DB.Model(&models.AlbumImage{}).
+		Where("album_id = ? AND gallery_image_id = ?", album.ID, imageID).
+		Count(&count)
+	if count == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Image not found in this album",
+		})
+	}
+
+	item := models.ProofingItem{AlbumID: album.ID, GalleryImageID: uint(imageID)}
+	database.DB.Where(models.ProofingItem{AlbumID: album.ID, GalleryImageID: uint(imageID)}).First(&item)
+
+	if req.Favorite != nil {
+		item.Favorite = *req.Favorite
+	}
+	if req.Comment != nil {
+		item.Comment = *req.Comment
+	}
+
+	if err := database.DB.Save(&item).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save proofing",
+		})
+	}
+
+	return c.JSON(item)
+}
+
+// SubmitProofingSelection freezes the current favorites into a selection
+// and notifies the admin (public)
+func SubmitProofingSelection(c *fiber.Ctx) error {
+	album, denied := loadSharedAlbum(c)
+	if denied != nil {
+		return denied.Send(c)
+	}
+
+	type SubmitRequest struct {
+		Name string `json:"name" validate:"max=100"`
+		Note string `json:"note" validate:"max=2000"`
+	}
+
+	var req SubmitRequest
+	if verr := bindRequest(c, &req); verr != nil {
+		return verr.Send(c)
+	}
+
+	// Favorites in album order, skipping images removed from the album since
+	var favorites []struct {
+		GalleryImageID uint
+		Comment        string
+		Title          string
+	}
+	if err := database.DB.Model(&models.ProofingItem{}).
+		Select("proofing_items.gallery_image_id, proofing_items.comment, gallery_images.title").
+		Joins("JOIN album_images ON album_images.album_id = proofing_items.album_id AND album_images.gallery_image_id = proofing_items.gallery_image_id").
+		Joins("JOIN gallery_images ON gallery_images.id = proofing_items.gallery_image_id AND gallery_images.deleted_at IS NULL").
+		Where("proofing_items.album_id = ? AND proofing_items.favorite = ?", album.ID, true).
+		Order("album_images.position ASC").
+		Scan(&favorites).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch favorites",
+		})
+	}
+
+	if len(favorites) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Select at least one photo before submitting",
+		})
+	}
+
+	selection := models.ProofingSelection{
+		AlbumID:     album.ID,
+		SubmittedBy: req.Name,
+		Note:        req.Note,
+	}
+	choices := make([]services.ProofingChoice, len(favorites))
+	for i, fav := range favorites {
+		selection.Images = append(selection.Images, models.ProofingSelectionImage{
+			GalleryImageID: fav.GalleryImageID,
+			Comment:        fav.Comment,
+			Position:       i,
+		})
+		choices[i] = services.ProofingChoice{Title: fav.Title, Comment: fav.Comment}
+	}
+
+	if err := database.DB.Create(&selection).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to submit selection",
+		})
+	}
+
+	database.DB.Preload("Images.GalleryImage").First(&selection, selection.ID)
+
+	// Resolve the client behind the album's booking for the notification and log
+	clientName := req.Name
+	var clientID *uint
+	if album.BookingID != nil {
+		var booking models.Booking
+		if err := database.DB.Preload("Client").First(&booking, *album.BookingID).Error; err == nil && booking.Client != nil {
+			clientName = booking.Client.Name
+			clientID = &booking.Client.ID
+		}
+	}
+
+	go func(albumTitle string) {
+		emailLog := models.EmailLog{
+			To:       os.Getenv("ADMIN_EMAIL"),
+			Subject:  "Sélection de photos reçue - " + albumTitle,
+			Type:     "proofing_selection",
+			Status:   "sent",
+			ClientID: clientID,
+		}
+		if err := emailService.SendProofingSelectionNotification(albumTitle, clientName, req.Note, choices); err != nil {
+			log.Printf("Failed to send proofing notification for album %d: %v", album.ID, err)
+			emailLog.Status = "failed"
+			emailLog.Error = err.Error()
+		}
+		database.DB.Create(&emailLog)
+	}(album.Title)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":   "Selection submitted successfully",
+		"selection": selection,
+	})
+}
+
+// GetProofingSelections returns a page of submitted selections (admin)
+func GetProofingSelections(c *fiber.Ctx) error {
+	var selections []models.ProofingSelection
+
+	query := database.DB.Model(&models.ProofingSelection{}).
+		Preload("Album").
+		Preload("Images", func(db *gorm.DB) *gorm.DB { return db.Order("position ASC") }).
+		Preload("Images.GalleryImage")
+
+	if albumID := c.Query("album_id"); albumID != "" {
+		query = query.Where("album_id = ?", albumID)
+	}
+
+	return respondPage(c, query, "proofing_selections", selectionSortFields, "-created_at", &selections, "Failed to fetch selections")
+}
+
+// GetProofingSelection returns one submitted selection (admin)
+func GetProofingSelection(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid selection ID",
+		})
+	}
+
+	var selection models.ProofingSelection
+	if err := database.DB.
+		Preload("Album.Booking.Client").
+		Preload("Images", func(db *gorm.DB) *gorm.DB { return db.Order("position ASC") }).
+		Preload("Images.GalleryImage").
+		First(&selection, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Selection not found",
+		})
+	}
+
+	return c.JSON(selection)
+}
@@ -1,33 +1,38 @@
 package handlers
 
 import (
-	"fmt"
-	"time"
+	"log"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/mazong/angel_event/internal/database"
 	"github.com/mazong/angel_event/internal/models"
+	"github.com/mazong/angel_event/internal/services"
 )
 
 // ContactFormRequest represents a contact form submission
 type ContactFormRequest struct {
-	Name    string `json:"name"`
-	Email   string `json:"email"`
-	Phone   string `json:"phone"`
-	Message string `json:"message"`
+	Name    string `json:"name" validate:"required,max=100"`
+	Email   string `json:"email" validate:"required,email"`
+	Phone   string `json:"phone" validate:"phone"`
+	Subject string `json:"subject" validate:"max=200"`
+	Message string `json:"message" validate:"required,max=5000"`
+	ClientSourceFields
+	SpamFields
 }
 
 // SubmitContactForm handles contact form submissions
 func SubmitContactForm(c *fiber.Ctx) error {
 	var req ContactFormRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+	if verr := bindRequest(c, &req); verr != nil {
+		return verr.Send(c)
+	}
+
+	if done, err := screenSubmission(c, services.FormContact, &req, req.Email, req.Name, req.Message); done {
+		return err
 	}
 
-	// Send email to admin
-	if err := emailService.SendContactFormEmail(req.Name, req.Email, req.Phone, req.Message); err != nil {
+	if err := submitContactForm(&req); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to send message",
 		})
@@ -38,30 +43,61 @@ func SubmitContactForm(c *fiber.Ctx) error {
 	})
 }
 
-// GetPublicAvailabilities returns availability calendar for public
-func GetPublicAvailabilities(c *fiber.Ctx) error {
-	var availabilities []models.Availability
+// submitContactForm stores the submission as an inquiry, then notifies the
+// admin. The inquiry is kept when the notification fails.
+func submitContactForm(req *ContactFormRequest) error {
+	inquiry, err := recordInquiry(req)
+	if err != nil {
+		log.Printf("Failed to record inquiry from %s: %v", req.Email, err)
+		return err
+	}
 
-	// Get month parameter
-	month := c.Query("month", time.Now().Format("2006-01"))
+	go func() {
+		if err := emailService.SendContactFormEmail(req.Name, req.Email, req.Phone, req.Message); err != nil {
+			log.Printf("Failed to notify admin of inquiry %d: %v", inquiry.ID, err)
+		}
+	}()
+	return nil
+}
+
+// PublicDayAvailability is the public view of a resolved date, without
+// notes or the rule that decided it
+type PublicDayAvailability struct {
+	Date      models.Date `json:"date"`
+	Available bool        `json:"available"`
+	MaxEvents int         `json:"max_events"`
+	Remaining int         `json:"remaining"`
+}
 
-	startDate := fmt.Sprintf("%s-01", month)
-	endDate := fmt.Sprintf("%s-31", month)
+// GetPublicAvailabilities returns the effective availability of every day
+// of a month for the public calendar
+func GetPublicAvailabilities(c *fiber.Ctx) error {
+	// Get month parameter, defaulting to the current business month
+	first, last, err := models.MonthRange(c.Query("month", services.CurrentMonth()))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid month format",
+		})
+	}
 
-	// Fetch availabilities
-	if err := database.DB.Where("date >= ? AND date <= ?", startDate, endDate).
-		Order("date ASC").
-		Find(&availabilities).Error; err != nil {
+	days, err := services.ResolveAvailability(first, last)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch availabilities",
 		})
 	}
 
-	// For public view, we might want to filter or transform data if needed
-	// But since Availability model is simple, we can return as is for now
-	// If notes contained sensitive info, we would create a response struct
+	response := make([]PublicDayAvailability, len(days))
+	for i, day := range days {
+		response[i] = PublicDayAvailability{
+			Date:      day.Date,
+			Available: day.Available,
+			MaxEvents: day.MaxEvents,
+			Remaining: day.Remaining,
+		}
+	}
 
-	return c.JSON(availabilities)
+	return c.JSON(response)
 }
 
 // GetRandomGalleryImages returns random gallery images for a category
@@ -73,48 +109,28 @@ func GetRandomGalleryImages(c *fiber.Ctx) error {
 	var images []models.GalleryImage
 	query := database.DB
 
-	// Filter by category if provided
+	// Filter by category slug if provided
 	if category != "" && category != "all" {
-		query = query.Where("category = ?", category)
+		query = query.Joins("Category").Where("Category.slug = ?", category)
 	}
 
 	// Exclude specific IDs if provided
 	if excludeIDs != "" {
-		query = query.Where("id NOT IN (?)", excludeIDs)
+		query = query.Where("gallery_images.id NOT IN (?)", strings.Split(excludeIDs, ","))
 	}
 
+	// Only images with a watermarked variant can be shown publicly
+	query = query.Where("gallery_images.public_url != ''")
+
 	// Get random images using ORDER BY RANDOM()
 	// Note: For SQLite use RANDOM(), for PostgreSQL use RANDOM(), for MySQL use RAND()
-	if err := query.Order("RANDOM()").Limit(limit).Find(&images).Error; err != nil {
+	if err := query.Preload("Category").Order("RANDOM()").Limit(limit).Find(&images).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch gallery images",
 		})
 	}
 
-	// Fill in default images if empty
-	for i := range images {
-		if images[i].ImageURL == "" {
-			images[i].ImageURL = getDefaultGalleryImage(string(images[i].Category))
-		}
-	}
+	publicGalleryImages(images)
 
 	return c.JSON(images)
 }
-
-// getDefaultGalleryImage returns the default image for a gallery category
-func getDefaultGalleryImage(category string) string {
-	defaults := map[string]string{
-		"wedding":     "/storage/weeding/photo_2026-01-10%2001.28.47.jpeg",
-		"marryme":     "/storage/marryme/photo_2026-01-10%2001.21.31.jpeg",
-		"birthday":    "/storage/birthday/photo_2026-01-10%2001.17.18.jpeg",
-		"baby_shower": "/storage/baby%20shower/photo_2026-01-10%2001.34.18.jpeg",
-		"bapteme":     "/storage/bapteme/photo_2026-01-10%2001.31.37.jpeg",
-		"loveroom":    "/storage/loveroom/photo_2026-01-10%2001.33.08.jpeg",
-		"congrats":    "/storage/congrats/photo_2026-01-10%2001.25.09.jpeg",
-	}
-
-	if img, ok := defaults[category]; ok {
-		return img
-	}
-	return defaults["wedding"] // Fallback
-}
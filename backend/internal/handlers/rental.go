@@ -1,26 +1,30 @@
 package handlers
 
 import (
-	"fmt"
-	"os"
-	"path/filepath"
+	"log"
 	"strconv"
-	"strings"
-	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/mazong/angel_event/internal/database"
 	"github.com/mazong/angel_event/internal/models"
+	"github.com/mazong/angel_event/internal/services"
 )
 
-// GetRentalItems returns all rental items, optionally filtered
+// rentalSortFields lists the sortable rental item fields
+var rentalSortFields = SortFields{
+	"created_at": "created_at",
+	"title":      "title",
+	"price":      "price",
+}
+
+// GetRentalItems returns a page of rental items, optionally filtered
 func GetRentalItems(c *fiber.Ctx) error {
 	var items []models.RentalItem
-	query := database.DB
+	query := database.DB.Model(&models.RentalItem{})
 
 	// Filter by category_id
 	if categoryID := c.Query("category_id"); categoryID != "" {
-		query = query.Where("category_id = ?", categoryID)
+		query = query.Where("rental_items.category_id = ?", categoryID)
 	}
 
 	// Filter by category slug
@@ -30,10 +34,18 @@ func GetRentalItems(c *fiber.Ctx) error {
 
 	// Featured only
 	if featured := c.Query("featured"); featured == "true" {
-		query = query.Where("featured = ?", true)
+		query = query.Where("rental_items.featured = ?", true)
 	}
 
-	if err := query.Preload("Category").Order("created_at DESC").Find(&items).Error; err != nil {
+	req, err := parsePageRequest(c, "rental_items", rentalSortFields, "-created_at")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	page, err := paginate(query.Preload("Category"), req, &items)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch rental items",
 		})
@@ -45,8 +57,9 @@ func GetRentalItems(c *fiber.Ctx) error {
 			items[i].ImageURL = getDefaultRentalImage(string(items[i].CategoryEnum))
 		}
 	}
+	page.Data = items
 
-	return c.JSON(items)
+	return c.JSON(page)
 }
 
 // getDefaultRentalImage returns the default image for a rental category
@@ -84,31 +97,10 @@ func CreateRentalItem(c *fiber.Ctx) error {
 	}
 	file := files[0]
 
-	// Validate file type
-	ext := strings.ToLower(filepath.Ext(file.Filename))
-	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" && ext != ".gif" && ext != ".webp" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid file type. Allowed: jpg, jpeg, png, gif, webp",
-		})
-	}
-
-	// Create uploads directory if not exists
-	uploadDir := "./uploads/rentals"
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create upload directory",
-		})
-	}
-
-	// Generate unique filename
-	filename := fmt.Sprintf("%d%s", time.Now().UnixNano(), ext)
-	filePath := filepath.Join(uploadDir, filename)
-
-	// Save file
-	if err := c.SaveFile(file, filePath); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to save file",
-		})
+	// Validate and save the file
+	upload, err := services.SaveImageUpload(c.UserContext(), file, services.RentalUploads)
+	if err != nil {
+		return uploadErrorResponse(c, err)
 	}
 
 	// Parse price
@@ -117,6 +109,12 @@ func CreateRentalItem(c *fiber.Ctx) error {
 	// Parse category_id
 	categoryID, _ := strconv.Atoi(c.FormValue("category_id"))
 
+	// Parse stock (0 = not tracked)
+	stock, _ := strconv.Atoi(c.FormValue("stock"))
+	if stock < 0 {
+		stock = 0
+	}
+
 	// Create database record
 	item := models.RentalItem{
 		Title:        c.FormValue("title"),
@@ -124,13 +122,14 @@ func CreateRentalItem(c *fiber.Ctx) error {
 		CategoryID:   uint(categoryID),
 		CategoryEnum: models.RentalCategoryOther, // Satisfy legacy constraint
 		Price:        price,
-		ImageURL:     "/uploads/rentals/" + filename,
+		ImageURL:     upload.URL,
 		Featured:     c.FormValue("featured") == "true",
 		Available:    true,
+		Stock:        stock,
 	}
 
 	if err := database.DB.Create(&item).Error; err != nil {
-		os.Remove(filePath)
+		services.Blobs().Delete(c.UserContext(), upload.Key)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create rental item",
 		})
@@ -177,34 +176,47 @@ func UpdateRentalItem(c *fiber.Ctx) error {
 	if available := c.FormValue("available"); available != "" {
 		updateData["available"] = available == "true"
 	}
+	if stockStr := c.FormValue("stock"); stockStr != "" {
+		stock, err := strconv.Atoi(stockStr)
+		if err != nil || stock < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Stock must be a positive number, or 0 to not track it",
+			})
+		}
+		updateData["stock"] = stock
+	}
 
 	// Handle new image upload if present
-	form, err := c.MultipartForm()
-	if err == nil {
-		files := form.File["image"]
-		if len(files) > 0 {
-			file := files[0]
-			ext := strings.ToLower(filepath.Ext(file.Filename))
-
-			uploadDir := "./uploads/rentals"
-			os.MkdirAll(uploadDir, 0755)
-
-			filename := fmt.Sprintf("%d%s", time.Now().UnixNano(), ext)
-			filePath := filepath.Join(uploadDir, filename)
-
-			if err := c.SaveFile(file, filePath); err == nil {
-				updateData["image_url"] = "/uploads/rentals/" + filename
-				// Don't delete old image just in case, or implement cleanup logic
+	var upload *services.StoredUpload
+	if form, err := c.MultipartForm(); err == nil {
+		if files := form.File["image"]; len(files) > 0 {
+			upload, err = services.SaveImageUpload(c.UserContext(), files[0], services.RentalUploads)
+			if err != nil {
+				return uploadErrorResponse(c, err)
 			}
+			updateData["image_url"] = upload.URL
 		}
 	}
 
+	oldImageURL := item.ImageURL
 	if err := database.DB.Model(&item).Updates(updateData).Error; err != nil {
+		if upload != nil {
+			services.Blobs().Delete(c.UserContext(), upload.Key)
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to update item",
 		})
 	}
 
+	// The replaced image is no longer referenced
+	if upload != nil {
+		if err := services.RemoveUpload(c.UserContext(), oldImageURL, services.RentalUploads); err != nil {
+			log.Printf("Failed to remove old image of rental item %d: %v", item.ID, err)
+		}
+	}
+
+	database.DB.Preload("Category").First(&item, item.ID)
+
 	return c.JSON(item)
 }
 
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"github.com/mazong/angel_event/internal/services"
+)
+
+// retentionRunSortFields lists the sortable retention run fields
+var retentionRunSortFields = SortFields{
+	"created_at":  "created_at",
+	"duration_ms": "duration_ms",
+}
+
+// GetRetentionPolicies returns how long each kind of record is kept (admin)
+func GetRetentionPolicies(c *fiber.Ctx) error {
+	policies, err := services.GetRetentionPolicies()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch retention policies",
+		})
+	}
+
+	return c.JSON(policies)
+}
+
+// UpdateRetentionPolicy changes the retention of the :entity policy (admin)
+func UpdateRetentionPolicy(c *fiber.Ctx) error {
+	var policy models.RetentionPolicy
+	if err := database.DB.Where("entity = ?", c.Params("entity")).First(&policy).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Retention policy not found",
+		})
+	}
+
+	type UpdatePolicyRequest struct {
+		Days    int   `json:"days" validate:"required,min=1,max=3650"`
+		Enabled *bool `json:"enabled"`
+	}
+
+	var req UpdatePolicyRequest
+	if verr := bindRequest(c, &req); verr != nil {
+		return verr.Send(c)
+	}
+
+	policy.Days = req.Days
+	if req.Enabled != nil {
+		policy.Enabled = *req.Enabled
+	}
+	if err := database.DB.Save(&policy).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update retention policy",
+		})
+	}
+
+	return c.JSON(policy)
+}
+
+// RunRetention enforces the retention policies now and returns what was
+// purged (admin)
+func RunRetention(c *fiber.Ctx) error {
+	run, err := services.ApplyRetention(true)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to apply retention policies",
+		})
+	}
+
+	return c.JSON(run)
+}
+
+// GetRetentionRuns returns a page of past retention runs (admin)
+func GetRetentionRuns(c *fiber.Ctx) error {
+	query := database.DB.Model(&models.RetentionRun{})
+	if c.Query("manual") != "" {
+		query = query.Where("manual = ?", c.QueryBool("manual"))
+	}
+
+	var runs []models.RetentionRun
+	return respondPage(c, query, "retention_runs", retentionRunSortFields, "-created_at", &runs,
+		"Failed to fetch retention runs")
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"github.com/mazong/angel_event/internal/services"
+	"gorm.io/gorm"
+)
+
+// reviewLinkErrorResponse answers a review link that cannot be used
+func reviewLinkErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Review link not found",
+		})
+	case errors.Is(err, services.ErrReviewLinkUsed):
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{
+			"error": "This review link was already used",
+		})
+	case errors.Is(err, services.ErrReviewLinkExpired):
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{
+			"error": "This review link has expired",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Failed to submit review",
+	})
+}
+
+// GetReviewInvitation returns the booking a review link is for, to prefill
+// the review form (public)
+func GetReviewInvitation(c *fiber.Ctx) error {
+	invitation, booking, err := services.FindReviewInvitation(database.DB, c.Params("token"))
+	if err != nil {
+		return reviewLinkErrorResponse(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"name":       booking.Client.Name,
+		"event_type": booking.EventType,
+		"event_date": booking.EventDate,
+		"language":   booking.Language,
+		"expires_at": invitation.ExpiresAt,
+	})
+}
+
+// SubmitReviewRequest is a review sent through a review link; the name
+// defaults to the client's
+type SubmitReviewRequest struct {
+	Name     string `json:"name" validate:"max=100"`
+	Content  string `json:"content" validate:"required,min=10,max=2000"`
+	Rating   int    `json:"rating" validate:"required,min=1,max=5"`
+	Language string `json:"language" validate:"oneof=fr en"`
+}
+
+// SubmitReview creates the verified testimonial of a review link, pending
+// approval; the link cannot be used again (public)
+func SubmitReview(c *fiber.Ctx) error {
+	var req SubmitReviewRequest
+	if verr := bindRequest(c, &req); verr != nil {
+		return verr.Send(c)
+	}
+
+	testimonial := models.Testimonial{
+		Name:    req.Name,
+		Content: req.Content,
+		Rating:  req.Rating,
+	}
+	if err := services.SubmitVerifiedReview(c.Params("token"), &testimonial); err != nil {
+		return reviewLinkErrorResponse(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(testimonial)
+}
+
+// GetBookingReviewLink returns the review link of a completed booking,
+// issuing it if needed, to send it by hand (admin)
+func GetBookingReviewLink(c *fiber.Ctx) error {
+	booking, err := loadBooking(c)
+	if booking == nil {
+		return err
+	}
+
+	invitation, err := services.IssueReviewInvitation(database.DB, booking)
+	if errors.Is(err, services.ErrBookingNotCompleted) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Only completed bookings can be reviewed",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to issue review link",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"url":            services.ReviewURL(invitation),
+		"expires_at":     invitation.ExpiresAt,
+		"used_at":        invitation.UsedAt,
+		"testimonial_id": invitation.TestimonialID,
+	})
+}
+
+// GetTestimonialRatings returns the average rating of approved testimonials
+// overall and per event type, all and verified, with the schema.org
+// AggregateRating JSON-LD of the verified ones for the testimonials page
+// (public)
+func GetTestimonialRatings(c *fiber.Ctx) error {
+	overall, byType, err := services.TestimonialRatings()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch ratings",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"overall":     overall,
+		"event_types": byType,
+		"json_ld":     services.AggregateRatingJSONLD(overall),
+	})
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mazong/angel_event/internal/database"
+)
+
+// useTestDB points the database package at a fresh, migrated SQLite file
+// for the duration of the test
+func useTestDB(t *testing.T) {
+	t.Helper()
+	t.Setenv("DATABASE_PATH", filepath.Join(t.TempDir(), "test.db"))
+	t.Setenv("DB_LOG_LEVEL", "silent")
+
+	previous := database.DB
+	if err := database.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := database.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+		database.DB = previous
+	})
+}
+
+// newTestApp returns an app reading client IPs from X-Forwarded-For, as
+// behind a proxy, so tests can send requests from distinct addresses
+func newTestApp() *fiber.App {
+	return fiber.New(fiber.Config{ProxyHeader: fiber.HeaderXForwardedFor})
+}
+
+// send performs a JSON request from ip and decodes the JSON object answered
+func send(t *testing.T, app *fiber.App, method, path, ip string, body interface{}, header map[string]string) (int, map[string]interface{}) {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+	req.Header.Set(fiber.HeaderXForwardedFor, ip)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var decoded map[string]interface{}
+	data, _ := io.ReadAll(resp.Body)
+	if len(data) > 0 && data[0] == '{' {
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("%s %s: invalid JSON %q", method, path, data)
+		}
+	}
+	return resp.StatusCode, decoded
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"github.com/mazong/angel_event/internal/services"
+)
+
+// timelineSortFields lists the sortable timeline fields
+var timelineSortFields = SortFields{
+	"occurred_at": "occurred_at",
+}
+
+// GetClientTimeline returns a page of everything that happened with a
+// client, newest first. ?type= takes a comma-separated list of entry types:
+// email_sent, email_received, status_change, payment, note, inquiry and
+// testimonial (admin)
+func GetClientTimeline(c *fiber.Ctx) error {
+	client, err := loadClient(c)
+	if client == nil {
+		return err
+	}
+
+	var types []string
+	for _, t := range strings.Split(c.Query("type"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+	for _, t := range types {
+		if !containsString(services.TimelineTypes, t) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid timeline type " + strconv.Quote(t),
+			})
+		}
+	}
+
+	req, err := parsePageRequest(c, "timeline", timelineSortFields, "-occurred_at")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	page := services.TimelinePage{
+		Types:  types,
+		Limit:  req.Limit,
+		Offset: req.Offset,
+		Oldest: !req.Desc,
+	}
+	if req.Cursor != nil {
+		occurredAt, ok := req.Cursor.Value.(string)
+		if !ok || req.Cursor.Type == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid cursor",
+			})
+		}
+		page.After = &services.TimelinePosition{OccurredAt: occurredAt, Type: req.Cursor.Type, ID: req.Cursor.ID}
+	}
+
+	entries, total, next, err := services.ClientTimeline(client.ID, page)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch timeline",
+		})
+	}
+
+	sort := req.Sort
+	if req.Desc {
+		sort = "-" + sort
+	}
+	info := PageInfo{
+		Total:   total,
+		Limit:   req.Limit,
+		Offset:  req.Offset,
+		Sort:    sort,
+		HasMore: next != nil,
+	}
+	if next != nil {
+		info.NextCursor, err = encodeCursor(pageCursor{
+			Sort:  req.Sort,
+			Desc:  req.Desc,
+			Value: next.OccurredAt,
+			Type:  next.Type,
+			ID:    next.ID,
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch timeline",
+			})
+		}
+	}
+
+	return c.JSON(Page{Data: entries, Pagination: info})
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientNoteRequest is the body of a client note
+type ClientNoteRequest struct {
+	Body string `json:"body" validate:"required,max=10000"`
+}
+
+// CreateClientNote adds a note to a client's timeline, signed by the
+// current staff user (admin)
+func CreateClientNote(c *fiber.Ctx) error {
+	client, err := loadWritableClient(c)
+	if client == nil {
+		return err
+	}
+
+	var req ClientNoteRequest
+	if verr := bindRequest(c, &req); verr != nil {
+		return verr.Send(c)
+	}
+
+	note := models.ClientNote{
+		ClientID: client.ID,
+		UserID:   currentUserID(c),
+		Body:     req.Body,
+	}
+	if err := database.DB.Create(&note).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create note",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(note)
+}
+
+// loadClientNote finds the note :noteId of the client :id, which must not
+// be erased
+func loadClientNote(c *fiber.Ctx) (*models.ClientNote, error) {
+	client, err := loadWritableClient(c)
+	if client == nil {
+		return nil, err
+	}
+
+	var note models.ClientNote
+	if err := database.DB.Where("client_id = ?", client.ID).
+		First(&note, c.Params("noteId")).Error; err != nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Note not found",
+		})
+	}
+	return &note, nil
+}
+
+// UpdateClientNote edits the text of a client note (admin)
+func UpdateClientNote(c *fiber.Ctx) error {
+	note, err := loadClientNote(c)
+	if note == nil {
+		return err
+	}
+
+	var req ClientNoteRequest
+	if verr := bindRequest(c, &req); verr != nil {
+		return verr.Send(c)
+	}
+
+	note.Body = req.Body
+	if err := database.DB.Model(note).Update("body", note.Body).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update note",
+		})
+	}
+
+	return c.JSON(note)
+}
+
+// DeleteClientNote soft deletes a client note (admin)
+func DeleteClientNote(c *fiber.Ctx) error {
+	note, err := loadClientNote(c)
+	if note == nil {
+		return err
+	}
+
+	if err := database.DB.Delete(note).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete note",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Note deleted successfully",
+	})
+}
@@ -0,0 +1,383 @@
+package handlers
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mazong/angel_event/internal/models"
+)
+
+// Request DTOs declare their rules in a validate tag, checked in order:
+//
+//	required     non-empty string, non-zero number, non-empty list
+//	email        a bare email address
+//	phone        digits with optional spaces, dots, dashes, parentheses and +
+//	date         YYYY-MM-DD
+//	min=N max=N  length of strings and lists, value of numbers
+//	oneof=a b    one of the listed values
+//
+// Empty optional fields skip every rule but required. Strings are trimmed
+// and emails lowercased before validation.
+
+// Error codes of the response envelope
+const (
+	codeInvalidBody      = "invalid_body"
+	codeValidationFailed = "validation_failed"
+)
+
+// localeLocal stores the request language once the body is bound
+const localeLocal = "locale"
+
+// validationMessages holds the French and English text of each code; %s is
+// the rule parameter
+var validationMessages = map[string][2]string{
+	codeInvalidBody:      {"Requête invalide", "Invalid request body"},
+	codeValidationFailed: {"Certains champs sont invalides", "Some fields are invalid"},
+	"required":           {"Ce champ est obligatoire", "This field is required"},
+	"email":              {"Adresse courriel invalide", "Invalid email address"},
+	"phone":              {"Numéro de téléphone invalide", "Invalid phone number"},
+	"date":               {"Date invalide (AAAA-MM-JJ)", "Invalid date (YYYY-MM-DD)"},
+	"min_length":         {"Au moins %s caractères", "At least %s characters"},
+	"max_length":         {"Au plus %s caractères", "At most %s characters"},
+	"min":                {"Doit être au moins %s", "Must be at least %s"},
+	"max":                {"Doit être au plus %s", "Must be at most %s"},
+	"min_items":          {"Au moins %s éléments", "At least %s items"},
+	"max_items":          {"Au plus %s éléments", "At most %s items"},
+	"oneof":              {"Valeur invalide (valeurs permises : %s)", "Invalid value (allowed: %s)"},
+	"past_date":          {"Cette date est déjà passée", "This date is in the past"},
+	"confirm_mismatch":   {"La confirmation ne correspond pas", "The confirmation does not match"},
+	"rate_limited":       {"Trop de demandes, veuillez réessayer plus tard", "Too many requests, please try again later"},
+	"date_unavailable":   {"Cette date n'est pas disponible", "This date is not available"},
+	"hold_expired":       {"La réservation temporaire a expiré", "The hold on this date has expired"},
+	"rental_unavailable": {"Certains articles ne sont pas disponibles à cette date", "Some items are not available on this date"},
+	"availability_busy":  {"Trop de réservations en cours, veuillez réessayer", "Too many bookings in progress, please try again"},
+	"date_available":     {"Cette date est disponible, vous pouvez réserver directement", "This date is available, you can book it directly"},
+	"too_many_holds":     {"Vous avez déjà des dates réservées temporairement, terminez ou annulez-les d'abord", "You already have dates on hold, complete or release them first"},
+	"booking_statuses":   {"Statuts invalides (pending, confirmed, paid, completed, cancelled)", "Invalid statuses (pending, confirmed, paid, completed, cancelled)"},
+	"single_status":      {"Ce déclencheur compte à partir d'un seul statut", "This trigger counts from a single status"},
+}
+
+// FieldError describes why one field was rejected
+type FieldError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError is the 400 response of a rejected request. Error repeats
+// Message for clients reading the usual {"error": ...} shape.
+type ValidationError struct {
+	Code    string                `json:"code"`
+	Message string                `json:"message"`
+	Fields  map[string]FieldError `json:"fields,omitempty"`
+	Error   string                `json:"error"`
+}
+
+// Send writes the error as a 400 response
+func (e *ValidationError) Send(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusBadRequest).JSON(e)
+}
+
+// conflict sends a 409 with a localized message for code
+func conflict(c *fiber.Ctx, code string) error {
+	message := localize(locale(c), code, "")
+	return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+		"code":    code,
+		"message": message,
+		"error":   message,
+	})
+}
+
+// localize returns the message of code in lang ("fr" or "en")
+func localize(lang, code, param string) string {
+	texts, ok := validationMessages[code]
+	if !ok {
+		return code
+	}
+	text := texts[0]
+	if lang == "en" {
+		text = texts[1]
+	}
+	if strings.Contains(text, "%s") {
+		text = fmt.Sprintf(text, param)
+	}
+	return text
+}
+
+// requestLanguage picks the response language: the body's language field,
+// then ?lang=, then Accept-Language, French by default
+func requestLanguage(c *fiber.Ctx, bodyLang string) string {
+	for _, lang := range []string{bodyLang, c.Query("lang"), c.Get(fiber.HeaderAcceptLanguage)} {
+		lang = strings.ToLower(strings.TrimSpace(lang))
+		switch {
+		case strings.HasPrefix(lang, "en"):
+			return "en"
+		case strings.HasPrefix(lang, "fr"):
+			return "fr"
+		}
+	}
+	return "fr"
+}
+
+// locale returns the language of the current request
+func locale(c *fiber.Ctx) string {
+	if lang, ok := c.Locals(localeLocal).(string); ok {
+		return lang
+	}
+	return requestLanguage(c, "")
+}
+
+func newValidationError(lang string, fields map[string]FieldError) *ValidationError {
+	code := codeValidationFailed
+	if fields == nil {
+		code = codeInvalidBody
+	}
+	message := localize(lang, code, "")
+	return &ValidationError{Code: code, Message: message, Fields: fields, Error: message}
+}
+
+// fieldError rejects a single field for a rule checked in the handler, such
+// as a date that must not be past
+func fieldError(c *fiber.Ctx, field, code string) *ValidationError {
+	lang := locale(c)
+	return newValidationError(lang, map[string]FieldError{
+		field: {Code: code, Message: localize(lang, code, "")},
+	})
+}
+
+// bindRequest parses the body into req, a pointer to a DTO, normalizes and
+// validates it. The returned error is ready to Send.
+func bindRequest(c *fiber.Ctx, req interface{}) *ValidationError {
+	if err := c.BodyParser(req); err != nil {
+		return newValidationError(requestLanguage(c, ""), nil)
+	}
+
+	v := reflect.ValueOf(req).Elem()
+	normalizeStruct(v)
+
+	bodyLang := ""
+	if f := fieldByJSONName(v, "language"); f.IsValid() && f.Kind() == reflect.String {
+		bodyLang = f.String()
+	}
+	lang := requestLanguage(c, bodyLang)
+	c.Locals(localeLocal, lang)
+
+	if fields := validateStruct(v, lang); len(fields) > 0 {
+		return newValidationError(lang, fields)
+	}
+	return nil
+}
+
+// jsonName is the name a field has in requests and error responses
+func jsonName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+func fieldByJSONName(v reflect.Value, name string) reflect.Value {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if embeddedStruct(t.Field(i), v.Field(i)) {
+			if f := fieldByJSONName(v.Field(i), name); f.IsValid() {
+				return f
+			}
+			continue
+		}
+		if jsonName(t.Field(i)) == name {
+			return v.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+// normalizeStruct trims strings and lowercases emails
+func normalizeStruct(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := v.Field(i)
+		if embeddedStruct(t.Field(i), f) {
+			normalizeStruct(f)
+			continue
+		}
+		if f.Kind() == reflect.Ptr && !f.IsNil() {
+			f = f.Elem()
+		}
+		if f.Kind() != reflect.String || !f.CanSet() {
+			continue
+		}
+		s := strings.TrimSpace(f.String())
+		if hasRule(t.Field(i).Tag.Get("validate"), "email") {
+			s = strings.ToLower(s)
+		}
+		f.SetString(s)
+	}
+}
+
+// embeddedStruct tells whether a field embeds shared request fields, which
+// are checked as if declared in the outer struct
+func embeddedStruct(sf reflect.StructField, f reflect.Value) bool {
+	return sf.Anonymous && f.Kind() == reflect.Struct
+}
+
+func hasRule(tag, rule string) bool {
+	for _, r := range strings.Split(tag, ",") {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// validateStruct returns the first failed rule of each field
+func validateStruct(v reflect.Value, lang string) map[string]FieldError {
+	fields := make(map[string]FieldError)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if embeddedStruct(sf, v.Field(i)) {
+			for name, fe := range validateStruct(v.Field(i), lang) {
+				fields[name] = fe
+			}
+			continue
+		}
+		tag := sf.Tag.Get("validate")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		if code, param := validateField(v.Field(i), tag); code != "" {
+			fields[jsonName(sf)] = FieldError{Code: code, Message: localize(lang, code, param)}
+		}
+	}
+	return fields
+}
+
+// validateField returns the code and parameter of the first rule f breaks
+func validateField(f reflect.Value, tag string) (string, string) {
+	// Absent pointers are empty
+	if f.Kind() == reflect.Ptr {
+		if f.IsNil() {
+			if hasRule(tag, "required") {
+				return "required", ""
+			}
+			return "", ""
+		}
+		f = f.Elem()
+	}
+
+	if f.IsZero() || (f.Kind() == reflect.Slice && f.Len() == 0) {
+		if hasRule(tag, "required") {
+			return "required", ""
+		}
+		// Zero numbers still go through min and max
+		if !isNumber(f) {
+			return "", ""
+		}
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+		case "email":
+			if !validEmail(f.String()) {
+				return "email", ""
+			}
+		case "phone":
+			if !validPhone(f.String()) {
+				return "phone", ""
+			}
+		case "date":
+			if _, err := models.ParseDate(f.String()); err != nil {
+				return "date", ""
+			}
+		case "min", "max":
+			limit, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				panic(fmt.Sprintf("validate: bad %s parameter %q", name, param))
+			}
+			size, suffix := measure(f)
+			if (name == "min" && size < limit) || (name == "max" && size > limit) {
+				return name + suffix, param
+			}
+		case "oneof":
+			allowed := strings.Fields(param)
+			found := false
+			for _, a := range allowed {
+				if f.String() == a {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return "oneof", strings.Join(allowed, ", ")
+			}
+		default:
+			panic(fmt.Sprintf("validate: unknown rule %q", name))
+		}
+	}
+	return "", ""
+}
+
+func isNumber(f reflect.Value) bool {
+	switch f.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// measure returns what min and max compare, and the code suffix for it
+func measure(f reflect.Value) (float64, string) {
+	switch f.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(f.String())), "_length"
+	case reflect.Slice:
+		return float64(f.Len()), "_items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(f.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(f.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return f.Float(), ""
+	}
+	panic(fmt.Sprintf("validate: min/max on %s", f.Kind()))
+}
+
+// validEmail accepts a bare address with a dotted domain
+func validEmail(s string) bool {
+	if len(s) > 254 {
+		return false
+	}
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s || addr.Name != "" {
+		return false
+	}
+	at := strings.LastIndex(s, "@")
+	domain := s[at+1:]
+	return strings.Contains(domain, ".") && !strings.HasPrefix(domain, ".") && !strings.HasSuffix(domain, ".")
+}
+
+// validPhone accepts 7 to 15 digits with common separators
+func validPhone(s string) bool {
+	digits := 0
+	for i, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == '+' && i == 0:
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return false
+		}
+	}
+	return digits >= 7 && digits <= 15
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"github.com/mazong/angel_event/internal/services"
+	"gorm.io/gorm"
+)
+
+// processWaitlist offers freed capacity on date to the waitlist; run it in
+// the background after anything that may free a slot
+func processWaitlist(date models.Date) {
+	if err := services.ProcessWaitlist(date); err != nil {
+		log.Printf("Waitlist processing failed for %s: %v", date, err)
+	}
+}
+
+// processWaitlists does the same for every waitlisted date, after changes
+// such as rules that affect many dates
+func processWaitlists() {
+	if err := services.ProcessWaitlists(); err != nil {
+		log.Printf("Waitlist processing failed: %v", err)
+	}
+}
+
+// WaitlistRequest asks for a place on the waitlist of a fully booked date
+type WaitlistRequest struct {
+	Date      string `json:"date" validate:"required,date"`
+	EventType string `json:"event_type" validate:"required,oneof=proposal wedding birthday baby_shower corporate other"`
+	Name      string `json:"name" validate:"required,max=100"`
+	Email     string `json:"email" validate:"required,email"`
+	Phone     string `json:"phone" validate:"phone"`
+	Language  string `json:"language" validate:"oneof=fr en"`
+	SpamFields
+}
+
+// JoinWaitlist puts a client on the waitlist of a fully booked date (public)
+func JoinWaitlist(c *fiber.Ctx) error {
+	var req WaitlistRequest
+	if verr := bindRequest(c, &req); verr != nil {
+		return verr.Send(c)
+	}
+
+	date, err := models.ParseDate(req.Date)
+	if err != nil {
+		return fieldError(c, "date", "date").Send(c)
+	}
+	if date.Before(services.Today()) {
+		return fieldError(c, "date", "past_date").Send(c)
+	}
+
+	// Offers to waitlisted clients are emailed: screen like the other forms
+	if done, err := screenSubmission(c, services.FormWaitlist, &req, req.Email, req.Name); done {
+		return err
+	}
+
+	entry, created, err := joinWaitlist(date, &req)
+	if err != nil {
+		return availabilityErrorResponse(c, err, "Failed to join waitlist")
+	}
+
+	// Position among the clients still waiting for the date
+	var ahead int64
+	database.DB.Model(&models.WaitlistEntry{}).
+		Where("date = ? AND status = ? AND id < ?", entry.Date, models.WaitlistWaiting, entry.ID).
+		Count(&ahead)
+
+	// Anyone can post a known email: only the request that created the
+	// entry gets its token, which is what LeaveWaitlist asks for
+	if !created {
+		return c.JSON(fiber.Map{
+			"position": ahead + 1,
+			"message":  "Already on the waitlist",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"entry":    entry,
+		"token":    entry.Token,
+		"position": ahead + 1,
+		"message":  "Added to waitlist",
+	})
+}
+
+// joinWaitlist adds the client of req to the waitlist of date, or finds
+// the entry they already have
+func joinWaitlist(date models.Date, req *WaitlistRequest) (*models.WaitlistEntry, bool, error) {
+	return services.JoinWaitlist(&models.WaitlistEntry{
+		Date:      date,
+		EventType: models.EventType(req.EventType),
+		Name:      req.Name,
+		Email:     req.Email,
+		Phone:     req.Phone,
+		Language:  req.Language,
+	})
+}
+
+// LeaveWaitlist removes a client from a waitlist (public, token-protected)
+func LeaveWaitlist(c *fiber.Ctx) error {
+	entry, err := services.LeaveWaitlist(c.Params("token"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Waitlist entry not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to leave waitlist",
+		})
+	}
+
+	// A slot offered to this client goes to the next one
+	go processWaitlist(entry.Date)
+
+	return c.JSON(fiber.Map{
+		"message": "Removed from waitlist",
+	})
+}
+
+// waitlistSortFields lists the sortable waitlist fields
+var waitlistSortFields = SortFields{
+	"created_at": "created_at",
+	"date":       "date",
+	"status":     "status",
+}
+
+// GetWaitlist returns a page of waitlist entries, optionally filtered by
+// ?date= and ?status= (admin)
+func GetWaitlist(c *fiber.Ctx) error {
+	var entries []models.WaitlistEntry
+
+	query := database.DB.Model(&models.WaitlistEntry{})
+	if d := c.Query("date"); d != "" {
+		date, err := models.ParseDate(d)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid date format",
+			})
+		}
+		query = query.Where("date = ?", date)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	return respondPage(c, query, "waitlist_entries", waitlistSortFields, "created_at", &entries, "Failed to fetch waitlist")
+}
+
+// GetWaitlistDemand returns waitlist demand per date in ?from=&to=,
+// defaulting to the next 12 months (admin)
+func GetWaitlistDemand(c *fiber.Ctx) error {
+	from := services.Today()
+	if s := c.Query("from"); s != "" {
+		d, err := models.ParseDate(s)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid from date format",
+			})
+		}
+		from = d
+	}
+	to := from.AddDate(1, 0, 0)
+	if s := c.Query("to"); s != "" {
+		d, err := models.ParseDate(s)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid to date format",
+			})
+		}
+		to = d
+	}
+
+	demand, err := services.GetWaitlistDemand(from, to)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(demand)
+}
+
+// DeleteWaitlistEntry cancels a waitlist entry (admin)
+func DeleteWaitlistEntry(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid waitlist entry ID",
+		})
+	}
+
+	entry, err := services.CancelWaitlistEntry(uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Waitlist entry not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to cancel waitlist entry",
+		})
+	}
+
+	go processWaitlist(entry.Date)
+
+	return c.JSON(fiber.Map{
+		"message": "Waitlist entry cancelled successfully",
+	})
+}
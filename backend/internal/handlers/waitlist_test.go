@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"github.com/mazong/angel_event/internal/services"
+)
+
+func TestJoinWaitlist(t *testing.T) {
+	useTestDB(t)
+	t.Setenv("SPAM_MIN_FILL_TIME", "off")
+	app := newTestApp()
+	app.Post("/waitlist", JoinWaitlist)
+
+	full := models.NewDate(2099, 8, 8)
+	open := models.NewDate(2099, 8, 9)
+	for _, date := range []models.Date{full, open} {
+		if err := database.DB.Create(&models.Availability{Date: date, Available: true, MaxEvents: 1}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Available defaults to true on insert
+	database.DB.Model(&models.Availability{}).Where("date = ?", full).Update("available", false)
+
+	join := func(ip, date, email string) (int, map[string]interface{}) {
+		t.Helper()
+		return send(t, app, http.MethodPost, "/waitlist", ip, map[string]interface{}{
+			"date":       date,
+			"event_type": "wedding",
+			"name":       "Ana",
+			"email":      email,
+			"language":   "en",
+			"form_token": services.IssueFormToken(),
+		}, nil)
+	}
+
+	status, body := join("198.51.100.10", "2099-08-08", "ana@example.com")
+	if status != http.StatusCreated || body["token"] == "" || body["token"] == nil {
+		t.Fatalf("join = %d %v, want 201 with a token", status, body)
+	}
+
+	// Someone else posting the same email and date must not get the token
+	// that lets them leave the waitlist in the client's place
+	status, body = join("198.51.100.11", "2099-08-08", "ana@example.com")
+	if status != http.StatusOK {
+		t.Errorf("second join = %d, want 200", status)
+	}
+	if _, ok := body["token"]; ok {
+		t.Errorf("second join returned a token: %v", body)
+	}
+	if _, ok := body["entry"]; ok {
+		t.Errorf("second join returned the entry: %v", body)
+	}
+	if body["position"] != float64(1) {
+		t.Errorf("second join position = %v, want 1", body["position"])
+	}
+
+	status, body = join("198.51.100.12", "2099-08-09", "bob@example.com")
+	if status != http.StatusConflict || body["code"] != "date_available" ||
+		body["message"] != "This date is available, you can book it directly" {
+		t.Errorf("join on an available date = %d %v, want a localized date_available 409", status, body)
+	}
+}
+
+func TestJoinWaitlistScreening(t *testing.T) {
+	useTestDB(t)
+	t.Setenv("SPAM_MIN_FILL_TIME", "off")
+	app := newTestApp()
+	app.Post("/waitlist", JoinWaitlist)
+
+	date := models.NewDate(2099, 9, 9)
+	if err := database.DB.Create(&models.Availability{Date: date, Available: true, MaxEvents: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+	database.DB.Model(&models.Availability{}).Where("date = ?", date).Update("available", false)
+
+	join := func(ip, email string, extra map[string]interface{}) (int, map[string]interface{}) {
+		t.Helper()
+		body := map[string]interface{}{
+			"date":       "2099-09-09",
+			"event_type": "birthday",
+			"name":       "Bob",
+			"email":      email,
+		}
+		for k, v := range extra {
+			body[k] = v
+		}
+		return send(t, app, http.MethodPost, "/waitlist", ip, body, nil)
+	}
+
+	// Bots posting without a form token, or filling the honeypot, are
+	// quarantined: no entry, so no offer is ever emailed to them
+	for _, extra := range []map[string]interface{}{
+		nil,
+		{"form_token": services.IssueFormToken(), "website": "https://spam.example"},
+	} {
+		if status, body := join("198.51.100.20", "bot@example.com", extra); status != http.StatusAccepted {
+			t.Errorf("suspicious join %v = %d %v, want 202", extra, status, body)
+		}
+	}
+	var entries int64
+	database.DB.Model(&models.WaitlistEntry{}).Count(&entries)
+	if entries != 0 {
+		t.Errorf("suspicious joins created %d entries", entries)
+	}
+	var quarantined int64
+	database.DB.Model(&models.QuarantinedSubmission{}).Where("form = ?", services.FormWaitlist).Count(&quarantined)
+	if quarantined != 2 {
+		t.Errorf("quarantined %d waitlist submissions, want 2", quarantined)
+	}
+
+	// Per-IP limit (SPAM_IP_LIMIT, 5 per 10 minutes by default)
+	token := map[string]interface{}{"form_token": services.IssueFormToken()}
+	for i := 0; i < 5; i++ {
+		if status, body := join("198.51.100.21", fmt.Sprintf("guest%d@example.com", i), token); status != http.StatusCreated {
+			t.Fatalf("join %d = %d %v, want 201", i, status, body)
+		}
+	}
+	if status, body := join("198.51.100.21", "guest5@example.com", token); status != http.StatusTooManyRequests || body["code"] != "rate_limited" {
+		t.Errorf("sixth join from an IP = %d %v, want 429 rate_limited", status, body)
+	}
+}
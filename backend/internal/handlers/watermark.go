@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"image"
+	_ "image/png" // logos are uploaded as PNG
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"github.com/mazong/angel_event/internal/services"
+)
+
+// GetWatermarkSetting returns the watermark configuration (admin)
+func GetWatermarkSetting(c *fiber.Ctx) error {
+	setting, err := services.GetWatermarkSetting()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch watermark settings",
+		})
+	}
+
+	return c.JSON(setting)
+}
+
+// UpdateWatermarkSetting updates the watermark and regenerates the public
+// variants in the background (admin)
+func UpdateWatermarkSetting(c *fiber.Ctx) error {
+	type WatermarkRequest struct {
+		Enabled    *bool                     `json:"enabled"`
+		Text       *string                   `json:"text"`
+		Position   *models.WatermarkPosition `json:"position"`
+		Opacity    *float64                  `json:"opacity"`
+		Scale      *float64                  `json:"scale"`
+		RemoveLogo bool                      `json:"remove_logo"`
+	}
+
+	var req WatermarkRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	setting, err := services.GetWatermarkSetting()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch watermark settings",
+		})
+	}
+
+	if req.Enabled != nil {
+		setting.Enabled = *req.Enabled
+	}
+	if req.Text != nil {
+		setting.Text = *req.Text
+	}
+	if req.Position != nil {
+		switch *req.Position {
+		case models.WatermarkTopLeft, models.WatermarkTopRight, models.WatermarkBottomLeft,
+			models.WatermarkBottomRight, models.WatermarkCenter:
+			setting.Position = *req.Position
+		default:
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid watermark position",
+			})
+		}
+	}
+	if req.Opacity != nil {
+		if *req.Opacity < 0 || *req.Opacity > 1 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Opacity must be between 0 and 1",
+			})
+		}
+		setting.Opacity = *req.Opacity
+	}
+	if req.Scale != nil {
+		if *req.Scale <= 0 || *req.Scale > 1 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Scale must be between 0 and 1",
+			})
+		}
+		setting.Scale = *req.Scale
+	}
+	if req.RemoveLogo {
+		setting.LogoPath = ""
+	}
+
+	return saveWatermarkSetting(c, setting)
+}
+
+// UploadWatermarkLogo replaces the watermark logo with an uploaded PNG (admin)
+func UploadWatermarkLogo(c *fiber.Ctx) error {
+	file, err := c.FormFile("logo")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Logo file is required",
+		})
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to read logo",
+		})
+	}
+	defer f.Close()
+
+	logo, format, err := image.Decode(f)
+	if err != nil || format != "png" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Logo must be a PNG image",
+		})
+	}
+
+	path, err := services.SaveWatermarkLogo(c.UserContext(), logo)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save logo",
+		})
+	}
+
+	setting, err := services.GetWatermarkSetting()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch watermark settings",
+		})
+	}
+	setting.LogoPath = path
+
+	return saveWatermarkSetting(c, setting)
+}
+
+// saveWatermarkSetting bumps the version, saves and starts regeneration
+func saveWatermarkSetting(c *fiber.Ctx, setting models.WatermarkSetting) error {
+	setting.Version++
+	if err := database.DB.Save(&setting).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update watermark settings",
+		})
+	}
+
+	go regenerateVariants(false)
+
+	return c.JSON(setting)
+}
+
+// RegenerateGalleryVariants re-renders public variants in the background.
+// Without ?force=true only missing or outdated variants are rendered. (admin)
+func RegenerateGalleryVariants(c *fiber.Ctx) error {
+	go regenerateVariants(c.QueryBool("force"))
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Variant regeneration started",
+	})
+}
+
+func regenerateVariants(force bool) {
+	if _, _, err := services.RegenerateGalleryVariants(force); err != nil {
+		log.Printf("Variant regeneration failed: %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DateLayout is the wire and storage format of a Date
+const DateLayout = "2006-01-02"
+
+// Date is a calendar day with no time of day or timezone, such as an event
+// date. It is stored and sent as "YYYY-MM-DD", so comparisons in SQL are
+// plain string comparisons and do not depend on how a timestamp was written.
+type Date struct {
+	t time.Time // midnight UTC
+}
+
+// NewDate returns the given calendar day
+func NewDate(year int, month time.Month, day int) Date {
+	return Date{t: time.Date(year, month, day, 0, 0, 0, 0, time.UTC)}
+}
+
+// DateOf returns the calendar day of t in t's own location. Convert t to
+// the business timezone first to get the business date of an instant.
+func DateOf(t time.Time) Date {
+	return NewDate(t.Year(), t.Month(), t.Day())
+}
+
+// ParseDate parses a "YYYY-MM-DD" date
+func ParseDate(s string) (Date, error) {
+	t, err := time.Parse(DateLayout, s)
+	if err != nil {
+		return Date{}, fmt.Errorf("invalid date %q", s)
+	}
+	return Date{t: t}, nil
+}
+
+// String formats the date as "YYYY-MM-DD"
+func (d Date) String() string {
+	return d.t.Format(DateLayout)
+}
+
+// Time returns midnight UTC of the date, for formatting and arithmetic
+func (d Date) Time() time.Time {
+	return d.t
+}
+
+// In returns the start of the date in loc, which is not always midnight
+// on DST transition days
+func (d Date) In(loc *time.Location) time.Time {
+	return time.Date(d.t.Year(), d.t.Month(), d.t.Day(), 0, 0, 0, 0, loc)
+}
+
+func (d Date) IsZero() bool                { return d.t.IsZero() }
+func (d Date) Year() int                   { return d.t.Year() }
+func (d Date) Month() time.Month           { return d.t.Month() }
+func (d Date) Day() int                    { return d.t.Day() }
+func (d Date) Weekday() time.Weekday       { return d.t.Weekday() }
+func (d Date) Before(other Date) bool      { return d.t.Before(other.t) }
+func (d Date) After(other Date) bool       { return d.t.After(other.t) }
+func (d Date) Equal(other Date) bool       { return d.t.Equal(other.t) }
+func (d Date) AddDays(n int) Date          { return Date{t: d.t.AddDate(0, 0, n)} }
+func (d Date) AddDate(y, m, days int) Date { return Date{t: d.t.AddDate(y, m, days)} }
+
+// DaysUntil returns the number of days from d to other
+func (d Date) DaysUntil(other Date) int {
+	return int(other.t.Sub(d.t).Hours() / 24)
+}
+
+// MonthRange returns the first and last day of a "YYYY-MM" month
+func MonthRange(month string) (Date, Date, error) {
+	t, err := time.Parse("2006-01", month)
+	if err != nil {
+		return Date{}, Date{}, fmt.Errorf("invalid month %q", month)
+	}
+	first := Date{t: t}
+	return first, first.AddDate(0, 1, -1), nil
+}
+
+// MarshalJSON writes "YYYY-MM-DD"
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON accepts "YYYY-MM-DD" or a full RFC 3339 timestamp, whose
+// own calendar day is kept
+func (d *Date) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if s == "" {
+		*d = Date{}
+		return nil
+	}
+	if len(s) > len(DateLayout) {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return fmt.Errorf("invalid date %q", s)
+		}
+		*d = DateOf(t)
+		return nil
+	}
+	parsed, err := ParseDate(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Value stores the date as "YYYY-MM-DD"
+func (d Date) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// Scan reads a date column, including timestamps written before dates
+// were stored as text; their own calendar day is kept
+func (d *Date) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*d = Date{}
+		return nil
+	case time.Time:
+		*d = DateOf(v)
+		return nil
+	case string:
+		return d.scanString(v)
+	case []byte:
+		return d.scanString(string(v))
+	default:
+		return fmt.Errorf("cannot scan %T into Date", value)
+	}
+}
+
+func (d *Date) scanString(s string) error {
+	if len(s) < len(DateLayout) {
+		return fmt.Errorf("invalid date %q", s)
+	}
+	parsed, err := ParseDate(s[:len(DateLayout)])
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// GormDataType declares the column type
+func (Date) GormDataType() string {
+	return "date"
+}
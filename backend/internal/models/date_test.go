@@ -0,0 +1,205 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		invalid bool
+	}{
+		{in: "2026-01-31", want: "2026-01-31"},
+		{in: "2026-02-28", want: "2026-02-28"},
+		{in: "2024-02-29", want: "2024-02-29"},
+		{in: "2026-04-30", want: "2026-04-30"},
+		{in: "2026-03-08", want: "2026-03-08"}, // DST starts in Toronto
+		{in: "2026-11-01", want: "2026-11-01"}, // DST ends in Toronto
+		{in: "2026-02-29", invalid: true},
+		{in: "2026-04-31", invalid: true},
+		{in: "2026-13-01", invalid: true},
+		{in: "2026-1-5", invalid: true},
+		{in: "2026-03-08T12:00:00Z", invalid: true},
+		{in: "", invalid: true},
+	}
+	for _, tt := range tests {
+		d, err := ParseDate(tt.in)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("ParseDate(%q) = %s, want an error", tt.in, d)
+			}
+			continue
+		}
+		if err != nil || d.String() != tt.want {
+			t.Errorf("ParseDate(%q) = %s, %v, want %s", tt.in, d, err, tt.want)
+		}
+		if tod := d.Time(); tod.Location() != time.UTC || tod.Hour() != 0 {
+			t.Errorf("ParseDate(%q).Time() = %v, want midnight UTC", tt.in, tod)
+		}
+	}
+}
+
+func TestMonthRange(t *testing.T) {
+	tests := []struct {
+		month       string
+		first, last string
+	}{
+		{"2026-01", "2026-01-01", "2026-01-31"},
+		{"2026-02", "2026-02-01", "2026-02-28"},
+		{"2024-02", "2024-02-01", "2024-02-29"},
+		{"2000-02", "2000-02-01", "2000-02-29"},
+		{"2100-02", "2100-02-01", "2100-02-28"},
+		{"2026-03", "2026-03-01", "2026-03-31"}, // DST starts on the 8th
+		{"2026-04", "2026-04-01", "2026-04-30"},
+		{"2026-11", "2026-11-01", "2026-11-30"}, // DST ends on the 1st
+		{"2026-12", "2026-12-01", "2026-12-31"},
+	}
+	for _, tt := range tests {
+		first, last, err := MonthRange(tt.month)
+		if err != nil || first.String() != tt.first || last.String() != tt.last {
+			t.Errorf("MonthRange(%q) = %s, %s, %v, want %s, %s", tt.month, first, last, err, tt.first, tt.last)
+		}
+	}
+
+	for _, month := range []string{"2026-13", "2026-00", "2026-1", "2026-01-01", ""} {
+		if _, _, err := MonthRange(month); err == nil {
+			t.Errorf("MonthRange(%q): want an error", month)
+		}
+	}
+}
+
+func TestAddDays(t *testing.T) {
+	tests := []struct {
+		from string
+		days int
+		want string
+	}{
+		{"2026-03-07", 1, "2026-03-08"}, // into the spring-forward day
+		{"2026-03-08", 1, "2026-03-09"}, // out of it
+		{"2026-10-31", 1, "2026-11-01"}, // into the fall-back day
+		{"2026-11-01", 1, "2026-11-02"},
+		{"2026-11-02", -1, "2026-11-01"},
+		{"2026-03-01", 7, "2026-03-08"},
+		{"2026-03-09", -7, "2026-03-02"},
+		{"2026-01-31", 1, "2026-02-01"},
+		{"2026-02-28", 1, "2026-03-01"},
+		{"2024-02-28", 1, "2024-02-29"},
+		{"2024-02-29", 1, "2024-03-01"},
+		{"2026-04-30", 1, "2026-05-01"},
+		{"2026-12-31", 1, "2027-01-01"},
+		{"2026-03-01", -1, "2026-02-28"},
+		{"2024-03-01", -1, "2024-02-29"},
+		{"2026-01-01", 365, "2027-01-01"},
+		{"2024-01-01", 365, "2024-12-31"},
+	}
+	for _, tt := range tests {
+		d, _ := ParseDate(tt.from)
+		if got := d.AddDays(tt.days); got.String() != tt.want {
+			t.Errorf("%s.AddDays(%d) = %s, want %s", tt.from, tt.days, got, tt.want)
+		}
+	}
+}
+
+func TestDaysUntil(t *testing.T) {
+	// Whole days, even across a DST change
+	tests := []struct {
+		from, to string
+		want     int
+	}{
+		{"2026-03-07", "2026-03-09", 2},
+		{"2026-10-31", "2026-11-02", 2},
+		{"2026-02-01", "2026-03-01", 28},
+		{"2024-02-01", "2024-03-01", 29},
+		{"2026-03-09", "2026-03-07", -2},
+	}
+	for _, tt := range tests {
+		from, _ := ParseDate(tt.from)
+		to, _ := ParseDate(tt.to)
+		if got := from.DaysUntil(to); got != tt.want {
+			t.Errorf("%s.DaysUntil(%s) = %d, want %d", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestDateIn(t *testing.T) {
+	toronto, err := time.LoadLocation("America/Toronto")
+	if err != nil {
+		t.Skip("no tzdata:", err)
+	}
+
+	// A business day lasts 23 hours in spring and 25 in the fall
+	tests := []struct {
+		date  string
+		hours float64
+	}{
+		{"2026-03-07", 24},
+		{"2026-03-08", 23},
+		{"2026-03-09", 24},
+		{"2026-11-01", 25},
+		{"2026-11-02", 24},
+	}
+	for _, tt := range tests {
+		d, _ := ParseDate(tt.date)
+		start := d.In(toronto)
+		if start.Hour() != 0 || DateOf(start) != d {
+			t.Errorf("%s.In(Toronto) = %v, want its midnight", tt.date, start)
+		}
+		if got := d.AddDays(1).In(toronto).Sub(start).Hours(); got != tt.hours {
+			t.Errorf("%s lasts %vh in Toronto, want %vh", tt.date, got, tt.hours)
+		}
+	}
+}
+
+func TestDateOf(t *testing.T) {
+	toronto, err := time.LoadLocation("America/Toronto")
+	if err != nil {
+		t.Skip("no tzdata:", err)
+	}
+
+	// The day in the instant's own location, not in UTC
+	instant := time.Date(2026, 11, 1, 3, 30, 0, 0, time.UTC)
+	if got := DateOf(instant.In(toronto)).String(); got != "2026-10-31" {
+		t.Errorf("DateOf in Toronto = %s, want 2026-10-31", got)
+	}
+	if got := DateOf(instant).String(); got != "2026-11-01" {
+		t.Errorf("DateOf in UTC = %s, want 2026-11-01", got)
+	}
+}
+
+func TestDateJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`"2026-03-08"`, "2026-03-08"},
+		{`"2024-02-29"`, "2024-02-29"},
+		// A timestamp keeps its own calendar day
+		{`"2026-03-08T23:30:00-04:00"`, "2026-03-08"},
+		{`"2026-11-01T00:30:00-04:00"`, "2026-11-01"},
+	}
+	for _, tt := range tests {
+		var d Date
+		if err := json.Unmarshal([]byte(tt.in), &d); err != nil || d.String() != tt.want {
+			t.Errorf("unmarshal %s = %s, %v, want %s", tt.in, d, err, tt.want)
+		}
+		out, _ := json.Marshal(d)
+		if string(out) != `"`+tt.want+`"` {
+			t.Errorf("marshal %s = %s", tt.want, out)
+		}
+	}
+
+	for _, in := range []string{`"2026-02-29"`, `"2026-03-08T25:00:00Z"`, `20260308`} {
+		var d Date
+		if err := json.Unmarshal([]byte(in), &d); err == nil {
+			t.Errorf("unmarshal %s = %s, want an error", in, d)
+		}
+	}
+
+	var zero Date
+	if out, _ := json.Marshal(zero); string(out) != "null" {
+		t.Errorf("marshal zero date = %s, want null", out)
+	}
+}
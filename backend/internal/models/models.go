@@ -28,7 +28,64 @@ type Client struct {
 	Email     string         `gorm:"uniqueIndex;not null" json:"email"`
 	Phone     string         `json:"phone"`
 	Notes     string         `gorm:"type:text" json:"notes"`
-	Bookings  []Booking      `json:"bookings,omitempty"`
+	// Prospect marks clients known only from inquiries, until they book
+	Prospect bool `gorm:"default:false;index" json:"prospect"`
+	// Source is how the client found us; SourceDetail names the referrer,
+	// campaign or fair
+	Source       ClientSource    `gorm:"index" json:"source"`
+	SourceDetail string          `json:"source_detail"`
+	Tags         []Tag           `gorm:"many2many:client_tags;" json:"tags,omitempty"`
+	Contacts     []ClientContact `json:"contacts,omitempty"`
+	Bookings     []Booking       `json:"bookings,omitempty"`
+	// ErasedAt is set once the client's personal data was anonymized
+	ErasedAt *time.Time `json:"erased_at,omitempty"`
+
+	BookingCount int64 `gorm:"-" json:"booking_count"`
+}
+
+// ClientSource represents how a client found the business
+type ClientSource string
+
+const (
+	SourceInstagram   ClientSource = "instagram"
+	SourceFacebook    ClientSource = "facebook"
+	SourceGoogle      ClientSource = "google"
+	SourceReferral    ClientSource = "referral"
+	SourceWebsite     ClientSource = "website"
+	SourceWeddingFair ClientSource = "wedding_fair"
+	SourceOther       ClientSource = "other"
+)
+
+// Tag labels clients for segmentation, such as "vip" or "2027"
+type Tag struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `gorm:"uniqueIndex;not null" json:"name"`
+	Color     string    `json:"color"`
+}
+
+// ContactRole represents who a secondary contact is to the client
+type ContactRole string
+
+const (
+	ContactPartner ContactRole = "partner"
+	ContactFamily  ContactRole = "family"
+	ContactPlanner ContactRole = "planner"
+	ContactOther   ContactRole = "other"
+)
+
+// ClientContact is another person of a client's file, such as the partner
+// of a couple. Forms and emails from a contact's address reach the client.
+type ClientContact struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ClientID  uint           `gorm:"index;not null" json:"client_id"`
+	Role      ContactRole    `gorm:"not null" json:"role"`
+	Name      string         `json:"name"`
+	Email     string         `gorm:"index" json:"email"`
+	Phone     string         `json:"phone"`
 }
 
 // EventType represents the type of event
@@ -62,7 +119,7 @@ type Booking struct {
 	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
 	ClientID        uint           `gorm:"not null" json:"client_id"`
 	Client          *Client        `json:"client,omitempty"`
-	EventDate       time.Time      `gorm:"not null" json:"event_date"`
+	EventDate       Date           `gorm:"not null;index" json:"event_date"`
 	EventType       EventType      `gorm:"not null" json:"event_type"`
 	EventLocation   string         `json:"event_location"`
 	GuestCount      int            `json:"guest_count"`
@@ -72,9 +129,210 @@ type Booking struct {
 	SpecialRequests string         `gorm:"type:text" json:"special_requests"`
 	TotalAmount     float64        `json:"total_amount"`
 	DepositAmount   float64        `json:"deposit_amount"`
+	// Language of the client's emails, fr or en
+	Language string `gorm:"default:'fr'" json:"language"`
 
 	AdminNotes  string       `gorm:"type:text" json:"admin_notes"`
 	RentalItems []RentalItem `gorm:"many2many:booking_rental_items;" json:"rental_items"`
+	// ArchivedAt hides a long-completed booking from the default list
+	ArchivedAt *time.Time `gorm:"index" json:"archived_at,omitempty"`
+	Revision   Revision   `gorm:"not null;default:0" json:"revision"`
+}
+
+// BookingStatusChange records a booking moving from one status to another;
+// FromStatus is empty for the creation of the booking
+type BookingStatusChange struct {
+	ID         uint          `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time     `json:"created_at"`
+	BookingID  uint          `gorm:"index;not null" json:"booking_id"`
+	ClientID   uint          `gorm:"index;not null" json:"client_id"`
+	FromStatus BookingStatus `json:"from_status"`
+	ToStatus   BookingStatus `gorm:"not null" json:"to_status"`
+	UserID     *uint         `json:"user_id,omitempty"` // admin who changed it, none for clients
+}
+
+// PaymentMethod represents how a payment was made
+type PaymentMethod string
+
+const (
+	PaymentCash      PaymentMethod = "cash"
+	PaymentETransfer PaymentMethod = "e_transfer"
+	PaymentCard      PaymentMethod = "card"
+	PaymentCheque    PaymentMethod = "cheque"
+	PaymentOther     PaymentMethod = "other"
+)
+
+// PaymentKind tells what a payment is for
+type PaymentKind string
+
+const (
+	PaymentDeposit PaymentKind = "deposit"
+	PaymentBalance PaymentKind = "balance"
+	PaymentRefund  PaymentKind = "refund"
+)
+
+// Payment is money received from, or refunded to, a client for a booking
+type Payment struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	BookingID uint           `gorm:"index;not null" json:"booking_id"`
+	ClientID  uint           `gorm:"index;not null" json:"client_id"`
+	Amount    float64        `gorm:"not null" json:"amount"`
+	Kind      PaymentKind    `gorm:"not null" json:"kind"`
+	Method    PaymentMethod  `gorm:"not null" json:"method"`
+	PaidOn    Date           `gorm:"not null" json:"paid_on"`
+	Reference string         `json:"reference"` // transfer or cheque number
+	UserID    *uint          `json:"user_id,omitempty"`
+}
+
+// ClientNote is a timestamped note about a client written by staff
+type ClientNote struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ClientID  uint           `gorm:"index;not null" json:"client_id"`
+	UserID    *uint          `json:"user_id,omitempty"`
+	User      *User          `json:"user,omitempty"`
+	Body      string         `gorm:"type:text;not null" json:"body"`
+}
+
+// PrivacyActionType represents a privacy request handled for a client
+type PrivacyActionType string
+
+const (
+	PrivacyExport  PrivacyActionType = "export"  // access request
+	PrivacyErasure PrivacyActionType = "erasure" // deletion request
+)
+
+// PrivacyAction records an access or deletion request handled for a client.
+// It names the client by ID and pseudonym only, so it outlives an erasure.
+type PrivacyAction struct {
+	ID        uint              `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time         `json:"created_at"`
+	Action    PrivacyActionType `gorm:"index;not null" json:"action"`
+	ClientID  uint              `gorm:"index;not null" json:"client_id"`
+	Pseudonym string            `gorm:"not null" json:"pseudonym"`
+	UserID    *uint             `json:"user_id,omitempty"`        // admin who handled it
+	Summary   string            `gorm:"type:text" json:"summary"` // records exported or scrubbed, per kind
+}
+
+// RetentionEntity names the records a retention policy applies to
+type RetentionEntity string
+
+const (
+	RetentionDeletedClients    RetentionEntity = "deleted_clients"    // soft-deleted clients
+	RetentionDeletedRecords    RetentionEntity = "deleted_records"    // other soft-deleted rows
+	RetentionEmailLogs         RetentionEntity = "email_logs"         // sent email logs
+	RetentionCompletedBookings RetentionEntity = "completed_bookings" // archived after their event
+	RetentionServerLogs        RetentionEntity = "server_logs"        // rotated server log files
+	RetentionJobRuns           RetentionEntity = "job_runs"           // background job history
+)
+
+// RetentionPolicy tells how many days records of an entity are kept
+type RetentionPolicy struct {
+	ID        uint            `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	Entity    RetentionEntity `gorm:"uniqueIndex;not null" json:"entity"`
+	Days      int             `gorm:"not null" json:"days"`
+	Enabled   bool            `gorm:"default:true" json:"enabled"`
+}
+
+// RetentionRun records a pass of the retention job and what it purged
+type RetentionRun struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	Manual     bool      `json:"manual"` // triggered by an admin
+	DurationMs int64     `json:"duration_ms"`
+	Summary    string    `gorm:"type:text" json:"summary"` // records purged or archived, per kind
+	Error      string    `gorm:"type:text" json:"error,omitempty"`
+}
+
+// JobRunStatus represents the outcome of a background job run
+type JobRunStatus string
+
+const (
+	JobRunning   JobRunStatus = "running"
+	JobSucceeded JobRunStatus = "succeeded"
+	JobFailed    JobRunStatus = "failed"
+)
+
+// JobRun records one run of a scheduled background job
+type JobRun struct {
+	ID         uint         `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time    `json:"created_at"`
+	Job        string       `gorm:"index;not null" json:"job"`
+	Owner      string       `json:"owner"`  // server instance that ran it
+	Manual     bool         `json:"manual"` // triggered by an admin
+	Status     JobRunStatus `gorm:"index;not null" json:"status"`
+	StartedAt  time.Time    `gorm:"index" json:"started_at"`
+	FinishedAt *time.Time   `json:"finished_at,omitempty"`
+	DurationMs int64        `json:"duration_ms"`
+	Summary    string       `gorm:"type:text" json:"summary,omitempty"`
+	Error      string       `gorm:"type:text" json:"error,omitempty"`
+}
+
+// JobLease lets a single server instance run a job at a time. The owner
+// renews it while the job runs; an expired lease may be taken over. It
+// outlives the run to remember the last scheduled slot that was run, so
+// that no instance runs the same slot twice. The "availability" lease
+// serializes capacity checks the same way.
+type JobLease struct {
+	Name      string    `gorm:"primarykey" json:"name"`
+	Owner     string    `gorm:"not null" json:"owner"`
+	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
+	LastSlot  int64     `gorm:"not null;default:0" json:"last_slot"` // Unix time of the last scheduled run
+}
+
+// AutomationTrigger tells what an automation's days count from
+type AutomationTrigger string
+
+const (
+	TriggerBeforeEvent AutomationTrigger = "before_event" // days before the event date
+	TriggerAfterEvent  AutomationTrigger = "after_event"  // days after the event date
+	TriggerAfterStatus AutomationTrigger = "after_status" // days after the booking entered Status
+)
+
+// AutomationTemplate names the email an automation sends
+type AutomationTemplate string
+
+const (
+	TemplateEventReminder AutomationTemplate = "event_reminder" // event details and rental list
+	TemplateBalanceDue    AutomationTemplate = "balance_due"    // sent only while a balance is due
+	TemplateThankYou      AutomationTemplate = "thank_you"      // thanks with a review request
+)
+
+// Automation emails the client of each matching booking once, Days after
+// or before its trigger
+type Automation struct {
+	ID        uint               `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+	Name      string             `gorm:"uniqueIndex;not null" json:"name"`
+	Template  AutomationTemplate `gorm:"not null" json:"template"`
+	Trigger   AutomationTrigger  `gorm:"not null" json:"trigger"`
+	Days      int                `json:"days"`
+	// Statuses limits the bookings to some statuses, comma-separated
+	// ("confirmed,paid"); for after_status it is the status counted from
+	Statuses string `gorm:"not null" json:"statuses"`
+	Enabled  bool   `gorm:"default:true" json:"enabled"`
+}
+
+// AutomationSend records an automation email sent for a booking. The row
+// is claimed as pending before sending, so the unique index keeps each
+// automation from emailing a booking twice, even from two runs at once.
+type AutomationSend struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	AutomationID uint      `gorm:"uniqueIndex:idx_automation_booking;not null" json:"automation_id"`
+	BookingID    uint      `gorm:"uniqueIndex:idx_automation_booking;index;not null" json:"booking_id"`
+	ClientID     uint      `gorm:"index;not null" json:"client_id"`
+	EmailLogID   *uint     `json:"email_log_id,omitempty"`
+	Status       string    `gorm:"not null" json:"status"` // pending, sent or failed
+	Error        string    `gorm:"type:text" json:"error,omitempty"`
 }
 
 // Availability represents available dates for bookings
@@ -83,10 +341,240 @@ type Availability struct {
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
-	Date      time.Time      `gorm:"uniqueIndex;not null" json:"date"`
+	Date      Date           `gorm:"uniqueIndex;not null" json:"date"`
 	Available bool           `gorm:"default:true" json:"available"`
 	MaxEvents int            `gorm:"default:1" json:"max_events"`
 	Notes     string         `json:"notes"`
+	// Source is manual for dates set by an admin, which always win over
+	// dates blocked by an imported calendar
+	Source           AvailabilitySource `gorm:"default:'manual';index" json:"source"`
+	CalendarImportID *uint              `gorm:"index" json:"calendar_import_id,omitempty"`
+	Revision         Revision           `gorm:"not null;default:0" json:"revision"`
+}
+
+// AvailabilitySource tells who set an availability date
+type AvailabilitySource string
+
+const (
+	AvailabilitySourceManual AvailabilitySource = "manual"
+	AvailabilitySourceImport AvailabilitySource = "import" // busy event of a CalendarImport
+)
+
+// AvailabilityRule opens, closes or limits the capacity of the dates it
+// matches. When several rules match a date the highest priority wins, and
+// an Availability row for that date overrides all rules.
+type AvailabilityRule struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	Name      string         `gorm:"not null" json:"name"`
+	// Weekdays limits the rule to some days, comma-separated with 0 for
+	// Sunday ("1" for Mondays, "5,6" for Fridays and Saturdays); empty
+	// matches every day
+	Weekdays string `json:"weekdays"`
+	// StartDate and EndDate bound the rule, inclusive; either may be open
+	StartDate *Date `json:"start_date,omitempty"`
+	EndDate   *Date `json:"end_date,omitempty"`
+	// Yearly repeats the date range every year (only month and day count),
+	// for seasons such as June to September or the end of December
+	Yearly    bool `json:"yearly"`
+	Available bool `json:"available"`
+	MaxEvents int  `json:"max_events"` // capacity of open dates
+	Priority  int  `gorm:"default:0" json:"priority"`
+}
+
+// DateHoldStatus represents the state of a date hold
+type DateHoldStatus string
+
+const (
+	DateHoldActive    DateHoldStatus = "active"
+	DateHoldConverted DateHoldStatus = "converted" // turned into a booking
+	DateHoldReleased  DateHoldStatus = "released"  // given up by the client
+	DateHoldExpired   DateHoldStatus = "expired"
+)
+
+// DateHold reserves capacity on a date, and optionally rental items, while a
+// client completes the booking or payment. Active holds count against
+// availability until they expire.
+type DateHold struct {
+	ID          uint           `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	Token       string         `gorm:"uniqueIndex;not null" json:"token"`
+	Date        Date           `gorm:"index;not null" json:"date"`
+	ExpiresAt   time.Time      `gorm:"index;not null" json:"expires_at"`
+	Status      DateHoldStatus `gorm:"index;default:'active'" json:"status"`
+	Email       string         `gorm:"index" json:"email,omitempty"`
+	IP          string         `gorm:"index" json:"-"` // client that placed the hold, for the per-IP cap
+	BookingID   *uint          `json:"booking_id,omitempty"`
+	RentalItems []RentalItem   `gorm:"many2many:date_hold_rental_items;" json:"rental_items"`
+}
+
+// InquiryStatus represents the state of a contact inquiry
+type InquiryStatus string
+
+const (
+	InquiryNew       InquiryStatus = "new"
+	InquiryReplied   InquiryStatus = "replied"
+	InquiryConverted InquiryStatus = "converted" // turned into a booking
+	InquiryClosed    InquiryStatus = "closed"
+)
+
+// Inquiry is a contact form submission, kept whether or not the admin
+// notification could be sent
+type Inquiry struct {
+	ID            uint             `gorm:"primarykey" json:"id"`
+	CreatedAt     time.Time        `json:"created_at"`
+	UpdatedAt     time.Time        `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt   `gorm:"index" json:"-"`
+	ClientID      uint             `gorm:"index;not null" json:"client_id"`
+	Client        *Client          `json:"client,omitempty"`
+	Name          string           `gorm:"not null" json:"name"`
+	Email         string           `gorm:"index;not null" json:"email"`
+	Phone         string           `json:"phone"`
+	Subject       string           `json:"subject"`
+	Message       string           `gorm:"type:text;not null" json:"message"`
+	Status        InquiryStatus    `gorm:"index;default:'new'" json:"status"`
+	BookingID     *uint            `json:"booking_id,omitempty"`
+	Booking       *Booking         `json:"booking,omitempty"`
+	LastMessageAt time.Time        `gorm:"index" json:"last_message_at"`
+	Messages      []InquiryMessage `json:"messages,omitempty"`
+}
+
+// Directions of an inquiry message
+const (
+	MessageInbound  = "inbound"  // from the client
+	MessageOutbound = "outbound" // from the admin
+)
+
+// InquiryMessage is a reply in an inquiry thread, after the original message
+type InquiryMessage struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	InquiryID  uint      `gorm:"index;not null" json:"inquiry_id"`
+	Direction  string    `gorm:"not null" json:"direction"`
+	Subject    string    `json:"subject"`
+	Body       string    `gorm:"type:text;not null" json:"body"`
+	EmailLogID *uint     `json:"email_log_id,omitempty"`
+	UserID     *uint     `json:"user_id,omitempty"` // admin who replied
+	// InboundEmailID is the received email of inbound messages
+	InboundEmailID *uint `json:"inbound_email_id,omitempty"`
+}
+
+// InboundSource tells how a received email reached the app
+type InboundSource string
+
+const (
+	InboundWebhook InboundSource = "webhook"
+	InboundMaildir InboundSource = "maildir"
+)
+
+// InboundMatch tells how a received email was tied to a client
+type InboundMatch string
+
+const (
+	MatchToken     InboundMatch = "token"  // reply-to address of an email we sent
+	MatchSender    InboundMatch = "sender" // From address of a known client
+	MatchManual    InboundMatch = "manual" // assigned by an admin
+	MatchUnmatched InboundMatch = "unmatched"
+)
+
+// InboundEmail is an email received from a client, such as a reply to a
+// confirmation
+type InboundEmail struct {
+	ID          uint                `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time           `json:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt      `gorm:"index" json:"-"`
+	MessageID   string              `gorm:"uniqueIndex;not null" json:"message_id"`
+	InReplyTo   string              `json:"in_reply_to,omitempty"`
+	Source      InboundSource       `gorm:"not null" json:"source"`
+	FromName    string              `json:"from_name"`
+	FromEmail   string              `gorm:"index;not null" json:"from_email"`
+	To          string              `json:"to"`
+	Subject     string              `json:"subject"`
+	TextBody    string              `gorm:"type:text" json:"text_body"`
+	HTMLBody    string              `gorm:"type:text" json:"html_body,omitempty"`
+	SentAt      *time.Time          `json:"sent_at,omitempty"` // Date header
+	AutoReply   bool                `json:"auto_reply"`        // out-of-office and other automatic replies
+	MatchedBy   InboundMatch        `gorm:"index;not null" json:"matched_by"`
+	ClientID    *uint               `gorm:"index" json:"client_id,omitempty"`
+	Client      *Client             `gorm:"foreignKey:ClientID" json:"client,omitempty"`
+	BookingID   *uint               `gorm:"index" json:"booking_id,omitempty"`
+	Booking     *Booking            `gorm:"foreignKey:BookingID" json:"booking,omitempty"`
+	InquiryID   *uint               `gorm:"index" json:"inquiry_id,omitempty"`
+	Attachments []InboundAttachment `gorm:"foreignKey:InboundEmailID" json:"attachments,omitempty"`
+}
+
+// InboundAttachment is a file attached to a received email, kept in the
+// private blob store
+type InboundAttachment struct {
+	ID             uint      `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	InboundEmailID uint      `gorm:"index;not null" json:"inbound_email_id"`
+	Filename       string    `json:"filename"`
+	ContentType    string    `json:"content_type"`
+	Size           int64     `json:"size"`
+	BlobKey        string    `gorm:"not null" json:"-"`
+}
+
+// QuarantineStatus represents the review state of a quarantined submission
+type QuarantineStatus string
+
+const (
+	QuarantinePending   QuarantineStatus = "pending"
+	QuarantineReleased  QuarantineStatus = "released"  // processed as legitimate
+	QuarantineDiscarded QuarantineStatus = "discarded" // confirmed spam
+)
+
+// QuarantinedSubmission is a public form post held back as suspected spam.
+// Payload keeps the request so a release can process it as if it had just
+// been submitted.
+type QuarantinedSubmission struct {
+	ID         uint             `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time        `json:"created_at"`
+	UpdatedAt  time.Time        `json:"updated_at"`
+	Form       string           `gorm:"index;not null" json:"form"`
+	IP         string           `json:"ip"`
+	Email      string           `gorm:"index" json:"email"`
+	Payload    string           `gorm:"type:text;not null" json:"payload"`
+	Score      float64          `json:"score"`
+	Reasons    string           `json:"reasons"` // comma-separated filter reasons
+	Status     QuarantineStatus `gorm:"index;default:'pending'" json:"status"`
+	ReviewedAt *time.Time       `json:"reviewed_at,omitempty"`
+}
+
+// WaitlistStatus represents the state of a waitlist entry
+type WaitlistStatus string
+
+const (
+	WaitlistWaiting   WaitlistStatus = "waiting"
+	WaitlistNotified  WaitlistStatus = "notified" // holds a claim on a freed slot
+	WaitlistClaimed   WaitlistStatus = "claimed"  // booked with the claim
+	WaitlistExpired   WaitlistStatus = "expired"  // claim lapsed or date passed
+	WaitlistCancelled WaitlistStatus = "cancelled"
+)
+
+// WaitlistEntry is a client waiting for a fully booked date. When capacity
+// frees up, entries are notified in order with a claim link backed by a
+// date hold.
+type WaitlistEntry struct {
+	ID             uint           `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	Token          string         `gorm:"uniqueIndex;not null" json:"-"`
+	Date           Date           `gorm:"index;not null" json:"date"`
+	EventType      EventType      `gorm:"not null" json:"event_type"`
+	Name           string         `gorm:"not null" json:"name"`
+	Email          string         `gorm:"index;not null" json:"email"`
+	Phone          string         `json:"phone"`
+	Language       string         `json:"language"`
+	Status         WaitlistStatus `gorm:"index;default:'waiting'" json:"status"`
+	NotifiedAt     *time.Time     `json:"notified_at,omitempty"`
+	ClaimExpiresAt *time.Time     `json:"claim_expires_at,omitempty"`
+	HoldID         *uint          `gorm:"index" json:"hold_id,omitempty"`
+	BookingID      *uint          `json:"booking_id,omitempty"`
 }
 
 // Testimonial represents client feedback
@@ -103,6 +591,23 @@ type Testimonial struct {
 	EventType EventType      `json:"event_type"`
 	Approved  bool           `gorm:"default:false" json:"approved"`
 	Featured  bool           `gorm:"default:false" json:"featured"`
+	// Verified testimonials came through the review link of a completed
+	// booking, by its client
+	Verified  bool  `gorm:"default:false;index" json:"verified"`
+	BookingID *uint `gorm:"index" json:"booking_id,omitempty"`
+}
+
+// ReviewInvitation is the one-time review link issued to the client of a
+// completed booking
+type ReviewInvitation struct {
+	ID            uint       `gorm:"primarykey" json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	BookingID     uint       `gorm:"uniqueIndex;not null" json:"booking_id"`
+	ClientID      uint       `gorm:"index;not null" json:"client_id"`
+	Token         string     `gorm:"uniqueIndex;not null" json:"-"`
+	ExpiresAt     time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt        *time.Time `json:"used_at,omitempty"`
+	TestimonialID *uint      `json:"testimonial_id,omitempty"`
 }
 
 // Newsletter represents newsletter subscribers
@@ -119,6 +624,7 @@ type Newsletter struct {
 }
 
 // GalleryCategory represents gallery image categories
+// Deprecated: Gallery categories are Category rows with Type "gallery"
 type GalleryCategory string
 
 const (
@@ -133,21 +639,159 @@ const (
 
 // GalleryImage represents images in the gallery
 type GalleryImage struct {
-	ID            uint            `gorm:"primarykey" json:"id"`
-	CreatedAt     time.Time       `json:"created_at"`
-	UpdatedAt     time.Time       `json:"updated_at"`
-	DeletedAt     gorm.DeletedAt  `gorm:"index" json:"-"`
-	Title         string          `json:"title"`
-	Description   string          `gorm:"type:text" json:"description"`
-	ImageURL      string          `gorm:"not null" json:"image_url"`
-	ThumbnailURL  string          `json:"thumbnail_url"`
-	Category      GalleryCategory `json:"category"` // baby_shower, bapteme, birthday, etc.
+	ID             uint           `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+	Title          string         `json:"title"`
+	Description    string         `gorm:"type:text" json:"description"`
+	ImageURL       string         `gorm:"not null" json:"image_url"` // private original
+	PublicURL      string         `json:"public_url"`                // watermarked variant
+	ThumbnailURL   string         `json:"thumbnail_url"`             // watermarked thumbnail
+	VariantVersion int            `gorm:"default:0" json:"-"`        // watermark version of the variants
+	CategoryID     uint           `gorm:"index" json:"category_id"`
+	Category       Category       `json:"category"`
+	// Deprecated: Use CategoryID instead
+	CategoryEnum  GalleryCategory `gorm:"column:category" json:"category_enum"`
 	FileName      string          `json:"file_name"`
 	IsFromStorage bool            `gorm:"default:false" json:"is_from_storage"`
 	Featured      bool            `gorm:"default:false" json:"featured"`
 	SortOrder     int             `gorm:"default:0" json:"sort_order"`
 }
 
+// Album groups gallery images delivered to a client, typically for one event
+type Album struct {
+	ID           uint           `gorm:"primarykey" json:"id"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+	Title        string         `gorm:"not null" json:"title"`
+	Description  string         `gorm:"type:text" json:"description"`
+	BookingID    *uint          `gorm:"index" json:"booking_id,omitempty"`
+	Booking      *Booking       `json:"booking,omitempty"`
+	CoverImageID *uint          `json:"cover_image_id,omitempty"`
+	CoverImage   *GalleryImage  `json:"cover_image,omitempty"`
+	ShareToken   string         `gorm:"uniqueIndex;not null" json:"share_token"`
+	PasswordHash string         `json:"-"`
+	ExpiresAt    *time.Time     `json:"expires_at,omitempty"`
+	Images       []AlbumImage   `json:"images,omitempty"`
+
+	HasPassword bool `gorm:"-" json:"has_password"`
+}
+
+// AlbumImage is an ordered entry of an album
+type AlbumImage struct {
+	ID             uint         `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time    `json:"created_at"`
+	AlbumID        uint         `gorm:"uniqueIndex:idx_album_image;not null" json:"album_id"`
+	GalleryImageID uint         `gorm:"uniqueIndex:idx_album_image;not null" json:"gallery_image_id"`
+	GalleryImage   GalleryImage `json:"gallery_image"`
+	Position       int          `gorm:"default:0" json:"position"`
+}
+
+// ProofingItem holds a client's favorite flag and comment on an album image
+type ProofingItem struct {
+	ID             uint      `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	AlbumID        uint      `gorm:"uniqueIndex:idx_proofing_item;not null" json:"album_id"`
+	GalleryImageID uint      `gorm:"uniqueIndex:idx_proofing_item;not null" json:"gallery_image_id"`
+	Favorite       bool      `gorm:"default:false" json:"favorite"`
+	Comment        string    `gorm:"type:text" json:"comment"`
+}
+
+// ProofingSelection is a final photo selection submitted by the client
+type ProofingSelection struct {
+	ID          uint                     `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time                `json:"created_at"`
+	UpdatedAt   time.Time                `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt           `gorm:"index" json:"-"`
+	AlbumID     uint                     `gorm:"index;not null" json:"album_id"`
+	Album       *Album                   `json:"album,omitempty"`
+	SubmittedBy string                   `json:"submitted_by"`
+	Note        string                   `gorm:"type:text" json:"note"`
+	Images      []ProofingSelectionImage `gorm:"foreignKey:SelectionID" json:"images,omitempty"`
+}
+
+// ProofingSelectionImage is an image of a submitted selection, with the
+// comment it had at submission time
+type ProofingSelectionImage struct {
+	ID             uint         `gorm:"primarykey" json:"id"`
+	SelectionID    uint         `gorm:"index;not null" json:"selection_id"`
+	GalleryImageID uint         `gorm:"not null" json:"gallery_image_id"`
+	GalleryImage   GalleryImage `json:"gallery_image"`
+	Comment        string       `gorm:"type:text" json:"comment"`
+	Position       int          `gorm:"default:0" json:"position"`
+}
+
+// WatermarkPosition is where the watermark is drawn on public variants
+type WatermarkPosition string
+
+const (
+	WatermarkTopLeft     WatermarkPosition = "top_left"
+	WatermarkTopRight    WatermarkPosition = "top_right"
+	WatermarkBottomLeft  WatermarkPosition = "bottom_left"
+	WatermarkBottomRight WatermarkPosition = "bottom_right"
+	WatermarkCenter      WatermarkPosition = "center"
+)
+
+// WatermarkSetting holds the watermark applied to public gallery variants.
+// A single row is used; Version is bumped on every change so outdated
+// variants can be regenerated.
+type WatermarkSetting struct {
+	ID        uint              `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	Enabled   bool              `gorm:"default:true" json:"enabled"`
+	Text      string            `json:"text"`      // used when no logo is set
+	LogoPath  string            `json:"logo_path"` // PNG blob key, outside the public folders
+	Position  WatermarkPosition `gorm:"default:'bottom_right'" json:"position"`
+	Opacity   float64           `gorm:"default:0.5" json:"opacity"` // 0 to 1
+	Scale     float64           `gorm:"default:0.2" json:"scale"`   // watermark width relative to the image
+	Version   int               `gorm:"default:1" json:"version"`
+}
+
+// CalendarFeedKind selects what a calendar feed publishes
+type CalendarFeedKind string
+
+const (
+	CalendarFeedBookings     CalendarFeedKind = "bookings"     // confirmed and paid bookings
+	CalendarFeedAvailability CalendarFeedKind = "availability" // blocked dates
+)
+
+// CalendarFeed is a token-protected iCalendar subscription URL, one per
+// coordinator or device so each can be revoked on its own
+type CalendarFeed struct {
+	ID             uint             `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt   `gorm:"index" json:"-"`
+	Name           string           `gorm:"not null" json:"name"`
+	Kind           CalendarFeedKind `gorm:"not null" json:"kind"`
+	Token          string           `gorm:"uniqueIndex;not null" json:"token"`
+	LastAccessedAt *time.Time       `json:"last_accessed_at,omitempty"`
+}
+
+// CalendarImport is an external iCalendar (URL or uploaded file) whose busy
+// events block dates in Availability
+type CalendarImport struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	Name      string         `gorm:"not null" json:"name"`
+	URL       string         `json:"url,omitempty"`      // http(s) URL, for subscribed calendars
+	FileKey   string         `json:"file_key,omitempty"` // private blob key, for uploaded files
+	Enabled   bool           `gorm:"default:true" json:"enabled"`
+	// Sync state
+	LastSyncedAt *time.Time `json:"last_synced_at,omitempty"`
+	LastStatus   string     `json:"last_status"` // ok, not_modified or error
+	LastError    string     `json:"last_error,omitempty"`
+	BlockedDates int        `json:"blocked_dates"`
+	ETag         string     `json:"-"`
+	LastModified string     `json:"-"`
+}
+
 // SiteContent represents editable site content
 type SiteContent struct {
 	ID        uint           `gorm:"primarykey" json:"id"`
@@ -186,6 +830,17 @@ type Category struct {
 	Type        string         `gorm:"default:'rental'" json:"type"` // 'rental', 'gallery'
 }
 
+// CategoryDirectory maps a storage folder name to a gallery category
+type CategoryDirectory struct {
+	ID         uint           `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+	Directory  string         `gorm:"uniqueIndex;not null" json:"directory"` // lowercase folder name, e.g. "weeding"
+	CategoryID uint           `gorm:"not null" json:"category_id"`
+	Category   Category       `json:"category"`
+}
+
 // RentalCategory represents rental item categories
 type RentalCategory string
 
@@ -212,4 +867,7 @@ type RentalItem struct {
 	ImageURL     string         `gorm:"not null" json:"image_url"`
 	Featured     bool           `gorm:"default:false" json:"featured"`
 	Available    bool           `gorm:"default:true" json:"available"`
+	// Stock is how many units can be rented for the same date; 0 means
+	// stock is not tracked
+	Stock int `gorm:"default:0" json:"stock"`
 }
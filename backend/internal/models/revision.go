@@ -0,0 +1,56 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Revision counts the updates of a row: every UPDATE made through GORM,
+// from Save as well as Update and Updates, sets it to revision + 1 in the
+// same statement. Calendar feeds publish it as the SEQUENCE of an event.
+type Revision int
+
+// UpdateClauses adds the increment to the updates of models with a Revision
+func (Revision) UpdateClauses(f *schema.Field) []clause.Interface {
+	return []clause.Interface{revisionClause{field: f}}
+}
+
+// revisionClause builds the SET clause of an update with the revision
+// column set to revision + 1, whatever value the update carried for it
+type revisionClause struct {
+	field *schema.Field
+}
+
+func (revisionClause) Name() string               { return "" }
+func (revisionClause) Build(clause.Builder)       {}
+func (revisionClause) MergeClause(*clause.Clause) {}
+
+func (c revisionClause) ModifyStatement(stmt *gorm.Statement) {
+	if stmt.SQL.Len() > 0 {
+		return
+	}
+
+	// GORM only converts the updated values when no SET clause exists yet
+	set, ok := stmt.Clauses["SET"].Expression.(clause.Set)
+	if !ok {
+		set = callbacks.ConvertToAssignments(stmt)
+		if len(set) == 0 {
+			return
+		}
+	}
+
+	column := clause.Column{Name: c.field.DBName}
+	assignments := make(clause.Set, 0, len(set)+1)
+	for _, a := range set {
+		if a.Column.Name != c.field.DBName {
+			assignments = append(assignments, a)
+		}
+	}
+	assignments = append(assignments, clause.Assignment{
+		Column: column,
+		Value:  gorm.Expr("? + 1", column),
+	})
+	stmt.AddClause(assignments)
+}
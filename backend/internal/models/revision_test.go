@@ -0,0 +1,61 @@
+package models
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestRevisionIncrementsOnUpdate(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&Availability{}); err != nil {
+		t.Fatal(err)
+	}
+
+	row := Availability{Date: NewDate(2026, 7, 1), Available: true, MaxEvents: 1}
+	if err := db.Create(&row).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	revision := func() Revision {
+		t.Helper()
+		var stored Availability
+		if err := db.First(&stored, row.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		return stored.Revision
+	}
+	if got := revision(); got != 0 {
+		t.Fatalf("revision after create = %d, want 0", got)
+	}
+
+	updates := []struct {
+		name   string
+		update func() error
+	}{
+		{"Update", func() error { return db.Model(&row).Update("notes", "a").Error }},
+		{"Updates map", func() error { return db.Model(&row).Updates(map[string]interface{}{"notes": "b"}).Error }},
+		{"Updates struct", func() error { return db.Model(&row).Updates(Availability{Notes: "c"}).Error }},
+		{"Save", func() error { row.Notes = "d"; return db.Save(&row).Error }},
+		{"Save with a stale revision", func() error { row.Revision = 0; return db.Save(&row).Error }},
+		{"bulk update", func() error {
+			return db.Model(&Availability{}).Where("date = ?", row.Date).Update("available", false).Error
+		}},
+	}
+	for i, u := range updates {
+		if err := u.update(); err != nil {
+			t.Fatalf("%s: %v", u.name, err)
+		}
+		if got, want := revision(), Revision(i+1); got != want {
+			t.Errorf("revision after %s = %d, want %d", u.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// Wrong album passwords slow down every answer on the album, from
+// albumPasswordBaseDelay doubling up to ALBUM_PASSWORD_MAX_DELAY
+const (
+	albumPasswordBaseDelay  = 250 * time.Millisecond
+	defaultAlbumPasswordMax = 8 * time.Second
+	albumPasswordWindow     = time.Hour
+)
+
+var (
+	albumPasswordLimitsOnce sync.Once
+	albumClientFailures     *RateLimiter
+	albumIPFailures         *RateLimiter
+	albumTokenFailures      *RateLimiter
+)
+
+func albumPasswordLimiters() (byClient, byIP, byToken *RateLimiter) {
+	albumPasswordLimitsOnce.Do(func() {
+		albumClientFailures = NewRateLimiter(parseRateEnv("ALBUM_PASSWORD_CLIENT_LIMIT", 5, 15*time.Minute))
+		albumIPFailures = NewRateLimiter(parseRateEnv("ALBUM_PASSWORD_IP_LIMIT", 10, 15*time.Minute))
+		// Counts failures past any sensible maximum delay
+		albumTokenFailures = NewRateLimiter(32, albumPasswordWindow)
+	})
+	return albumClientFailures, albumIPFailures, albumTokenFailures
+}
+
+// AlbumPasswordLocked reports whether ip sent too many wrong passwords for
+// the album (ALBUM_PASSWORD_CLIENT_LIMIT, default 5/15m) or for any album
+// (ALBUM_PASSWORD_IP_LIMIT, default 10/15m). Failures from other IPs never
+// lock a client out of an album it has the password of.
+func AlbumPasswordLocked(token, ip string) bool {
+	byClient, byIP, _ := albumPasswordLimiters()
+	return byClient.Exceeded(token+"|"+ip) || byIP.Exceeded(ip)
+}
+
+// RecordAlbumPasswordFailure counts a wrong password and returns how long
+// to wait before answering it: the delay doubles with each failure on the
+// album in the last hour, whatever the IP, to slow down guessing spread
+// over many addresses
+func RecordAlbumPasswordFailure(token, ip string) time.Duration {
+	byClient, byIP, byToken := albumPasswordLimiters()
+	byClient.Allow(token + "|" + ip)
+	byIP.Allow(ip)
+	byToken.Allow(token)
+
+	return albumPasswordDelay(byToken.Count(token), ParseDurationEnv("ALBUM_PASSWORD_MAX_DELAY", defaultAlbumPasswordMax))
+}
+
+// albumPasswordDelay is the wait after the nth recent failure, capped at max
+func albumPasswordDelay(failures int, max time.Duration) time.Duration {
+	delay := albumPasswordBaseDelay
+	for i := 1; i < failures && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
@@ -0,0 +1,27 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAlbumPasswordDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		max      time.Duration
+		want     time.Duration
+	}{
+		{1, 8 * time.Second, 250 * time.Millisecond},
+		{2, 8 * time.Second, 500 * time.Millisecond},
+		{4, 8 * time.Second, 2 * time.Second},
+		{6, 8 * time.Second, 8 * time.Second},
+		{30, 8 * time.Second, 8 * time.Second},
+		{3, 600 * time.Millisecond, 600 * time.Millisecond},
+		{3, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := albumPasswordDelay(tt.failures, tt.max); got != tt.want {
+			t.Errorf("albumPasswordDelay(%d, %s) = %s, want %s", tt.failures, tt.max, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"gorm.io/gorm"
+)
+
+// automationWindowDays is how long after its due date a booking may still
+// be emailed, so that a missed run catches up but enabling an automation
+// does not email bookings that were due long ago
+const automationWindowDays = 7
+
+// Statuses of automation sends. A send stays pending if the server stops
+// while sending; it is not retried, since the email may have gone out.
+const (
+	AutomationPending = "pending"
+	AutomationSent    = "sent"
+	AutomationFailed  = "failed"
+)
+
+// bookingStatuses are the valid booking statuses
+var bookingStatuses = []models.BookingStatus{
+	models.BookingStatusPending,
+	models.BookingStatusConfirmed,
+	models.BookingStatusPaid,
+	models.BookingStatusCompleted,
+	models.BookingStatusCancelled,
+}
+
+// ParseBookingStatuses parses a comma-separated booking status list
+func ParseBookingStatuses(s string) ([]models.BookingStatus, error) {
+	var statuses []models.BookingStatus
+	for _, part := range strings.Split(s, ",") {
+		status := models.BookingStatus(strings.TrimSpace(part))
+		if status == "" {
+			continue
+		}
+		valid := false
+		for _, known := range bookingStatuses {
+			if status == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("invalid booking status %q", status)
+		}
+		if !containsStatus(statuses, status) {
+			statuses = append(statuses, status)
+		}
+	}
+	if len(statuses) == 0 {
+		return nil, fmt.Errorf("no booking status")
+	}
+	return statuses, nil
+}
+
+// FormatBookingStatuses is the canonical form of a status list
+func FormatBookingStatuses(statuses []models.BookingStatus) string {
+	parts := make([]string, len(statuses))
+	for i, status := range statuses {
+		parts[i] = string(status)
+	}
+	return strings.Join(parts, ",")
+}
+
+func containsStatus(statuses []models.BookingStatus, status models.BookingStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// RunAutomations emails the client of each booking that an enabled
+// automation became due for and that it has not emailed yet. Failed sends
+// are retried on the next runs while the booking is in the window.
+func RunAutomations(ctx context.Context) (sent, failed int, err error) {
+	var automations []models.Automation
+	if err := database.DB.Where("enabled = ?", true).Order("id").Find(&automations).Error; err != nil {
+		return 0, 0, err
+	}
+
+	today := Today()
+	for i := range automations {
+		automation := &automations[i]
+		bookings, err := dueBookings(automation, today)
+		if err != nil {
+			return sent, failed, fmt.Errorf("automation %s: %w", automation.Name, err)
+		}
+		for j := range bookings {
+			if ctx.Err() != nil {
+				return sent, failed, ctx.Err()
+			}
+			ok, err := sendAutomation(automation, &bookings[j])
+			if err != nil {
+				log.Printf("Automation %s failed for booking %d: %v", automation.Name, bookings[j].ID, err)
+				failed++
+			} else if ok {
+				sent++
+			}
+		}
+	}
+	return sent, failed, nil
+}
+
+// dueBookings returns the bookings of live clients that automation is due
+// for today and has not emailed or started emailing
+func dueBookings(automation *models.Automation, today models.Date) ([]models.Booking, error) {
+	statuses, err := ParseBookingStatuses(automation.Statuses)
+	if err != nil {
+		return nil, err
+	}
+
+	query := database.DB.Preload("Client").Preload("RentalItems").
+		Joins("JOIN clients ON clients.id = bookings.client_id AND clients.deleted_at IS NULL AND clients.erased_at IS NULL").
+		Where("bookings.status IN ?", statuses).
+		Where("bookings.id NOT IN (?)", database.DB.Model(&models.AutomationSend{}).
+			Select("booking_id").Where("automation_id = ? AND status = ?", automation.ID, AutomationSent))
+
+	days := automation.Days
+	switch automation.Trigger {
+	case models.TriggerBeforeEvent:
+		from := today.AddDays(days - automationWindowDays)
+		if from.Before(today) {
+			from = today
+		}
+		query = query.Where("bookings.event_date BETWEEN ? AND ?", from, today.AddDays(days))
+	case models.TriggerAfterEvent:
+		query = query.Where("bookings.event_date BETWEEN ? AND ?",
+			today.AddDays(-days-automationWindowDays), today.AddDays(-days))
+	case models.TriggerAfterStatus:
+		// Entered the status on a day in the window
+		loc := BusinessLocation()
+		from := today.AddDays(-days - automationWindowDays).In(loc).Local()
+		to := today.AddDays(-days + 1).In(loc).Local()
+		query = query.Where("bookings.id IN (?)", database.DB.Model(&models.BookingStatusChange{}).
+			Select("booking_id").
+			Where("to_status IN ? AND created_at >= ? AND created_at < ?", statuses, from, to))
+	default:
+		return nil, fmt.Errorf("unknown trigger %q", automation.Trigger)
+	}
+
+	var bookings []models.Booking
+	err = query.Order("bookings.event_date ASC, bookings.id ASC").Find(&bookings).Error
+	return bookings, err
+}
+
+// sendAutomation emails the booking's client, logs the email and records
+// the send. It returns false when there was nothing to send, such as a
+// balance reminder for a booking paid in full, or when the send was
+// claimed by another run.
+func sendAutomation(automation *models.Automation, booking *models.Booking) (bool, error) {
+	client := booking.Client
+	details := AutomationDetails{
+		ClientName:  client.Name,
+		EventType:   string(booking.EventType),
+		EventDate:   booking.EventDate.Time().Format("2 January 2006"),
+		Location:    booking.EventLocation,
+		GuestCount:  booking.GuestCount,
+		TotalAmount: booking.TotalAmount,
+		ReviewURL:   FrontendURL("/temoignages"),
+	}
+	for _, item := range booking.RentalItems {
+		details.RentalItems = append(details.RentalItems, item.Title)
+	}
+
+	// Completed bookings get their one-time review link
+	if automation.Template == models.TemplateThankYou {
+		invitation, err := IssueReviewInvitation(database.DB, booking)
+		if err != nil && !errors.Is(err, ErrBookingNotCompleted) {
+			return false, err
+		}
+		if invitation != nil && invitation.UsedAt == nil {
+			details.ReviewURL = ReviewURL(invitation)
+		}
+	}
+
+	if automation.Template == models.TemplateBalanceDue {
+		paid, err := BookingPaid(booking.ID)
+		if err != nil {
+			return false, err
+		}
+		details.TotalPaid = paid
+		details.BalanceDue = booking.TotalAmount - paid
+		if details.BalanceDue < 0.01 {
+			return false, nil
+		}
+	}
+
+	sendID, claimed, err := claimAutomationSend(automation, booking)
+	if err != nil || !claimed {
+		return false, err
+	}
+
+	sendErr := NewEmailService().SendAutomationEmail(client.Email, automation.Template, booking.Language,
+		details, ReplyAddress(ReplyBooking, booking.ID))
+
+	emailLog := models.EmailLog{
+		To:       client.Email,
+		Subject:  AutomationSubject(automation.Template, booking.Language),
+		Type:     string(automation.Template),
+		Status:   "sent",
+		ClientID: &client.ID,
+	}
+	status, errText := AutomationSent, ""
+	if sendErr != nil {
+		emailLog.Status = "failed"
+		emailLog.Error = sendErr.Error()
+		status, errText = AutomationFailed, sendErr.Error()
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&emailLog).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.AutomationSend{}).Where("id = ?", sendID).
+			Updates(map[string]interface{}{
+				"email_log_id": emailLog.ID,
+				"status":       status,
+				"error":        errText,
+			}).Error
+	})
+	if sendErr != nil {
+		return false, sendErr
+	}
+	return true, err
+}
+
+// claimAutomationSend records a pending send of automation for booking
+// before the email goes out. Only one run wins the unique index; a failed
+// send is claimed again to retry it. It returns the ID of the claimed send.
+func claimAutomationSend(automation *models.Automation, booking *models.Booking) (uint, bool, error) {
+	result := database.DB.Exec(
+		`INSERT INTO automation_sends (created_at, automation_id, booking_id, client_id, status, error)
+		VALUES (?, ?, ?, ?, ?, '')
+		ON CONFLICT (automation_id, booking_id) DO UPDATE SET
+			client_id = excluded.client_id, status = excluded.status, error = '', email_log_id = NULL
+		WHERE automation_sends.status = ?`,
+		time.Now(), automation.ID, booking.ID, booking.ClientID, AutomationPending, AutomationFailed,
+	)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return 0, false, result.Error
+	}
+
+	var send models.AutomationSend
+	err := database.DB.Select("id").
+		Where("automation_id = ? AND booking_id = ?", automation.ID, booking.ID).
+		First(&send).Error
+	return send.ID, err == nil, err
+}
+
+// AutomationJob sends the due automation emails
+func AutomationJob(ctx context.Context) (string, error) {
+	sent, failed, err := RunAutomations(ctx)
+	summary := ""
+	if sent > 0 || failed > 0 {
+		summary = fmt.Sprintf("sent %d emails, %d failed", sent, failed)
+	}
+	if err == nil && failed > 0 {
+		err = fmt.Errorf("%d automation emails failed", failed)
+	}
+	return summary, err
+}
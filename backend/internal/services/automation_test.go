@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+)
+
+// reminderFixture creates a 3-day event reminder and a confirmed booking it
+// is due for today
+func reminderFixture(t *testing.T) (*models.Automation, *models.Booking) {
+	t.Helper()
+	useClock(t, time.Date(2026, 6, 1, 12, 0, 0, 0, BusinessLocation()))
+
+	automation := models.Automation{
+		Name:     "Rappel",
+		Template: models.TemplateEventReminder,
+		Trigger:  models.TriggerBeforeEvent,
+		Days:     3,
+		Statuses: "confirmed",
+		Enabled:  true,
+	}
+	client := models.Client{Name: "Marie", Email: "marie@example.com"}
+	if err := database.DB.Create(&automation).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Create(&client).Error; err != nil {
+		t.Fatal(err)
+	}
+	booking := models.Booking{
+		ClientID:  client.ID,
+		EventDate: models.NewDate(2026, 6, 4),
+		EventType: "wedding",
+		Status:    models.BookingStatusConfirmed,
+	}
+	if err := database.DB.Create(&booking).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &automation, &booking
+}
+
+func automationSend(t *testing.T, automation *models.Automation, booking *models.Booking) models.AutomationSend {
+	t.Helper()
+	var send models.AutomationSend
+	database.DB.Where("automation_id = ? AND booking_id = ?", automation.ID, booking.ID).Find(&send)
+	return send
+}
+
+func TestRunAutomationsRetriesFailedSends(t *testing.T) {
+	useTestDB(t)
+	smtp := useFakeSMTP(t)
+	automation, booking := reminderFixture(t)
+
+	smtp.setReject(true)
+	sent, failed, err := RunAutomations(context.Background())
+	if err != nil || sent != 0 || failed != 1 {
+		t.Fatalf("rejected run = %d sent, %d failed, %v", sent, failed, err)
+	}
+	if send := automationSend(t, automation, booking); send.Status != AutomationFailed || send.Error == "" || send.EmailLogID == nil {
+		t.Errorf("send after failure = %+v", send)
+	}
+
+	smtp.setReject(false)
+	sent, failed, err = RunAutomations(context.Background())
+	if err != nil || sent != 1 || failed != 0 {
+		t.Fatalf("retry = %d sent, %d failed, %v", sent, failed, err)
+	}
+	send := automationSend(t, automation, booking)
+	if send.Status != AutomationSent || send.Error != "" {
+		t.Errorf("send after retry = %+v", send)
+	}
+
+	// Sent once: later runs leave it alone
+	sent, _, _ = RunAutomations(context.Background())
+	if sent != 0 || smtp.count() != 1 {
+		t.Errorf("third run sent %d, %d emails in total, want 0 and 1", sent, smtp.count())
+	}
+
+	var sends int64
+	database.DB.Model(&models.AutomationSend{}).Count(&sends)
+	if sends != 1 {
+		t.Errorf("%d send rows, want 1", sends)
+	}
+}
+
+func TestClaimAutomationSend(t *testing.T) {
+	useTestDB(t)
+	smtp := useFakeSMTP(t)
+	automation, booking := reminderFixture(t)
+
+	// Another run claimed the booking and is sending: this one stays out
+	id, claimed, err := claimAutomationSend(automation, booking)
+	if err != nil || !claimed || id == 0 {
+		t.Fatalf("first claim = %d, %v, %v", id, claimed, err)
+	}
+	if _, claimed, err := claimAutomationSend(automation, booking); err != nil || claimed {
+		t.Errorf("second claim = %v, %v, want lost", claimed, err)
+	}
+
+	database.DB.Preload("Client").First(booking, booking.ID)
+	ok, err := sendAutomation(automation, booking)
+	if ok || err != nil || smtp.count() != 0 {
+		t.Errorf("send while claimed = %v, %v, %d emails", ok, err, smtp.count())
+	}
+	// A pending send is neither due again nor retried
+	if sent, failed, err := RunAutomations(context.Background()); sent != 0 || failed != 0 || err != nil {
+		t.Errorf("run with a pending send = %d, %d, %v", sent, failed, err)
+	}
+	if send := automationSend(t, automation, booking); send.Status != AutomationPending {
+		t.Errorf("send = %+v, want pending", send)
+	}
+
+	// A failed send is claimed again, reusing its row
+	database.DB.Model(&models.AutomationSend{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"status": AutomationFailed, "error": "timeout"})
+	retryID, claimed, err := claimAutomationSend(automation, booking)
+	if err != nil || !claimed || retryID != id {
+		t.Errorf("claim of a failed send = %d, %v, %v, want %d", retryID, claimed, err, id)
+	}
+	if send := automationSend(t, automation, booking); send.Status != AutomationPending || send.Error != "" {
+		t.Errorf("reclaimed send = %+v", send)
+	}
+}
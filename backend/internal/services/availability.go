@@ -0,0 +1,215 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+)
+
+// DefaultMaxEvents is the capacity of a date no rule or override covers
+const DefaultMaxEvents = 1
+
+// maxResolveDays bounds the range ResolveAvailability accepts
+const maxResolveDays = 731
+
+// Sources of a resolved day
+const (
+	AvailabilityFromDefault = "default"
+	AvailabilityFromRule    = "rule"
+)
+
+// DayAvailability is the effective availability of one date
+type DayAvailability struct {
+	Date      models.Date `json:"date"`
+	Open      bool        `json:"open"` // events may be held that day
+	MaxEvents int         `json:"max_events"`
+	Booked    int         `json:"booked"`    // bookings not cancelled
+	Held      int         `json:"held"`      // active date holds
+	Remaining int         `json:"remaining"` // bookings still accepted
+	Available bool        `json:"available"` // open with remaining capacity
+	// Source is default, rule, or the source of the date override
+	// (manual or import)
+	Source string `json:"source"`
+	RuleID *uint  `json:"rule_id,omitempty"`
+	Notes  string `json:"notes,omitempty"`
+}
+
+// ResolveDate returns the effective availability of one date
+func ResolveDate(date models.Date) (DayAvailability, error) {
+	days, err := ResolveAvailability(date, date)
+	if err != nil {
+		return DayAvailability{}, err
+	}
+	return days[0], nil
+}
+
+// ResolveAvailability returns the effective availability of every date from
+// from to to (inclusive)
+func ResolveAvailability(from, to models.Date) ([]DayAvailability, error) {
+	if to.Before(from) {
+		return nil, fmt.Errorf("end date is before start date")
+	}
+	if from.DaysUntil(to) > maxResolveDays {
+		return nil, fmt.Errorf("date range exceeds %d days", maxResolveDays)
+	}
+
+	var rules []models.AvailabilityRule
+	if err := database.DB.Order("priority DESC, id DESC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	var overrides []models.Availability
+	if err := database.DB.Where("date >= ? AND date <= ?", from, to).Find(&overrides).Error; err != nil {
+		return nil, err
+	}
+	overridesByDate := make(map[string]models.Availability, len(overrides))
+	for _, o := range overrides {
+		overridesByDate[o.Date.String()] = o
+	}
+
+	var bookingDates []models.Date
+	if err := database.DB.Model(&models.Booking{}).
+		Where("event_date >= ? AND event_date <= ? AND status != ?",
+			from, to, models.BookingStatusCancelled).
+		Pluck("event_date", &bookingDates).Error; err != nil {
+		return nil, err
+	}
+	booked := make(map[string]int, len(bookingDates))
+	for _, d := range bookingDates {
+		booked[d.String()]++
+	}
+
+	var holdDates []models.Date
+	if err := activeHolds(database.DB).
+		Where("date >= ? AND date <= ?", from, to).
+		Pluck("date", &holdDates).Error; err != nil {
+		return nil, err
+	}
+	held := make(map[string]int, len(holdDates))
+	for _, d := range holdDates {
+		held[d.String()]++
+	}
+
+	var days []DayAvailability
+	for d := from; !d.After(to); d = d.AddDays(1) {
+		day := DayAvailability{Date: d, Open: true, MaxEvents: DefaultMaxEvents, Source: AvailabilityFromDefault}
+
+		// Rules are sorted by priority, so the first match wins
+		for i := range rules {
+			if RuleMatches(&rules[i], d) {
+				day.Open = rules[i].Available
+				day.MaxEvents = rules[i].MaxEvents
+				day.Source = AvailabilityFromRule
+				day.RuleID = &rules[i].ID
+				break
+			}
+		}
+
+		if o, ok := overridesByDate[d.String()]; ok {
+			day.Open = o.Available
+			day.MaxEvents = o.MaxEvents
+			day.Source = string(o.Source)
+			day.RuleID = nil
+			day.Notes = o.Notes
+		}
+
+		day.Booked = booked[d.String()]
+		day.Held = held[d.String()]
+		if day.Open && day.MaxEvents > day.Booked+day.Held {
+			day.Remaining = day.MaxEvents - day.Booked - day.Held
+		}
+		day.Available = day.Remaining > 0
+		days = append(days, day)
+	}
+
+	return days, nil
+}
+
+// RuleMatches reports whether a rule applies to a date
+func RuleMatches(rule *models.AvailabilityRule, date models.Date) bool {
+	if rule.Weekdays != "" {
+		weekdays, err := ParseWeekdays(rule.Weekdays)
+		if err != nil {
+			return false
+		}
+		found := false
+		for _, wd := range weekdays {
+			if wd == date.Weekday() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if rule.Yearly {
+		return inYearlyRange(rule.StartDate, rule.EndDate, date)
+	}
+	if rule.StartDate != nil && date.Before(*rule.StartDate) {
+		return false
+	}
+	if rule.EndDate != nil && date.After(*rule.EndDate) {
+		return false
+	}
+	return true
+}
+
+// inYearlyRange compares month and day only. A range whose end comes before
+// its start wraps over the new year (December 20 to January 5).
+func inYearlyRange(start, end *models.Date, date models.Date) bool {
+	md := func(d models.Date) int { return int(d.Month())*100 + d.Day() }
+	d := md(date)
+
+	switch {
+	case start == nil && end == nil:
+		return true
+	case start == nil:
+		return d <= md(*end)
+	case end == nil:
+		return d >= md(*start)
+	}
+
+	s, e := md(*start), md(*end)
+	if s <= e {
+		return d >= s && d <= e
+	}
+	return d >= s || d <= e
+}
+
+// ParseWeekdays parses a comma-separated weekday list, 0 being Sunday
+func ParseWeekdays(s string) ([]time.Weekday, error) {
+	var weekdays []time.Weekday
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || n > 6 {
+			return nil, fmt.Errorf("invalid weekday %q", part)
+		}
+		if !seen[n] {
+			seen[n] = true
+			weekdays = append(weekdays, time.Weekday(n))
+		}
+	}
+	sort.Slice(weekdays, func(i, j int) bool { return weekdays[i] < weekdays[j] })
+	return weekdays, nil
+}
+
+// FormatWeekdays is the canonical form of a weekday list ("1,6")
+func FormatWeekdays(weekdays []time.Weekday) string {
+	parts := make([]string, len(weekdays))
+	for i, wd := range weekdays {
+		parts[i] = strconv.Itoa(int(wd))
+	}
+	return strings.Join(parts, ",")
+}
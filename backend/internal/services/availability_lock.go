@@ -0,0 +1,82 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+)
+
+// availabilityLease is the job_leases row held while capacity is checked
+// and taken. Server instances sharing the database take it in turn, as
+// they do job leases, so two of them cannot both take the last slot.
+const availabilityLease = "availability"
+
+var (
+	// availabilityLeaseTTL bounds how long a crashed instance blocks the
+	// others; it is far longer than any capacity check
+	availabilityLeaseTTL = 30 * time.Second
+	// availabilityLockWait is how long a request waits for another instance
+	availabilityLockWait = 10 * time.Second
+	availabilityLockPoll = 20 * time.Millisecond
+)
+
+// ErrAvailabilityBusy is returned when the availability lock stays held by
+// another server instance for too long
+var ErrAvailabilityBusy = errors.New("availability is locked by another instance")
+
+// availabilityMu serializes capacity checks within this instance, before
+// the lease serializes them across instances
+var availabilityMu sync.Mutex
+
+// WithAvailabilityLock runs fn while no other hold or booking can take
+// capacity, on this server instance or any other sharing the database
+func WithAvailabilityLock(fn func() error) error {
+	availabilityMu.Lock()
+	defer availabilityMu.Unlock()
+
+	owner := Jobs().owner
+	if err := acquireAvailabilityLease(owner); err != nil {
+		return err
+	}
+	defer releaseAvailabilityLease(owner)
+
+	return fn()
+}
+
+// acquireAvailabilityLease takes the availability lease, waiting up to
+// availabilityLockWait while another instance holds an unexpired one
+func acquireAvailabilityLease(owner string) error {
+	deadline := time.Now().Add(availabilityLockWait)
+	for {
+		now := time.Now()
+		result := database.DB.Exec(
+			`INSERT INTO job_leases (name, owner, expires_at, last_slot) VALUES (?, ?, ?, 0)
+			ON CONFLICT (name) DO UPDATE SET owner = excluded.owner, expires_at = excluded.expires_at
+			WHERE job_leases.owner = excluded.owner OR job_leases.expires_at < ?`,
+			availabilityLease, owner, now.Add(availabilityLeaseTTL), now,
+		)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			return nil
+		}
+		if now.After(deadline) {
+			return ErrAvailabilityBusy
+		}
+		time.Sleep(availabilityLockPoll)
+	}
+}
+
+// releaseAvailabilityLease expires the lease for the next instance
+func releaseAvailabilityLease(owner string) {
+	if err := database.DB.Model(&models.JobLease{}).
+		Where("name = ? AND owner = ?", availabilityLease, owner).
+		Update("expires_at", time.Now()).Error; err != nil {
+		log.Printf("Failed to release the availability lease: %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+)
+
+func TestWithAvailabilityLockAcrossInstances(t *testing.T) {
+	useTestDB(t)
+	previous := availabilityLockWait
+	availabilityLockWait = 100 * time.Millisecond
+	t.Cleanup(func() { availabilityLockWait = previous })
+
+	ran := false
+	run := func() error { ran = true; return nil }
+
+	// Another instance checking capacity
+	lease := models.JobLease{Name: availabilityLease, Owner: "other-instance", ExpiresAt: time.Now().Add(time.Minute)}
+	if err := database.DB.Create(&lease).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := WithAvailabilityLock(run); !errors.Is(err, ErrAvailabilityBusy) || ran {
+		t.Fatalf("lock held elsewhere: err %v, ran %v; want ErrAvailabilityBusy without running", err, ran)
+	}
+
+	// A crashed instance's lease expires
+	database.DB.Model(&lease).Update("expires_at", time.Now().Add(-time.Second))
+	if err := WithAvailabilityLock(run); err != nil || !ran {
+		t.Fatalf("expired lease: err %v, ran %v", err, ran)
+	}
+
+	// Released for the next instance
+	database.DB.First(&lease, "name = ?", availabilityLease)
+	if lease.Owner != Jobs().owner || lease.ExpiresAt.After(time.Now()) {
+		t.Errorf("lease after the lock = %+v, want it released by this instance", lease)
+	}
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BlobStore stores media files by key. Keys are slash-separated paths whose
+// first segment is the media root, e.g. "uploads/gallery/ab12.jpg" or
+// "storage/weeding/photo.jpeg". The app serves a key under "/" + key, which
+// is also the URL recorded in the database (see BlobKeyForURL).
+type BlobStore interface {
+	// Put stores r under key. size may be -1 when unknown.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the blob; the caller closes the reader
+	Get(ctx context.Context, key string) (io.ReadCloser, BlobInfo, error)
+	// Stat returns the blob metadata, or ErrBlobNotFound
+	Stat(ctx context.Context, key string) (BlobInfo, error)
+	// Delete removes the blob; deleting a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+	// List calls fn for every blob whose key starts with prefix
+	List(ctx context.Context, prefix string, fn func(BlobInfo) error) error
+	// URL returns where clients can fetch a public blob directly
+	URL(key string) string
+	// SignedURL returns a URL granting read access to key until ttl elapses
+	SignedURL(key string, ttl time.Duration) (string, error)
+}
+
+// BlobInfo describes a stored blob
+type BlobInfo struct {
+	Key         string
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+}
+
+var (
+	// ErrBlobNotFound is returned when a key does not exist
+	ErrBlobNotFound = errors.New("blob not found")
+	// ErrInvalidBlobKey is returned for keys outside the media roots
+	ErrInvalidBlobKey = errors.New("invalid blob key")
+	// ErrUnknownMediaURL is returned for URLs outside the served media folders
+	ErrUnknownMediaURL = errors.New("unknown media URL")
+)
+
+// Media roots, the first segment of every key
+var blobRoots = []string{"uploads", "storage"}
+
+// PublicBlobPrefixes are served to anyone; other keys (gallery originals,
+// private files) are only reachable through signed URLs
+var PublicBlobPrefixes = []string{"uploads/rentals", "uploads/variants", "storage/location"}
+
+var (
+	blobStore     BlobStore
+	blobStoreErr  error
+	blobStoreOnce sync.Once
+)
+
+// InitBlobStore configures the store selected by BLOB_BACKEND. It is safe
+// to call more than once; the first configuration wins.
+func InitBlobStore() error {
+	blobStoreOnce.Do(func() {
+		blobStore, blobStoreErr = NewBlobStore(os.Getenv("BLOB_BACKEND"))
+	})
+	return blobStoreErr
+}
+
+// Blobs returns the configured blob store
+func Blobs() BlobStore {
+	if err := InitBlobStore(); err != nil {
+		log.Fatalf("Failed to configure blob store: %v", err)
+	}
+	return blobStore
+}
+
+// NewBlobStore builds a store for a backend name ("local" or "s3") from
+// the environment
+func NewBlobStore(backend string) (BlobStore, error) {
+	switch backend {
+	case "", "local":
+		return NewLocalBlobStore(map[string]string{
+			"uploads": envOr("UPLOADS_DIR", "./uploads"),
+			"storage": envOr("STORAGE_DIR", "../storage"),
+		}, blobSigningKey()), nil
+	case "s3":
+		return NewS3BlobStore(S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          envOr("S3_REGION", "us-east-1"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PathStyle:       os.Getenv("S3_PATH_STYLE") == "true",
+			PublicURL:       os.Getenv("S3_PUBLIC_URL"),
+		})
+	default:
+		return nil, fmt.Errorf("unknown blob backend %q", backend)
+	}
+}
+
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// CleanBlobKey validates a key and returns it in canonical form
+func CleanBlobKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, `\`) {
+		return "", ErrInvalidBlobKey
+	}
+
+	cleaned := path.Clean(key)
+	if cleaned != strings.TrimSuffix(key, "/") || strings.HasPrefix(cleaned, "..") {
+		return "", ErrInvalidBlobKey
+	}
+
+	root, _, _ := strings.Cut(cleaned, "/")
+	for _, r := range blobRoots {
+		if root == r {
+			return cleaned, nil
+		}
+	}
+	return "", ErrInvalidBlobKey
+}
+
+// BlobKeyForURL maps a media URL stored in the database, such as
+// /storage/weeding/a.jpeg or /uploads/gallery/ab12.jpg, to its blob key
+func BlobKeyForURL(mediaURL string) (string, error) {
+	if !strings.HasPrefix(mediaURL, "/") {
+		return "", ErrUnknownMediaURL
+	}
+
+	rel, err := url.PathUnescape(strings.TrimPrefix(mediaURL, "/"))
+	if err != nil {
+		return "", err
+	}
+
+	// Normalize before validating so "a/../b" style URLs cannot escape a root
+	key, err := CleanBlobKey(strings.TrimPrefix(path.Clean("/"+rel), "/"))
+	if err != nil {
+		return "", ErrUnknownMediaURL
+	}
+	return key, nil
+}
+
+// MediaURLForKey is the inverse of BlobKeyForURL
+func MediaURLForKey(key string) string {
+	return "/" + escapeKeyPath(key)
+}
+
+// IsPublicBlob reports whether key is served without a signature
+func IsPublicBlob(key string) bool {
+	for _, prefix := range PublicBlobPrefixes {
+		if strings.HasPrefix(key, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// escapeKeyPath escapes each segment of a key for use in a URL path
+func escapeKeyPath(key string) string {
+	parts := strings.Split(key, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+// ReadBlob reads a whole blob into memory
+func ReadBlob(ctx context.Context, store BlobStore, key string) ([]byte, error) {
+	r, _, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// formatExpires renders an expiry as a unix timestamp string
+func formatExpires(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalBlobStore keeps blobs on the local filesystem, one directory per
+// media root. Signed URLs point at the app's /api/blobs route.
+type LocalBlobStore struct {
+	roots      map[string]string
+	signingKey []byte
+}
+
+// NewLocalBlobStore creates a store mapping media roots to directories
+func NewLocalBlobStore(roots map[string]string, signingKey []byte) *LocalBlobStore {
+	return &LocalBlobStore{roots: roots, signingKey: signingKey}
+}
+
+// blobSigningKey returns the secret used to sign local blob URLs
+func blobSigningKey() []byte {
+	return []byte(envOr("BLOB_SIGNING_KEY", os.Getenv("JWT_SECRET")))
+}
+
+// Path returns the file backing key
+func (s *LocalBlobStore) Path(key string) (string, error) {
+	key, err := CleanBlobKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	root, rel, _ := strings.Cut(key, "/")
+	dir, ok := s.roots[root]
+	if !ok {
+		return "", ErrInvalidBlobKey
+	}
+	return filepath.Join(dir, filepath.FromSlash(rel)), nil
+}
+
+// Put writes the blob through a temporary file so readers never see a
+// partial file
+func (s *LocalBlobStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	p, err := s.Path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// Get opens the blob file
+func (s *LocalBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, BlobInfo, error) {
+	p, err := s.Path(key)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, BlobInfo{}, localBlobError(err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, BlobInfo{}, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, BlobInfo{}, ErrBlobNotFound
+	}
+	return f, localBlobInfo(key, info), nil
+}
+
+// Stat returns the blob metadata
+func (s *LocalBlobStore) Stat(ctx context.Context, key string) (BlobInfo, error) {
+	p, err := s.Path(key)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+
+	info, err := os.Stat(p)
+	if err != nil {
+		return BlobInfo{}, localBlobError(err)
+	}
+	if info.IsDir() {
+		return BlobInfo{}, ErrBlobNotFound
+	}
+	return localBlobInfo(key, info), nil
+}
+
+// Delete removes the blob file
+func (s *LocalBlobStore) Delete(ctx context.Context, key string) error {
+	p, err := s.Path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List walks the directories under prefix. Hidden and temporary files are
+// skipped.
+func (s *LocalBlobStore) List(ctx context.Context, prefix string, fn func(BlobInfo) error) error {
+	for _, root := range blobRoots {
+		dir, ok := s.roots[root]
+		if !ok || !(strings.HasPrefix(prefix, root+"/") || strings.HasPrefix(root+"/", prefix)) {
+			continue
+		}
+
+		// Start from the deepest directory the prefix names
+		start := root
+		if strings.HasPrefix(prefix, root+"/") {
+			start = path.Dir(prefix + "x")
+		}
+		startDir := filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(strings.TrimPrefix(start, root), "/")))
+
+		err := filepath.WalkDir(startDir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if strings.HasPrefix(d.Name(), ".") && p != startDir {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			key := root + "/" + filepath.ToSlash(rel)
+			if !strings.HasPrefix(key, prefix) {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			return fn(localBlobInfo(key, info))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// URL returns the app path the blob is served under
+func (s *LocalBlobStore) URL(key string) string {
+	return MediaURLForKey(key)
+}
+
+// SignedURL returns an /api/blobs link carrying an HMAC of the key and expiry
+func (s *LocalBlobStore) SignedURL(key string, ttl time.Duration) (string, error) {
+	key, err := CleanBlobKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	expires := formatExpires(time.Now().Add(ttl))
+	return "/api/blobs/" + escapeKeyPath(key) + "?expires=" + expires + "&signature=" + s.signature(key, expires), nil
+}
+
+// VerifySignature checks a signature produced by SignedURL
+func (s *LocalBlobStore) VerifySignature(key, expires, signature string) bool {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(s.signature(key, expires)))
+}
+
+func (s *LocalBlobStore) signature(key, expires string) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func localBlobInfo(key string, info fs.FileInfo) BlobInfo {
+	return BlobInfo{
+		Key:         key,
+		Size:        info.Size(),
+		ModTime:     info.ModTime(),
+		ContentType: mime.TypeByExtension(strings.ToLower(path.Ext(key))),
+	}
+}
+
+func localBlobError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrBlobNotFound
+	}
+	return err
+}
@@ -0,0 +1,326 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Config configures an S3-compatible store (AWS S3, MinIO, R2, ...)
+type S3Config struct {
+	// Endpoint is the service URL, e.g. https://s3.ca-central-1.amazonaws.com
+	// or http://localhost:9000. Defaults to the AWS endpoint of Region.
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// PathStyle addresses objects as endpoint/bucket/key instead of
+	// bucket.endpoint/key, as required by most self-hosted services
+	PathStyle bool
+	// PublicURL, when set, is the base URL public blobs are served from
+	// (a CDN or a public bucket). Otherwise public URLs are presigned.
+	PublicURL string
+	// HTTPClient defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// s3PublicURLTTL is the lifetime of presigned URLs handed out for public
+// blobs when no PublicURL is configured
+const s3PublicURLTTL = 24 * time.Hour
+
+// S3BlobStore keeps blobs in an S3-compatible bucket using plain HTTP
+// requests signed with AWS Signature Version 4
+type S3BlobStore struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+	signer   *sigV4Signer
+}
+
+// NewS3BlobStore validates the configuration and creates the store
+func NewS3BlobStore(cfg S3Config) (*S3BlobStore, error) {
+	if cfg.Bucket == "" || cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("s3: bucket and credentials are required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("s3: invalid endpoint %q", cfg.Endpoint)
+	}
+
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &S3BlobStore{
+		cfg:      cfg,
+		endpoint: endpoint,
+		client:   client,
+		signer: &sigV4Signer{
+			accessKeyID:     cfg.AccessKeyID,
+			secretAccessKey: cfg.SecretAccessKey,
+			region:          cfg.Region,
+			service:         "s3",
+			now:             time.Now,
+		},
+	}, nil
+}
+
+// Put uploads the blob in a single request
+func (s *S3BlobStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	key, err := CleanBlobKey(key)
+	if err != nil {
+		return err
+	}
+
+	// S3 needs the length up front
+	if size < 0 {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		r, size = bytes.NewReader(data), int64(len(data))
+	}
+
+	req, err := s.newRequest(ctx, http.MethodPut, key, nil, r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get downloads the blob
+func (s *S3BlobStore) Get(ctx context.Context, key string) (io.ReadCloser, BlobInfo, error) {
+	key, err := CleanBlobKey(key)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+
+	req, err := s.newRequest(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	return resp.Body, s3BlobInfo(key, resp), nil
+}
+
+// Stat issues a HEAD request for the blob
+func (s *S3BlobStore) Stat(ctx context.Context, key string) (BlobInfo, error) {
+	key, err := CleanBlobKey(key)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+
+	req, err := s.newRequest(ctx, http.MethodHead, key, nil, nil)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	resp.Body.Close()
+	return s3BlobInfo(key, resp), nil
+}
+
+// Delete removes the blob
+func (s *S3BlobStore) Delete(ctx context.Context, key string) error {
+	key, err := CleanBlobKey(key)
+	if err != nil {
+		return err
+	}
+
+	req, err := s.newRequest(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if errors.Is(err, ErrBlobNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// List pages through ListObjectsV2
+func (s *S3BlobStore) List(ctx context.Context, prefix string, fn func(BlobInfo) error) error {
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		req, err := s.newRequest(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := s.do(req)
+		if err != nil {
+			return err
+		}
+
+		var result struct {
+			Contents []struct {
+				Key          string
+				Size         int64
+				LastModified time.Time
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("s3: invalid list response: %w", err)
+		}
+
+		for _, obj := range result.Contents {
+			if err := fn(BlobInfo{Key: obj.Key, Size: obj.Size, ModTime: obj.LastModified}); err != nil {
+				return err
+			}
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// URL returns the CDN/public bucket URL when configured, or a long-lived
+// presigned URL
+func (s *S3BlobStore) URL(key string) string {
+	if s.cfg.PublicURL != "" {
+		return strings.TrimSuffix(s.cfg.PublicURL, "/") + "/" + escapeKeyPath(key)
+	}
+	signed, err := s.SignedURL(key, s3PublicURLTTL)
+	if err != nil {
+		return ""
+	}
+	return signed
+}
+
+// SignedURL returns a presigned GET URL (query-string SigV4)
+func (s *S3BlobStore) SignedURL(key string, ttl time.Duration) (string, error) {
+	key, err := CleanBlobKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	u := s.objectURL(key, nil)
+	return s.signer.presign(http.MethodGet, u, ttl), nil
+}
+
+// objectURL addresses key (or the bucket itself when key is empty)
+func (s *S3BlobStore) objectURL(key string, query url.Values) *url.URL {
+	u := *s.endpoint
+	rawPath := strings.TrimSuffix(u.EscapedPath(), "/")
+	if s.cfg.PathStyle {
+		rawPath += "/" + uriEncode(s.cfg.Bucket)
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+	}
+	rawPath += "/" + escapeS3Path(key)
+
+	u.Path, _ = url.PathUnescape(rawPath)
+	u.RawPath = rawPath
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+func (s *S3BlobStore) newRequest(ctx context.Context, method, key string, query url.Values, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key, query).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// do signs and sends the request, turning error responses into errors
+func (s *S3BlobStore) do(req *http.Request) (*http.Response, error) {
+	s.signer.sign(req, unsignedPayload)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrBlobNotFound
+	}
+
+	var apiErr struct {
+		Code    string
+		Message string
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if xml.Unmarshal(body, &apiErr) == nil && apiErr.Code != "" {
+		return nil, fmt.Errorf("s3: %s %s: %s: %s", req.Method, req.URL.Path, apiErr.Code, apiErr.Message)
+	}
+	return nil, fmt.Errorf("s3: %s %s: unexpected status %s", req.Method, req.URL.Path, resp.Status)
+}
+
+func s3BlobInfo(key string, resp *http.Response) BlobInfo {
+	info := BlobInfo{
+		Key:         key,
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	if size, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64); err == nil {
+		info.Size = size
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = t
+	}
+	return info
+}
+
+// escapeS3Path URI-encodes a key the way SigV4 expects: every byte except
+// unreserved characters, keeping the slashes
+func escapeS3Path(key string) string {
+	parts := strings.Split(key, "/")
+	for i, part := range parts {
+		parts[i] = uriEncode(part)
+	}
+	return strings.Join(parts, "/")
+}
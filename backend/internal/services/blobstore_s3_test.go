@@ -0,0 +1,225 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestS3BlobStoreRoundTrip(t *testing.T) {
+	for _, pathStyle := range []bool{true, false} {
+		name := "virtual-host"
+		if pathStyle {
+			name = "path-style"
+		}
+		t.Run(name, func(t *testing.T) {
+			fake := newFakeS3(t, "media")
+			store := fake.store(pathStyle)
+			ctx := context.Background()
+
+			key := "uploads/gallery/été photo+1.jpg"
+			data := []byte("jpeg bytes")
+			if err := store.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "image/jpeg"); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+
+			r, info, err := store.Get(ctx, key)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			got, _ := io.ReadAll(r)
+			r.Close()
+			if !bytes.Equal(got, data) {
+				t.Errorf("Get = %q, want %q", got, data)
+			}
+			if info.Size != int64(len(data)) || info.ContentType != "image/jpeg" || info.ModTime.IsZero() {
+				t.Errorf("Get info = %+v", info)
+			}
+
+			if info, err := store.Stat(ctx, key); err != nil || info.Size != int64(len(data)) {
+				t.Errorf("Stat = %+v, %v", info, err)
+			}
+
+			if err := store.Delete(ctx, key); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if _, _, err := store.Get(ctx, key); !errors.Is(err, ErrBlobNotFound) {
+				t.Errorf("Get after Delete: %v, want ErrBlobNotFound", err)
+			}
+			if _, err := store.Stat(ctx, key); !errors.Is(err, ErrBlobNotFound) {
+				t.Errorf("Stat after Delete: %v, want ErrBlobNotFound", err)
+			}
+			// Deleting a missing blob is not an error
+			if err := store.Delete(ctx, key); err != nil {
+				t.Errorf("second Delete: %v", err)
+			}
+		})
+	}
+}
+
+func TestS3BlobStorePutUnknownSize(t *testing.T) {
+	fake := newFakeS3(t, "media")
+	store := fake.store(true)
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "uploads/a.txt", strings.NewReader("streamed"), -1, "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := store.Put(ctx, "uploads/empty.txt", strings.NewReader(""), 0, ""); err != nil {
+		t.Fatalf("Put empty: %v", err)
+	}
+
+	got, err := ReadBlob(ctx, store, "uploads/a.txt")
+	if err != nil || string(got) != "streamed" {
+		t.Errorf("ReadBlob = %q, %v", got, err)
+	}
+}
+
+func TestS3BlobStoreList(t *testing.T) {
+	fake := newFakeS3(t, "media")
+	store := fake.store(true)
+	ctx := context.Background()
+
+	keys := []string{
+		"uploads/gallery/a.jpg",
+		"uploads/gallery/b.jpg",
+		"uploads/gallery/c d.jpg",
+		"uploads/gallery/e.jpg",
+		"uploads/rentals/x.jpg",
+	}
+	for _, key := range keys {
+		if err := store.Put(ctx, key, strings.NewReader(key), int64(len(key)), ""); err != nil {
+			t.Fatalf("Put %s: %v", key, err)
+		}
+	}
+
+	// More entries than a page, so List follows the continuation token
+	var listed []string
+	err := store.List(ctx, "uploads/gallery/", func(info BlobInfo) error {
+		if info.Size != int64(len(info.Key)) {
+			t.Errorf("%s: size %d", info.Key, info.Size)
+		}
+		listed = append(listed, info.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	sort.Strings(listed)
+	if want := keys[:4]; strings.Join(listed, ",") != strings.Join(want, ",") {
+		t.Errorf("List = %v, want %v", listed, want)
+	}
+
+	// An error from fn stops the listing
+	stop := errors.New("stop")
+	calls := 0
+	err = store.List(ctx, "uploads/", func(BlobInfo) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("List stop = %v after %d calls", err, calls)
+	}
+}
+
+func TestS3BlobStoreSignedURL(t *testing.T) {
+	for _, pathStyle := range []bool{true, false} {
+		fake := newFakeS3(t, "media")
+		store := fake.store(pathStyle)
+		client := fake.client()
+		ctx := context.Background()
+
+		key := "uploads/private/contrat signé.pdf"
+		if err := store.Put(ctx, key, strings.NewReader("pdf"), 3, "application/pdf"); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+
+		signed, err := store.SignedURL(key, time.Hour)
+		if err != nil {
+			t.Fatalf("SignedURL: %v", err)
+		}
+		resp, err := client.Get(signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(body) != "pdf" {
+			t.Errorf("path style %v: GET signed URL = %d %q", pathStyle, resp.StatusCode, body)
+		}
+
+		// Extending the expiry invalidates the signature
+		u, _ := url.Parse(signed)
+		q := u.Query()
+		q.Set("X-Amz-Expires", "604800")
+		u.RawQuery = q.Encode()
+		resp, err = client.Get(u.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("path style %v: tampered URL status = %d, want 403", pathStyle, resp.StatusCode)
+		}
+	}
+}
+
+func TestS3BlobStoreSignedURLExpires(t *testing.T) {
+	fake := newFakeS3(t, "media")
+	store := fake.store(true)
+	store.signer.now = func() time.Time { return time.Now().Add(-2 * time.Hour) }
+
+	signed, err := store.SignedURL("uploads/a.jpg", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := fake.client().Get(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expired URL status = %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestS3BlobStoreErrors(t *testing.T) {
+	fake := newFakeS3(t, "media")
+	ctx := context.Background()
+
+	// Wrong credentials come back as the S3 error
+	store := fake.store(true)
+	store.signer.secretAccessKey = "wrong"
+	err := store.Put(ctx, "uploads/a.jpg", strings.NewReader("x"), 1, "")
+	if err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("Put with wrong secret: %v", err)
+	}
+
+	// Keys outside the media roots never reach the bucket
+	if err := fake.store(true).Put(ctx, "../etc/passwd", strings.NewReader("x"), 1, ""); !errors.Is(err, ErrInvalidBlobKey) {
+		t.Errorf("Put invalid key: %v", err)
+	}
+}
+
+func TestS3BlobStoreURL(t *testing.T) {
+	fake := newFakeS3(t, "media")
+	store := fake.store(true)
+
+	store.cfg.PublicURL = "https://cdn.example.com/"
+	if got := store.URL("uploads/rentals/a b.jpg"); got != "https://cdn.example.com/uploads/rentals/a%20b.jpg" {
+		t.Errorf("URL with PublicURL = %s", got)
+	}
+
+	store.cfg.PublicURL = ""
+	u, err := url.Parse(store.URL("uploads/rentals/a.jpg"))
+	if err != nil || u.Query().Get("X-Amz-Expires") != "86400" {
+		t.Errorf("presigned URL = %v, %v", u, err)
+	}
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+)
+
+// calendarFeedHistory is how far back feeds include past dates
+const calendarFeedHistory = 180 * 24 * time.Hour
+
+// eventTypeLabels are the French names of event types shown in calendars
+var eventTypeLabels = map[models.EventType]string{
+	models.EventTypeProposal:   "Demande en mariage",
+	models.EventTypeWedding:    "Mariage",
+	models.EventTypeBirthday:   "Anniversaire",
+	models.EventTypeBabyShower: "Baby shower",
+	models.EventTypeCorporate:  "Événement corporatif",
+	models.EventTypeOther:      "Événement",
+}
+
+// EventTypeLabel returns the display name of an event type
+func EventTypeLabel(t models.EventType) string {
+	if label, ok := eventTypeLabels[t]; ok {
+		return label
+	}
+	return string(t)
+}
+
+// calendarUID builds a stable UID from a record kind and identifier
+func calendarUID(kind string, id interface{}) string {
+	return fmt.Sprintf("%s-%v@%s", kind, id, envOr("CALENDAR_UID_DOMAIN", "angelevent.com"))
+}
+
+// feedBookingStatuses are the statuses of bookings published in feeds
+var feedBookingStatuses = []models.BookingStatus{models.BookingStatusConfirmed, models.BookingStatusPaid}
+
+// BookingCalendarEvents returns confirmed and paid bookings as all-day
+// events. Bookings cancelled after being published stay in the feed as
+// cancelled events, so subscribed calendars remove them.
+func BookingCalendarEvents() ([]ICalEvent, error) {
+	published := database.DB.Model(&models.BookingStatusChange{}).
+		Select("booking_id").
+		Where("to_status IN ?", feedBookingStatuses)
+
+	var bookings []models.Booking
+	if err := database.DB.
+		Preload("Client").
+		Preload("RentalItems").
+		Where(database.DB.Where("status IN ?", feedBookingStatuses).
+			Or("status = ? AND id IN (?)", models.BookingStatusCancelled, published)).
+		Where("event_date >= ?", BusinessDate(time.Now().Add(-calendarFeedHistory))).
+		Order("event_date ASC").
+		Find(&bookings).Error; err != nil {
+		return nil, err
+	}
+
+	events := make([]ICalEvent, 0, len(bookings))
+	for _, b := range bookings {
+		clientName := ""
+		if b.Client != nil {
+			clientName = b.Client.Name
+		}
+
+		summary := EventTypeLabel(b.EventType)
+		if clientName != "" {
+			summary += " - " + clientName
+		}
+
+		var desc strings.Builder
+		fmt.Fprintf(&desc, "Type: %s\n", EventTypeLabel(b.EventType))
+		if clientName != "" {
+			fmt.Fprintf(&desc, "Client: %s\n", clientName)
+		}
+		if b.Client != nil && b.Client.Phone != "" {
+			fmt.Fprintf(&desc, "Téléphone: %s\n", b.Client.Phone)
+		}
+		if b.EventLocation != "" {
+			fmt.Fprintf(&desc, "Lieu: %s\n", b.EventLocation)
+		}
+		fmt.Fprintf(&desc, "Invités: %d\n", b.GuestCount)
+		fmt.Fprintf(&desc, "Statut: %s\n", b.Status)
+		if len(b.RentalItems) > 0 {
+			desc.WriteString("Locations:\n")
+			for _, item := range b.RentalItems {
+				fmt.Fprintf(&desc, "- %s\n", item.Title)
+			}
+		}
+		if b.SpecialRequests != "" {
+			fmt.Fprintf(&desc, "Demandes spéciales: %s\n", b.SpecialRequests)
+		}
+
+		status := "CONFIRMED"
+		if b.Status == models.BookingStatusCancelled {
+			status = "CANCELLED"
+		}
+
+		day := b.EventDate.Time()
+		events = append(events, ICalEvent{
+			UID:          calendarUID("booking", b.ID),
+			Summary:      summary,
+			Description:  strings.TrimSpace(desc.String()),
+			Location:     b.EventLocation,
+			Start:        day,
+			End:          day.AddDate(0, 0, 1),
+			AllDay:       true,
+			Status:       status,
+			Categories:   []string{EventTypeLabel(b.EventType)},
+			Created:      b.CreatedAt,
+			LastModified: b.UpdatedAt,
+			Sequence:     int(b.Revision),
+		})
+	}
+
+	return events, nil
+}
+
+// AvailabilityCalendarEvents returns blocked dates as all-day events
+func AvailabilityCalendarEvents() ([]ICalEvent, error) {
+	var blocked []models.Availability
+	if err := database.DB.
+		Where("available = ?", false).
+		Where("date >= ?", BusinessDate(time.Now().Add(-calendarFeedHistory))).
+		Order("date ASC").
+		Find(&blocked).Error; err != nil {
+		return nil, err
+	}
+
+	events := make([]ICalEvent, 0, len(blocked))
+	for _, a := range blocked {
+		day := a.Date.Time()
+		summary := "Indisponible"
+		if a.Notes != "" {
+			summary += " - " + a.Notes
+		}
+
+		events = append(events, ICalEvent{
+			// Keyed by date: the row for a date may be recreated
+			UID:          calendarUID("blocked", day.Format("20060102")),
+			Summary:      summary,
+			Description:  a.Notes,
+			Start:        day,
+			End:          day.AddDate(0, 0, 1),
+			AllDay:       true,
+			Status:       "CONFIRMED",
+			Created:      a.CreatedAt,
+			LastModified: a.UpdatedAt,
+			Sequence:     int(a.Revision),
+		})
+	}
+
+	return events, nil
+}
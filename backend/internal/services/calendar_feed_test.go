@@ -0,0 +1,65 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+)
+
+func TestBookingCalendarEvents(t *testing.T) {
+	useTestDB(t)
+
+	client := models.Client{Name: "Ana", Email: "ana@example.com"}
+	if err := database.DB.Create(&client).Error; err != nil {
+		t.Fatal(err)
+	}
+	date := BusinessDate(time.Now().AddDate(0, 1, 0))
+	book := func(status models.BookingStatus) *models.Booking {
+		t.Helper()
+		b := &models.Booking{ClientID: client.ID, EventDate: date, EventType: models.EventTypeWedding, Status: models.BookingStatusPending}
+		if err := database.DB.Create(b).Error; err != nil {
+			t.Fatal(err)
+		}
+		setStatus(t, b, status)
+		return b
+	}
+
+	published := book(models.BookingStatusConfirmed)
+	// Never published: cancelled while pending
+	book(models.BookingStatusCancelled)
+
+	events := feedEvents(t)
+	if len(events) != 1 || events[0].Status != "CONFIRMED" || events[0].Sequence != 1 {
+		t.Fatalf("events = %+v, want the confirmed booking at sequence 1", events)
+	}
+
+	setStatus(t, published, models.BookingStatusCancelled)
+	events = feedEvents(t)
+	if len(events) != 1 || events[0].Status != "CANCELLED" || events[0].Sequence != 2 {
+		t.Errorf("events after cancelling = %+v, want it cancelled at sequence 2", events)
+	}
+}
+
+// setStatus updates a booking status the way the handlers do
+func setStatus(t *testing.T, b *models.Booking, status models.BookingStatus) {
+	t.Helper()
+	from := b.Status
+	b.Status = status
+	if err := database.DB.Model(b).Update("status", status).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := RecordStatusChange(database.DB, b, from, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func feedEvents(t *testing.T) []ICalEvent {
+	t.Helper()
+	events, err := BookingCalendarEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
@@ -0,0 +1,371 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"gorm.io/gorm"
+)
+
+// MaxCalendarImportSize bounds downloaded and uploaded calendars
+const MaxCalendarImportSize = 10 << 20
+
+// calendarImportMonths is how far ahead recurring events are expanded
+const calendarImportMonths = 18
+
+// calendarImportPrefix holds uploaded .ics files, never served publicly
+const calendarImportPrefix = "uploads/private/calendars/"
+
+// CalendarImportHTTPClient fetches subscribed calendars; replaceable so the
+// sync can run against a local fixture server
+var CalendarImportHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// calendarImportMu serializes syncs so two runs never race on the same dates
+var calendarImportMu sync.Mutex
+
+// CalendarImportResult summarizes one sync
+type CalendarImportResult struct {
+	NotModified bool `json:"not_modified"`
+	Busy        int  `json:"busy"`    // dates covered by busy events
+	Added       int  `json:"added"`   // newly blocked dates
+	Updated     int  `json:"updated"` // blocked dates whose event changed
+	Removed     int  `json:"removed"` // dates no longer busy, unblocked
+	Skipped     int  `json:"skipped"` // dates already set manually or by another calendar
+	Blocked     int  `json:"blocked"` // upcoming dates this calendar now blocks
+}
+
+// NormalizeCalendarURL validates a subscription URL, mapping webcal:// to https://
+func NormalizeCalendarURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return "", errors.New("invalid calendar URL")
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "webcal", "webcals":
+		u.Scheme = "https"
+	case "http", "https":
+	default:
+		return "", errors.New("calendar URL must use http, https or webcal")
+	}
+	return u.String(), nil
+}
+
+// SaveCalendarUpload validates an uploaded .ics file and stores it privately.
+// Invalid files are returned as *UploadError.
+func SaveCalendarUpload(ctx context.Context, file *multipart.FileHeader) (string, error) {
+	if file.Size > MaxCalendarImportSize {
+		return "", &UploadError{Message: fmt.Sprintf("Calendar file exceeds %d MB", MaxCalendarImportSize>>20)}
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return "", &UploadError{Message: "Failed to read uploaded file"}
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, MaxCalendarImportSize+1))
+	if err != nil {
+		return "", &UploadError{Message: "Failed to read uploaded file"}
+	}
+	if len(data) > MaxCalendarImportSize {
+		return "", &UploadError{Message: fmt.Sprintf("Calendar file exceeds %d MB", MaxCalendarImportSize>>20)}
+	}
+	if _, err := parseICalendar(bytes.NewReader(data)); err != nil {
+		return "", &UploadError{Message: "File is not a valid iCalendar (.ics) file"}
+	}
+
+	name, err := RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	key := calendarImportPrefix + name + ".ics"
+	if err := Blobs().Put(ctx, key, bytes.NewReader(data), int64(len(data)), "text/calendar"); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// SyncCalendarImport fetches a calendar and mirrors its busy dates into
+// Availability. Manual dates are never touched, so an admin override wins.
+// The outcome is recorded on the import.
+func SyncCalendarImport(ctx context.Context, imp *models.CalendarImport) (*CalendarImportResult, error) {
+	calendarImportMu.Lock()
+	defer calendarImportMu.Unlock()
+
+	result, err := syncCalendarImport(ctx, imp)
+
+	now := time.Now()
+	updates := map[string]interface{}{"last_synced_at": &now, "last_error": ""}
+	switch {
+	case err != nil:
+		updates["last_status"] = "error"
+		updates["last_error"] = err.Error()
+	case result.NotModified:
+		updates["last_status"] = "not_modified"
+	default:
+		updates["last_status"] = "ok"
+		updates["blocked_dates"] = result.Blocked
+		updates["e_tag"] = imp.ETag
+		updates["last_modified"] = imp.LastModified
+	}
+	if dbErr := database.DB.Model(imp).Updates(updates).Error; dbErr != nil {
+		log.Printf("Failed to record sync of calendar import %d: %v", imp.ID, dbErr)
+	}
+
+	return result, err
+}
+
+func syncCalendarImport(ctx context.Context, imp *models.CalendarImport) (*CalendarImportResult, error) {
+	body, notModified, err := fetchCalendarImport(ctx, imp)
+	if err != nil {
+		return nil, err
+	}
+	if notModified {
+		return &CalendarImportResult{NotModified: true}, nil
+	}
+
+	from := Today()
+	to := from.AddDate(0, calendarImportMonths, 0)
+	busy, err := ParseBusyDates(bytes.NewReader(body), from, to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid calendar: %w", err)
+	}
+
+	result := &CalendarImportResult{Busy: len(busy)}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		return applyBusyDates(tx, imp, busy, from, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// fetchCalendarImport reads an uploaded file, or downloads a subscribed
+// calendar with a conditional request
+func fetchCalendarImport(ctx context.Context, imp *models.CalendarImport) ([]byte, bool, error) {
+	if imp.FileKey != "" {
+		data, err := ReadBlob(ctx, Blobs(), imp.FileKey)
+		return data, false, err
+	}
+	if imp.URL == "" {
+		return nil, false, errors.New("calendar import has no URL or file")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imp.URL, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Accept", "text/calendar, */*;q=0.5")
+	if imp.ETag != "" {
+		req.Header.Set("If-None-Match", imp.ETag)
+	}
+	if imp.LastModified != "" {
+		req.Header.Set("If-Modified-Since", imp.LastModified)
+	}
+
+	resp, err := CalendarImportHTTPClient.Do(req)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to fetch calendar: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return nil, true, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, false, fmt.Errorf("failed to fetch calendar: HTTP %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxCalendarImportSize+1))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to fetch calendar: %w", err)
+	}
+	if len(data) > MaxCalendarImportSize {
+		return nil, false, fmt.Errorf("calendar exceeds %d MB", MaxCalendarImportSize>>20)
+	}
+
+	imp.ETag = resp.Header.Get("ETag")
+	imp.LastModified = resp.Header.Get("Last-Modified")
+	return data, false, nil
+}
+
+// applyBusyDates blocks the busy dates and unblocks dates this import set
+// earlier that are no longer busy. Past dates are left as they are.
+func applyBusyDates(tx *gorm.DB, imp *models.CalendarImport, busy []BusyDate, from models.Date, result *CalendarImportResult) error {
+	busyDates := make(map[string]bool, len(busy))
+	for _, b := range busy {
+		busyDates[b.Date.String()] = true
+
+		notes := importedDateNotes(imp, b.Summary)
+
+		// The unique index on date also covers soft-deleted rows
+		var existing models.Availability
+		err := tx.Unscoped().Where("date = ?", b.Date).First(&existing).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			row := models.Availability{
+				Date:             b.Date,
+				MaxEvents:        1,
+				Notes:            notes,
+				Source:           models.AvailabilitySourceImport,
+				CalendarImportID: &imp.ID,
+			}
+			if err := tx.Create(&row).Error; err != nil {
+				return err
+			}
+			// GORM writes the column default for a false Available on create
+			if err := tx.Model(&row).Update("available", false).Error; err != nil {
+				return err
+			}
+			result.Added++
+
+		case err != nil:
+			return err
+
+		case existing.DeletedAt.Valid:
+			// A deleted row carries no decision anymore; reuse it
+			if err := tx.Unscoped().Model(&existing).Updates(map[string]interface{}{
+				"deleted_at":         nil,
+				"available":          false,
+				"max_events":         1,
+				"notes":              notes,
+				"source":             models.AvailabilitySourceImport,
+				"calendar_import_id": imp.ID,
+			}).Error; err != nil {
+				return err
+			}
+			result.Added++
+
+		case existing.Source != models.AvailabilitySourceImport ||
+			existing.CalendarImportID == nil || *existing.CalendarImportID != imp.ID:
+			// Set by an admin (or another calendar): the existing decision stays
+			result.Skipped++
+
+		case existing.Notes != notes || existing.Available:
+			if err := tx.Model(&existing).Updates(map[string]interface{}{
+				"available": false,
+				"notes":     notes,
+			}).Error; err != nil {
+				return err
+			}
+			result.Updated++
+		}
+	}
+
+	var previous []models.Availability
+	if err := tx.Where("source = ? AND calendar_import_id = ? AND date >= ?",
+		models.AvailabilitySourceImport, imp.ID, from).
+		Find(&previous).Error; err != nil {
+		return err
+	}
+	for _, row := range previous {
+		if busyDates[row.Date.String()] {
+			continue
+		}
+		// Hard delete so the date can be blocked again later
+		if err := tx.Unscoped().Delete(&row).Error; err != nil {
+			return err
+		}
+		result.Removed++
+	}
+	if result.Removed > 0 {
+		if err := forgetCalendarValidators(tx, imp.ID); err != nil {
+			return err
+		}
+	}
+
+	var blocked int64
+	if err := tx.Model(&models.Availability{}).
+		Where("source = ? AND calendar_import_id = ? AND date >= ?",
+			models.AvailabilitySourceImport, imp.ID, from).
+		Count(&blocked).Error; err != nil {
+		return err
+	}
+	result.Blocked = int(blocked)
+
+	return nil
+}
+
+// importedDateNotes marks an imported date with its calendar and event
+func importedDateNotes(imp *models.CalendarImport, summary string) string {
+	if summary == "" {
+		return "Importé : " + imp.Name
+	}
+	return fmt.Sprintf("Importé : %s - %s", imp.Name, summary)
+}
+
+// RemoveCalendarImportDates unblocks the future dates set by an import
+func RemoveCalendarImportDates(importID uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().
+			Where("source = ? AND calendar_import_id = ? AND date >= ?",
+				models.AvailabilitySourceImport, importID, Today()).
+			Delete(&models.Availability{}).Error; err != nil {
+			return err
+		}
+		return forgetCalendarValidators(tx, importID)
+	})
+}
+
+// forgetCalendarValidators makes the next sync of the other imports download
+// their calendar in full, so they can block dates this import released even
+// when their feed did not change
+func forgetCalendarValidators(tx *gorm.DB, exceptID uint) error {
+	return tx.Model(&models.CalendarImport{}).
+		Where("id <> ?", exceptID).
+		Updates(map[string]interface{}{"e_tag": "", "last_modified": ""}).Error
+}
+
+// SyncCalendarImports syncs every enabled import, logging failures. It
+// returns how many synced and the failures joined into one error.
+func SyncCalendarImports(ctx context.Context) (synced, failed int, err error) {
+	var imports []models.CalendarImport
+	if err := database.DB.Where("enabled = ?", true).Order("id ASC").Find(&imports).Error; err != nil {
+		log.Printf("Failed to load calendar imports: %v", err)
+		return 0, 0, fmt.Errorf("failed to load calendar imports: %w", err)
+	}
+
+	var errs []error
+	for i := range imports {
+		if ctx.Err() != nil {
+			errs = append(errs, ctx.Err())
+			break
+		}
+		result, err := SyncCalendarImport(ctx, &imports[i])
+		if err != nil {
+			log.Printf("Calendar import %q failed: %v", imports[i].Name, err)
+			errs = append(errs, fmt.Errorf("calendar import %q: %w", imports[i].Name, err))
+			failed++
+			continue
+		}
+		synced++
+		if result.Added+result.Updated+result.Removed > 0 {
+			log.Printf("Calendar import %q: %d added, %d updated, %d removed, %d kept manual",
+				imports[i].Name, result.Added, result.Updated, result.Removed, result.Skipped)
+		}
+	}
+	return synced, failed, errors.Join(errs...)
+}
+
+// CalendarImportJob syncs the imported calendars
+func CalendarImportJob(ctx context.Context) (string, error) {
+	synced, failed, err := SyncCalendarImports(ctx)
+	if synced == 0 && failed == 0 {
+		return "", err
+	}
+	return fmt.Sprintf("synced %d calendars, %d failed", synced, failed), err
+}
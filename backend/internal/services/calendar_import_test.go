@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+)
+
+// calendarServer serves a calendar with an ETag, answering conditional
+// requests with 304 like the calendar providers do
+type calendarServer struct {
+	mu       sync.Mutex
+	body     string
+	etag     string
+	requests int
+}
+
+func (s *calendarServer) set(body, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.body, s.etag = body, etag
+}
+
+func (s *calendarServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if r.Header.Get("If-None-Match") == s.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("ETag", s.etag)
+	w.Write([]byte(s.body))
+}
+
+func readCalendarFixture(t *testing.T) string {
+	t.Helper()
+	data, err := os.ReadFile("../../testdata/calendars/personal.ics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// withoutEvent removes the VEVENT blocks of a UID from a calendar
+func withoutEvent(calendar, uid string) string {
+	var kept []string
+	for _, block := range strings.SplitAfter(calendar, "END:VEVENT\r\n") {
+		if !strings.Contains(block, "UID:"+uid+"\r\n") {
+			kept = append(kept, block)
+			continue
+		}
+		// Keep what precedes the event in its block
+		kept = append(kept, block[:strings.Index(block, "BEGIN:VEVENT")])
+	}
+	return strings.Join(kept, "")
+}
+
+func availabilityOn(t *testing.T, date string) *models.Availability {
+	t.Helper()
+	d, _ := models.ParseDate(date)
+	var rows []models.Availability
+	if err := database.DB.Where("date = ?", d).Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return &rows[0]
+}
+
+func TestSyncCalendarImport(t *testing.T) {
+	useTestDB(t)
+	useClock(t, time.Date(2026, 6, 1, 12, 0, 0, 0, BusinessLocation()))
+
+	fixture := readCalendarFixture(t)
+	calendar := &calendarServer{}
+	calendar.set(fixture, `"v1"`)
+	server := httptest.NewServer(calendar)
+	defer server.Close()
+
+	// A date the admin set by hand is never overwritten
+	manual := models.Availability{Date: models.NewDate(2026, 12, 24), Available: true, MaxEvents: 2, Notes: "Ouvert"}
+	if err := database.DB.Create(&manual).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	imp := models.CalendarImport{Name: "Perso", URL: server.URL + "/personal.ics", Enabled: true}
+	if err := database.DB.Create(&imp).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := SyncCalendarImport(context.Background(), &imp)
+	if err != nil {
+		t.Fatalf("SyncCalendarImport: %v", err)
+	}
+	// Between 2026-06-01 and 2027-12-01: 28 vacation days, 33 days of the
+	// monthly contract (2 overlapping the vacation) and 2 at Christmas
+	want := CalendarImportResult{Busy: 61, Added: 60, Skipped: 1, Blocked: 60}
+	if *result != want {
+		t.Errorf("first sync = %+v, want %+v", *result, want)
+	}
+
+	tests := []struct {
+		date  string
+		notes string // empty when the date must stay free
+	}{
+		{"2026-07-20", "Importé : Perso - Vacances d'été"},
+		{"2027-08-02", "Importé : Perso - Vacances d'été"},
+		{"2026-07-04", "Importé : Perso - Contrat, salle Laval"},
+		{"2026-07-05", "Importé : Perso - Contrat, salle Laval"}, // ends at 1:00 the next day
+		{"2027-01-09", "Importé : Perso - Contrat, salle Laval (reporté)"},
+		{"2026-12-31", "Importé : Perso - Noël en famille"}, // RDATE
+		{"2026-12-05", ""}, // EXDATE
+		{"2027-01-02", ""}, // moved by RECURRENCE-ID
+		{"2027-12-04", ""}, // past the import window
+		{"2026-11-14", ""}, // cancelled
+		{"2026-06-08", ""}, // transparent
+	}
+	for _, tt := range tests {
+		row := availabilityOn(t, tt.date)
+		switch {
+		case tt.notes == "" && row != nil:
+			t.Errorf("%s: blocked by %q, want free", tt.date, row.Notes)
+		case tt.notes != "" && row == nil:
+			t.Errorf("%s: free, want blocked", tt.date)
+		case tt.notes != "" && (row.Available || row.Source != models.AvailabilitySourceImport || row.Notes != tt.notes):
+			t.Errorf("%s: %+v, want blocked with %q", tt.date, row, tt.notes)
+		}
+	}
+	if row := availabilityOn(t, "2026-12-24"); row == nil || !row.Available || row.Source != models.AvailabilitySourceManual {
+		t.Errorf("manual date changed: %+v", row)
+	}
+
+	var stored models.CalendarImport
+	database.DB.First(&stored, imp.ID)
+	if stored.LastStatus != "ok" || stored.ETag != `"v1"` || stored.BlockedDates != 60 || stored.LastSyncedAt == nil {
+		t.Errorf("import after sync = %+v", stored)
+	}
+
+	// Unchanged feed: conditional request, nothing touched
+	result, err = SyncCalendarImport(context.Background(), &stored)
+	if err != nil || !result.NotModified {
+		t.Fatalf("second sync = %+v, %v", result, err)
+	}
+
+	// The vacation is removed from the feed: its dates are released, except
+	// the two the contract still covers, which now carry its name
+	calendar.set(withoutEvent(fixture, "vacances@fixture"), `"v2"`)
+	database.DB.First(&stored, imp.ID)
+	result, err = SyncCalendarImport(context.Background(), &stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = CalendarImportResult{Busy: 35, Updated: 2, Skipped: 1, Removed: 26, Blocked: 34}
+	if *result != want {
+		t.Errorf("sync after change = %+v, want %+v", *result, want)
+	}
+	if row := availabilityOn(t, "2026-07-20"); row != nil {
+		t.Errorf("2026-07-20 still blocked: %+v", row)
+	}
+	if row := availabilityOn(t, "2026-08-01"); row == nil || row.Notes != "Importé : Perso - Contrat, salle Laval" {
+		t.Errorf("2026-08-01 = %+v, want blocked by the contract", row)
+	}
+}
+
+func TestSyncCalendarImportErrors(t *testing.T) {
+	useTestDB(t)
+	useClock(t, time.Date(2026, 6, 1, 12, 0, 0, 0, BusinessLocation()))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/broken.ics":
+			w.Write([]byte("<html>not a calendar</html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		path string
+		err  string
+	}{
+		{"/missing.ics", "HTTP 404"},
+		{"/broken.ics", "invalid calendar"},
+	}
+	for _, tt := range tests {
+		imp := models.CalendarImport{Name: tt.path, URL: server.URL + tt.path, Enabled: true}
+		database.DB.Create(&imp)
+
+		if _, err := SyncCalendarImport(context.Background(), &imp); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: err = %v, want %q", tt.path, err, tt.err)
+		}
+		var stored models.CalendarImport
+		database.DB.First(&stored, imp.ID)
+		if stored.LastStatus != "error" || !strings.Contains(stored.LastError, tt.err) {
+			t.Errorf("%s: recorded %q / %q", tt.path, stored.LastStatus, stored.LastError)
+		}
+	}
+}
+
+func TestCalendarImportJob(t *testing.T) {
+	useTestDB(t)
+	useClock(t, time.Date(2026, 6, 1, 12, 0, 0, 0, BusinessLocation()))
+
+	calendar := &calendarServer{}
+	calendar.set(readCalendarFixture(t), `"v1"`)
+	mux := http.NewServeMux()
+	mux.Handle("/personal.ics", calendar)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Nothing to sync: no summary, no error
+	if summary, err := CalendarImportJob(context.Background()); summary != "" || err != nil {
+		t.Errorf("empty job = %q, %v", summary, err)
+	}
+
+	imports := []models.CalendarImport{
+		{Name: "Perso", URL: server.URL + "/personal.ics", Enabled: true},
+		{Name: "Ancien", URL: server.URL + "/gone.ics", Enabled: true},
+		{Name: "Salle", URL: server.URL + "/gone.ics", Enabled: true},
+	}
+	if err := database.DB.Create(&imports).Error; err != nil {
+		t.Fatal(err)
+	}
+	// Disabled imports are not synced
+	database.DB.Model(&imports[2]).Update("enabled", false)
+
+	summary, err := CalendarImportJob(context.Background())
+	if summary != "synced 1 calendars, 1 failed" {
+		t.Errorf("summary = %q", summary)
+	}
+	if err == nil || !strings.Contains(err.Error(), `calendar import "Ancien"`) || !strings.Contains(err.Error(), "HTTP 404") {
+		t.Errorf("err = %v", err)
+	}
+	if calendar.requests != 1 {
+		t.Errorf("calendar fetched %d times, want 1", calendar.requests)
+	}
+}
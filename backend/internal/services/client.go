@@ -0,0 +1,278 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mazong/angel_event/internal/models"
+	"gorm.io/gorm"
+)
+
+// ClientDetails is what a form tells about the person submitting it
+type ClientDetails struct {
+	Name         string
+	Email        string
+	Phone        string
+	Source       models.ClientSource
+	SourceDetail string
+}
+
+// ErrSameClient is returned when merging a client into itself
+var ErrSameClient = errors.New("cannot merge a client into itself")
+
+// FindClientByEmail returns the client with email as its own address or as
+// the address of one of its contacts
+func FindClientByEmail(db *gorm.DB, email string) (*models.Client, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	var client models.Client
+	err := db.Where("LOWER(email) = ?", email).First(&client).Error
+	if err == nil {
+		return &client, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var contact models.ClientContact
+	if err := db.Where("LOWER(email) = ?", email).First(&contact).Error; err != nil {
+		return nil, err
+	}
+	if err := db.First(&client, contact.ClientID).Error; err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// FindOrCreateClient returns the client of the submitted email, creating it
+// when none exists. Prospects are clients known only from inquiries. An
+// email of a secondary contact, such as the partner of a couple, reaches
+// the primary client. A deleted client writing again is restored, since the
+// email is unique across deletions.
+//
+// refresh takes the submitted name and phone as the current ones, as on
+// bookings, writing the replaced values to the client's notes; otherwise
+// only a missing phone is filled in.
+func FindOrCreateClient(db *gorm.DB, details ClientDetails, prospect, refresh bool) (*models.Client, error) {
+	email := strings.ToLower(strings.TrimSpace(details.Email))
+
+	var client models.Client
+	err := db.Unscoped().Where("LOWER(email) = ?", email).First(&client).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		var contact models.ClientContact
+		if db.Where("LOWER(email) = ?", email).First(&contact).Error == nil &&
+			db.First(&client, contact.ClientID).Error == nil {
+			if refresh {
+				updateContactDetails(db, &contact, details)
+			}
+			return &client, fillClientSource(db, &client, details)
+		}
+
+		client = models.Client{
+			Name:         details.Name,
+			Email:        email,
+			Phone:        details.Phone,
+			Prospect:     prospect,
+			Source:       details.Source,
+			SourceDetail: details.SourceDetail,
+		}
+		if err := db.Create(&client).Error; err != nil {
+			return nil, err
+		}
+		return &client, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if client.DeletedAt.Valid {
+		if err := db.Unscoped().Model(&client).Update("deleted_at", nil).Error; err != nil {
+			return nil, err
+		}
+		client.DeletedAt = gorm.DeletedAt{}
+	}
+
+	if refresh {
+		if err := refreshClientDetails(db, &client, details); err != nil {
+			return nil, err
+		}
+	} else if client.Phone == "" && details.Phone != "" {
+		// Fill in a phone number the client did not give before
+		client.Phone = details.Phone
+		db.Model(&client).Update("phone", details.Phone)
+	}
+	return &client, fillClientSource(db, &client, details)
+}
+
+// refreshClientDetails replaces the name and phone of a client with the
+// submitted ones, keeping the previous values in a note
+func refreshClientDetails(db *gorm.DB, client *models.Client, details ClientDetails) error {
+	updates := map[string]interface{}{}
+	var changes []string
+	if details.Name != "" && details.Name != client.Name {
+		changes = append(changes, fmt.Sprintf("name %q → %q", client.Name, details.Name))
+		updates["name"] = details.Name
+		client.Name = details.Name
+	}
+	if details.Phone != "" && details.Phone != client.Phone {
+		if client.Phone != "" {
+			changes = append(changes, fmt.Sprintf("phone %q → %q", client.Phone, details.Phone))
+		}
+		updates["phone"] = details.Phone
+		client.Phone = details.Phone
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+
+	if err := db.Model(client).Updates(updates).Error; err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return db.Create(&models.ClientNote{
+		ClientID: client.ID,
+		Body:     "Updated from a booking form: " + strings.Join(changes, ", "),
+	}).Error
+}
+
+// updateContactDetails keeps a contact's name and phone current
+func updateContactDetails(db *gorm.DB, contact *models.ClientContact, details ClientDetails) {
+	updates := map[string]interface{}{}
+	if details.Name != "" && details.Name != contact.Name {
+		updates["name"] = details.Name
+	}
+	if details.Phone != "" && details.Phone != contact.Phone {
+		updates["phone"] = details.Phone
+	}
+	if len(updates) > 0 {
+		db.Model(contact).Updates(updates)
+	}
+}
+
+// fillClientSource records where a client came from, unless already known
+func fillClientSource(db *gorm.DB, client *models.Client, details ClientDetails) error {
+	if client.Source != "" || details.Source == "" {
+		return nil
+	}
+	client.Source = details.Source
+	client.SourceDetail = details.SourceDetail
+	return db.Model(client).Updates(map[string]interface{}{
+		"source":        details.Source,
+		"source_detail": details.SourceDetail,
+	}).Error
+}
+
+// PromoteProspect marks a client who booked as a customer
+func PromoteProspect(db *gorm.DB, client *models.Client) error {
+	if !client.Prospect {
+		return nil
+	}
+	client.Prospect = false
+	return db.Model(client).Update("prospect", false).Error
+}
+
+// clientOwnedTables hold rows belonging to a client through client_id
+var clientOwnedTables = []interface{}{
+	&models.Booking{},
+	&models.Testimonial{},
+	&models.EmailLog{},
+	&models.Inquiry{},
+	&models.InboundEmail{},
+	&models.Payment{},
+	&models.BookingStatusChange{},
+	&models.ClientNote{},
+	&models.ClientContact{},
+	&models.AutomationSend{},
+	&models.ReviewInvitation{},
+}
+
+// MergeClients moves everything of the source client to the target in one
+// transaction: bookings, testimonials, email logs and the rest of its
+// history, contacts and tags. The source email becomes a contact of the
+// target, blank target fields take the source values, and the source is
+// deleted for good so its email cannot bring it back.
+func MergeClients(db *gorm.DB, targetID, sourceID uint, userID *uint) (*models.Client, error) {
+	if targetID == sourceID {
+		return nil, ErrSameClient
+	}
+
+	var target models.Client
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var source models.Client
+		if err := tx.Preload("Tags").First(&target, targetID).Error; err != nil {
+			return err
+		}
+		if err := tx.Preload("Tags").First(&source, sourceID).Error; err != nil {
+			return err
+		}
+
+		for _, table := range clientOwnedTables {
+			if err := tx.Unscoped().Model(table).Where("client_id = ?", source.ID).
+				Update("client_id", target.ID).Error; err != nil {
+				return err
+			}
+		}
+
+		if !strings.EqualFold(source.Email, target.Email) {
+			if err := tx.Create(&models.ClientContact{
+				ClientID: target.ID,
+				Role:     models.ContactOther,
+				Name:     source.Name,
+				Email:    source.Email,
+				Phone:    source.Phone,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		updates := map[string]interface{}{}
+		if target.Phone == "" && source.Phone != "" {
+			updates["phone"] = source.Phone
+		}
+		if target.Source == "" && source.Source != "" {
+			updates["source"] = source.Source
+			updates["source_detail"] = source.SourceDetail
+		}
+		if source.Notes != "" {
+			updates["notes"] = strings.TrimSpace(target.Notes + "\n\n" + source.Notes)
+		}
+		if target.Prospect && !source.Prospect {
+			updates["prospect"] = false
+		}
+		if len(updates) > 0 {
+			if err := tx.Model(&target).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(source.Tags) > 0 {
+			if err := tx.Model(&target).Association("Tags").Append(source.Tags); err != nil {
+				return err
+			}
+			if err := tx.Model(&source).Association("Tags").Clear(); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Create(&models.ClientNote{
+			ClientID: target.ID,
+			UserID:   userID,
+			Body:     fmt.Sprintf("Merged client #%d %s <%s>", source.ID, source.Name, source.Email),
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Delete(&source).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Preload("Tags").Preload("Contacts").First(&target, targetID).Error; err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
@@ -0,0 +1,298 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+)
+
+// DefaultDuplicateScore is the score from which two clients are reported as
+// likely duplicates: a shared phone, the same name, or a similar name with
+// a similar email
+const DefaultDuplicateScore = 0.6
+
+// Duplicate match reasons and their weights; a pair scores the sum of its
+// reasons, capped at 1
+var duplicateWeights = map[string]float64{
+	"same_email":       1,
+	"similar_email":    0.4,
+	"same_phone":       0.6,
+	"same_name":        0.6,
+	"similar_name":     0.4,
+	"shared_last_name": 0.2,
+}
+
+// DuplicatePair is two clients that may be the same person or couple
+type DuplicatePair struct {
+	Client    models.Client `json:"client"`
+	Duplicate models.Client `json:"duplicate"`
+	Score     float64       `json:"score"`
+	Reasons   []string      `json:"reasons"`
+}
+
+// clientProfile holds the normalized identifiers of a client and its
+// contacts
+type clientProfile struct {
+	client models.Client
+	emails []string
+	phones []string
+	names  []string
+}
+
+// FindDuplicateClients returns the pairs of clients scoring at least
+// minScore, best first. With clientID set, only the pairs of that client are
+// returned.
+func FindDuplicateClients(clientID uint, minScore float64) ([]DuplicatePair, error) {
+	var clients []models.Client
+	if err := database.DB.Preload("Contacts").Order("id").Find(&clients).Error; err != nil {
+		return nil, err
+	}
+
+	profiles := make([]clientProfile, len(clients))
+	for i, c := range clients {
+		profiles[i] = newClientProfile(c)
+	}
+
+	pairs := []DuplicatePair{}
+	for i := range profiles {
+		for j := i + 1; j < len(profiles); j++ {
+			a, b := &profiles[i], &profiles[j]
+			if clientID != 0 && a.client.ID != clientID && b.client.ID != clientID {
+				continue
+			}
+			score, reasons := scoreDuplicate(a, b)
+			if score < minScore {
+				continue
+			}
+			// The client asked about comes first
+			if b.client.ID == clientID {
+				a, b = b, a
+			}
+			pairs = append(pairs, DuplicatePair{Client: a.client, Duplicate: b.client, Score: score, Reasons: reasons})
+		}
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].Score > pairs[j].Score })
+	return pairs, nil
+}
+
+func newClientProfile(c models.Client) clientProfile {
+	p := clientProfile{client: c}
+	add := func(name, email, phone string) {
+		if e := normalizeEmail(email); e != "" {
+			p.emails = append(p.emails, e)
+		}
+		if ph := normalizePhone(phone); ph != "" {
+			p.phones = append(p.phones, ph)
+		}
+		if n := normalizeName(name); n != "" {
+			p.names = append(p.names, n)
+		}
+	}
+	add(c.Name, c.Email, c.Phone)
+	for _, contact := range c.Contacts {
+		add(contact.Name, contact.Email, contact.Phone)
+	}
+	// Contacts are only listed with their client in responses
+	p.client.Contacts = nil
+	return p
+}
+
+// scoreDuplicate compares every identifier of two clients, keeping the
+// strongest email, phone and name evidence
+func scoreDuplicate(a, b *clientProfile) (float64, []string) {
+	var reasons []string
+
+	emailReason := ""
+	for _, ea := range a.emails {
+		for _, eb := range b.emails {
+			switch {
+			case ea == eb:
+				emailReason = "same_email"
+			case emailReason == "" && similarEmail(ea, eb):
+				emailReason = "similar_email"
+			}
+		}
+	}
+	if emailReason != "" {
+		reasons = append(reasons, emailReason)
+	}
+
+	for _, pa := range a.phones {
+		if containsString(b.phones, pa) {
+			reasons = append(reasons, "same_phone")
+			break
+		}
+	}
+
+	nameReason := ""
+	for _, na := range a.names {
+		for _, nb := range b.names {
+			switch {
+			case na == nb:
+				nameReason = "same_name"
+			case nameReason != "same_name" && similarity(na, nb) >= 0.85:
+				nameReason = "similar_name"
+			case nameReason == "" && sharedLastName(na, nb):
+				nameReason = "shared_last_name"
+			}
+		}
+	}
+	if nameReason != "" {
+		reasons = append(reasons, nameReason)
+	}
+
+	score := 0.0
+	for _, r := range reasons {
+		score += duplicateWeights[r]
+	}
+	if score > 1 {
+		score = 1
+	}
+	return score, reasons
+}
+
+// normalizeEmail lowercases an address and drops the +tag; Gmail
+// addresses also lose their dots, which Gmail ignores
+func normalizeEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return email
+	}
+	local, domain := email[:at], email[at+1:]
+	if plus := strings.Index(local, "+"); plus > 0 {
+		local = local[:plus]
+	}
+	if domain == "gmail.com" || domain == "googlemail.com" {
+		local = strings.ReplaceAll(local, ".", "")
+		domain = "gmail.com"
+	}
+	return local + "@" + domain
+}
+
+// similarEmail matches the same mailbox name at another provider, or a
+// typo in the address
+func similarEmail(a, b string) bool {
+	localA, domainA, _ := strings.Cut(a, "@")
+	localB, domainB, _ := strings.Cut(b, "@")
+	if len(localA) >= 4 && localA == localB {
+		return true
+	}
+	return domainA == domainB && len(localA) >= 5 && levenshtein(localA, localB) <= 1
+}
+
+// normalizePhone keeps the last 10 digits, dropping the country code of
+// North American numbers
+func normalizePhone(phone string) string {
+	var digits []rune
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, r)
+		}
+	}
+	if len(digits) < 7 {
+		return ""
+	}
+	if len(digits) > 10 {
+		digits = digits[len(digits)-10:]
+	}
+	return string(digits)
+}
+
+// normalizeName lowercases a name, removes accents and punctuation and
+// sorts its words, so "Tremblay, Élise" matches "elise tremblay"
+func normalizeName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		r = foldAccent(r)
+		switch {
+		case unicode.IsLetter(r):
+			b.WriteRune(r)
+		default:
+			b.WriteRune(' ')
+		}
+	}
+	words := strings.Fields(b.String())
+	sort.Strings(words)
+	return strings.Join(words, " ")
+}
+
+// accentFolds maps the accented letters of French names to plain ones
+var accentFolds = map[rune]rune{
+	'à': 'a', 'â': 'a', 'ä': 'a', 'á': 'a', 'ã': 'a',
+	'ç': 'c',
+	'é': 'e', 'è': 'e', 'ê': 'e', 'ë': 'e',
+	'î': 'i', 'ï': 'i', 'í': 'i', 'ì': 'i',
+	'ô': 'o', 'ö': 'o', 'ó': 'o', 'ò': 'o', 'õ': 'o',
+	'û': 'u', 'ù': 'u', 'ü': 'u', 'ú': 'u',
+	'ÿ': 'y', 'ñ': 'n',
+}
+
+func foldAccent(r rune) rune {
+	if folded, ok := accentFolds[r]; ok {
+		return folded
+	}
+	return r
+}
+
+// sharedLastName matches names sharing a word of 3 letters or more other
+// than the first name, as partners or relatives often do
+func sharedLastName(a, b string) bool {
+	wordsA, wordsB := strings.Fields(a), strings.Fields(b)
+	if len(wordsA) < 2 || len(wordsB) < 2 {
+		return false
+	}
+	for _, wa := range wordsA {
+		if len(wa) >= 3 && containsString(wordsB, wa) {
+			return true
+		}
+	}
+	return false
+}
+
+// similarity is 1 minus the edit distance relative to the longer string
+func similarity(a, b string) float64 {
+	longest := len([]rune(a))
+	if n := len([]rune(b)); n > longest {
+		longest = n
+	}
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(a, b))/float64(longest)
+}
+
+// levenshtein returns the edit distance between two strings
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,306 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"gorm.io/gorm"
+)
+
+// DefaultDateHoldTTL is how long a client keeps a date while booking
+const DefaultDateHoldTTL = 20 * time.Minute
+
+// dateHoldTokenBytes is the size of hold tokens (192 bits)
+const dateHoldTokenBytes = 24
+
+var (
+	// ErrDateUnavailable is returned when a date has no capacity left
+	ErrDateUnavailable = errors.New("date is not available")
+	// ErrHoldNotActive is returned for unknown, expired, released or used holds
+	ErrHoldNotActive = errors.New("date hold is not active")
+	// ErrTooManyHolds is returned when an email or IP already has the
+	// maximum number of active holds
+	ErrTooManyHolds = errors.New("too many active date holds")
+)
+
+// RentalUnavailableError lists rental items out of stock on a date
+type RentalUnavailableError struct {
+	Items []string
+}
+
+func (e *RentalUnavailableError) Error() string {
+	return "rental items unavailable: " + strings.Join(e.Items, ", ")
+}
+
+var (
+	dateHoldTTL     time.Duration
+	dateHoldTTLOnce sync.Once
+)
+
+// DateHoldTTL returns the configured hold duration (DATE_HOLD_TTL)
+func DateHoldTTL() time.Duration {
+	dateHoldTTLOnce.Do(func() {
+		dateHoldTTL = ParseDurationEnv("DATE_HOLD_TTL", DefaultDateHoldTTL)
+		if dateHoldTTL <= 0 {
+			dateHoldTTL = DefaultDateHoldTTL
+		}
+	})
+	return dateHoldTTL
+}
+
+var (
+	holdCapsOnce     sync.Once
+	maxHoldsPerEmail int
+	maxHoldsPerIP    int
+)
+
+// holdCaps returns the maximum number of active holds per email
+// (DATE_HOLD_MAX_PER_EMAIL, default 2) and per IP (DATE_HOLD_MAX_PER_IP,
+// default 3); 0 disables a cap
+func holdCaps() (perEmail, perIP int) {
+	holdCapsOnce.Do(func() {
+		maxHoldsPerEmail = envInt("DATE_HOLD_MAX_PER_EMAIL", 2)
+		maxHoldsPerIP = envInt("DATE_HOLD_MAX_PER_IP", 3)
+	})
+	return maxHoldsPerEmail, maxHoldsPerIP
+}
+
+// checkHoldCaps fails with ErrTooManyHolds when email or ip already has
+// as many active holds as allowed
+func checkHoldCaps(db *gorm.DB, email, ip string) error {
+	perEmail, perIP := holdCaps()
+	if email != "" && perEmail > 0 {
+		var count int64
+		if err := activeHolds(db).Where("LOWER(email) = ?", strings.ToLower(email)).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= int64(perEmail) {
+			return ErrTooManyHolds
+		}
+	}
+	if ip != "" && perIP > 0 {
+		var count int64
+		if err := activeHolds(db).Where("ip = ?", ip).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= int64(perIP) {
+			return ErrTooManyHolds
+		}
+	}
+	return nil
+}
+
+// activeHolds scopes a query to holds still reserving capacity
+func activeHolds(db *gorm.DB) *gorm.DB {
+	return db.Model(&models.DateHold{}).
+		Where("date_holds.status = ? AND date_holds.expires_at > ?", models.DateHoldActive, time.Now())
+}
+
+// CreateDateHold reserves capacity on a date, and one unit of each rental
+// item, for DateHoldTTL. The email and IP of the client are capped to a few
+// active holds so one client cannot block the calendar.
+func CreateDateHold(date models.Date, itemIDs []uint, email, ip string) (*models.DateHold, error) {
+	var hold *models.DateHold
+	err := WithAvailabilityLock(func() error {
+		if err := checkHoldCaps(database.DB, email, ip); err != nil {
+			return err
+		}
+
+		day, err := ResolveDate(date)
+		if err != nil {
+			return err
+		}
+		if !day.Available {
+			return ErrDateUnavailable
+		}
+
+		items, err := LoadRentalItems(itemIDs)
+		if err != nil {
+			return err
+		}
+		if err := CheckRentalStock(date, items, 0); err != nil {
+			return err
+		}
+
+		hold, err = createDateHold(database.DB, date, items, email, ip, DateHoldTTL())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// createDateHold stores a hold lasting ttl. Capacity must have been checked
+// under the availability lock.
+func createDateHold(db *gorm.DB, date models.Date, items []models.RentalItem, email, ip string, ttl time.Duration) (*models.DateHold, error) {
+	token, err := RandomToken(dateHoldTokenBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	hold := &models.DateHold{
+		Token:       token,
+		Date:        date,
+		ExpiresAt:   time.Now().Add(ttl),
+		Status:      models.DateHoldActive,
+		Email:       email,
+		IP:          ip,
+		RentalItems: items,
+	}
+	if err := db.Create(hold).Error; err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// FindActiveHold returns the hold for a token if it still reserves capacity
+func FindActiveHold(token string) (*models.DateHold, error) {
+	var hold models.DateHold
+	err := activeHolds(database.DB).Preload("RentalItems").
+		Where("token = ?", token).First(&hold).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrHoldNotActive
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// ReleaseDateHold gives the capacity of an active hold back
+func ReleaseDateHold(token string) (*models.DateHold, error) {
+	hold, err := FindActiveHold(token)
+	if err != nil {
+		return nil, err
+	}
+
+	result := activeHolds(database.DB).
+		Where("id = ?", hold.ID).
+		Update("status", models.DateHoldReleased)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrHoldNotActive
+	}
+	hold.Status = models.DateHoldReleased
+	return hold, nil
+}
+
+// ConvertDateHold marks a hold as turned into a booking, along with the
+// waitlist claim it was issued for
+func ConvertDateHold(tx *gorm.DB, hold *models.DateHold, bookingID uint) error {
+	if err := tx.Model(hold).Updates(map[string]interface{}{
+		"status":     models.DateHoldConverted,
+		"booking_id": bookingID,
+	}).Error; err != nil {
+		return err
+	}
+
+	return tx.Model(&models.WaitlistEntry{}).
+		Where("hold_id = ? AND status = ?", hold.ID, models.WaitlistNotified).
+		Updates(map[string]interface{}{
+			"status":     models.WaitlistClaimed,
+			"booking_id": bookingID,
+		}).Error
+}
+
+// LoadRentalItems returns the requested rental items, all of which must
+// exist and be offered
+func LoadRentalItems(ids []uint) ([]models.RentalItem, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var items []models.RentalItem
+	if err := database.DB.Where("id IN ? AND available = ?", ids, true).Find(&items).Error; err != nil {
+		return nil, err
+	}
+
+	found := make(map[uint]bool, len(items))
+	for _, item := range items {
+		found[item.ID] = true
+	}
+	var missing []string
+	for _, id := range ids {
+		if !found[id] {
+			missing = append(missing, fmt.Sprintf("#%d", id))
+		}
+	}
+	if len(missing) > 0 {
+		return nil, &RentalUnavailableError{Items: missing}
+	}
+	return items, nil
+}
+
+// CheckRentalStock fails with *RentalUnavailableError when an item with
+// tracked stock is fully booked or held on date. The reservation of
+// excludeHoldID, the hold being converted, does not count.
+func CheckRentalStock(date models.Date, items []models.RentalItem, excludeHoldID uint) error {
+	var unavailable []string
+	for _, item := range items {
+		if item.Stock <= 0 {
+			continue
+		}
+
+		var booked int64
+		if err := database.DB.Table("booking_rental_items").
+			Joins("JOIN bookings ON bookings.id = booking_rental_items.booking_id").
+			Where("booking_rental_items.rental_item_id = ?", item.ID).
+			Where("bookings.event_date = ? AND bookings.status != ? AND bookings.deleted_at IS NULL",
+				date, models.BookingStatusCancelled).
+			Count(&booked).Error; err != nil {
+			return err
+		}
+
+		var held int64
+		if err := activeHolds(database.DB).
+			Joins("JOIN date_hold_rental_items ON date_hold_rental_items.date_hold_id = date_holds.id").
+			Where("date_hold_rental_items.rental_item_id = ?", item.ID).
+			Where("date_holds.date = ? AND date_holds.id != ?", date, excludeHoldID).
+			Count(&held).Error; err != nil {
+			return err
+		}
+
+		if int(booked+held) >= item.Stock {
+			unavailable = append(unavailable, item.Title)
+		}
+	}
+
+	if len(unavailable) > 0 {
+		return &RentalUnavailableError{Items: unavailable}
+	}
+	return nil
+}
+
+// ExpireDateHolds marks lapsed active holds as expired. Availability already
+// ignores them; this keeps the status accurate for the admin.
+func ExpireDateHolds() (int64, error) {
+	result := database.DB.Model(&models.DateHold{}).
+		Where("status = ? AND expires_at <= ?", models.DateHoldActive, time.Now()).
+		Update("status", models.DateHoldExpired)
+	return result.RowsAffected, result.Error
+}
+
+// DateHoldJob expires lapsed holds, then offers freed capacity to the
+// waitlist
+func DateHoldJob(ctx context.Context) (string, error) {
+	expired, err := ExpireDateHolds()
+	if err != nil {
+		return "", fmt.Errorf("date hold sweep: %w", err)
+	}
+	if err := ProcessWaitlists(); err != nil {
+		return "", fmt.Errorf("waitlist processing: %w", err)
+	}
+	if expired == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("expired %d holds", expired), nil
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+)
+
+func TestCreateDateHoldCaps(t *testing.T) {
+	useTestDB(t)
+
+	date := models.NewDate(2099, 6, 6)
+	if err := database.DB.Create(&models.Availability{Date: date, Available: true, MaxEvents: 10}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Two holds per email, whatever its case
+	for _, email := range []string{"ana@example.com", "Ana@Example.com"} {
+		if _, err := CreateDateHold(date, nil, email, "198.51.100.1"); err != nil {
+			t.Fatalf("hold for %s: %v", email, err)
+		}
+	}
+	if _, err := CreateDateHold(date, nil, "ANA@example.com", "198.51.100.2"); !errors.Is(err, ErrTooManyHolds) {
+		t.Errorf("third hold for the email: %v, want ErrTooManyHolds", err)
+	}
+
+	// Three per IP, across emails
+	if _, err := CreateDateHold(date, nil, "bob@example.com", "198.51.100.1"); err != nil {
+		t.Fatalf("third hold for the IP: %v", err)
+	}
+	if _, err := CreateDateHold(date, nil, "eve@example.com", "198.51.100.1"); !errors.Is(err, ErrTooManyHolds) {
+		t.Errorf("fourth hold for the IP: %v, want ErrTooManyHolds", err)
+	}
+
+	// Released holds no longer count
+	var hold models.DateHold
+	database.DB.Where("email = ?", "ana@example.com").First(&hold)
+	if _, err := ReleaseDateHold(hold.Token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateDateHold(date, nil, "ana@example.com", "198.51.100.3"); err != nil {
+		t.Errorf("hold after a release: %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"sync"
+	"time"
+	_ "time/tzdata" // BusinessTimezone must resolve on hosts without tzdata
+
+	"github.com/mazong/angel_event/internal/models"
+)
+
+// BusinessTimezone is where the business operates: "today", event dates and
+// calendar times are reckoned in it, whatever the server timezone is
+const BusinessTimezone = "America/Toronto"
+
+var (
+	businessLocation     *time.Location
+	businessLocationOnce sync.Once
+)
+
+// clock tells the current time; tests replace it to pin "today"
+var clock = time.Now
+
+// BusinessLocation loads BusinessTimezone (embedded through time/tzdata)
+func BusinessLocation() *time.Location {
+	businessLocationOnce.Do(func() {
+		loc, err := time.LoadLocation(BusinessTimezone)
+		if err != nil {
+			loc = time.UTC
+		}
+		businessLocation = loc
+	})
+	return businessLocation
+}
+
+// BusinessDate returns the business calendar day an instant falls on
+func BusinessDate(t time.Time) models.Date {
+	return models.DateOf(t.In(BusinessLocation()))
+}
+
+// Today returns the current business date
+func Today() models.Date {
+	return BusinessDate(clock())
+}
+
+// CurrentMonth returns the current business month as "YYYY-MM"
+func CurrentMonth() string {
+	return clock().In(BusinessLocation()).Format("2006-01")
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mazong/angel_event/internal/models"
+)
+
+// Toronto switches to EDT (UTC-4) at 2:00 on 2026-03-08 and back to EST
+// (UTC-5) at 2:00 on 2026-11-01
+var dstInstants = []struct {
+	name    string
+	instant time.Time
+	date    string
+	month   string
+}{
+	{"before midnight, EST", time.Date(2026, 3, 8, 4, 59, 0, 0, time.UTC), "2026-03-07", "2026-03"},
+	{"midnight, EST", time.Date(2026, 3, 8, 5, 0, 0, 0, time.UTC), "2026-03-08", "2026-03"},
+	{"just before the spring change", time.Date(2026, 3, 8, 6, 59, 0, 0, time.UTC), "2026-03-08", "2026-03"},
+	{"just after the spring change", time.Date(2026, 3, 8, 7, 0, 0, 0, time.UTC), "2026-03-08", "2026-03"},
+	{"before midnight, first EDT day", time.Date(2026, 3, 9, 3, 59, 0, 0, time.UTC), "2026-03-08", "2026-03"},
+	{"midnight, EDT", time.Date(2026, 3, 9, 4, 0, 0, 0, time.UTC), "2026-03-09", "2026-03"},
+	{"before midnight, EDT", time.Date(2026, 11, 1, 3, 59, 0, 0, time.UTC), "2026-10-31", "2026-10"},
+	{"midnight of the fall change", time.Date(2026, 11, 1, 4, 0, 0, 0, time.UTC), "2026-11-01", "2026-11"},
+	{"first 1:30, EDT", time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC), "2026-11-01", "2026-11"},
+	{"second 1:30, EST", time.Date(2026, 11, 1, 6, 30, 0, 0, time.UTC), "2026-11-01", "2026-11"},
+	{"before midnight, first EST day", time.Date(2026, 11, 2, 4, 59, 0, 0, time.UTC), "2026-11-01", "2026-11"},
+	{"midnight, EST again", time.Date(2026, 11, 2, 5, 0, 0, 0, time.UTC), "2026-11-02", "2026-11"},
+	// Month ends, in UTC already the next month
+	{"end of February", time.Date(2026, 3, 1, 4, 30, 0, 0, time.UTC), "2026-02-28", "2026-02"},
+	{"end of leap February", time.Date(2024, 3, 1, 4, 30, 0, 0, time.UTC), "2024-02-29", "2024-02"},
+	{"end of April", time.Date(2026, 5, 1, 3, 30, 0, 0, time.UTC), "2026-04-30", "2026-04"},
+	{"end of year", time.Date(2027, 1, 1, 4, 30, 0, 0, time.UTC), "2026-12-31", "2026-12"},
+}
+
+func TestBusinessDate(t *testing.T) {
+	for _, tt := range dstInstants {
+		if got := BusinessDate(tt.instant).String(); got != tt.date {
+			t.Errorf("%s: BusinessDate(%v) = %s, want %s", tt.name, tt.instant, got, tt.date)
+		}
+		// The server timezone does not matter
+		if got := BusinessDate(tt.instant.In(time.FixedZone("UTC+9", 9*3600))).String(); got != tt.date {
+			t.Errorf("%s: BusinessDate in UTC+9 = %s, want %s", tt.name, got, tt.date)
+		}
+	}
+}
+
+func TestToday(t *testing.T) {
+	for _, tt := range dstInstants {
+		useClock(t, tt.instant)
+		if got := Today().String(); got != tt.date {
+			t.Errorf("%s: Today() = %s, want %s", tt.name, got, tt.date)
+		}
+		if got := CurrentMonth(); got != tt.month {
+			t.Errorf("%s: CurrentMonth() = %s, want %s", tt.name, got, tt.month)
+		}
+	}
+}
+
+func TestBusinessDayBounds(t *testing.T) {
+	// The start of a business date is where BusinessDate changes
+	loc := BusinessLocation()
+	for _, date := range []string{"2026-03-08", "2026-03-09", "2026-11-01", "2026-11-02", "2024-02-29"} {
+		d, _ := models.ParseDate(date)
+		start := d.In(loc)
+		if got := BusinessDate(start); got != d {
+			t.Errorf("BusinessDate(start of %s) = %s", date, got)
+		}
+		if got := BusinessDate(start.Add(-time.Nanosecond)); got != d.AddDays(-1) {
+			t.Errorf("BusinessDate(just before %s) = %s, want %s", date, got, d.AddDays(-1))
+		}
+	}
+}
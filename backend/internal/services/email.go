@@ -3,9 +3,12 @@ package services
 import (
 	"crypto/tls"
 	"fmt"
+	"html"
 	"os"
 	"strconv"
+	"strings"
 
+	"github.com/mazong/angel_event/internal/models"
 	"gopkg.in/gomail.v2"
 )
 
@@ -42,17 +45,26 @@ func NewEmailService() *EmailService {
 
 // SendEmail sends a basic email
 func (s *EmailService) SendEmail(to, subject, body string) error {
+	return s.SendEmailReplyTo(to, subject, body, "")
+}
+
+// SendEmailReplyTo sends a basic email whose replies go to replyTo, such as
+// an address from ReplyAddress; an empty replyTo leaves replies to From
+func (s *EmailService) SendEmailReplyTo(to, subject, body, replyTo string) error {
 	m := gomail.NewMessage()
 	m.SetHeader("From", s.from)
 	m.SetHeader("To", to)
 	m.SetHeader("Subject", subject)
+	if replyTo != "" {
+		m.SetHeader("Reply-To", replyTo)
+	}
 	m.SetBody("text/html", body)
 
 	return s.dialer.DialAndSend(m)
 }
 
 // SendBookingConfirmation sends a booking confirmation email
-func (s *EmailService) SendBookingConfirmation(to, clientName, eventType, eventDate, language string) error {
+func (s *EmailService) SendBookingConfirmation(to, clientName, eventType, eventDate, language, replyTo string) error {
 	var subject, body string
 	if language == "en" {
 		subject = "Your Booking Confirmation - Angel Event"
@@ -61,7 +73,7 @@ func (s *EmailService) SendBookingConfirmation(to, clientName, eventType, eventD
 		subject = "Confirmation de votre réservation - Angel Event"
 		body = s.getBookingConfirmationTemplateFr(clientName, eventType, eventDate)
 	}
-	return s.SendEmail(to, subject, body)
+	return s.SendEmailReplyTo(to, subject, body, replyTo)
 }
 
 // SendContactFormEmail sends contact form submission to admin
@@ -86,6 +98,106 @@ func (s *EmailService) SendNewsletterEmail(to, subject, content string) error {
 	return s.SendEmail(to, subject, body)
 }
 
+// ProofingChoice is a selected photo listed in the proofing notification
+type ProofingChoice struct {
+	Title   string
+	Comment string
+}
+
+// SendProofingSelectionNotification notifies the admin that a client submitted a photo selection
+func (s *EmailService) SendProofingSelectionNotification(albumTitle, clientName, note string, choices []ProofingChoice) error {
+	adminEmail := os.Getenv("ADMIN_EMAIL")
+	subject := fmt.Sprintf("📸 Sélection de photos reçue - %s", albumTitle)
+	body := s.getProofingSelectionTemplate(albumTitle, clientName, note, choices)
+	return s.SendEmail(adminEmail, subject, body)
+}
+
+// WaitlistClaimSubject is the subject of the waitlist claim email
+func WaitlistClaimSubject(language string) string {
+	if language == "en" {
+		return "A date you wanted is available - Angel Event"
+	}
+	return "Une date que vous attendiez est disponible - Angel Event"
+}
+
+// SendWaitlistClaim tells a waitlisted client a slot opened, with the link
+// to claim it before it expires
+func (s *EmailService) SendWaitlistClaim(to, clientName, eventType, eventDate, claimURL, expires, language string) error {
+	var body string
+	if language == "en" {
+		body = s.getWaitlistClaimTemplateEn(clientName, eventType, eventDate, claimURL, expires)
+	} else {
+		body = s.getWaitlistClaimTemplateFr(clientName, eventType, eventDate, claimURL, expires)
+	}
+	return s.SendEmail(to, WaitlistClaimSubject(language), body)
+}
+
+// AutomationDetails are the booking details shown in automation emails
+type AutomationDetails struct {
+	ClientName  string
+	EventType   string
+	EventDate   string
+	Location    string
+	GuestCount  int
+	RentalItems []string
+	TotalAmount float64
+	TotalPaid   float64
+	BalanceDue  float64
+	ReviewURL   string
+}
+
+// AutomationSubject is the subject of an automation template email
+func AutomationSubject(template models.AutomationTemplate, language string) string {
+	en := language == "en"
+	switch template {
+	case models.TemplateEventReminder:
+		if en {
+			return "Your event is coming up - Angel Event"
+		}
+		return "Votre événement approche - Angel Event"
+	case models.TemplateBalanceDue:
+		if en {
+			return "Balance reminder for your event - Angel Event"
+		}
+		return "Rappel de solde pour votre événement - Angel Event"
+	default:
+		if en {
+			return "Thank you for choosing Angel Event"
+		}
+		return "Merci d'avoir choisi Angel Event"
+	}
+}
+
+// SendAutomationEmail sends the template email of an automation in the
+// booking's language
+func (s *EmailService) SendAutomationEmail(to string, template models.AutomationTemplate, language string, details AutomationDetails, replyTo string) error {
+	en := language == "en"
+	var body string
+	switch template {
+	case models.TemplateEventReminder:
+		if en {
+			body = s.getEventReminderTemplateEn(details)
+		} else {
+			body = s.getEventReminderTemplateFr(details)
+		}
+	case models.TemplateBalanceDue:
+		if en {
+			body = s.getBalanceDueTemplateEn(details)
+		} else {
+			body = s.getBalanceDueTemplateFr(details)
+		}
+	case models.TemplateThankYou:
+		if en {
+			body = s.getThankYouTemplateEn(details)
+		} else {
+			body = s.getThankYouTemplateFr(details)
+		}
+	default:
+		return fmt.Errorf("unknown email template %q", template)
+	}
+	return s.SendEmailReplyTo(to, AutomationSubject(template, language), body, replyTo)
+}
+
 // Email Templates
 
 func (s *EmailService) getBookingConfirmationTemplateFr(name, eventType, eventDate string) string {
@@ -168,6 +280,358 @@ func (s *EmailService) getBookingConfirmationTemplateEn(name, eventType, eventDa
 	`, name, eventType, eventDate)
 }
 
+func (s *EmailService) getWaitlistClaimTemplateFr(name, eventType, eventDate, claimURL, expires string) string {
+	return fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="UTF-8">
+	<style>
+		body { font-family: 'Inter', Arial, sans-serif; line-height: 1.6; color: #1A1A1A; }
+		.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+		.header { text-align: center; padding: 30px 0; background: linear-gradient(135deg, #FFFEF7 0%%, #F7E7CE 100%%); }
+		.logo { font-family: 'Great Vibes', cursive; font-size: 36px; color: #D4AF37; }
+		.content { padding: 30px; background: white; }
+		.footer { text-align: center; padding: 20px; color: #666; font-size: 12px; }
+		.button { display: inline-block; padding: 12px 30px; background: #D4AF37; color: white; text-decoration: none; border-radius: 5px; margin: 20px 0; }
+	</style>
+</head>
+<body>
+	<div class="container">
+		<div class="header">
+			<div class="logo">Angel Event</div>
+			<p style="color: #666; margin: 10px 0;">Créer l'instant parfait</p>
+		</div>
+		<div class="content">
+			<h2 style="color: #D4AF37;">Bonne nouvelle !</h2>
+			<p>Bonjour %s,</p>
+			<p>Une place s'est libérée pour votre <strong>%s</strong> le <strong>%s</strong>. Nous vous l'avons réservée.</p>
+			<p style="text-align: center;"><a class="button" href="%s">Confirmer ma réservation</a></p>
+			<p>Cette place vous est réservée jusqu'au <strong>%s</strong>. Passé ce délai, elle sera proposée à la personne suivante sur la liste d'attente.</p>
+			<p style="margin-top: 30px;">Cordialement,<br><strong>L'équipe Angel Event</strong></p>
+		</div>
+		<div class="footer">
+			<p>Angel Event - L'art de sublimer vos moments précieux</p>
+			<p>Pour toute question, contactez-nous à contact@angelevent.com</p>
+		</div>
+	</div>
+</body>
+</html>
+	`, html.EscapeString(name), html.EscapeString(eventType), eventDate, html.EscapeString(claimURL), expires)
+}
+
+func (s *EmailService) getWaitlistClaimTemplateEn(name, eventType, eventDate, claimURL, expires string) string {
+	return fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="UTF-8">
+	<style>
+		body { font-family: 'Inter', Arial, sans-serif; line-height: 1.6; color: #1A1A1A; }
+		.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+		.header { text-align: center; padding: 30px 0; background: linear-gradient(135deg, #FFFEF7 0%%, #F7E7CE 100%%); }
+		.logo { font-family: 'Great Vibes', cursive; font-size: 36px; color: #D4AF37; }
+		.content { padding: 30px; background: white; }
+		.footer { text-align: center; padding: 20px; color: #666; font-size: 12px; }
+		.button { display: inline-block; padding: 12px 30px; background: #D4AF37; color: white; text-decoration: none; border-radius: 5px; margin: 20px 0; }
+	</style>
+</head>
+<body>
+	<div class="container">
+		<div class="header">
+			<div class="logo">Angel Event</div>
+			<p style="color: #666; margin: 10px 0;">Creating the perfect moment</p>
+		</div>
+		<div class="content">
+			<h2 style="color: #D4AF37;">Good news!</h2>
+			<p>Hello %s,</p>
+			<p>A spot opened up for your <strong>%s</strong> on <strong>%s</strong>, and we have reserved it for you.</p>
+			<p style="text-align: center;"><a class="button" href="%s">Confirm my booking</a></p>
+			<p>This spot is yours until <strong>%s</strong>. After that, it will be offered to the next person on the waitlist.</p>
+			<p style="margin-top: 30px;">Best regards,<br><strong>The Angel Event Team</strong></p>
+		</div>
+		<div class="footer">
+			<p>Angel Event - The art of sublimating your precious moments</p>
+			<p>For any questions, contact us at contact@angelevent.com</p>
+		</div>
+	</div>
+</body>
+</html>
+	`, html.EscapeString(name), html.EscapeString(eventType), eventDate, html.EscapeString(claimURL), expires)
+}
+
+func (s *EmailService) getEventReminderTemplateFr(d AutomationDetails) string {
+	return fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="UTF-8">
+	<style>
+		body { font-family: 'Inter', Arial, sans-serif; line-height: 1.6; color: #1A1A1A; }
+		.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+		.header { text-align: center; padding: 30px 0; background: linear-gradient(135deg, #FFFEF7 0%%, #F7E7CE 100%%); }
+		.logo { font-family: 'Great Vibes', cursive; font-size: 36px; color: #D4AF37; }
+		.content { padding: 30px; background: white; }
+		.footer { text-align: center; padding: 20px; color: #666; font-size: 12px; }
+		.button { display: inline-block; padding: 12px 30px; background: #D4AF37; color: white; text-decoration: none; border-radius: 5px; margin: 20px 0; }
+	</style>
+</head>
+<body>
+	<div class="container">
+		<div class="header">
+			<div class="logo">Angel Event</div>
+			<p style="color: #666; margin: 10px 0;">Créer l'instant parfait</p>
+		</div>
+		<div class="content">
+			<h2 style="color: #D4AF37;">Votre événement approche !</h2>
+			<p>Bonjour %s,</p>
+			<p>Votre <strong>%s</strong> aura lieu le <strong>%s</strong>. Voici le rappel des détails :</p>
+			<ul>
+				<li>Lieu : %s</li>
+				<li>Nombre d'invités : %d</li>
+			</ul>
+			<p><strong>Articles loués :</strong></p>
+			%s
+			<p>Si un détail a changé, répondez simplement à ce courriel.</p>
+			<p style="margin-top: 30px;">Cordialement,<br><strong>L'équipe Angel Event</strong></p>
+		</div>
+		<div class="footer">
+			<p>Angel Event - L'art de sublimer vos moments précieux</p>
+			<p>Pour toute question, contactez-nous à contact@angelevent.com</p>
+		</div>
+	</div>
+</body>
+</html>
+	`, html.EscapeString(d.ClientName), html.EscapeString(d.EventType), d.EventDate, html.EscapeString(d.Location), d.GuestCount, rentalListHTML(d.RentalItems, "Aucun article"))
+}
+
+func (s *EmailService) getEventReminderTemplateEn(d AutomationDetails) string {
+	return fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="UTF-8">
+	<style>
+		body { font-family: 'Inter', Arial, sans-serif; line-height: 1.6; color: #1A1A1A; }
+		.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+		.header { text-align: center; padding: 30px 0; background: linear-gradient(135deg, #FFFEF7 0%%, #F7E7CE 100%%); }
+		.logo { font-family: 'Great Vibes', cursive; font-size: 36px; color: #D4AF37; }
+		.content { padding: 30px; background: white; }
+		.footer { text-align: center; padding: 20px; color: #666; font-size: 12px; }
+		.button { display: inline-block; padding: 12px 30px; background: #D4AF37; color: white; text-decoration: none; border-radius: 5px; margin: 20px 0; }
+	</style>
+</head>
+<body>
+	<div class="container">
+		<div class="header">
+			<div class="logo">Angel Event</div>
+			<p style="color: #666; margin: 10px 0;">Creating the perfect moment</p>
+		</div>
+		<div class="content">
+			<h2 style="color: #D4AF37;">Your event is coming up!</h2>
+			<p>Hello %s,</p>
+			<p>Your <strong>%s</strong> takes place on <strong>%s</strong>. Here is a reminder of the details:</p>
+			<ul>
+				<li>Location: %s</li>
+				<li>Guests: %d</li>
+			</ul>
+			<p><strong>Rental items:</strong></p>
+			%s
+			<p>If any detail has changed, simply reply to this email.</p>
+			<p style="margin-top: 30px;">Best regards,<br><strong>The Angel Event Team</strong></p>
+		</div>
+		<div class="footer">
+			<p>Angel Event - The art of sublimating your precious moments</p>
+			<p>For any questions, contact us at contact@angelevent.com</p>
+		</div>
+	</div>
+</body>
+</html>
+	`, html.EscapeString(d.ClientName), html.EscapeString(d.EventType), d.EventDate, html.EscapeString(d.Location), d.GuestCount, rentalListHTML(d.RentalItems, "No items"))
+}
+
+func (s *EmailService) getBalanceDueTemplateFr(d AutomationDetails) string {
+	return fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="UTF-8">
+	<style>
+		body { font-family: 'Inter', Arial, sans-serif; line-height: 1.6; color: #1A1A1A; }
+		.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+		.header { text-align: center; padding: 30px 0; background: linear-gradient(135deg, #FFFEF7 0%%, #F7E7CE 100%%); }
+		.logo { font-family: 'Great Vibes', cursive; font-size: 36px; color: #D4AF37; }
+		.content { padding: 30px; background: white; }
+		.footer { text-align: center; padding: 20px; color: #666; font-size: 12px; }
+		.button { display: inline-block; padding: 12px 30px; background: #D4AF37; color: white; text-decoration: none; border-radius: 5px; margin: 20px 0; }
+	</style>
+</head>
+<body>
+	<div class="container">
+		<div class="header">
+			<div class="logo">Angel Event</div>
+			<p style="color: #666; margin: 10px 0;">Créer l'instant parfait</p>
+		</div>
+		<div class="content">
+			<h2 style="color: #D4AF37;">Rappel de solde</h2>
+			<p>Bonjour %s,</p>
+			<p>Votre <strong>%s</strong> du <strong>%s</strong> approche. Voici l'état de votre compte :</p>
+			<ul>
+				<li>Montant total : %.2f $</li>
+				<li>Déjà payé : %.2f $</li>
+				<li><strong>Solde à payer : %.2f $</strong></li>
+			</ul>
+			<p>Merci de régler le solde avant l'événement. Si vous l'avez déjà fait, vous pouvez ignorer ce message.</p>
+			<p style="margin-top: 30px;">Cordialement,<br><strong>L'équipe Angel Event</strong></p>
+		</div>
+		<div class="footer">
+			<p>Angel Event - L'art de sublimer vos moments précieux</p>
+			<p>Pour toute question, contactez-nous à contact@angelevent.com</p>
+		</div>
+	</div>
+</body>
+</html>
+	`, html.EscapeString(d.ClientName), html.EscapeString(d.EventType), d.EventDate, d.TotalAmount, d.TotalPaid, d.BalanceDue)
+}
+
+func (s *EmailService) getBalanceDueTemplateEn(d AutomationDetails) string {
+	return fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="UTF-8">
+	<style>
+		body { font-family: 'Inter', Arial, sans-serif; line-height: 1.6; color: #1A1A1A; }
+		.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+		.header { text-align: center; padding: 30px 0; background: linear-gradient(135deg, #FFFEF7 0%%, #F7E7CE 100%%); }
+		.logo { font-family: 'Great Vibes', cursive; font-size: 36px; color: #D4AF37; }
+		.content { padding: 30px; background: white; }
+		.footer { text-align: center; padding: 20px; color: #666; font-size: 12px; }
+		.button { display: inline-block; padding: 12px 30px; background: #D4AF37; color: white; text-decoration: none; border-radius: 5px; margin: 20px 0; }
+	</style>
+</head>
+<body>
+	<div class="container">
+		<div class="header">
+			<div class="logo">Angel Event</div>
+			<p style="color: #666; margin: 10px 0;">Creating the perfect moment</p>
+		</div>
+		<div class="content">
+			<h2 style="color: #D4AF37;">Balance reminder</h2>
+			<p>Hello %s,</p>
+			<p>Your <strong>%s</strong> on <strong>%s</strong> is approaching. Here is the state of your account:</p>
+			<ul>
+				<li>Total amount: $%.2f</li>
+				<li>Already paid: $%.2f</li>
+				<li><strong>Balance due: $%.2f</strong></li>
+			</ul>
+			<p>Please settle the balance before the event. If you already have, you can ignore this message.</p>
+			<p style="margin-top: 30px;">Best regards,<br><strong>The Angel Event Team</strong></p>
+		</div>
+		<div class="footer">
+			<p>Angel Event - The art of sublimating your precious moments</p>
+			<p>For any questions, contact us at contact@angelevent.com</p>
+		</div>
+	</div>
+</body>
+</html>
+	`, html.EscapeString(d.ClientName), html.EscapeString(d.EventType), d.EventDate, d.TotalAmount, d.TotalPaid, d.BalanceDue)
+}
+
+func (s *EmailService) getThankYouTemplateFr(d AutomationDetails) string {
+	return fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="UTF-8">
+	<style>
+		body { font-family: 'Inter', Arial, sans-serif; line-height: 1.6; color: #1A1A1A; }
+		.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+		.header { text-align: center; padding: 30px 0; background: linear-gradient(135deg, #FFFEF7 0%%, #F7E7CE 100%%); }
+		.logo { font-family: 'Great Vibes', cursive; font-size: 36px; color: #D4AF37; }
+		.content { padding: 30px; background: white; }
+		.footer { text-align: center; padding: 20px; color: #666; font-size: 12px; }
+		.button { display: inline-block; padding: 12px 30px; background: #D4AF37; color: white; text-decoration: none; border-radius: 5px; margin: 20px 0; }
+	</style>
+</head>
+<body>
+	<div class="container">
+		<div class="header">
+			<div class="logo">Angel Event</div>
+			<p style="color: #666; margin: 10px 0;">Créer l'instant parfait</p>
+		</div>
+		<div class="content">
+			<h2 style="color: #D4AF37;">Merci !</h2>
+			<p>Bonjour %s,</p>
+			<p>Merci de nous avoir fait confiance pour votre <strong>%s</strong> du <strong>%s</strong>. Ce fut un plaisir de créer ce moment avec vous.</p>
+			<p>Votre avis compte beaucoup pour nous et aide d'autres clients à nous découvrir. Auriez-vous un instant pour partager votre expérience ?</p>
+			<p style="text-align: center;"><a class="button" href="%s">Laisser un témoignage</a></p>
+			<p style="margin-top: 30px;">Cordialement,<br><strong>L'équipe Angel Event</strong></p>
+		</div>
+		<div class="footer">
+			<p>Angel Event - L'art de sublimer vos moments précieux</p>
+			<p>Pour toute question, contactez-nous à contact@angelevent.com</p>
+		</div>
+	</div>
+</body>
+</html>
+	`, html.EscapeString(d.ClientName), html.EscapeString(d.EventType), d.EventDate, html.EscapeString(d.ReviewURL))
+}
+
+func (s *EmailService) getThankYouTemplateEn(d AutomationDetails) string {
+	return fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="UTF-8">
+	<style>
+		body { font-family: 'Inter', Arial, sans-serif; line-height: 1.6; color: #1A1A1A; }
+		.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+		.header { text-align: center; padding: 30px 0; background: linear-gradient(135deg, #FFFEF7 0%%, #F7E7CE 100%%); }
+		.logo { font-family: 'Great Vibes', cursive; font-size: 36px; color: #D4AF37; }
+		.content { padding: 30px; background: white; }
+		.footer { text-align: center; padding: 20px; color: #666; font-size: 12px; }
+		.button { display: inline-block; padding: 12px 30px; background: #D4AF37; color: white; text-decoration: none; border-radius: 5px; margin: 20px 0; }
+	</style>
+</head>
+<body>
+	<div class="container">
+		<div class="header">
+			<div class="logo">Angel Event</div>
+			<p style="color: #666; margin: 10px 0;">Creating the perfect moment</p>
+		</div>
+		<div class="content">
+			<h2 style="color: #D4AF37;">Thank you!</h2>
+			<p>Hello %s,</p>
+			<p>Thank you for trusting us with your <strong>%s</strong> on <strong>%s</strong>. It was a pleasure creating this moment with you.</p>
+			<p>Your opinion means a lot to us and helps other clients discover us. Would you have a moment to share your experience?</p>
+			<p style="text-align: center;"><a class="button" href="%s">Leave a testimonial</a></p>
+			<p style="margin-top: 30px;">Best regards,<br><strong>The Angel Event Team</strong></p>
+		</div>
+		<div class="footer">
+			<p>Angel Event - The art of sublimating your precious moments</p>
+			<p>For any questions, contact us at contact@angelevent.com</p>
+		</div>
+	</div>
+</body>
+</html>
+	`, html.EscapeString(d.ClientName), html.EscapeString(d.EventType), d.EventDate, html.EscapeString(d.ReviewURL))
+}
+
+// rentalListHTML lists rental item titles, or says there are none
+func rentalListHTML(items []string, none string) string {
+	if len(items) == 0 {
+		return "<p>" + html.EscapeString(none) + "</p>"
+	}
+	var list strings.Builder
+	list.WriteString("<ul>")
+	for _, item := range items {
+		fmt.Fprintf(&list, "<li>%s</li>", html.EscapeString(item))
+	}
+	list.WriteString("</ul>")
+	return list.String()
+}
+
 func (s *EmailService) getContactFormTemplate(name, email, phone, message string) string {
 	return fmt.Sprintf(`
 <!DOCTYPE html>
@@ -315,3 +779,44 @@ func (s *EmailService) getAdminBookingTemplate(clientName, clientEmail, clientPh
 </html>
 	`, eventType, eventDate, location, guestCount, budget, clientName, clientEmail, clientEmail, clientPhone, message)
 }
+
+func (s *EmailService) getProofingSelectionTemplate(albumTitle, clientName, note string, choices []ProofingChoice) string {
+	var rows strings.Builder
+	for i, choice := range choices {
+		comment := ""
+		if choice.Comment != "" {
+			comment = fmt.Sprintf(`<div class="comment">« %s »</div>`, html.EscapeString(choice.Comment))
+		}
+		fmt.Fprintf(&rows, `<div class="field"><div class="value">%d. %s</div>%s</div>`, i+1, html.EscapeString(choice.Title), comment)
+	}
+
+	return fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="UTF-8">
+	<style>
+		body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+		.container { max-width: 600px; margin: 0 auto; padding: 20px; background: #f9f9f9; }
+		.content { background: white; padding: 30px; border-radius: 8px; }
+		.field { margin-bottom: 10px; padding-bottom: 10px; border-bottom: 1px solid #eee; }
+		.label { font-weight: bold; color: #D4AF37; }
+		.comment { color: #666; font-style: italic; }
+	</style>
+</head>
+<body>
+	<div class="container">
+		<div class="content">
+			<h2 style="color: #D4AF37;">Nouvelle sélection de photos</h2>
+			<p><span class="label">Album:</span> %s</p>
+			<p><span class="label">Client:</span> %s</p>
+			<p><span class="label">Photos choisies:</span> %d</p>
+			<p><span class="label">Note:</span> %s</p>
+			%s
+			<p style="color: #666;">🔔 Connectez-vous à l'administration pour consulter la sélection</p>
+		</div>
+	</div>
+</body>
+</html>
+	`, html.EscapeString(albumTitle), html.EscapeString(clientName), len(choices), html.EscapeString(note), rows.String())
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+)
+
+// GalleryCategoryResolver maps storage folder names to gallery categories
+// using the CategoryDirectory table
+type GalleryCategoryResolver struct {
+	cache map[string]uint
+}
+
+// NewGalleryCategoryResolver creates a resolver loaded with the configured mappings
+func NewGalleryCategoryResolver() (*GalleryCategoryResolver, error) {
+	var dirs []models.CategoryDirectory
+	if err := database.DB.Find(&dirs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load category directories: %w", err)
+	}
+
+	cache := make(map[string]uint)
+	for _, d := range dirs {
+		cache[strings.ToLower(d.Directory)] = d.CategoryID
+	}
+
+	return &GalleryCategoryResolver{cache: cache}, nil
+}
+
+// Resolve returns the category ID for a storage folder name.
+// Unmapped folders get a gallery category (matched or created by slug,
+// never a rental one) and a mapping, so a new folder never requires a
+// code change.
+func (r *GalleryCategoryResolver) Resolve(dir string) (uint, error) {
+	key := strings.ToLower(strings.TrimSpace(dir))
+	if id, ok := r.cache[key]; ok {
+		return id, nil
+	}
+
+	category, err := database.GalleryCategoryForSlug(GallerySlug(key), dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve category for %q: %w", dir, err)
+	}
+
+	mapping := models.CategoryDirectory{Directory: key, CategoryID: category.ID}
+	if err := database.DB.Create(&mapping).Error; err != nil {
+		return 0, fmt.Errorf("failed to map directory %q: %w", dir, err)
+	}
+	log.Printf("Mapped storage directory %q to category %q", dir, category.Slug)
+
+	r.cache[key] = category.ID
+	return category.ID, nil
+}
+
+// GallerySlug normalizes a folder or category name into a slug
+func GallerySlug(name string) string {
+	slug := strings.ToLower(strings.TrimSpace(name))
+	slug = strings.ReplaceAll(slug, " ", "_")
+	slug = strings.ReplaceAll(slug, "-", "_")
+	return slug
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+)
+
+func TestGalleryCategoryResolver(t *testing.T) {
+	useTestDB(t)
+
+	rental := models.Category{Name: "Props", Slug: "props", Type: "rental"}
+	deleted := models.Category{Name: "Old", Slug: "old", Type: "gallery"}
+	for _, category := range []*models.Category{&rental, &deleted} {
+		if err := database.DB.Create(category).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	database.DB.Delete(&deleted)
+
+	resolver, err := NewGalleryCategoryResolver()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dir, slug string
+	}{
+		{"Baby Shower", "baby_shower"},
+		{"props", "props-gallery"}, // held by a rental category
+		{"Old", "old-gallery"},     // held by a deleted category
+	}
+	for _, tt := range tests {
+		id, err := resolver.Resolve(tt.dir)
+		if err != nil {
+			t.Fatalf("Resolve(%q): %v", tt.dir, err)
+		}
+		var category models.Category
+		database.DB.First(&category, id)
+		if category.Slug != tt.slug || category.Type != "gallery" {
+			t.Errorf("Resolve(%q) = %s category %q, want gallery %q", tt.dir, category.Type, category.Slug, tt.slug)
+		}
+		if again, _ := resolver.Resolve(tt.dir); again != id {
+			t.Errorf("Resolve(%q) again = %d, want %d", tt.dir, again, id)
+		}
+	}
+}
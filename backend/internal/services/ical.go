@@ -0,0 +1,179 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// icalProductID identifies the generator in PRODID
+const icalProductID = "-//Angel Event//Calendar Feed//FR"
+
+// ICalEvent is one VEVENT of a generated calendar
+type ICalEvent struct {
+	// UID must stay the same across regenerations so clients update the
+	// event instead of adding a duplicate
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	// Start and End are calendar dates for all-day events (End exclusive),
+	// or instants for timed events, written in BusinessTimezone
+	Start  time.Time
+	End    time.Time
+	AllDay bool
+	// Status is CONFIRMED, TENTATIVE or CANCELLED
+	Status       string
+	Categories   []string
+	Transparent  bool // does not block time in free/busy
+	Created      time.Time
+	LastModified time.Time
+	Sequence     int
+}
+
+// WriteICalendar writes an RFC 5545 VCALENDAR with the given events
+func WriteICalendar(w io.Writer, name string, events []ICalEvent) error {
+	iw := &icalWriter{w: bufio.NewWriter(w)}
+	now := time.Now()
+
+	iw.line("BEGIN:VCALENDAR")
+	iw.line("VERSION:2.0")
+	iw.line("PRODID:" + icalProductID)
+	iw.line("CALSCALE:GREGORIAN")
+	iw.line("METHOD:PUBLISH")
+	iw.line("X-WR-CALNAME:" + icalText(name))
+	iw.line("X-WR-TIMEZONE:" + BusinessTimezone)
+	iw.line("REFRESH-INTERVAL;VALUE=DURATION:PT1H")
+	iw.line("X-PUBLISHED-TTL:PT1H")
+
+	for _, event := range events {
+		if !event.AllDay {
+			writeTorontoTimezone(iw)
+			break
+		}
+	}
+
+	for _, event := range events {
+		iw.line("BEGIN:VEVENT")
+		iw.line("UID:" + icalText(event.UID))
+		iw.line("DTSTAMP:" + icalUTC(now))
+		if event.AllDay {
+			iw.line("DTSTART;VALUE=DATE:" + event.Start.Format("20060102"))
+			iw.line("DTEND;VALUE=DATE:" + event.End.Format("20060102"))
+		} else {
+			loc := BusinessLocation()
+			iw.line("DTSTART;TZID=" + BusinessTimezone + ":" + event.Start.In(loc).Format("20060102T150405"))
+			iw.line("DTEND;TZID=" + BusinessTimezone + ":" + event.End.In(loc).Format("20060102T150405"))
+		}
+		iw.line("SUMMARY:" + icalText(event.Summary))
+		if event.Description != "" {
+			iw.line("DESCRIPTION:" + icalText(event.Description))
+		}
+		if event.Location != "" {
+			iw.line("LOCATION:" + icalText(event.Location))
+		}
+		if event.Status != "" {
+			iw.line("STATUS:" + event.Status)
+		}
+		if len(event.Categories) > 0 {
+			escaped := make([]string, len(event.Categories))
+			for i, c := range event.Categories {
+				escaped[i] = icalText(c)
+			}
+			iw.line("CATEGORIES:" + strings.Join(escaped, ","))
+		}
+		if event.Transparent {
+			iw.line("TRANSP:TRANSPARENT")
+		} else {
+			iw.line("TRANSP:OPAQUE")
+		}
+		if !event.Created.IsZero() {
+			iw.line("CREATED:" + icalUTC(event.Created))
+		}
+		if !event.LastModified.IsZero() {
+			iw.line("LAST-MODIFIED:" + icalUTC(event.LastModified))
+		}
+		iw.line(fmt.Sprintf("SEQUENCE:%d", event.Sequence))
+		iw.line("END:VEVENT")
+	}
+
+	iw.line("END:VCALENDAR")
+	return iw.flush()
+}
+
+// writeTorontoTimezone describes BusinessTimezone with the North American
+// rules in force since 2007, needed by clients to resolve TZID references
+func writeTorontoTimezone(iw *icalWriter) {
+	iw.line("BEGIN:VTIMEZONE")
+	iw.line("TZID:" + BusinessTimezone)
+	iw.line("X-LIC-LOCATION:" + BusinessTimezone)
+	iw.line("BEGIN:DAYLIGHT")
+	iw.line("TZOFFSETFROM:-0500")
+	iw.line("TZOFFSETTO:-0400")
+	iw.line("TZNAME:EDT")
+	iw.line("DTSTART:20070311T020000")
+	iw.line("RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=2SU")
+	iw.line("END:DAYLIGHT")
+	iw.line("BEGIN:STANDARD")
+	iw.line("TZOFFSETFROM:-0400")
+	iw.line("TZOFFSETTO:-0500")
+	iw.line("TZNAME:EST")
+	iw.line("DTSTART:20071104T020000")
+	iw.line("RRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=1SU")
+	iw.line("END:STANDARD")
+	iw.line("END:VTIMEZONE")
+}
+
+// icalWriter writes content lines with CRLF endings, folded at 75 octets
+type icalWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (iw *icalWriter) line(s string) {
+	if iw.err != nil {
+		return
+	}
+
+	limit := 75
+	for len(s) > limit {
+		// Never split a multi-byte UTF-8 sequence
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		if _, iw.err = iw.w.WriteString(s[:cut] + "\r\n "); iw.err != nil {
+			return
+		}
+		s = s[cut:]
+		limit = 74 // continuation lines start with a space
+	}
+	_, iw.err = iw.w.WriteString(s + "\r\n")
+}
+
+func (iw *icalWriter) flush() error {
+	if iw.err != nil {
+		return iw.err
+	}
+	return iw.w.Flush()
+}
+
+// icalText escapes a TEXT value (RFC 5545 section 3.3.11)
+func icalText(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// icalUTC formats an instant as a UTC DATE-TIME
+func icalUTC(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
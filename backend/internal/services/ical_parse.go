@@ -0,0 +1,766 @@
+package services
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mazong/angel_event/internal/models"
+)
+
+// maxRecurrencePeriods bounds RRULE expansion of a single event within the
+// import window; periods before the window are skipped or not counted
+const maxRecurrencePeriods = 5000
+
+// icalComponent is a parsed BEGIN/END block
+type icalComponent struct {
+	Name     string
+	Props    []icalProp
+	Children []*icalComponent
+}
+
+// icalProp is one content line: NAME;PARAM=VALUE:value
+type icalProp struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// prop returns the first property with the given name
+func (c *icalComponent) prop(name string) (icalProp, bool) {
+	for _, p := range c.Props {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return icalProp{}, false
+}
+
+// parseICalendar reads an iCalendar stream into its component tree
+func parseICalendar(r io.Reader) (*icalComponent, error) {
+	lines, err := unfoldICalLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &icalComponent{}
+	stack := []*icalComponent{root}
+	for _, line := range lines {
+		prop, ok := parseICalLine(line)
+		if !ok {
+			continue
+		}
+
+		current := stack[len(stack)-1]
+		switch prop.Name {
+		case "BEGIN":
+			child := &icalComponent{Name: strings.ToUpper(prop.Value)}
+			current.Children = append(current.Children, child)
+			stack = append(stack, child)
+		case "END":
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		default:
+			current.Props = append(current.Props, prop)
+		}
+	}
+
+	for _, c := range root.Children {
+		if c.Name == "VCALENDAR" {
+			return c, nil
+		}
+	}
+	return nil, errors.New("no VCALENDAR found")
+}
+
+// unfoldICalLines joins folded continuation lines (RFC 5545 section 3.1)
+func unfoldICalLines(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// parseICalLine splits a content line, honoring quoted parameter values
+func parseICalLine(line string) (icalProp, bool) {
+	inQuotes := false
+	colon := -1
+	for i, r := range line {
+		if r == '"' {
+			inQuotes = !inQuotes
+		} else if r == ':' && !inQuotes {
+			colon = i
+			break
+		}
+	}
+	if colon <= 0 {
+		return icalProp{}, false
+	}
+
+	head := line[:colon]
+	prop := icalProp{Params: map[string]string{}, Value: line[colon+1:]}
+
+	parts := splitOutsideQuotes(head, ';')
+	prop.Name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		if k, v, ok := strings.Cut(param, "="); ok {
+			prop.Params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return prop, true
+}
+
+func splitOutsideQuotes(s string, sep rune) []string {
+	var parts []string
+	inQuotes := false
+	start := 0
+	for i, r := range s {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+		case r == sep && !inQuotes:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unescapeICalText reverses TEXT escaping
+func unescapeICalText(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
+
+// parseICalTime parses a DATE or DATE-TIME property. DATE values are
+// returned at midnight UTC; floating times use the business timezone.
+func parseICalTime(value string, params map[string]string) (time.Time, bool, error) {
+	value = strings.TrimSpace(value)
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.Parse("20060102", value)
+		return t, true, err
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+
+	loc := BusinessLocation()
+	if tzid := params["TZID"]; tzid != "" {
+		// Unknown identifiers (e.g. Windows names from Outlook) fall back
+		// to the business timezone
+		if l, err := time.LoadLocation(strings.TrimPrefix(tzid, "/")); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+// parseICalDuration parses a DURATION value such as P1D, PT2H30M or -P1W
+func parseICalDuration(value string) (time.Duration, error) {
+	s := strings.TrimSpace(value)
+	sign := time.Duration(1)
+	if strings.HasPrefix(s, "-") {
+		sign = -1
+		s = s[1:]
+	}
+	s = strings.TrimPrefix(s, "+")
+	if !strings.HasPrefix(s, "P") {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	s = s[1:]
+
+	var total time.Duration
+	inTime := false
+	num := ""
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			num += string(r)
+		case r == 'T':
+			inTime = true
+		default:
+			n, err := strconv.Atoi(num)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", value)
+			}
+			num = ""
+			switch {
+			case r == 'W':
+				total += time.Duration(n) * 7 * 24 * time.Hour
+			case r == 'D':
+				total += time.Duration(n) * 24 * time.Hour
+			case r == 'H' && inTime:
+				total += time.Duration(n) * time.Hour
+			case r == 'M' && inTime:
+				total += time.Duration(n) * time.Minute
+			case r == 'S' && inTime:
+				total += time.Duration(n) * time.Second
+			default:
+				return 0, fmt.Errorf("invalid duration %q", value)
+			}
+		}
+	}
+	return sign * total, nil
+}
+
+// BusyDate is a calendar date blocked by an imported event
+type BusyDate struct {
+	Date    models.Date
+	Summary string
+}
+
+// icalInstance is one occurrence of an event
+type icalInstance struct {
+	start, end time.Time
+	allDay     bool
+	summary    string
+}
+
+// ParseBusyDates expands the busy events of an iCalendar stream, including
+// RRULE/RDATE/EXDATE recurrences and RECURRENCE-ID overrides, into the
+// business-timezone dates they cover between from and to (inclusive)
+func ParseBusyDates(r io.Reader, from, to models.Date) ([]BusyDate, error) {
+	cal, err := parseICalendar(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Overridden occurrences replace the matching instance of their series
+	overridden := make(map[string]map[string]bool)
+	var events []*icalComponent
+	for _, c := range cal.Children {
+		if c.Name != "VEVENT" {
+			continue
+		}
+		events = append(events, c)
+		if rid, ok := c.prop("RECURRENCE-ID"); ok {
+			uid, _ := c.prop("UID")
+			if t, allDay, err := parseICalTime(rid.Value, rid.Params); err == nil {
+				if overridden[uid.Value] == nil {
+					overridden[uid.Value] = make(map[string]bool)
+				}
+				overridden[uid.Value][instanceKey(t, allDay)] = true
+			}
+		}
+	}
+
+	// Expand a little past the window so multi-day events starting before
+	// it are still seen, and timed events late on the last day are too
+	expandFrom := from.AddDays(-31).Time()
+	expandTo := to.AddDays(2).Time()
+
+	dates := make(map[string]BusyDate)
+	for _, event := range events {
+		if !isBusyEvent(event) {
+			continue
+		}
+
+		var skip map[string]bool
+		if _, isOverride := event.prop("RECURRENCE-ID"); !isOverride {
+			uid, _ := event.prop("UID")
+			skip = overridden[uid.Value]
+		}
+
+		instances, err := expandEvent(event, expandFrom, expandTo, skip)
+		if err != nil {
+			// One malformed event should not drop the whole calendar
+			continue
+		}
+		for _, inst := range instances {
+			for _, day := range instanceDates(inst) {
+				if day.Before(from) || day.After(to) {
+					continue
+				}
+				key := day.String()
+				if _, seen := dates[key]; !seen {
+					dates[key] = BusyDate{Date: day, Summary: inst.summary}
+				}
+			}
+		}
+	}
+
+	result := make([]BusyDate, 0, len(dates))
+	for _, d := range dates {
+		result = append(result, d)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Date.Before(result[j].Date) })
+	return result, nil
+}
+
+// isBusyEvent skips cancelled and free (transparent) events
+func isBusyEvent(event *icalComponent) bool {
+	if status, ok := event.prop("STATUS"); ok && strings.EqualFold(status.Value, "CANCELLED") {
+		return false
+	}
+	if transp, ok := event.prop("TRANSP"); ok && strings.EqualFold(transp.Value, "TRANSPARENT") {
+		return false
+	}
+	return true
+}
+
+// expandEvent returns the occurrences of an event starting before to
+func expandEvent(event *icalComponent, from, to time.Time, skip map[string]bool) ([]icalInstance, error) {
+	dtstart, ok := event.prop("DTSTART")
+	if !ok {
+		return nil, errors.New("event without DTSTART")
+	}
+	start, allDay, err := parseICalTime(dtstart.Value, dtstart.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	// DTEND, else DURATION, else one day (dates) or an instant (times)
+	duration := time.Duration(0)
+	if allDay {
+		duration = 24 * time.Hour
+	}
+	if dtend, ok := event.prop("DTEND"); ok {
+		end, _, err := parseICalTime(dtend.Value, dtend.Params)
+		if err != nil {
+			return nil, err
+		}
+		duration = end.Sub(start)
+	} else if dur, ok := event.prop("DURATION"); ok {
+		if duration, err = parseICalDuration(dur.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	summary := ""
+	if s, ok := event.prop("SUMMARY"); ok {
+		summary = unescapeICalText(s.Value)
+	}
+
+	starts := []time.Time{start}
+	if rrule, ok := event.prop("RRULE"); ok {
+		rule, err := parseRRule(rrule.Value, allDay, start.Location())
+		if err != nil {
+			return nil, err
+		}
+		starts = rule.expand(start, from, to)
+	}
+
+	// RDATE adds occurrences, EXDATE removes them
+	excluded := make(map[string]bool)
+	for _, p := range event.Props {
+		if p.Name != "RDATE" && p.Name != "EXDATE" {
+			continue
+		}
+		for _, v := range strings.Split(p.Value, ",") {
+			if p.Params["VALUE"] == "PERIOD" || strings.Contains(v, "/") {
+				v, _, _ = strings.Cut(v, "/")
+			}
+			t, isDate, err := parseICalTime(v, p.Params)
+			if err != nil {
+				continue
+			}
+			if p.Name == "RDATE" {
+				starts = append(starts, t)
+			} else {
+				excluded[instanceKey(t, isDate || allDay)] = true
+			}
+		}
+	}
+
+	var instances []icalInstance
+	for _, s := range starts {
+		key := instanceKey(s, allDay)
+		if excluded[key] || skip[key] {
+			continue
+		}
+		end := s.Add(duration)
+		if allDay {
+			// Whole days, robust to DST in the source calendar
+			end = s.AddDate(0, 0, int((duration+12*time.Hour)/(24*time.Hour)))
+		}
+		if end.Before(from) || s.After(to) {
+			continue
+		}
+		instances = append(instances, icalInstance{start: s, end: end, allDay: allDay, summary: summary})
+	}
+	return instances, nil
+}
+
+// instanceKey identifies an occurrence for EXDATE and RECURRENCE-ID matching
+func instanceKey(t time.Time, allDay bool) string {
+	if allDay {
+		return t.Format("20060102")
+	}
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// instanceDates returns the business-timezone dates an occurrence touches
+func instanceDates(inst icalInstance) []models.Date {
+	var first, last models.Date
+	if inst.allDay {
+		first = models.DateOf(inst.start)
+		last = models.DateOf(inst.end).AddDays(-1)
+	} else {
+		loc := BusinessLocation()
+		s := inst.start.In(loc)
+		e := inst.end.In(loc)
+		if e.After(s) {
+			// The end instant is exclusive
+			e = e.Add(-time.Nanosecond)
+		} else {
+			e = s
+		}
+		first = models.DateOf(s)
+		last = models.DateOf(e)
+	}
+	if last.Before(first) {
+		last = first
+	}
+
+	var days []models.Date
+	for d := first; !d.After(last); d = d.AddDays(1) {
+		days = append(days, d)
+	}
+	return days
+}
+
+// rrule is a parsed recurrence rule (RFC 5545 section 3.3.10). BYSETPOS,
+// BYWEEKNO, BYYEARDAY and sub-daily frequencies are not supported.
+type rrule struct {
+	freq       string
+	interval   int
+	count      int
+	until      time.Time
+	byMonth    []int
+	byMonthDay []int
+	byDay      []rruleWeekday
+}
+
+type rruleWeekday struct {
+	ordinal int // 0 for every matching weekday, -1 for the last, ...
+	day     time.Weekday
+}
+
+var rruleWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// parseRRule parses an RRULE value; loc is the timezone of DTSTART, in
+// which a date UNTIL of a timed event is read
+func parseRRule(value string, allDay bool, loc *time.Location) (*rrule, error) {
+	rule := &rrule{interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		k, v, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToUpper(k) {
+		case "FREQ":
+			rule.freq = strings.ToUpper(v)
+		case "INTERVAL":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid INTERVAL %q", v)
+			}
+			rule.interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid COUNT %q", v)
+			}
+			rule.count = n
+		case "UNTIL":
+			t, _, err := parseICalTime(v, nil)
+			if err != nil {
+				return nil, fmt.Errorf("invalid UNTIL %q", v)
+			}
+			if len(v) == 8 && !allDay {
+				// A date UNTIL includes that whole day where the event is
+				t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc).Add(-time.Second)
+			}
+			rule.until = t
+		case "BYMONTH":
+			for _, s := range strings.Split(v, ",") {
+				n, err := strconv.Atoi(s)
+				if err != nil || n < 1 || n > 12 {
+					return nil, fmt.Errorf("invalid BYMONTH %q", v)
+				}
+				rule.byMonth = append(rule.byMonth, n)
+			}
+		case "BYMONTHDAY":
+			for _, s := range strings.Split(v, ",") {
+				n, err := strconv.Atoi(s)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, fmt.Errorf("invalid BYMONTHDAY %q", v)
+				}
+				rule.byMonthDay = append(rule.byMonthDay, n)
+			}
+		case "BYDAY":
+			for _, s := range strings.Split(v, ",") {
+				s = strings.ToUpper(strings.TrimSpace(s))
+				if len(s) < 2 {
+					return nil, fmt.Errorf("invalid BYDAY %q", v)
+				}
+				day, ok := rruleWeekdays[s[len(s)-2:]]
+				if !ok {
+					return nil, fmt.Errorf("invalid BYDAY %q", v)
+				}
+				ordinal := 0
+				if len(s) > 2 {
+					n, err := strconv.Atoi(s[:len(s)-2])
+					if err != nil || n == 0 {
+						return nil, fmt.Errorf("invalid BYDAY %q", v)
+					}
+					ordinal = n
+				}
+				rule.byDay = append(rule.byDay, rruleWeekday{ordinal: ordinal, day: day})
+			}
+		}
+	}
+
+	switch rule.freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+		return rule, nil
+	default:
+		return nil, fmt.Errorf("unsupported FREQ %q", rule.freq)
+	}
+}
+
+// expand returns the occurrence starts from dtstart up to limit, honoring
+// COUNT and UNTIL. Occurrences keep the wall-clock time of dtstart. Without
+// COUNT, the periods ending before from are skipped; with COUNT they must
+// be walked to know how many occurrences are left, but only the periods
+// from on count toward maxRecurrencePeriods.
+func (r *rrule) expand(dtstart, from, limit time.Time) []time.Time {
+	var starts []time.Time
+	emitted := 0
+
+	first := 0
+	if r.count == 0 {
+		first = r.periodsBefore(dtstart, from)
+	}
+
+	inWindow := 0
+	for period := first; inWindow < maxRecurrencePeriods; period++ {
+		start := r.periodStart(dtstart, period*r.interval)
+		if !start.Before(from) {
+			inWindow++
+		}
+		candidates := r.periodCandidates(dtstart, period*r.interval)
+		if len(candidates) == 0 && start.After(limit) {
+			break
+		}
+
+		for _, t := range candidates {
+			if t.Before(dtstart) {
+				continue
+			}
+			if !r.until.IsZero() && t.After(r.until) {
+				return starts
+			}
+			if t.After(limit) {
+				return starts
+			}
+			emitted++
+			if !t.Before(from) {
+				starts = append(starts, t)
+			}
+			if r.count > 0 && emitted >= r.count {
+				return starts
+			}
+		}
+	}
+	return starts
+}
+
+// periodsBefore returns the index of a period starting before from and
+// ending no earlier than it, so expansion can start there. It errs early:
+// the period before that one is returned too.
+func (r *rrule) periodsBefore(dtstart, from time.Time) int {
+	if !dtstart.Before(from) {
+		return 0
+	}
+
+	var units int
+	switch r.freq {
+	case "DAILY":
+		units = int(from.Sub(dtstart).Hours() / 24)
+	case "WEEKLY":
+		units = int(from.Sub(dtstart).Hours() / (24 * 7))
+	case "MONTHLY":
+		units = (from.Year()-dtstart.Year())*12 + int(from.Month()-dtstart.Month())
+	default:
+		units = from.Year() - dtstart.Year()
+	}
+
+	n := units/r.interval - 1
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// periodStart is the first day of the n-th period after dtstart
+func (r *rrule) periodStart(dtstart time.Time, n int) time.Time {
+	switch r.freq {
+	case "DAILY":
+		return dtstart.AddDate(0, 0, n)
+	case "WEEKLY":
+		// Weeks start on Monday (WKST=MO)
+		offset := (int(dtstart.Weekday()) + 6) % 7
+		return dtstart.AddDate(0, 0, 7*n-offset)
+	case "MONTHLY":
+		return time.Date(dtstart.Year(), dtstart.Month()+time.Month(n), 1,
+			dtstart.Hour(), dtstart.Minute(), dtstart.Second(), 0, dtstart.Location())
+	default:
+		return time.Date(dtstart.Year()+n, 1, 1,
+			dtstart.Hour(), dtstart.Minute(), dtstart.Second(), 0, dtstart.Location())
+	}
+}
+
+// periodCandidates lists the sorted occurrences within the n-th period
+func (r *rrule) periodCandidates(dtstart time.Time, n int) []time.Time {
+	start := r.periodStart(dtstart, n)
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, dtstart.Hour(), dtstart.Minute(), dtstart.Second(), 0, dtstart.Location())
+	}
+
+	var days []time.Time
+	switch r.freq {
+	case "DAILY":
+		days = []time.Time{start}
+	case "WEEKLY":
+		if len(r.byDay) == 0 {
+			days = []time.Time{dtstart.AddDate(0, 0, 7*n)}
+			break
+		}
+		for i := 0; i < 7; i++ {
+			d := start.AddDate(0, 0, i)
+			for _, wd := range r.byDay {
+				if d.Weekday() == wd.day {
+					days = append(days, d)
+				}
+			}
+		}
+	case "MONTHLY":
+		days = r.monthDays(start.Year(), start.Month(), dtstart, at)
+	case "YEARLY":
+		months := r.byMonth
+		if len(months) == 0 {
+			months = []int{int(dtstart.Month())}
+		}
+		for _, m := range months {
+			days = append(days, r.monthDays(start.Year(), time.Month(m), dtstart, at)...)
+		}
+	}
+
+	// BYMONTH / BYMONTHDAY / BYDAY narrow daily and weekly rules
+	var result []time.Time
+	for _, d := range days {
+		if len(r.byMonth) > 0 && !containsInt(r.byMonth, int(d.Month())) {
+			continue
+		}
+		if r.freq == "DAILY" {
+			if len(r.byMonthDay) > 0 && !matchesMonthDay(d, r.byMonthDay) {
+				continue
+			}
+			if len(r.byDay) > 0 && !matchesWeekday(d, r.byDay) {
+				continue
+			}
+		}
+		result = append(result, d)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Before(result[j]) })
+	return result
+}
+
+// monthDays applies BYMONTHDAY and BYDAY within one month, defaulting to
+// the day of month of dtstart
+func (r *rrule) monthDays(year int, month time.Month, dtstart time.Time, at func(int, time.Month, int) time.Time) []time.Time {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	var days []time.Time
+
+	switch {
+	case len(r.byMonthDay) > 0:
+		for _, md := range r.byMonthDay {
+			d := md
+			if d < 0 {
+				d = last + md + 1
+			}
+			if d >= 1 && d <= last {
+				day := at(year, month, d)
+				if len(r.byDay) == 0 || matchesWeekday(day, r.byDay) {
+					days = append(days, day)
+				}
+			}
+		}
+	case len(r.byDay) > 0:
+		for _, wd := range r.byDay {
+			var matches []int
+			for d := 1; d <= last; d++ {
+				if time.Date(year, month, d, 0, 0, 0, 0, time.UTC).Weekday() == wd.day {
+					matches = append(matches, d)
+				}
+			}
+			switch {
+			case wd.ordinal == 0:
+				for _, d := range matches {
+					days = append(days, at(year, month, d))
+				}
+			case wd.ordinal > 0 && wd.ordinal <= len(matches):
+				days = append(days, at(year, month, matches[wd.ordinal-1]))
+			case wd.ordinal < 0 && -wd.ordinal <= len(matches):
+				days = append(days, at(year, month, matches[len(matches)+wd.ordinal]))
+			}
+		}
+	default:
+		// Months without that day (e.g. the 31st) are skipped
+		if dtstart.Day() <= last {
+			days = append(days, at(year, month, dtstart.Day()))
+		}
+	}
+	return days
+}
+
+func matchesMonthDay(d time.Time, monthDays []int) bool {
+	last := time.Date(d.Year(), d.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	for _, md := range monthDays {
+		if md == d.Day() || (md < 0 && last+md+1 == d.Day()) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesWeekday(d time.Time, days []rruleWeekday) bool {
+	for _, wd := range days {
+		if wd.day == d.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(list []int, n int) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
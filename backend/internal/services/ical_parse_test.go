@@ -0,0 +1,246 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mazong/angel_event/internal/models"
+)
+
+// icalEvent wraps the properties of one VEVENT into a calendar
+func icalEvent(props ...string) string {
+	lines := append([]string{"BEGIN:VCALENDAR", "VERSION:2.0", "BEGIN:VEVENT", "UID:test@fixture"}, props...)
+	lines = append(lines, "END:VEVENT", "END:VCALENDAR")
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+func busyDates(t *testing.T, calendar, from, to string) string {
+	t.Helper()
+	f, _ := models.ParseDate(from)
+	l, _ := models.ParseDate(to)
+	busy, err := ParseBusyDates(strings.NewReader(calendar), f, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dates := make([]string, len(busy))
+	for i, b := range busy {
+		dates[i] = b.Date.String()
+	}
+	return strings.Join(dates, " ")
+}
+
+func TestParseBusyDatesRRule(t *testing.T) {
+	tests := []struct {
+		name     string
+		props    []string
+		from, to string
+		want     string
+	}{
+		// FREQ
+		{
+			name:  "daily",
+			props: []string{"DTSTART;VALUE=DATE:20260301", "RRULE:FREQ=DAILY"},
+			from:  "2026-03-05", to: "2026-03-08",
+			want: "2026-03-05 2026-03-06 2026-03-07 2026-03-08",
+		},
+		{
+			name:  "daily with interval",
+			props: []string{"DTSTART;VALUE=DATE:20260301", "RRULE:FREQ=DAILY;INTERVAL=3"},
+			from:  "2026-03-01", to: "2026-03-10",
+			want: "2026-03-01 2026-03-04 2026-03-07 2026-03-10",
+		},
+		{
+			name:  "weekly on the start weekday",
+			props: []string{"DTSTART;VALUE=DATE:20260302", "RRULE:FREQ=WEEKLY"},
+			from:  "2026-03-01", to: "2026-03-24",
+			want: "2026-03-02 2026-03-09 2026-03-16 2026-03-23",
+		},
+		{
+			name:  "monthly skips months without the day",
+			props: []string{"DTSTART;VALUE=DATE:20260131", "RRULE:FREQ=MONTHLY"},
+			from:  "2026-01-01", to: "2026-06-30",
+			want: "2026-01-31 2026-03-31 2026-05-31",
+		},
+		{
+			name:  "yearly on February 29",
+			props: []string{"DTSTART;VALUE=DATE:20240229", "RRULE:FREQ=YEARLY"},
+			from:  "2024-01-01", to: "2032-12-31",
+			want: "2024-02-29 2028-02-29 2032-02-29",
+		},
+		{
+			name:  "yearly by month",
+			props: []string{"DTSTART;VALUE=DATE:20260110", "RRULE:FREQ=YEARLY;BYMONTH=1,7"},
+			from:  "2026-01-01", to: "2027-01-31",
+			want: "2026-01-10 2026-07-10 2027-01-10",
+		},
+
+		// UNTIL
+		{
+			name:  "until date is inclusive",
+			props: []string{"DTSTART;VALUE=DATE:20260301", "RRULE:FREQ=DAILY;UNTIL=20260303"},
+			from:  "2026-03-01", to: "2026-03-31",
+			want: "2026-03-01 2026-03-02 2026-03-03",
+		},
+		{
+			name:  "until date with a timed event includes that whole day",
+			props: []string{"DTSTART;TZID=America/Toronto:20260301T200000", "DURATION:PT1H", "RRULE:FREQ=DAILY;UNTIL=20260303"},
+			from:  "2026-03-01", to: "2026-03-31",
+			want: "2026-03-01 2026-03-02 2026-03-03",
+		},
+		{
+			name:  "until time in UTC includes an occurrence at that instant",
+			props: []string{"DTSTART;TZID=America/Toronto:20260301T200000", "DURATION:PT1H", "RRULE:FREQ=DAILY;UNTIL=20260303T010000Z"},
+			from:  "2026-03-01", to: "2026-03-31",
+			want: "2026-03-01 2026-03-02",
+		},
+		{
+			name:  "until before the window",
+			props: []string{"DTSTART;VALUE=DATE:20200301", "RRULE:FREQ=DAILY;UNTIL=20210101"},
+			from:  "2026-03-01", to: "2026-03-31",
+			want: "",
+		},
+
+		// COUNT
+		{
+			name:  "count",
+			props: []string{"DTSTART;VALUE=DATE:20260301", "RRULE:FREQ=WEEKLY;COUNT=3"},
+			from:  "2026-03-01", to: "2026-04-30",
+			want: "2026-03-01 2026-03-08 2026-03-15",
+		},
+		{
+			name:  "count spent before the window",
+			props: []string{"DTSTART;VALUE=DATE:20260101", "RRULE:FREQ=DAILY;COUNT=10"},
+			from:  "2026-01-08", to: "2026-01-31",
+			want: "2026-01-08 2026-01-09 2026-01-10",
+		},
+		{
+			name:  "count over expanded BYDAY occurrences",
+			props: []string{"DTSTART;VALUE=DATE:20260302", "RRULE:FREQ=WEEKLY;BYDAY=MO,TH;COUNT=3"},
+			from:  "2026-03-01", to: "2026-03-31",
+			want: "2026-03-02 2026-03-05 2026-03-09",
+		},
+
+		// BYDAY
+		{
+			name:  "weekly by day",
+			props: []string{"DTSTART;VALUE=DATE:20260302", "RRULE:FREQ=WEEKLY;BYDAY=TU,SA"},
+			from:  "2026-03-01", to: "2026-03-14",
+			want: "2026-03-03 2026-03-07 2026-03-10 2026-03-14",
+		},
+		{
+			name:  "biweekly by day",
+			props: []string{"DTSTART;VALUE=DATE:20260302", "RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR"},
+			from:  "2026-03-01", to: "2026-03-31",
+			want: "2026-03-02 2026-03-06 2026-03-16 2026-03-20 2026-03-30",
+		},
+		{
+			name:  "monthly first Saturday",
+			props: []string{"DTSTART;VALUE=DATE:20260103", "RRULE:FREQ=MONTHLY;BYDAY=1SA"},
+			from:  "2026-01-01", to: "2026-04-30",
+			want: "2026-01-03 2026-02-07 2026-03-07 2026-04-04",
+		},
+		{
+			name:  "monthly last Friday",
+			props: []string{"DTSTART;VALUE=DATE:20260130", "RRULE:FREQ=MONTHLY;BYDAY=-1FR"},
+			from:  "2026-01-01", to: "2026-04-30",
+			want: "2026-01-30 2026-02-27 2026-03-27 2026-04-24",
+		},
+		{
+			name:  "monthly fifth Sunday only where there is one",
+			props: []string{"DTSTART;VALUE=DATE:20260201", "RRULE:FREQ=MONTHLY;BYDAY=5SU"},
+			from:  "2026-02-01", to: "2026-06-30",
+			want: "2026-03-29 2026-05-31",
+		},
+		{
+			name:  "daily narrowed to weekends",
+			props: []string{"DTSTART;VALUE=DATE:20260302", "RRULE:FREQ=DAILY;BYDAY=SA,SU"},
+			from:  "2026-03-01", to: "2026-03-15",
+			want: "2026-03-07 2026-03-08 2026-03-14 2026-03-15",
+		},
+
+		// EXDATE
+		{
+			name:  "exdate removes a day",
+			props: []string{"DTSTART;VALUE=DATE:20260301", "RRULE:FREQ=DAILY;COUNT=4", "EXDATE;VALUE=DATE:20260302"},
+			from:  "2026-03-01", to: "2026-03-31",
+			want: "2026-03-01 2026-03-03 2026-03-04",
+		},
+		{
+			name:  "exdate list",
+			props: []string{"DTSTART;VALUE=DATE:20260301", "RRULE:FREQ=DAILY;COUNT=5", "EXDATE;VALUE=DATE:20260302,20260304"},
+			from:  "2026-03-01", to: "2026-03-31",
+			want: "2026-03-01 2026-03-03 2026-03-05",
+		},
+		{
+			name: "exdate of a timed occurrence in another timezone",
+			props: []string{"DTSTART;TZID=America/Toronto:20260301T200000", "DURATION:PT1H",
+				"RRULE:FREQ=DAILY;COUNT=3", "EXDATE:20260303T010000Z"},
+			from: "2026-03-01", to: "2026-03-31",
+			want: "2026-03-01 2026-03-03",
+		},
+		{
+			name: "exdate on several lines",
+			props: []string{"DTSTART;VALUE=DATE:20260301", "RRULE:FREQ=WEEKLY;COUNT=4",
+				"EXDATE;VALUE=DATE:20260308", "EXDATE;VALUE=DATE:20260322"},
+			from: "2026-03-01", to: "2026-03-31",
+			want: "2026-03-01 2026-03-15",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := busyDates(t, icalEvent(tt.props...), tt.from, tt.to); got != tt.want {
+				t.Errorf("busy dates =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBusyDatesOldSeries(t *testing.T) {
+	// Series that started long before the window must still reach it,
+	// however many periods separate them from it
+	tests := []struct {
+		name  string
+		props []string
+		want  string
+	}{
+		{
+			name:  "daily since 1990",
+			props: []string{"DTSTART;VALUE=DATE:19900101", "RRULE:FREQ=DAILY"},
+			want:  "2026-03-01 2026-03-02 2026-03-03",
+		},
+		{
+			name:  "daily every 7 days since 1990",
+			props: []string{"DTSTART;VALUE=DATE:19900101", "RRULE:FREQ=DAILY;INTERVAL=7"},
+			want:  "2026-03-02",
+		},
+		{
+			name:  "weekly timed since 1980",
+			props: []string{"DTSTART;TZID=America/Toronto:19800106T190000", "DURATION:PT2H", "RRULE:FREQ=WEEKLY;BYDAY=MO"},
+			want:  "2026-03-02",
+		},
+		{
+			name:  "monthly since 1900",
+			props: []string{"DTSTART;VALUE=DATE:19000102", "RRULE:FREQ=MONTHLY;BYMONTHDAY=1,3"},
+			want:  "2026-03-01 2026-03-03",
+		},
+		{
+			name:  "daily with a large count since 2000",
+			props: []string{"DTSTART;VALUE=DATE:20000101", "RRULE:FREQ=DAILY;COUNT=100000"},
+			want:  "2026-03-01 2026-03-02 2026-03-03",
+		},
+		{
+			name:  "daily with a count ending in the window",
+			props: []string{"DTSTART;VALUE=DATE:20000101", "RRULE:FREQ=DAILY;COUNT=9558"},
+			want:  "2026-03-01 2026-03-02",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := busyDates(t, icalEvent(tt.props...), "2026-03-01", "2026-03-03"); got != tt.want {
+				t.Errorf("busy dates = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,347 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"gorm.io/gorm"
+)
+
+// Reply tokens tie a reply to what the email we sent was about. Emails get
+// a Reply-To of INBOUND_EMAIL_ADDRESS plus-addressed with the token, for
+// example reply+b42.1f3a9c0d7e2b@angelevent.com for booking 42.
+const (
+	ReplyClient  = "c"
+	ReplyBooking = "b"
+	ReplyInquiry = "i"
+)
+
+// inboundAttachmentPrefix holds the files of received emails; it is
+// neither public nor collected by the orphan GC
+const inboundAttachmentPrefix = "uploads/inbound/"
+
+// ErrDuplicateEmail is returned when a message was already ingested
+var ErrDuplicateEmail = errors.New("email already received")
+
+func replyTokenKey() []byte {
+	return []byte(envOr("INBOUND_TOKEN_KEY", os.Getenv("JWT_SECRET")))
+}
+
+func replyTokenSignature(subject string) string {
+	mac := hmac.New(sha256.New, replyTokenKey())
+	mac.Write([]byte(subject))
+	return hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// ReplyAddress returns the Reply-To address for an email about a client,
+// booking or inquiry, or "" when INBOUND_EMAIL_ADDRESS is not set
+func ReplyAddress(kind string, id uint) string {
+	inbox := os.Getenv("INBOUND_EMAIL_ADDRESS")
+	at := strings.LastIndex(inbox, "@")
+	if at <= 0 {
+		return ""
+	}
+	subject := kind + strconv.FormatUint(uint64(id), 10)
+	return inbox[:at] + "+" + subject + "." + replyTokenSignature(subject) + inbox[at:]
+}
+
+// parseReplyToken returns the kind and ID of a recipient address carrying a
+// valid reply token
+func parseReplyToken(address string) (string, uint, bool) {
+	at := strings.LastIndex(address, "@")
+	plus := strings.Index(address, "+")
+	if at < 0 || plus < 0 || plus > at {
+		return "", 0, false
+	}
+	subject, signature, ok := strings.Cut(address[plus+1:at], ".")
+	if !ok || len(subject) < 2 || !hmac.Equal([]byte(signature), []byte(replyTokenSignature(subject))) {
+		return "", 0, false
+	}
+	id, err := strconv.ParseUint(subject[1:], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return subject[:1], uint(id), true
+}
+
+// IngestEmail parses a raw message, matches it to a client and stores it
+// with its attachments. A reply to an inquiry is added to its thread.
+func IngestEmail(raw []byte, source models.InboundSource) (*models.InboundEmail, error) {
+	parsed, err := ParseEmail(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	// Messages without an ID are deduplicated on their content
+	messageID := parsed.MessageID
+	if messageID == "" {
+		sum := sha256.Sum256(raw)
+		messageID = hex.EncodeToString(sum[:]) + "@inbound"
+	}
+	var existing int64
+	database.DB.Unscoped().Model(&models.InboundEmail{}).Where("message_id = ?", messageID).Count(&existing)
+	if existing > 0 {
+		return nil, ErrDuplicateEmail
+	}
+
+	email := &models.InboundEmail{
+		MessageID: messageID,
+		InReplyTo: parsed.InReplyTo,
+		Source:    source,
+		FromName:  parsed.FromName,
+		FromEmail: parsed.FromEmail,
+		To:        strings.Join(parsed.To, ", "),
+		Subject:   parsed.Subject,
+		TextBody:  parsed.TextBody,
+		HTMLBody:  parsed.HTMLBody,
+		SentAt:    parsed.Date,
+		AutoReply: parsed.AutoReply,
+		MatchedBy: models.MatchUnmatched,
+	}
+	matchInboundEmail(email, parsed.To)
+
+	// Store the files first so a saved email never lacks its attachments
+	ctx := context.Background()
+	batch, err := RandomToken(8)
+	if err != nil {
+		return nil, err
+	}
+	var stored []string
+	for i, a := range parsed.Attachments {
+		key := fmt.Sprintf("%s%s/%d-%s", inboundAttachmentPrefix, batch, i+1, safeAttachmentName(a.Filename))
+		if err := Blobs().Put(ctx, key, bytes.NewReader(a.Data), int64(len(a.Data)), a.ContentType); err != nil {
+			removeBlobs(ctx, stored)
+			return nil, fmt.Errorf("failed to store attachment %q: %w", a.Filename, err)
+		}
+		stored = append(stored, key)
+		email.Attachments = append(email.Attachments, models.InboundAttachment{
+			Filename:    a.Filename,
+			ContentType: a.ContentType,
+			Size:        int64(len(a.Data)),
+			BlobKey:     key,
+		})
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(email).Error; err != nil {
+			return err
+		}
+		if email.InquiryID != nil {
+			return appendInquiryReply(tx, email)
+		}
+		return nil
+	})
+	if err != nil {
+		removeBlobs(ctx, stored)
+		return nil, err
+	}
+	return email, nil
+}
+
+// matchInboundEmail ties an email to a client through a reply token among
+// its recipients, then through its sender, a client or one of its contacts
+func matchInboundEmail(email *models.InboundEmail, recipients []string) {
+	for _, address := range recipients {
+		kind, id, ok := parseReplyToken(address)
+		if !ok {
+			continue
+		}
+		if matchReplyToken(email, kind, id) {
+			email.MatchedBy = models.MatchToken
+			return
+		}
+	}
+
+	if client, err := FindClientByEmail(database.DB, email.FromEmail); err == nil {
+		email.ClientID = &client.ID
+		email.MatchedBy = models.MatchSender
+	}
+}
+
+func matchReplyToken(email *models.InboundEmail, kind string, id uint) bool {
+	switch kind {
+	case ReplyClient:
+		var client models.Client
+		if database.DB.First(&client, id).Error != nil {
+			return false
+		}
+		email.ClientID = &client.ID
+	case ReplyBooking:
+		var booking models.Booking
+		if database.DB.First(&booking, id).Error != nil {
+			return false
+		}
+		email.ClientID = &booking.ClientID
+		email.BookingID = &booking.ID
+	case ReplyInquiry:
+		var inquiry models.Inquiry
+		if database.DB.First(&inquiry, id).Error != nil {
+			return false
+		}
+		email.ClientID = &inquiry.ClientID
+		email.BookingID = inquiry.BookingID
+		email.InquiryID = &inquiry.ID
+	default:
+		return false
+	}
+	return true
+}
+
+// appendInquiryReply adds an inbound email to its inquiry thread. A client
+// writing back reopens a replied or closed inquiry, unless the email is an
+// automatic reply.
+func appendInquiryReply(tx *gorm.DB, email *models.InboundEmail) error {
+	message := models.InquiryMessage{
+		InquiryID:      *email.InquiryID,
+		Direction:      models.MessageInbound,
+		Subject:        email.Subject,
+		Body:           email.TextBody,
+		InboundEmailID: &email.ID,
+	}
+	if message.Body == "" {
+		message.Body = email.HTMLBody
+	}
+	if err := tx.Create(&message).Error; err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{"last_message_at": message.CreatedAt}
+	if !email.AutoReply {
+		var inquiry models.Inquiry
+		if err := tx.First(&inquiry, *email.InquiryID).Error; err != nil {
+			return err
+		}
+		if inquiry.Status == models.InquiryReplied || inquiry.Status == models.InquiryClosed {
+			updates["status"] = models.InquiryNew
+		}
+	}
+	return tx.Model(&models.Inquiry{}).Where("id = ?", *email.InquiryID).Updates(updates).Error
+}
+
+// AssignInboundEmail ties an email to a client, and optionally one of its
+// bookings, by hand
+func AssignInboundEmail(email *models.InboundEmail, clientID uint, bookingID *uint) error {
+	var client models.Client
+	if err := database.DB.First(&client, clientID).Error; err != nil {
+		return err
+	}
+	if bookingID != nil {
+		var booking models.Booking
+		if err := database.DB.Where("client_id = ?", clientID).First(&booking, *bookingID).Error; err != nil {
+			return err
+		}
+	}
+
+	email.ClientID = &client.ID
+	email.BookingID = bookingID
+	email.MatchedBy = models.MatchManual
+	return database.DB.Model(email).Updates(map[string]interface{}{
+		"client_id":  email.ClientID,
+		"booking_id": email.BookingID,
+		"matched_by": email.MatchedBy,
+	}).Error
+}
+
+// safeAttachmentName keeps a sender-chosen file name usable as a blob key
+func safeAttachmentName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	safe := strings.TrimLeft(b.String(), ".")
+	if len(safe) > 100 {
+		safe = safe[len(safe)-100:]
+	}
+	if safe == "" {
+		return "attachment"
+	}
+	return safe
+}
+
+func removeBlobs(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := Blobs().Delete(ctx, key); err != nil {
+			log.Printf("Failed to remove %s: %v", key, err)
+		}
+	}
+}
+
+// Maildir info suffixes of processed messages:
+// seen once ingested, flagged when they could not be parsed
+const (
+	maildirSeen    = ":2,S"
+	maildirFlagged = ":2,F"
+)
+
+// PollMaildir ingests the messages delivered to dir/new and moves them to
+// dir/cur. It returns how many were ingested.
+func PollMaildir(dir string) (int, error) {
+	entries, err := os.ReadDir(path.Join(dir, "new"))
+	if err != nil {
+		return 0, err
+	}
+
+	ingested := 0
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		src := path.Join(dir, "new", entry.Name())
+		raw, err := os.ReadFile(src)
+		if err != nil {
+			log.Printf("Failed to read %s: %v", src, err)
+			continue
+		}
+
+		flags := maildirSeen
+		_, err = IngestEmail(raw, models.InboundMaildir)
+		switch {
+		case err == nil:
+			ingested++
+		case errors.Is(err, ErrDuplicateEmail):
+		default:
+			log.Printf("Failed to ingest %s: %v", src, err)
+			// Leave storage failures for the next poll
+			if !errors.Is(err, ErrInvalidEmail) {
+				continue
+			}
+			flags = maildirFlagged
+		}
+
+		if err := os.Rename(src, path.Join(dir, "cur", entry.Name()+flags)); err != nil {
+			log.Printf("Failed to move %s: %v", src, err)
+		}
+	}
+	return ingested, nil
+}
+
+// MaildirJob ingests mail delivered to INBOUND_MAILDIR
+func MaildirJob(ctx context.Context) (string, error) {
+	dir := os.Getenv("INBOUND_MAILDIR")
+	if dir == "" {
+		return "", errors.New("INBOUND_MAILDIR is not set")
+	}
+	n, err := PollMaildir(dir)
+	if err != nil || n == 0 {
+		return "", err
+	}
+	return fmt.Sprintf("ingested %d emails from %s", n, dir), nil
+}
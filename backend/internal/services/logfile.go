@@ -0,0 +1,104 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// defaultLogMaxSizeMB is the size at which the server log is rotated
+const defaultLogMaxSizeMB = 10
+
+// rotatedLogLayout suffixes rotated log files, e.g. server.log.20260115-043000
+const rotatedLogLayout = "20060102-150405"
+
+// RotatingFile is an append-only log file that is renamed with a timestamp
+// suffix once it grows past its maximum size. The retention job deletes
+// old rotated files (see RetentionServerLogs).
+type RotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	file    *os.File
+	size    int64
+}
+
+// OpenLogFile opens the LOG_FILE server log, rotated every LOG_MAX_SIZE_MB
+// megabytes, or returns nil when LOG_FILE is not set
+func OpenLogFile() (*RotatingFile, error) {
+	path := os.Getenv("LOG_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	maxSizeMB := envInt("LOG_MAX_SIZE_MB", defaultLogMaxSizeMB)
+	if maxSizeMB <= 0 {
+		maxSizeMB = defaultLogMaxSizeMB
+	}
+	return OpenRotatingFile(path, int64(maxSizeMB)<<20)
+}
+
+// OpenRotatingFile opens path for appending, creating it if needed
+func OpenRotatingFile(path string, maxSize int64) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, maxSize: maxSize}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	if dir := filepath.Dir(f.path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// Write appends p, rotating the file first when p would overflow it
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.path, f.path+"."+time.Now().Format(rotatedLogLayout)); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+// Close closes the current file
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+// rotatedLogFiles returns the rotated files of the log at path
+func rotatedLogFiles(path string) ([]string, error) {
+	return filepath.Glob(path + ".[0-9]*-[0-9]*")
+}
@@ -0,0 +1,252 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxMIMEDepth bounds nested multiparts and forwarded messages
+const maxMIMEDepth = 10
+
+// ErrInvalidEmail is returned for messages that cannot be parsed
+var ErrInvalidEmail = errors.New("invalid email")
+
+// ParsedEmail is an RFC 822 message split into the parts the app keeps
+type ParsedEmail struct {
+	MessageID   string
+	InReplyTo   string
+	References  []string
+	FromName    string
+	FromEmail   string
+	To          []string // To, Cc and delivery headers, lowercased
+	Subject     string
+	Date        *time.Time
+	TextBody    string
+	HTMLBody    string
+	AutoReply   bool
+	Attachments []ParsedAttachment
+}
+
+// ParsedAttachment is a decoded attachment of a parsed email
+type ParsedAttachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+var headerDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// ParseEmail parses a raw RFC 822 message with its MIME parts
+func ParseEmail(raw []byte) (*ParsedEmail, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEmail, err)
+	}
+	h := msg.Header
+
+	from, err := mail.ParseAddress(decodeHeader(h.Get("From")))
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad From address: %v", ErrInvalidEmail, err)
+	}
+
+	email := &ParsedEmail{
+		MessageID: strings.Trim(strings.TrimSpace(h.Get("Message-Id")), "<>"),
+		InReplyTo: strings.Trim(strings.TrimSpace(h.Get("In-Reply-To")), "<>"),
+		FromName:  from.Name,
+		FromEmail: strings.ToLower(from.Address),
+		Subject:   decodeHeader(h.Get("Subject")),
+		AutoReply: isAutoReply(h),
+	}
+	for _, ref := range strings.Fields(h.Get("References")) {
+		email.References = append(email.References, strings.Trim(ref, "<>"))
+	}
+	if date, err := h.Date(); err == nil {
+		email.Date = &date
+	}
+	for _, name := range []string{"To", "Cc", "Delivered-To", "X-Original-To", "Envelope-To"} {
+		for _, value := range h[name] {
+			addrs, err := mail.ParseAddressList(decodeHeader(value))
+			if err != nil {
+				continue
+			}
+			for _, addr := range addrs {
+				email.To = append(email.To, strings.ToLower(addr.Address))
+			}
+		}
+	}
+
+	if err := email.readPart(map[string][]string(h), msg.Body, 0); err != nil {
+		return nil, err
+	}
+	return email, nil
+}
+
+// readPart walks a MIME part: the first text/plain and text/html parts
+// shown inline are the bodies, anything else with content is an attachment
+func (e *ParsedEmail) readPart(header map[string][]string, body io.Reader, depth int) error {
+	get := func(name string) string {
+		if values := header[name]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	mediaType, params, err := mime.ParseMediaType(get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") && depth < maxMIMEDepth {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("%w: bad MIME part: %v", ErrInvalidEmail, err)
+			}
+			if err := e.readPart(part.Header, part, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := io.ReadAll(decodeTransfer(body, get("Content-Transfer-Encoding")))
+	if err != nil {
+		return fmt.Errorf("%w: bad MIME part encoding: %v", ErrInvalidEmail, err)
+	}
+
+	disposition, dispParams, _ := mime.ParseMediaType(get("Content-Disposition"))
+	filename := decodeHeader(dispParams["filename"])
+	if filename == "" {
+		filename = decodeHeader(params["name"])
+	}
+	inline := disposition != "attachment" && filename == ""
+
+	switch {
+	case inline && mediaType == "text/plain" && e.TextBody == "":
+		e.TextBody = decodeCharset(data, params["charset"])
+	case inline && mediaType == "text/html" && e.HTMLBody == "":
+		e.HTMLBody = decodeCharset(data, params["charset"])
+	case len(data) > 0:
+		if filename == "" {
+			filename = "attachment"
+			if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+				filename += exts[0]
+			}
+		}
+		e.Attachments = append(e.Attachments, ParsedAttachment{
+			Filename:    filename,
+			ContentType: mediaType,
+			Data:        data,
+		})
+	}
+	return nil
+}
+
+func decodeTransfer(r io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &base64Cleaner{r: r})
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// base64Cleaner drops the line breaks and spaces wrapped base64 contains
+type base64Cleaner struct {
+	r io.Reader
+}
+
+func (c *base64Cleaner) Read(p []byte) (int, error) {
+	for {
+		n, err := c.r.Read(p)
+		kept := 0
+		for _, b := range p[:n] {
+			if b != '\r' && b != '\n' && b != ' ' && b != '\t' {
+				p[kept] = b
+				kept++
+			}
+		}
+		if kept > 0 || err != nil {
+			return kept, err
+		}
+	}
+}
+
+// decodeHeader decodes RFC 2047 encoded words, keeping the raw value when
+// they are malformed
+func decodeHeader(value string) string {
+	decoded, err := headerDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// decodeCharset converts a text part to UTF-8. Latin-1 and Windows-1252,
+// the usual non-UTF-8 charsets of French mail clients, are converted;
+// invalid bytes of other charsets are replaced.
+func decodeCharset(data []byte, charset string) string {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "iso-8859-15", "latin1", "windows-1252", "cp1252":
+		return windows1252ToUTF8(data)
+	}
+	return strings.ToValidUTF8(string(data), string(utf8.RuneError))
+}
+
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(decodeCharset(data, charset)), nil
+}
+
+// windows1252High maps the bytes 0x80-0x9F, where Windows-1252 puts
+// typographic quotes and the euro sign instead of Latin-1 control codes
+var windows1252High = [32]rune{
+	'€', '\u0081', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '\u008d', 'Ž', '\u008f',
+	'\u0090', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '\u009d', 'ž', 'Ÿ',
+}
+
+// windows1252ToUTF8 decodes Windows-1252, a superset of the printable
+// Latin-1 characters
+func windows1252ToUTF8(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		if b >= 0x80 && b < 0xa0 {
+			runes[i] = windows1252High[b-0x80]
+		} else {
+			runes[i] = rune(b)
+		}
+	}
+	return string(runes)
+}
+
+// isAutoReply detects out-of-office replies and bounces (RFC 3834)
+func isAutoReply(h mail.Header) bool {
+	if auto := strings.ToLower(strings.TrimSpace(h.Get("Auto-Submitted"))); auto != "" && auto != "no" {
+		return true
+	}
+	if h.Get("X-Autoreply") != "" || h.Get("X-Autorespond") != "" {
+		return true
+	}
+	switch strings.ToLower(strings.TrimSpace(h.Get("Precedence"))) {
+	case "auto_reply", "bulk", "junk":
+		return true
+	}
+	return false
+}
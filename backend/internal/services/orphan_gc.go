@@ -0,0 +1,235 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+)
+
+// orphanGCPrefixes are the app-managed folders the GC may clean. Imported
+// photos under storage/ and private files are never touched.
+var orphanGCPrefixes = []string{"uploads/gallery/", "uploads/rentals/", "uploads/variants/"}
+
+// quarantinePrefix holds orphans moved aside instead of deleted
+const quarantinePrefix = "uploads/quarantine/"
+
+// DefaultOrphanGracePeriod protects fresh uploads whose row is not saved yet
+// and soft-deleted rows that may still be restored
+const DefaultOrphanGracePeriod = 72 * time.Hour
+
+// orphanGCMu prevents the job, the CLI and the admin endpoint from
+// collecting at the same time in one process
+var orphanGCMu sync.Mutex
+
+// OrphanGCOptions configures a garbage collection run
+type OrphanGCOptions struct {
+	// DryRun only reports what would be collected
+	DryRun bool
+	// GracePeriod keeps files modified, or rows soft-deleted, more recently
+	GracePeriod time.Duration
+	// Quarantine moves orphans under uploads/quarantine/ instead of deleting them
+	Quarantine bool
+}
+
+// OrphanFile is an unreferenced file found by the GC
+type OrphanFile struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// OrphanGCReport summarizes a garbage collection run
+type OrphanGCReport struct {
+	DryRun      bool         `json:"dry_run"`
+	Quarantine  bool         `json:"quarantine"`
+	Scanned     int          `json:"scanned"`
+	Referenced  int          `json:"referenced"`
+	SoftDeleted int          `json:"soft_deleted"` // kept for rows deleted within the grace period
+	Recent      int          `json:"recent"`       // kept for files newer than the grace period
+	Orphans     []OrphanFile `json:"orphans"`
+	OrphanBytes int64        `json:"orphan_bytes"`
+	Removed     int          `json:"removed"`
+	Failed      int          `json:"failed"`
+}
+
+// CollectOrphanFiles finds files under the upload folders that no gallery
+// image or rental item references, and deletes or quarantines them
+func CollectOrphanFiles(ctx context.Context, opts OrphanGCOptions) (*OrphanGCReport, error) {
+	orphanGCMu.Lock()
+	defer orphanGCMu.Unlock()
+
+	if opts.GracePeriod < 0 {
+		opts.GracePeriod = 0
+	}
+	now := time.Now()
+
+	refs, err := referencedBlobKeys()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load file references: %w", err)
+	}
+
+	report := &OrphanGCReport{DryRun: opts.DryRun, Quarantine: opts.Quarantine, Orphans: []OrphanFile{}}
+	store := Blobs()
+
+	for _, prefix := range orphanGCPrefixes {
+		err := store.List(ctx, prefix, func(info BlobInfo) error {
+			report.Scanned++
+
+			if deletedAt, ok := refs[info.Key]; ok {
+				// A live row, or a soft-deleted one that may still be restored
+				if deletedAt.IsZero() {
+					report.Referenced++
+					return nil
+				}
+				if now.Sub(deletedAt) < opts.GracePeriod {
+					report.SoftDeleted++
+					return nil
+				}
+			}
+
+			if now.Sub(info.ModTime) < opts.GracePeriod {
+				report.Recent++
+				return nil
+			}
+
+			report.Orphans = append(report.Orphans, OrphanFile{Key: info.Key, Size: info.Size, ModTime: info.ModTime})
+			report.OrphanBytes += info.Size
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", prefix, err)
+		}
+	}
+
+	if opts.DryRun {
+		return report, nil
+	}
+
+	batch := quarantinePrefix + now.UTC().Format("20060102-150405") + "/"
+	for _, orphan := range report.Orphans {
+		var err error
+		if opts.Quarantine {
+			err = moveBlob(ctx, store, orphan.Key, batch+orphan.Key)
+		} else {
+			err = store.Delete(ctx, orphan.Key)
+		}
+		if err != nil {
+			log.Printf("Orphan GC: failed to remove %s: %v", orphan.Key, err)
+			report.Failed++
+			continue
+		}
+		report.Removed++
+	}
+
+	return report, nil
+}
+
+// referencedBlobKeys maps every file referenced by a gallery image or rental
+// item to the deletion time of its row, zero for live rows
+func referencedBlobKeys() (map[string]time.Time, error) {
+	refs := make(map[string]time.Time)
+	add := func(url string, deletedAt *time.Time) {
+		key, err := BlobKeyForURL(url)
+		if err != nil {
+			return
+		}
+		if deletedAt == nil {
+			refs[key] = time.Time{}
+			return
+		}
+		// A live reference wins over a deleted one; the latest deletion wins otherwise
+		if current, ok := refs[key]; ok && (current.IsZero() || current.After(*deletedAt)) {
+			return
+		}
+		refs[key] = *deletedAt
+	}
+
+	var images []struct {
+		ImageURL     string
+		ThumbnailURL string
+		PublicURL    string
+		DeletedAt    *time.Time
+	}
+	if err := database.DB.Unscoped().Model(&models.GalleryImage{}).
+		Select("image_url, thumbnail_url, public_url, deleted_at").
+		Scan(&images).Error; err != nil {
+		return nil, err
+	}
+	for _, img := range images {
+		add(img.ImageURL, img.DeletedAt)
+		add(img.ThumbnailURL, img.DeletedAt)
+		add(img.PublicURL, img.DeletedAt)
+	}
+
+	var items []struct {
+		ImageURL  string
+		DeletedAt *time.Time
+	}
+	if err := database.DB.Unscoped().Model(&models.RentalItem{}).
+		Select("image_url, deleted_at").
+		Scan(&items).Error; err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		add(item.ImageURL, item.DeletedAt)
+	}
+
+	return refs, nil
+}
+
+// moveBlob copies a blob to a new key and deletes the original
+func moveBlob(ctx context.Context, store BlobStore, from, to string) error {
+	r, info, err := store.Get(ctx, from)
+	if err != nil {
+		return err
+	}
+	err = store.Put(ctx, to, r, info.Size, info.ContentType)
+	r.Close()
+	if err != nil {
+		return err
+	}
+	return store.Delete(ctx, from)
+}
+
+// OrphanGCJob quarantines orphans older than the grace period
+func OrphanGCJob(grace time.Duration) JobFunc {
+	return func(ctx context.Context) (string, error) {
+		report, err := CollectOrphanFiles(ctx, OrphanGCOptions{
+			GracePeriod: grace,
+			Quarantine:  true,
+		})
+		if err != nil {
+			return "", err
+		}
+		if len(report.Orphans) == 0 {
+			return "", nil
+		}
+		return fmt.Sprintf("quarantined %d files (%d bytes), %d failed",
+			report.Removed, report.OrphanBytes, report.Failed), nil
+	}
+}
+
+// ParseDurationEnv reads a duration such as "24h" from the environment.
+// Empty values return fallback; "0" or "off" disable the feature (0).
+func ParseDurationEnv(name string, fallback time.Duration) time.Duration {
+	v := strings.TrimSpace(envOr(name, ""))
+	switch v {
+	case "":
+		return fallback
+	case "0", "off", "false":
+		return 0
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %s", name, v, fallback)
+		return fallback
+	}
+	return d
+}
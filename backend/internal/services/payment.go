@@ -0,0 +1,28 @@
+package services
+
+import (
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+)
+
+// TotalPaid sums payments, refunds counting against them
+func TotalPaid(payments []models.Payment) float64 {
+	paid := 0.0
+	for _, p := range payments {
+		if p.Kind == models.PaymentRefund {
+			paid -= p.Amount
+		} else {
+			paid += p.Amount
+		}
+	}
+	return paid
+}
+
+// BookingPaid returns what was paid for a booking, net of refunds
+func BookingPaid(bookingID uint) (float64, error) {
+	var payments []models.Payment
+	if err := database.DB.Where("booking_id = ?", bookingID).Find(&payments).Error; err != nil {
+		return 0, err
+	}
+	return TotalPaid(payments), nil
+}
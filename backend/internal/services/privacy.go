@@ -0,0 +1,365 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrClientErased is returned when erasing a client a second time
+var ErrClientErased = errors.New("client data was already erased")
+
+// erasedEmailDomain receives the pseudonymous addresses of erased clients;
+// .invalid is reserved and never delivers
+const erasedEmailDomain = "erased.invalid"
+
+// ClientPseudonym returns the stable pseudonym standing for a client in
+// kept financial records and in the privacy audit trail. It is keyed by
+// PSEUDONYM_KEY, falling back to JWT_SECRET.
+func ClientPseudonym(clientID uint) string {
+	mac := hmac.New(sha256.New, []byte(envOr("PSEUDONYM_KEY", os.Getenv("JWT_SECRET"))))
+	mac.Write([]byte("client:" + strconv.FormatUint(uint64(clientID), 10)))
+	return "anon-" + hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// ClientExport is everything held about a client, deleted records
+// included, as written to an access request archive
+type ClientExport struct {
+	Client        models.Client                  `json:"client"`
+	Bookings      []models.Booking               `json:"bookings"`
+	Payments      []models.Payment               `json:"payments"`
+	StatusChanges []models.BookingStatusChange   `json:"status_changes"`
+	Notes         []models.ClientNote            `json:"notes"`
+	EmailLogs     []models.EmailLog              `json:"email_logs"`
+	InboundEmails []models.InboundEmail          `json:"inbound_emails"`
+	Inquiries     []models.Inquiry               `json:"inquiries"`
+	Testimonials  []models.Testimonial           `json:"testimonials"`
+	Newsletter    []models.Newsletter            `json:"newsletter"`
+	Waitlist      []models.WaitlistEntry         `json:"waitlist"`
+	DateHolds     []models.DateHold              `json:"date_holds"`
+	Quarantined   []models.QuarantinedSubmission `json:"quarantined_submissions"`
+}
+
+// clientEmails returns the lowercased addresses of a client and its
+// contacts, which tie records without a client_id to the client
+func clientEmails(db *gorm.DB, client *models.Client) ([]string, error) {
+	emails := []string{strings.ToLower(client.Email)}
+	var contacts []string
+	if err := db.Model(&models.ClientContact{}).Where("client_id = ? AND email <> ''", client.ID).
+		Pluck("LOWER(email)", &contacts).Error; err != nil {
+		return nil, err
+	}
+	for _, e := range contacts {
+		if !containsString(emails, e) {
+			emails = append(emails, e)
+		}
+	}
+	return emails, nil
+}
+
+// CollectClientData gathers everything tied to a client, through its
+// client_id or the email of the client or one of its contacts
+func CollectClientData(clientID uint) (*ClientExport, error) {
+	// A session, so that the queries below do not share conditions
+	db := database.DB.Unscoped().Session(&gorm.Session{})
+
+	export := &ClientExport{}
+	if err := db.Preload("Tags").Preload("Contacts").First(&export.Client, clientID).Error; err != nil {
+		return nil, err
+	}
+	emails, err := clientEmails(db, &export.Client)
+	if err != nil {
+		return nil, err
+	}
+
+	queries := []struct {
+		dest  interface{}
+		query *gorm.DB
+	}{
+		{&export.Bookings, db.Preload("RentalItems").Where("client_id = ?", clientID)},
+		{&export.Payments, db.Where("client_id = ?", clientID)},
+		{&export.StatusChanges, db.Where("client_id = ?", clientID)},
+		{&export.Notes, db.Where("client_id = ?", clientID)},
+		{&export.EmailLogs, db.Where(`client_id = ? OR LOWER("to") IN ?`, clientID, emails)},
+		{&export.InboundEmails, db.Preload("Attachments").Where("client_id = ? OR LOWER(from_email) IN ?", clientID, emails)},
+		{&export.Inquiries, db.Preload("Messages").Where("client_id = ? OR LOWER(email) IN ?", clientID, emails)},
+		{&export.Testimonials, db.Where("client_id = ?", clientID)},
+		{&export.Newsletter, db.Where("LOWER(email) IN ?", emails)},
+		{&export.Waitlist, db.Where("LOWER(email) IN ?", emails)},
+		{&export.DateHolds, db.Where("LOWER(email) IN ?", emails)},
+		{&export.Quarantined, db.Where("LOWER(email) IN ?", emails)},
+	}
+	for _, q := range queries {
+		if err := q.query.Order("id").Find(q.dest).Error; err != nil {
+			return nil, err
+		}
+	}
+	return export, nil
+}
+
+// Counts returns the number of records of each kind in the export
+func (e *ClientExport) Counts() map[string]int64 {
+	attachments := 0
+	for _, m := range e.InboundEmails {
+		attachments += len(m.Attachments)
+	}
+	return map[string]int64{
+		"bookings":                int64(len(e.Bookings)),
+		"payments":                int64(len(e.Payments)),
+		"status_changes":          int64(len(e.StatusChanges)),
+		"notes":                   int64(len(e.Notes)),
+		"email_logs":              int64(len(e.EmailLogs)),
+		"inbound_emails":          int64(len(e.InboundEmails)),
+		"inbound_attachments":     int64(attachments),
+		"inquiries":               int64(len(e.Inquiries)),
+		"testimonials":            int64(len(e.Testimonials)),
+		"newsletter":              int64(len(e.Newsletter)),
+		"waitlist":                int64(len(e.Waitlist)),
+		"date_holds":              int64(len(e.DateHolds)),
+		"quarantined_submissions": int64(len(e.Quarantined)),
+	}
+}
+
+// WriteClientExport writes the export as a ZIP of one JSON file per kind of
+// record, followed by the files attached to received emails
+func WriteClientExport(ctx context.Context, w io.Writer, export *ClientExport) error {
+	zw := zip.NewWriter(w)
+	now := time.Now()
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"client.json", export.Client},
+		{"bookings.json", export.Bookings},
+		{"payments.json", export.Payments},
+		{"status_changes.json", export.StatusChanges},
+		{"notes.json", export.Notes},
+		{"email_logs.json", export.EmailLogs},
+		{"inbound_emails.json", export.InboundEmails},
+		{"inquiries.json", export.Inquiries},
+		{"testimonials.json", export.Testimonials},
+		{"newsletter.json", export.Newsletter},
+		{"waitlist.json", export.Waitlist},
+		{"date_holds.json", export.DateHolds},
+		{"quarantined_submissions.json", export.Quarantined},
+	}
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range export.InboundEmails {
+		for _, a := range m.Attachments {
+			name := fmt.Sprintf("attachments/%d-%d-%s", m.ID, a.ID, path.Base(a.BlobKey))
+			err := copyBlobToZip(ctx, zw, a.BlobKey, name)
+			if errors.Is(err, ErrBlobNotFound) {
+				log.Printf("Client %d export: skipping attachment %d: %v", export.Client.ID, a.ID, err)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return zw.Close()
+}
+
+func copyBlobToZip(ctx context.Context, zw *zip.Writer, key, name string) error {
+	r, info, err := Blobs().Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: info.ModTime})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, r)
+	return err
+}
+
+// RecordPrivacyAction adds an entry to the privacy audit trail
+func RecordPrivacyAction(db *gorm.DB, action models.PrivacyActionType, clientID uint, userID *uint, counts map[string]int64) (*models.PrivacyAction, error) {
+	entry := models.PrivacyAction{
+		Action:    action,
+		ClientID:  clientID,
+		Pseudonym: ClientPseudonym(clientID),
+		UserID:    userID,
+		Summary:   formatCounts(counts),
+	}
+	if err := db.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// EraseClient anonymizes a client in one transaction. Bookings, payments
+// and status changes are kept for the accounts, with their free text
+// cleared, under a client renamed to its pseudonym. Email logs keep their
+// type, status and date under the pseudonymous address. Everything else
+// carrying personal data is deleted for good: contacts, notes, tags,
+// inquiries, received emails and their files, testimonials, newsletter
+// subscriptions, waitlist entries and quarantined submissions.
+func EraseClient(clientID uint, userID *uint) (*models.PrivacyAction, error) {
+	var action *models.PrivacyAction
+	var blobKeys []string
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		db := tx.Unscoped().Session(&gorm.Session{})
+
+		var client models.Client
+		if err := db.First(&client, clientID).Error; err != nil {
+			return err
+		}
+		if client.ErasedAt != nil {
+			return ErrClientErased
+		}
+		emails, err := clientEmails(db, &client)
+		if err != nil {
+			return err
+		}
+
+		pseudonym := ClientPseudonym(client.ID)
+		address := pseudonym + "@" + erasedEmailDomain
+		counts := make(map[string]int64)
+		count := func(kind string, result *gorm.DB) error {
+			counts[kind] += result.RowsAffected
+			return result.Error
+		}
+
+		var emailIDs []uint
+		if err := db.Model(&models.InboundEmail{}).Where("client_id = ? OR LOWER(from_email) IN ?", client.ID, emails).
+			Pluck("id", &emailIDs).Error; err != nil {
+			return err
+		}
+		if len(emailIDs) > 0 {
+			if err := db.Model(&models.InboundAttachment{}).Where("inbound_email_id IN ?", emailIDs).
+				Pluck("blob_key", &blobKeys).Error; err != nil {
+				return err
+			}
+		}
+
+		var inquiryIDs []uint
+		if err := db.Model(&models.Inquiry{}).Where("client_id = ? OR LOWER(email) IN ?", client.ID, emails).
+			Pluck("id", &inquiryIDs).Error; err != nil {
+			return err
+		}
+
+		steps := []struct {
+			kind   string
+			result func() *gorm.DB
+		}{
+			{"bookings", func() *gorm.DB {
+				return db.Model(&models.Booking{}).Where("client_id = ?", client.ID).Updates(map[string]interface{}{
+					"event_location": "", "message": "", "special_requests": "", "admin_notes": "",
+				})
+			}},
+			{"payments", func() *gorm.DB {
+				return db.Model(&models.Payment{}).Where("client_id = ? AND reference <> ''", client.ID).Update("reference", "")
+			}},
+			{"email_logs", func() *gorm.DB {
+				return db.Model(&models.EmailLog{}).Where(`client_id = ? OR LOWER("to") IN ?`, client.ID, emails).
+					Updates(map[string]interface{}{"to": address, "subject": "[erased]", "error": "", "client_id": client.ID})
+			}},
+			{"inquiry_messages", func() *gorm.DB {
+				return db.Where("inquiry_id IN ?", inquiryIDs).Delete(&models.InquiryMessage{})
+			}},
+			{"inquiries", func() *gorm.DB {
+				return db.Where("id IN ?", inquiryIDs).Delete(&models.Inquiry{})
+			}},
+			{"inbound_attachments", func() *gorm.DB {
+				return db.Where("inbound_email_id IN ?", emailIDs).Delete(&models.InboundAttachment{})
+			}},
+			{"inbound_emails", func() *gorm.DB {
+				return db.Where("id IN ?", emailIDs).Delete(&models.InboundEmail{})
+			}},
+			{"testimonials", func() *gorm.DB {
+				return db.Where("client_id = ?", client.ID).Delete(&models.Testimonial{})
+			}},
+			{"review_invitations", func() *gorm.DB {
+				return db.Where("client_id = ?", client.ID).Delete(&models.ReviewInvitation{})
+			}},
+			{"newsletter", func() *gorm.DB {
+				return db.Where("LOWER(email) IN ?", emails).Delete(&models.Newsletter{})
+			}},
+			{"waitlist", func() *gorm.DB {
+				return db.Where("LOWER(email) IN ?", emails).Delete(&models.WaitlistEntry{})
+			}},
+			{"date_holds", func() *gorm.DB {
+				return db.Model(&models.DateHold{}).Where("LOWER(email) IN ?", emails).Update("email", "")
+			}},
+			{"quarantined_submissions", func() *gorm.DB {
+				return db.Where("LOWER(email) IN ?", emails).Delete(&models.QuarantinedSubmission{})
+			}},
+			{"notes", func() *gorm.DB {
+				return db.Where("client_id = ?", client.ID).Delete(&models.ClientNote{})
+			}},
+			{"contacts", func() *gorm.DB {
+				return db.Where("client_id = ?", client.ID).Delete(&models.ClientContact{})
+			}},
+		}
+		for _, step := range steps {
+			if err := count(step.kind, step.result()); err != nil {
+				return fmt.Errorf("erase %s: %w", step.kind, err)
+			}
+		}
+
+		if err := tx.Model(&client).Association("Tags").Clear(); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := db.Model(&client).Updates(map[string]interface{}{
+			"name":          pseudonym,
+			"email":         address,
+			"phone":         "",
+			"notes":         "",
+			"source_detail": "",
+			"erased_at":     now,
+		}).Error; err != nil {
+			return err
+		}
+		counts["clients"] = 1
+
+		action, err = RecordPrivacyAction(tx, models.PrivacyErasure, client.ID, userID, counts)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Files go once the rows are gone; a leftover file is only reachable
+	// through the deleted attachment rows
+	for _, key := range blobKeys {
+		if err := Blobs().Delete(context.Background(), key); err != nil {
+			log.Printf("Client %d erasure: failed to delete %s: %v", clientID, key, err)
+		}
+	}
+	return action, nil
+}
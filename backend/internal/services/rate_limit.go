@@ -0,0 +1,81 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiterSweepEvery is how many calls pass between purges of idle keys
+const rateLimiterSweepEvery = 1000
+
+// RateLimiter allows up to limit events per key in a sliding window. It is
+// in-memory, so limits reset on restart and are per server process.
+type RateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	hits   map[string][]time.Time
+	calls  int
+}
+
+// NewRateLimiter creates a limiter; a limit of 0 allows everything
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{limit: limit, window: window, hits: make(map[string][]time.Time)}
+}
+
+// Allow records an event for key, reporting false when it exceeds the limit
+func (l *RateLimiter) Allow(key string) bool {
+	if l.limit <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-l.window)
+
+	l.calls++
+	if l.calls%rateLimiterSweepEvery == 0 {
+		for k, times := range l.hits {
+			if len(times) == 0 || !times[len(times)-1].After(cutoff) {
+				delete(l.hits, k)
+			}
+		}
+	}
+
+	times := l.hits[key]
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	times = times[i:]
+
+	if len(times) >= l.limit {
+		l.hits[key] = times
+		return false
+	}
+	l.hits[key] = append(times, now)
+	return true
+}
+
+// Exceeded reports whether key has reached the limit, without recording
+// an event
+func (l *RateLimiter) Exceeded(key string) bool {
+	return l.limit > 0 && l.Count(key) >= l.limit
+}
+
+// Count returns the events of key within the window, up to the limit
+func (l *RateLimiter) Count(key string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := time.Now().Add(-l.window)
+	recent := 0
+	for _, t := range l.hits[key] {
+		if t.After(cutoff) {
+			recent++
+		}
+	}
+	return recent
+}
@@ -0,0 +1,33 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterExceeded(t *testing.T) {
+	l := NewRateLimiter(2, time.Minute)
+
+	// Checking does not count as an event
+	for i := 0; i < 3; i++ {
+		if l.Exceeded("a") {
+			t.Fatal("exceeded before any event")
+		}
+	}
+
+	l.Allow("a")
+	if l.Exceeded("a") {
+		t.Error("exceeded after one event of two")
+	}
+	l.Allow("a")
+	if !l.Exceeded("a") || l.Allow("a") {
+		t.Error("not exceeded after two events of two")
+	}
+	if l.Exceeded("b") {
+		t.Error("another key is exceeded")
+	}
+
+	if NewRateLimiter(0, time.Minute).Exceeded("a") {
+		t.Error("a disabled limiter is exceeded")
+	}
+}
@@ -0,0 +1,332 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"gorm.io/gorm"
+)
+
+// retentionMu prevents the job and the admin endpoint from purging at the
+// same time in one process
+var retentionMu sync.Mutex
+
+// retentionTasks enforce the policy of each entity, adding the number of
+// records they purged or archived to counts
+var retentionTasks = map[models.RetentionEntity]func(cutoff time.Time, counts map[string]int64) error{
+	models.RetentionDeletedClients:    purgeDeletedClients,
+	models.RetentionDeletedRecords:    purgeDeletedRecords,
+	models.RetentionEmailLogs:         pruneEmailLogs,
+	models.RetentionCompletedBookings: archiveCompletedBookings,
+	models.RetentionServerLogs:        pruneServerLogs,
+	models.RetentionJobRuns:           pruneJobRuns,
+}
+
+// softDeletedTables are purged by the deleted_records policy, along with
+// inquiries and received emails. Bookings are kept for the accounts, and
+// rows pointing to files (gallery, albums, rentals, calendar imports) are
+// left to the orphan GC and their own cleanup.
+var softDeletedTables = map[string]interface{}{
+	"testimonials":       &models.Testimonial{},
+	"newsletter":         &models.Newsletter{},
+	"notes":              &models.ClientNote{},
+	"contacts":           &models.ClientContact{},
+	"payments":           &models.Payment{},
+	"availability":       &models.Availability{},
+	"availability_rules": &models.AvailabilityRule{},
+	"calendar_feeds":     &models.CalendarFeed{},
+	"site_content":       &models.SiteContent{},
+}
+
+// GetRetentionPolicies returns the retention policy of every entity
+func GetRetentionPolicies() ([]models.RetentionPolicy, error) {
+	var policies []models.RetentionPolicy
+	err := database.DB.Order("entity").Find(&policies).Error
+	return policies, err
+}
+
+// ApplyRetention enforces every enabled retention policy and records the
+// run. A failing policy does not stop the others; their errors are joined
+// in the run.
+func ApplyRetention(manual bool) (*models.RetentionRun, error) {
+	retentionMu.Lock()
+	defer retentionMu.Unlock()
+
+	policies, err := GetRetentionPolicies()
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	counts := make(map[string]int64)
+	var errs []string
+	for _, policy := range policies {
+		task, ok := retentionTasks[policy.Entity]
+		if !ok || !policy.Enabled || policy.Days <= 0 {
+			continue
+		}
+		cutoff := start.AddDate(0, 0, -policy.Days)
+		if err := task(cutoff, counts); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", policy.Entity, err))
+		}
+	}
+
+	run := models.RetentionRun{
+		Manual:     manual,
+		DurationMs: time.Since(start).Milliseconds(),
+		Summary:    formatCounts(counts),
+		Error:      strings.Join(errs, "; "),
+	}
+	if err := database.DB.Create(&run).Error; err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// formatCounts lists the non-zero counts as "kind=n", sorted by kind
+func formatCounts(counts map[string]int64) string {
+	var parts []string
+	for kind, n := range counts {
+		if n > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%d", kind, n))
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+// purgeDeletedClients handles clients deleted before cutoff. Those with
+// bookings are erased, keeping the bookings under a pseudonym; the others
+// are deleted for good with everything they own.
+func purgeDeletedClients(cutoff time.Time, counts map[string]int64) error {
+	var clients []models.Client
+	if err := database.DB.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Find(&clients).Error; err != nil {
+		return err
+	}
+
+	for _, client := range clients {
+		var bookings int64
+		if err := database.DB.Unscoped().Model(&models.Booking{}).Where("client_id = ?", client.ID).
+			Count(&bookings).Error; err != nil {
+			return err
+		}
+
+		if bookings > 0 {
+			if client.ErasedAt != nil {
+				continue
+			}
+			if _, err := EraseClient(client.ID, nil); err != nil && !errors.Is(err, ErrClientErased) {
+				return fmt.Errorf("erase client %d: %w", client.ID, err)
+			}
+			counts["clients_erased"]++
+			continue
+		}
+
+		if err := purgeClient(client.ID); err != nil {
+			return fmt.Errorf("purge client %d: %w", client.ID, err)
+		}
+		counts["clients_purged"]++
+	}
+	return nil
+}
+
+// purgeClient deletes a client without bookings and every row it owns
+func purgeClient(clientID uint) error {
+	var blobKeys []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		db := tx.Unscoped().Session(&gorm.Session{})
+
+		var emailIDs, inquiryIDs []uint
+		if err := db.Model(&models.InboundEmail{}).Where("client_id = ?", clientID).Pluck("id", &emailIDs).Error; err != nil {
+			return err
+		}
+		if err := db.Model(&models.Inquiry{}).Where("client_id = ?", clientID).Pluck("id", &inquiryIDs).Error; err != nil {
+			return err
+		}
+		if err := deleteInboundEmails(db, emailIDs, &blobKeys); err != nil {
+			return err
+		}
+		if err := db.Where("inquiry_id IN ?", inquiryIDs).Delete(&models.InquiryMessage{}).Error; err != nil {
+			return err
+		}
+		for _, table := range clientOwnedTables {
+			if err := db.Where("client_id = ?", clientID).Delete(table).Error; err != nil {
+				return err
+			}
+		}
+		if err := db.Exec("DELETE FROM client_tags WHERE client_id = ?", clientID).Error; err != nil {
+			return err
+		}
+		return db.Delete(&models.Client{}, clientID).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	deleteBlobs(blobKeys)
+	return nil
+}
+
+// deleteInboundEmails deletes received emails and their attachment rows,
+// adding the attachment files to blobKeys for deletion after commit
+func deleteInboundEmails(db *gorm.DB, ids []uint, blobKeys *[]string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var keys []string
+	if err := db.Model(&models.InboundAttachment{}).Where("inbound_email_id IN ?", ids).
+		Pluck("blob_key", &keys).Error; err != nil {
+		return err
+	}
+	if err := db.Where("inbound_email_id IN ?", ids).Delete(&models.InboundAttachment{}).Error; err != nil {
+		return err
+	}
+	if err := db.Model(&models.InquiryMessage{}).Where("inbound_email_id IN ?", ids).
+		Update("inbound_email_id", nil).Error; err != nil {
+		return err
+	}
+	if err := db.Where("id IN ?", ids).Delete(&models.InboundEmail{}).Error; err != nil {
+		return err
+	}
+	*blobKeys = append(*blobKeys, keys...)
+	return nil
+}
+
+func deleteBlobs(keys []string) {
+	for _, key := range keys {
+		if err := Blobs().Delete(context.Background(), key); err != nil {
+			log.Printf("Retention: failed to delete %s: %v", key, err)
+		}
+	}
+}
+
+// purgeDeletedRecords deletes for good the rows soft-deleted before cutoff
+func purgeDeletedRecords(cutoff time.Time, counts map[string]int64) error {
+	db := database.DB.Unscoped().Session(&gorm.Session{})
+
+	for kind, table := range softDeletedTables {
+		result := db.Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Delete(table)
+		if result.Error != nil {
+			return fmt.Errorf("%s: %w", kind, result.Error)
+		}
+		counts[kind] += result.RowsAffected
+	}
+
+	// Inquiries and received emails take their messages and files along
+	var inquiryIDs []uint
+	if err := db.Model(&models.Inquiry{}).Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Pluck("id", &inquiryIDs).Error; err != nil {
+		return err
+	}
+	if len(inquiryIDs) > 0 {
+		if err := db.Where("inquiry_id IN ?", inquiryIDs).Delete(&models.InquiryMessage{}).Error; err != nil {
+			return err
+		}
+		result := db.Where("id IN ?", inquiryIDs).Delete(&models.Inquiry{})
+		if result.Error != nil {
+			return result.Error
+		}
+		counts["inquiries"] += result.RowsAffected
+	}
+
+	var emailIDs []uint
+	if err := db.Model(&models.InboundEmail{}).Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Pluck("id", &emailIDs).Error; err != nil {
+		return err
+	}
+	var blobKeys []string
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return deleteInboundEmails(tx, emailIDs, &blobKeys)
+	}); err != nil {
+		return err
+	}
+	counts["inbound_emails"] += int64(len(emailIDs))
+	deleteBlobs(blobKeys)
+	return nil
+}
+
+// pruneEmailLogs deletes the logs of emails sent before cutoff
+func pruneEmailLogs(cutoff time.Time, counts map[string]int64) error {
+	var ids []uint
+	if err := database.DB.Unscoped().Model(&models.EmailLog{}).Where("created_at < ?", cutoff).
+		Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.InquiryMessage{}).Where("email_log_id IN ?", ids).
+			Update("email_log_id", nil).Error; err != nil {
+			return err
+		}
+		result := tx.Unscoped().Where("id IN ?", ids).Delete(&models.EmailLog{})
+		counts["email_logs"] += result.RowsAffected
+		return result.Error
+	})
+}
+
+// archiveCompletedBookings archives completed bookings whose event took
+// place before cutoff
+func archiveCompletedBookings(cutoff time.Time, counts map[string]int64) error {
+	before := BusinessDate(cutoff)
+	result := database.DB.Model(&models.Booking{}).
+		Where("status = ? AND archived_at IS NULL AND event_date < ?", models.BookingStatusCompleted, before).
+		Update("archived_at", time.Now())
+	counts["bookings_archived"] += result.RowsAffected
+	return result.Error
+}
+
+// pruneServerLogs deletes rotated server log files older than cutoff
+func pruneServerLogs(cutoff time.Time, counts map[string]int64) error {
+	path := os.Getenv("LOG_FILE")
+	if path == "" {
+		return nil
+	}
+	files, err := rotatedLogFiles(path)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+		counts["server_logs"]++
+	}
+	return nil
+}
+
+// pruneJobRuns deletes the history of job runs started before cutoff
+func pruneJobRuns(cutoff time.Time, counts map[string]int64) error {
+	result := database.DB.Where("started_at < ? AND status <> ?", cutoff, models.JobRunning).
+		Delete(&models.JobRun{})
+	counts["job_runs"] += result.RowsAffected
+	return result.Error
+}
+
+// RetentionJob enforces the retention policies
+func RetentionJob(ctx context.Context) (string, error) {
+	run, err := ApplyRetention(false)
+	if err != nil {
+		return "", err
+	}
+	if run.Error != "" {
+		return run.Summary, errors.New(run.Error)
+	}
+	return run.Summary, nil
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"gorm.io/gorm"
+)
+
+// DefaultReviewLinkTTL is how long a review link stays valid
+const DefaultReviewLinkTTL = 60 * 24 * time.Hour
+
+// reviewTokenBytes is the size of review link tokens (192 bits)
+const reviewTokenBytes = 24
+
+var (
+	// ErrBookingNotCompleted is returned when asking a review for a booking
+	// that is not completed
+	ErrBookingNotCompleted = errors.New("booking is not completed")
+	// ErrReviewLinkUsed is returned for a review link already submitted
+	ErrReviewLinkUsed = errors.New("review link was already used")
+	// ErrReviewLinkExpired is returned for a review link past its expiry
+	ErrReviewLinkExpired = errors.New("review link has expired")
+)
+
+var (
+	reviewLinkTTL     time.Duration
+	reviewLinkTTLOnce sync.Once
+)
+
+// ReviewLinkTTL returns the configured review link lifetime (REVIEW_LINK_TTL)
+func ReviewLinkTTL() time.Duration {
+	reviewLinkTTLOnce.Do(func() {
+		reviewLinkTTL = ParseDurationEnv("REVIEW_LINK_TTL", DefaultReviewLinkTTL)
+		if reviewLinkTTL <= 0 {
+			reviewLinkTTL = DefaultReviewLinkTTL
+		}
+	})
+	return reviewLinkTTL
+}
+
+// IssueReviewInvitation returns the review invitation of a completed
+// booking, creating it on the first call
+func IssueReviewInvitation(db *gorm.DB, booking *models.Booking) (*models.ReviewInvitation, error) {
+	if booking.Status != models.BookingStatusCompleted {
+		return nil, ErrBookingNotCompleted
+	}
+
+	var invitation models.ReviewInvitation
+	err := db.Where("booking_id = ?", booking.ID).First(&invitation).Error
+	if err == nil {
+		return &invitation, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	token, err := RandomToken(reviewTokenBytes)
+	if err != nil {
+		return nil, err
+	}
+	invitation = models.ReviewInvitation{
+		BookingID: booking.ID,
+		ClientID:  booking.ClientID,
+		Token:     token,
+		ExpiresAt: time.Now().Add(ReviewLinkTTL()),
+	}
+	if err := db.Create(&invitation).Error; err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// ReviewURL is the testimonials page link that submits a verified review
+func ReviewURL(invitation *models.ReviewInvitation) string {
+	q := url.Values{}
+	q.Set("review", invitation.Token)
+	return FrontendURL("/temoignages?" + q.Encode())
+}
+
+// FindReviewInvitation returns the invitation of token with its booking and
+// client, if it can still be used
+func FindReviewInvitation(db *gorm.DB, token string) (*models.ReviewInvitation, *models.Booking, error) {
+	var invitation models.ReviewInvitation
+	if err := db.Where("token = ?", token).First(&invitation).Error; err != nil {
+		return nil, nil, err
+	}
+	if invitation.UsedAt != nil {
+		return nil, nil, ErrReviewLinkUsed
+	}
+	if time.Now().After(invitation.ExpiresAt) {
+		return nil, nil, ErrReviewLinkExpired
+	}
+
+	var booking models.Booking
+	if err := db.Preload("Client").First(&booking, invitation.BookingID).Error; err != nil {
+		return nil, nil, err
+	}
+	if booking.Client == nil {
+		return nil, nil, gorm.ErrRecordNotFound
+	}
+	return &invitation, &booking, nil
+}
+
+// SubmitVerifiedReview stores testimonial as the verified review of the
+// invitation of token, for its booking and client, and uses up the link.
+// The testimonial still awaits approval.
+func SubmitVerifiedReview(token string, testimonial *models.Testimonial) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		invitation, booking, err := FindReviewInvitation(tx, token)
+		if err != nil {
+			return err
+		}
+
+		if testimonial.Name == "" {
+			testimonial.Name = booking.Client.Name
+		}
+		testimonial.ClientID = &invitation.ClientID
+		testimonial.BookingID = &invitation.BookingID
+		testimonial.EventType = booking.EventType
+		testimonial.Verified = true
+		testimonial.Approved = false
+		if err := tx.Create(testimonial).Error; err != nil {
+			return err
+		}
+
+		// Only one submission may use the link
+		result := tx.Model(&models.ReviewInvitation{}).
+			Where("id = ? AND used_at IS NULL", invitation.ID).
+			Updates(map[string]interface{}{"used_at": time.Now(), "testimonial_id": testimonial.ID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrReviewLinkUsed
+		}
+		return nil
+	})
+}
+
+// RatingSummary aggregates the ratings of approved testimonials, all of
+// them and the verified ones only
+type RatingSummary struct {
+	EventType       models.EventType `json:"event_type,omitempty"`
+	Count           int64            `json:"count"`
+	Average         float64          `json:"average"` // rounded to one decimal, 0 without ratings
+	VerifiedCount   int64            `json:"verified_count"`
+	VerifiedAverage float64          `json:"verified_average"`
+}
+
+// TestimonialRatings returns the ratings of approved testimonials overall
+// and per event type
+func TestimonialRatings() (RatingSummary, []RatingSummary, error) {
+	var rows []struct {
+		EventType     models.EventType
+		Count         int64
+		Total         float64
+		Verified      int64
+		VerifiedTotal float64
+	}
+	if err := database.DB.Model(&models.Testimonial{}).
+		Select("event_type, COUNT(*) AS count, SUM(rating) AS total, "+
+			"SUM(CASE WHEN verified THEN 1 ELSE 0 END) AS verified, "+
+			"SUM(CASE WHEN verified THEN rating ELSE 0 END) AS verified_total").
+		Where("approved = ?", true).
+		Group("event_type").
+		Order("event_type").
+		Scan(&rows).Error; err != nil {
+		return RatingSummary{}, nil, err
+	}
+
+	var overall RatingSummary
+	var total, verifiedTotal float64
+	byType := make([]RatingSummary, 0, len(rows))
+	for _, row := range rows {
+		overall.Count += row.Count
+		overall.VerifiedCount += row.Verified
+		total += row.Total
+		verifiedTotal += row.VerifiedTotal
+		if row.EventType == "" {
+			continue
+		}
+		byType = append(byType, RatingSummary{
+			EventType:       row.EventType,
+			Count:           row.Count,
+			Average:         averageRating(row.Total, row.Count),
+			VerifiedCount:   row.Verified,
+			VerifiedAverage: averageRating(row.VerifiedTotal, row.Verified),
+		})
+	}
+	overall.Average = averageRating(total, overall.Count)
+	overall.VerifiedAverage = averageRating(verifiedTotal, overall.VerifiedCount)
+	return overall, byType, nil
+}
+
+func averageRating(total float64, count int64) float64 {
+	if count == 0 {
+		return 0
+	}
+	return math.Round(total/float64(count)*10) / 10
+}
+
+// AggregateRatingJSONLD is the schema.org description of the business with
+// its AggregateRating, for the testimonials page. Only verified reviews,
+// left by clients of a completed booking, are published to search engines;
+// there is no rating until one is approved.
+func AggregateRatingJSONLD(overall RatingSummary) map[string]interface{} {
+	ld := map[string]interface{}{
+		"@context": "https://schema.org",
+		"@type":    "LocalBusiness",
+		"name":     envOr("BUSINESS_NAME", "Angel Event"),
+		"url":      FrontendURL("/"),
+	}
+	if overall.VerifiedCount > 0 {
+		ld["aggregateRating"] = map[string]interface{}{
+			"@type":       "AggregateRating",
+			"ratingValue": overall.VerifiedAverage,
+			"reviewCount": overall.VerifiedCount,
+			"bestRating":  5,
+			"worstRating": 1,
+		}
+	}
+	return ld
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+)
+
+func TestTestimonialRatings(t *testing.T) {
+	useTestDB(t)
+
+	// No approved testimonial: no rating published
+	overall, _, err := TestimonialRatings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := AggregateRatingJSONLD(overall)["aggregateRating"]; ok {
+		t.Error("aggregateRating published without testimonials")
+	}
+
+	testimonials := []models.Testimonial{
+		{Name: "A", Content: "x", Rating: 5, EventType: models.EventTypeWedding, Approved: true, Verified: true},
+		{Name: "B", Content: "x", Rating: 4, EventType: models.EventTypeWedding, Approved: true, Verified: true},
+		{Name: "C", Content: "x", Rating: 1, EventType: models.EventTypeWedding, Approved: true},
+		{Name: "D", Content: "x", Rating: 1, EventType: models.EventTypeBirthday, Approved: true},
+		// Awaiting approval: not counted
+		{Name: "E", Content: "x", Rating: 1, EventType: models.EventTypeWedding, Verified: true},
+	}
+	if err := database.DB.Create(&testimonials).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	overall, byType, err := TestimonialRatings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := RatingSummary{Count: 4, Average: 2.8, VerifiedCount: 2, VerifiedAverage: 4.5}
+	if overall != want {
+		t.Errorf("overall = %+v, want %+v", overall, want)
+	}
+	wantTypes := []RatingSummary{
+		{EventType: models.EventTypeBirthday, Count: 1, Average: 1},
+		{EventType: models.EventTypeWedding, Count: 3, Average: 3.3, VerifiedCount: 2, VerifiedAverage: 4.5},
+	}
+	if len(byType) != len(wantTypes) {
+		t.Fatalf("by type = %+v, want %+v", byType, wantTypes)
+	}
+	for i := range wantTypes {
+		if byType[i] != wantTypes[i] {
+			t.Errorf("by type[%d] = %+v, want %+v", i, byType[i], wantTypes[i])
+		}
+	}
+
+	// Search engines only get the verified reviews
+	rating, _ := AggregateRatingJSONLD(overall)["aggregateRating"].(map[string]interface{})
+	if rating["ratingValue"] != 4.5 || rating["reviewCount"] != int64(2) {
+		t.Errorf("aggregateRating = %v", rating)
+	}
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	fakeS3AccessKey = "AKIDFAKE"
+	fakeS3Secret    = "fake-secret"
+	fakeS3Region    = "ca-central-1"
+	// fakeS3PageSize keeps list pages small to exercise continuation
+	fakeS3PageSize = 2
+)
+
+type fakeS3Object struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+// fakeS3 is an in-process S3 serving one bucket, path-style or virtual-host
+// style. It checks the SigV4 signature of every request, header-signed or
+// presigned, by signing it again with the shared secret.
+type fakeS3 struct {
+	t      *testing.T
+	bucket string
+	server *httptest.Server
+
+	mu      sync.Mutex
+	objects map[string]fakeS3Object
+}
+
+func newFakeS3(t *testing.T, bucket string) *fakeS3 {
+	f := &fakeS3{t: t, bucket: bucket, objects: make(map[string]fakeS3Object)}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// client dials the fake for any host, so virtual-host style bucket
+// hostnames reach it too
+func (f *fakeS3) client() *http.Client {
+	addr := f.server.Listener.Addr().String()
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+}
+
+// store returns an S3BlobStore talking to the fake
+func (f *fakeS3) store(pathStyle bool) *S3BlobStore {
+	f.t.Helper()
+	store, err := NewS3BlobStore(S3Config{
+		Endpoint:        f.server.URL,
+		Region:          fakeS3Region,
+		Bucket:          f.bucket,
+		AccessKeyID:     fakeS3AccessKey,
+		SecretAccessKey: fakeS3Secret,
+		PathStyle:       pathStyle,
+		HTTPClient:      f.client(),
+	})
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return store
+}
+
+func (f *fakeS3) serve(w http.ResponseWriter, r *http.Request) {
+	key, ok := f.objectKey(r)
+	if !ok {
+		f.fail(w, http.StatusNotFound, "NoSuchBucket", "bucket not found")
+		return
+	}
+	if code, msg := f.checkSignature(r); code != "" {
+		f.fail(w, http.StatusForbidden, code, msg)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case key == "" && r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		f.list(w, r)
+	case key == "":
+		f.fail(w, http.StatusNotImplemented, "NotImplemented", "bucket operation")
+	case r.Method == http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			f.fail(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		if int64(len(data)) != r.ContentLength {
+			f.fail(w, http.StatusBadRequest, "IncompleteBody", "length mismatch")
+			return
+		}
+		f.objects[key] = fakeS3Object{data: data, contentType: r.Header.Get("Content-Type"), modTime: time.Now().UTC()}
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		obj, ok := f.objects[key]
+		if !ok {
+			f.fail(w, http.StatusNotFound, "NoSuchKey", "key not found")
+			return
+		}
+		w.Header().Set("Content-Type", obj.contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+		w.Header().Set("Last-Modified", obj.modTime.Format(http.TimeFormat))
+		if r.Method == http.MethodGet {
+			w.Write(obj.data)
+		}
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		f.fail(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+// objectKey extracts the key of a path-style or virtual-host request
+func (f *fakeS3) objectKey(r *http.Request) (string, bool) {
+	host, _, _ := strings.Cut(r.Host, ":")
+	if strings.HasPrefix(host, f.bucket+".") {
+		return strings.TrimPrefix(r.URL.Path, "/"), true
+	}
+	rest, ok := strings.CutPrefix(r.URL.Path, "/"+f.bucket)
+	if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+		return "", false
+	}
+	return strings.TrimPrefix(rest, "/"), true
+}
+
+// checkSignature signs the request again and compares, returning an S3
+// error code on mismatch
+func (f *fakeS3) checkSignature(r *http.Request) (string, string) {
+	query := r.URL.Query()
+	if query.Get("X-Amz-Signature") != "" {
+		return f.checkPresigned(r, query)
+	}
+
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return "AccessDenied", "missing Authorization"
+	}
+	signer, ok := f.signerAt(r.Header.Get("X-Amz-Date"))
+	if !ok {
+		return "AccessDenied", "invalid X-Amz-Date"
+	}
+
+	check, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	for name, values := range r.Header {
+		check.Header[name] = values
+	}
+	signer.sign(check, r.Header.Get("X-Amz-Content-Sha256"))
+	if check.Header.Get("Authorization") != auth {
+		return "SignatureDoesNotMatch", "signature mismatch"
+	}
+	return "", ""
+}
+
+func (f *fakeS3) checkPresigned(r *http.Request, query url.Values) (string, string) {
+	signer, ok := f.signerAt(query.Get("X-Amz-Date"))
+	if !ok {
+		return "AccessDenied", "invalid X-Amz-Date"
+	}
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil {
+		return "AccessDenied", "invalid X-Amz-Expires"
+	}
+	if time.Now().After(signer.now().Add(time.Duration(expires) * time.Second)) {
+		return "AccessDenied", "Request has expired"
+	}
+
+	unsigned := url.URL{Scheme: "http", Host: r.Host, Path: r.URL.Path, RawPath: r.URL.RawPath}
+	rest := url.Values{}
+	for name, values := range query {
+		if !strings.HasPrefix(name, "X-Amz-") {
+			rest[name] = values
+		}
+	}
+	unsigned.RawQuery = rest.Encode()
+
+	check, err := url.Parse(signer.presign(r.Method, &unsigned, time.Duration(expires)*time.Second))
+	if err != nil || check.Query().Get("X-Amz-Signature") != query.Get("X-Amz-Signature") {
+		return "SignatureDoesNotMatch", "signature mismatch"
+	}
+	return "", ""
+}
+
+func (f *fakeS3) signerAt(amzDate string) (*sigV4Signer, bool) {
+	at, err := time.Parse(sigV4TimeFormat, amzDate)
+	if err != nil {
+		return nil, false
+	}
+	return &sigV4Signer{
+		accessKeyID:     fakeS3AccessKey,
+		secretAccessKey: fakeS3Secret,
+		region:          fakeS3Region,
+		service:         "s3",
+		now:             func() time.Time { return at },
+	}, true
+}
+
+// list serves ListObjectsV2; the continuation token is the last key of the
+// previous page
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	after := r.URL.Query().Get("continuation-token")
+
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	type content struct {
+		Key          string
+		Size         int64
+		LastModified string
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Contents              []content
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+	}{}
+	if len(keys) > fakeS3PageSize {
+		keys = keys[:fakeS3PageSize]
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[len(keys)-1]
+	}
+	for _, key := range keys {
+		obj := f.objects[key]
+		result.Contents = append(result.Contents, content{
+			Key:          key,
+			Size:         int64(len(obj.data)),
+			LastModified: obj.modTime.Format(time.RFC3339),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+func (f *fakeS3) fail(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: message})
+}
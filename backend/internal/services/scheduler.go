@@ -0,0 +1,434 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+)
+
+// jobLeaseTTL is how long a job lease lasts without renewal; running jobs
+// renew it every third of that
+var jobLeaseTTL = 2 * time.Minute
+
+var (
+	// ErrUnknownJob is returned when triggering a job that is not registered
+	ErrUnknownJob = errors.New("unknown job")
+	// ErrJobRunning is returned when a job is already running, here or on
+	// another server instance
+	ErrJobRunning = errors.New("job is already running")
+	// ErrSchedulerStopped is returned when triggering a job during shutdown
+	ErrSchedulerStopped = errors.New("scheduler is stopped")
+	// ErrSlotDone is returned when another instance already ran a scheduled slot
+	ErrSlotDone = errors.New("scheduled run already done")
+	// errLeaseLost cancels a job whose lease could not be renewed
+	errLeaseLost = errors.New("job lease lost")
+)
+
+// JobFunc runs a background job and returns a short summary of what it did.
+// It should return early once ctx is cancelled at shutdown.
+type JobFunc func(ctx context.Context) (string, error)
+
+// Job is a recurring background task
+type Job struct {
+	Name string
+	// Spec is a schedule for ParseSchedule; an empty spec registers a job
+	// that only runs when triggered
+	Spec string
+	// RunAtStart also runs the job when the scheduler starts
+	RunAtStart bool
+	Run        JobFunc
+
+	schedule Schedule
+	next     time.Time
+	running  bool
+}
+
+// JobInfo describes a registered job for the admin
+type JobInfo struct {
+	Name    string         `json:"name"`
+	Spec    string         `json:"spec"`
+	NextRun *time.Time     `json:"next_run,omitempty"`
+	Running bool           `json:"running"`
+	LastRun *models.JobRun `json:"last_run,omitempty"`
+}
+
+// JobScheduler runs registered jobs on their schedules. Each run takes a
+// database lease on the job, so that when several server instances share
+// the database only one of them runs it, and is recorded as a JobRun.
+type JobScheduler struct {
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	owner   string
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	started bool
+}
+
+var scheduler = NewJobScheduler()
+
+// Jobs returns the scheduler of the server's background jobs
+func Jobs() *JobScheduler {
+	return scheduler
+}
+
+// NewJobScheduler returns a scheduler owned by this process
+func NewJobScheduler() *JobScheduler {
+	host, _ := os.Hostname()
+	suffix, _ := RandomToken(3)
+	ctx, cancel := context.WithCancel(context.Background())
+	return &JobScheduler{
+		jobs:   make(map[string]*Job),
+		owner:  fmt.Sprintf("%s:%d:%s", host, os.Getpid(), suffix),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Register adds a job; it starts with the scheduler
+func (s *JobScheduler) Register(job Job) error {
+	if job.Spec != "" {
+		schedule, err := ParseSchedule(job.Spec)
+		if err != nil {
+			return fmt.Errorf("job %s: %w", job.Name, err)
+		}
+		job.schedule = schedule
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[job.Name]; ok {
+		return fmt.Errorf("job %s is already registered", job.Name)
+	}
+	s.jobs[job.Name] = &job
+	return nil
+}
+
+// Start runs the scheduled jobs in the background until Stop
+func (s *JobScheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+
+	// Runs left running by a crashed instance lost their lease
+	database.DB.Model(&models.JobRun{}).
+		Where("status = ? AND job NOT IN (?)", models.JobRunning,
+			database.DB.Model(&models.JobLease{}).Select("name").Where("expires_at > ?", time.Now())).
+		Updates(map[string]interface{}{"status": models.JobFailed, "error": "interrupted"})
+
+	for _, job := range s.jobs {
+		if job.schedule == nil {
+			continue
+		}
+		s.wg.Add(1)
+		go s.loop(job)
+	}
+}
+
+// loop runs a job at each of its scheduled times
+func (s *JobScheduler) loop(job *Job) {
+	defer s.wg.Done()
+
+	if job.RunAtStart {
+		s.run(job, time.Time{})
+	}
+	for {
+		next := job.schedule.Next(time.Now())
+		if next.IsZero() {
+			return
+		}
+		s.mu.Lock()
+		job.next = next
+		s.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			s.run(job, next)
+		}
+	}
+}
+
+// Trigger runs a job now in the background, returning its run record
+func (s *JobScheduler) Trigger(name string) (*models.JobRun, error) {
+	s.mu.Lock()
+	job, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrUnknownJob
+	}
+
+	run, err := s.begin(job, true, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.execute(job, run)
+	}()
+	return run, nil
+}
+
+// run runs a scheduled job for its slot, the time it was scheduled at (zero
+// at start), skipping it when it runs elsewhere or the slot was already run
+func (s *JobScheduler) run(job *Job, slot time.Time) {
+	run, err := s.begin(job, false, slot)
+	if errors.Is(err, ErrJobRunning) || errors.Is(err, ErrSlotDone) || errors.Is(err, ErrSchedulerStopped) {
+		return
+	}
+	if err != nil {
+		log.Printf("Job %s: failed to start: %v", job.Name, err)
+		return
+	}
+	s.execute(job, run)
+}
+
+// begin takes the job's lease, claiming slot unless it is zero, and records
+// the start of a run
+func (s *JobScheduler) begin(job *Job, manual bool, slot time.Time) (*models.JobRun, error) {
+	if s.ctx.Err() != nil {
+		return nil, ErrSchedulerStopped
+	}
+
+	s.mu.Lock()
+	if job.running {
+		s.mu.Unlock()
+		return nil, ErrJobRunning
+	}
+	job.running = true
+	s.mu.Unlock()
+
+	err := s.acquireLease(job.Name, slot)
+	if err != nil {
+		s.finish(job)
+		return nil, err
+	}
+
+	run := models.JobRun{
+		Job:       job.Name,
+		Owner:     s.owner,
+		Manual:    manual,
+		Status:    models.JobRunning,
+		StartedAt: time.Now(),
+	}
+	if err := database.DB.Create(&run).Error; err != nil {
+		s.releaseLease(job.Name)
+		s.finish(job)
+		return nil, err
+	}
+	return &run, nil
+}
+
+// execute runs a started job, renewing its lease, and records the outcome.
+// The job is cancelled if its lease is lost, since another instance may
+// then take it over.
+func (s *JobScheduler) execute(job *Job, run *models.JobRun) {
+	defer s.finish(job)
+	defer s.releaseLease(job.Name)
+
+	ctx, cancel := context.WithCancelCause(s.ctx)
+	defer cancel(nil)
+	go s.keepLease(ctx, cancel, job.Name)
+
+	summary, err := runJob(ctx, job)
+	if lost := context.Cause(ctx); errors.Is(lost, errLeaseLost) {
+		err = errors.Join(lost, err)
+	}
+
+	finished := time.Now()
+	run.FinishedAt = &finished
+	run.DurationMs = finished.Sub(run.StartedAt).Milliseconds()
+	run.Summary = summary
+	run.Status = models.JobSucceeded
+	if err != nil {
+		run.Status = models.JobFailed
+		run.Error = err.Error()
+		log.Printf("Job %s failed: %v", job.Name, err)
+	}
+	if err := database.DB.Save(run).Error; err != nil {
+		log.Printf("Job %s: failed to record run: %v", job.Name, err)
+	}
+}
+
+// keepLease renews the lease of a running job until ctx is done. When the
+// lease was taken over, or could not be renewed before it expired, the job
+// is cancelled.
+func (s *JobScheduler) keepLease(ctx context.Context, cancel context.CancelCauseFunc, name string) {
+	ticker := time.NewTicker(jobLeaseTTL / 3)
+	defer ticker.Stop()
+
+	renewed := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		held, err := s.renewLease(name)
+		switch {
+		case err == nil && !held:
+			log.Printf("Job %s: lease taken over, cancelling", name)
+			cancel(errLeaseLost)
+			return
+		case err != nil && time.Since(renewed) >= jobLeaseTTL:
+			log.Printf("Job %s: lease expired, cancelling: %v", name, err)
+			cancel(fmt.Errorf("%w: %v", errLeaseLost, err))
+			return
+		case err != nil:
+			log.Printf("Job %s: failed to renew lease: %v", name, err)
+		default:
+			renewed = time.Now()
+		}
+	}
+}
+
+// runJob calls the job, turning a panic into an error
+func runJob(ctx context.Context, job *Job) (summary string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return job.Run(ctx)
+}
+
+func (s *JobScheduler) finish(job *Job) {
+	s.mu.Lock()
+	job.running = false
+	s.mu.Unlock()
+}
+
+// acquireLease takes the lease of a job, unless another instance holds an
+// unexpired one (ErrJobRunning). A scheduled run passes its slot and only
+// gets the lease if no instance ran that slot or a later one (ErrSlotDone);
+// a zero slot, for manual runs, skips that check.
+func (s *JobScheduler) acquireLease(name string, slot time.Time) error {
+	now := time.Now()
+	var lastSlot int64
+	if !slot.IsZero() {
+		lastSlot = slot.Unix()
+	}
+
+	result := database.DB.Exec(
+		`INSERT INTO job_leases (name, owner, expires_at, last_slot) VALUES (?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET owner = excluded.owner, expires_at = excluded.expires_at,
+			last_slot = MAX(job_leases.last_slot, excluded.last_slot)
+		WHERE (job_leases.owner = excluded.owner OR job_leases.expires_at < ?)
+			AND (excluded.last_slot = 0 OR job_leases.last_slot < excluded.last_slot)`,
+		name, s.owner, now.Add(jobLeaseTTL), lastSlot, now,
+	)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	if lastSlot != 0 {
+		var lease models.JobLease
+		if err := database.DB.Where("name = ?", name).First(&lease).Error; err == nil && lease.LastSlot >= lastSlot {
+			return ErrSlotDone
+		}
+	}
+	return ErrJobRunning
+}
+
+// renewLease extends the lease of a running job, reporting false when this
+// instance does not hold it anymore
+func (s *JobScheduler) renewLease(name string) (bool, error) {
+	result := database.DB.Model(&models.JobLease{}).
+		Where("name = ? AND owner = ?", name, s.owner).
+		Update("expires_at", time.Now().Add(jobLeaseTTL))
+	return result.RowsAffected > 0, result.Error
+}
+
+// releaseLease expires the lease at the end of a run, keeping its last slot
+func (s *JobScheduler) releaseLease(name string) {
+	if err := database.DB.Model(&models.JobLease{}).
+		Where("name = ? AND owner = ?", name, s.owner).
+		Update("expires_at", time.Now()).Error; err != nil {
+		log.Printf("Job %s: failed to release lease: %v", name, err)
+	}
+}
+
+// List describes the registered jobs with their last run, by name
+func (s *JobScheduler) List() ([]JobInfo, error) {
+	s.mu.Lock()
+	infos := make([]JobInfo, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		info := JobInfo{Name: job.Name, Spec: job.Spec, Running: job.running}
+		if !job.next.IsZero() {
+			next := job.next
+			info.NextRun = &next
+		}
+		infos = append(infos, info)
+	}
+	s.mu.Unlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+
+	for i := range infos {
+		var run models.JobRun
+		err := database.DB.Where("job = ?", infos[i].Name).Order("started_at DESC").Limit(1).Find(&run).Error
+		if err != nil {
+			return nil, err
+		}
+		if run.ID != 0 {
+			infos[i].LastRun = &run
+		}
+	}
+	return infos, nil
+}
+
+// Stop cancels the running jobs and waits up to timeout for them to return
+func (s *JobScheduler) Stop(timeout time.Duration) {
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log.Printf("Scheduler: jobs still running after %s", timeout)
+	}
+}
+
+// ScheduleEnv reads a job schedule from the environment: a cron spec, or a
+// duration such as "1h" meaning "@every 1h". Empty values return fallback;
+// "0" or "off" leave the job to manual runs ("").
+func ScheduleEnv(name, fallback string) string {
+	v := strings.TrimSpace(os.Getenv(name))
+	switch v {
+	case "":
+		return fallback
+	case "0", "off", "false":
+		return ""
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return "@every " + d.String()
+	}
+	if _, err := ParseSchedule(v); err != nil {
+		log.Printf("Invalid %s %q, using %q: %v", name, v, fallback, err)
+		return fallback
+	}
+	return v
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+)
+
+// countingJob registers a job on each scheduler that counts its runs
+func countingJob(t *testing.T, runs *int32, schedulers ...*JobScheduler) []*Job {
+	t.Helper()
+	var jobs []*Job
+	for _, s := range schedulers {
+		err := s.Register(Job{Name: "count", Run: func(ctx context.Context) (string, error) {
+			atomic.AddInt32(runs, 1)
+			return "", nil
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		jobs = append(jobs, s.jobs["count"])
+	}
+	return jobs
+}
+
+func TestSchedulerRunsEachSlotOnce(t *testing.T) {
+	useTestDB(t)
+
+	var runs int32
+	a, b := NewJobScheduler(), NewJobScheduler()
+	jobs := countingJob(t, &runs, a, b)
+
+	slot := time.Date(2026, 3, 8, 4, 0, 0, 0, time.UTC)
+	a.run(jobs[0], slot)
+	// The other instance's timer fires late, after the run was over
+	b.run(jobs[1], slot)
+	if runs != 1 {
+		t.Fatalf("slot ran %d times, want 1", runs)
+	}
+	if err := b.acquireLease("count", slot); err != ErrSlotDone {
+		t.Errorf("acquiring a done slot: %v, want ErrSlotDone", err)
+	}
+
+	// The next slot runs on whichever instance gets there first
+	b.run(jobs[1], slot.Add(time.Hour))
+	a.run(jobs[0], slot.Add(time.Hour))
+	// An earlier slot is not run after a later one
+	a.run(jobs[0], slot.Add(30*time.Minute))
+	if runs != 2 {
+		t.Fatalf("after the next slot: %d runs, want 2", runs)
+	}
+
+	// Manual runs are not tied to a slot
+	if _, err := a.Trigger("count"); err != nil {
+		t.Fatal(err)
+	}
+	a.wg.Wait()
+	if runs != 3 {
+		t.Errorf("after a manual run: %d runs, want 3", runs)
+	}
+
+	var lease models.JobLease
+	database.DB.First(&lease, "name = ?", "count")
+	if lease.LastSlot != slot.Add(time.Hour).Unix() || lease.ExpiresAt.After(time.Now()) {
+		t.Errorf("lease after runs = %+v", lease)
+	}
+}
+
+func TestSchedulerSkipsRunningJob(t *testing.T) {
+	useTestDB(t)
+
+	a, b := NewJobScheduler(), NewJobScheduler()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	a.Register(Job{Name: "slow", Run: func(ctx context.Context) (string, error) {
+		close(started)
+		<-release
+		return "done", nil
+	}})
+	var runs int32
+	b.Register(Job{Name: "slow", Run: func(ctx context.Context) (string, error) {
+		atomic.AddInt32(&runs, 1)
+		return "", nil
+	}})
+
+	if _, err := a.Trigger("slow"); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if _, err := b.Trigger("slow"); err != ErrJobRunning {
+		t.Errorf("trigger while running elsewhere: %v, want ErrJobRunning", err)
+	}
+	if _, err := a.Trigger("slow"); err != ErrJobRunning {
+		t.Errorf("trigger while running here: %v, want ErrJobRunning", err)
+	}
+	close(release)
+	a.wg.Wait()
+
+	if _, err := b.Trigger("slow"); err != nil {
+		t.Errorf("trigger after the run: %v", err)
+	}
+	b.wg.Wait()
+	if runs != 1 {
+		t.Errorf("second instance ran %d times, want 1", runs)
+	}
+}
+
+func TestSchedulerCancelsJobOnLostLease(t *testing.T) {
+	useTestDB(t)
+	previous := jobLeaseTTL
+	jobLeaseTTL = 300 * time.Millisecond
+	t.Cleanup(func() { jobLeaseTTL = previous })
+
+	a := NewJobScheduler()
+	started := make(chan struct{})
+	a.Register(Job{Name: "long", Run: func(ctx context.Context) (string, error) {
+		close(started)
+		select {
+		case <-ctx.Done():
+			return "stopped", ctx.Err()
+		case <-time.After(5 * time.Second):
+			return "finished", nil
+		}
+	}})
+
+	run, err := a.Trigger("long")
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	// Another instance takes the lease over, as if this one had stalled
+	database.DB.Model(&models.JobLease{}).Where("name = ?", "long").
+		Updates(map[string]interface{}{"owner": "other", "expires_at": time.Now().Add(time.Minute)})
+
+	waited := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(3 * time.Second):
+		t.Fatal("job was not cancelled after losing its lease")
+	}
+
+	var stored models.JobRun
+	database.DB.First(&stored, run.ID)
+	if stored.Status != models.JobFailed || !strings.Contains(stored.Error, "lease lost") || stored.Summary != "stopped" {
+		t.Errorf("run = %+v", stored)
+	}
+
+	// The lease released at the end is the other instance's, untouched
+	var lease models.JobLease
+	database.DB.First(&lease, "name = ?", "long")
+	if lease.Owner != "other" || !lease.ExpiresAt.After(time.Now()) {
+		t.Errorf("lease = %+v", lease)
+	}
+}
+
+func TestEveryScheduleAligned(t *testing.T) {
+	schedule, err := ParseSchedule("@every 15m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Instances started at different times agree on the slots
+	for _, now := range []time.Time{
+		time.Date(2026, 3, 8, 10, 0, 0, 0, time.UTC),
+		time.Date(2026, 3, 8, 10, 7, 30, 0, time.UTC),
+		time.Date(2026, 3, 8, 10, 14, 59, 999, time.UTC),
+	} {
+		if got := schedule.Next(now); !got.Equal(time.Date(2026, 3, 8, 10, 15, 0, 0, time.UTC)) {
+			t.Errorf("Next(%v) = %v, want 10:15", now, got)
+		}
+	}
+}
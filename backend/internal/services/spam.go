@@ -0,0 +1,341 @@
+package services
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+)
+
+// Public forms screened for spam
+const (
+	FormContact     = "contact"
+	FormBooking     = "booking"
+	FormTestimonial = "testimonial"
+	FormNewsletter  = "newsletter"
+	FormWaitlist    = "waitlist"
+	// FormDateHold is only rate limited: a hold has no text to score
+	FormDateHold = "date_hold"
+)
+
+// DefaultSpamThreshold is the score from which a submission is quarantined
+const DefaultSpamThreshold = 1.0
+
+// Form token timing: humans take a few seconds to fill a form, and a page
+// left open for a day should be reloaded
+const (
+	DefaultMinFillTime = 3 * time.Second
+	formTokenMaxAge    = 24 * time.Hour
+)
+
+// ErrRateLimited is returned when an IP or email submits too often
+var ErrRateLimited = errors.New("too many submissions")
+
+// Submission is a public form post as seen by the spam checks
+type Submission struct {
+	Form      string
+	IP        string
+	Email     string
+	Text      []string // free-text fields the content filters read
+	Honeypot  string   // hidden field only bots fill
+	FormToken string
+}
+
+// SpamFilter scores one aspect of a submission. A score of 1 quarantines it
+// on its own; smaller scores add up with other filters.
+type SpamFilter interface {
+	Score(s *Submission) (score float64, reason string)
+}
+
+// SpamFilterFunc adapts a function to SpamFilter
+type SpamFilterFunc func(s *Submission) (float64, string)
+
+// Score calls f
+func (f SpamFilterFunc) Score(s *Submission) (float64, string) { return f(s) }
+
+var (
+	spamFiltersMu   sync.RWMutex
+	spamFilters     []SpamFilter
+	spamFiltersOnce sync.Once
+)
+
+// defaultSpamFilters are the built-in checks, configured from the environment
+func defaultSpamFilters() []SpamFilter {
+	return []SpamFilter{
+		SpamFilterFunc(honeypotScore),
+		SpamFilterFunc(formTokenScore),
+		&LinkFilter{MaxLinks: envInt("SPAM_MAX_LINKS", 2)},
+		NewBlocklistFilter(loadSpamBlocklist()),
+	}
+}
+
+// RegisterSpamFilter adds a filter to the built-in ones
+func RegisterSpamFilter(f SpamFilter) {
+	currentSpamFilters()
+	spamFiltersMu.Lock()
+	defer spamFiltersMu.Unlock()
+	spamFilters = append(spamFilters, f)
+}
+
+func currentSpamFilters() []SpamFilter {
+	spamFiltersOnce.Do(func() {
+		spamFiltersMu.Lock()
+		spamFilters = append(defaultSpamFilters(), spamFilters...)
+		spamFiltersMu.Unlock()
+	})
+	spamFiltersMu.RLock()
+	defer spamFiltersMu.RUnlock()
+	return spamFilters
+}
+
+// SpamVerdict is the combined score of a submission
+type SpamVerdict struct {
+	Score   float64  `json:"score"`
+	Reasons []string `json:"reasons"`
+}
+
+// Suspicious reports whether the submission should be quarantined
+func (v SpamVerdict) Suspicious() bool {
+	return v.Score >= envFloat("SPAM_THRESHOLD", DefaultSpamThreshold)
+}
+
+// ScoreSubmission runs every filter over s
+func ScoreSubmission(s *Submission) SpamVerdict {
+	var verdict SpamVerdict
+	for _, f := range currentSpamFilters() {
+		score, reason := f.Score(s)
+		if score > 0 {
+			verdict.Score += score
+			verdict.Reasons = append(verdict.Reasons, reason)
+		}
+	}
+	return verdict
+}
+
+func honeypotScore(s *Submission) (float64, string) {
+	if s.Honeypot != "" {
+		return 1, "honeypot"
+	}
+	return 0, ""
+}
+
+// formTokenScore penalizes missing or forged tokens and forms sent faster
+// than a human could fill them. The public forms fetch a token when shown,
+// so only scripts post without one.
+func formTokenScore(s *Submission) (float64, string) {
+	if s.FormToken == "" {
+		return 1, "missing_form_token"
+	}
+	issued, ok := VerifyFormToken(s.FormToken)
+	if !ok {
+		return 1, "invalid_form_token"
+	}
+	age := time.Since(issued)
+	switch {
+	case age < ParseDurationEnv("SPAM_MIN_FILL_TIME", DefaultMinFillTime):
+		return 1, "filled_too_fast"
+	case age > formTokenMaxAge:
+		return 0.5, "expired_form_token"
+	}
+	return 0, ""
+}
+
+// linkPattern matches URLs and the link markup spam bots post
+var linkPattern = regexp.MustCompile(`(?i)https?://|www\.|\[url[=\]]|<a\s`)
+
+// LinkFilter scores text with more than MaxLinks links, 0.5 per extra link
+type LinkFilter struct {
+	MaxLinks int
+}
+
+// Score counts links across the free-text fields
+func (f *LinkFilter) Score(s *Submission) (float64, string) {
+	links := 0
+	for _, text := range s.Text {
+		links += len(linkPattern.FindAllStringIndex(text, -1))
+	}
+	if links <= f.MaxLinks {
+		return 0, ""
+	}
+	return 0.5 * float64(links-f.MaxLinks), fmt.Sprintf("links:%d", links)
+}
+
+// BlocklistFilter quarantines submissions whose text or email contains a
+// blocked term, such as a word or an email domain
+type BlocklistFilter struct {
+	terms []string
+}
+
+// NewBlocklistFilter matches terms case-insensitively
+func NewBlocklistFilter(terms []string) *BlocklistFilter {
+	f := &BlocklistFilter{}
+	for _, t := range terms {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			f.terms = append(f.terms, t)
+		}
+	}
+	return f
+}
+
+// Score reports the first blocked term found
+func (f *BlocklistFilter) Score(s *Submission) (float64, string) {
+	fields := append([]string{s.Email}, s.Text...)
+	for _, field := range fields {
+		field = strings.ToLower(field)
+		for _, term := range f.terms {
+			if strings.Contains(field, term) {
+				return 1, "blocklist:" + term
+			}
+		}
+	}
+	return 0, ""
+}
+
+// loadSpamBlocklist reads SPAM_BLOCKLIST (comma-separated) and
+// SPAM_BLOCKLIST_FILE (one term per line, # for comments)
+func loadSpamBlocklist() []string {
+	terms := strings.Split(os.Getenv("SPAM_BLOCKLIST"), ",")
+
+	if path := os.Getenv("SPAM_BLOCKLIST_FILE"); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Printf("Failed to read spam blocklist: %v", err)
+			return terms
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line != "" && !strings.HasPrefix(line, "#") {
+				terms = append(terms, line)
+			}
+		}
+	}
+	return terms
+}
+
+// formTokenKey signs form tokens
+func formTokenKey() []byte {
+	return []byte(envOr("FORM_TOKEN_KEY", os.Getenv("JWT_SECRET")))
+}
+
+// IssueFormToken returns a signed token recording when a form was displayed
+func IssueFormToken() string {
+	issued := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	return issued + "." + formTokenSignature(issued)
+}
+
+// VerifyFormToken returns when a token was issued, if its signature is valid
+func VerifyFormToken(token string) (time.Time, bool) {
+	issued, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(formTokenSignature(issued))) {
+		return time.Time{}, false
+	}
+	ms, err := strconv.ParseInt(issued, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(ms), true
+}
+
+func formTokenSignature(issued string) string {
+	mac := hmac.New(sha256.New, formTokenKey())
+	mac.Write([]byte("form\n" + issued))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+var (
+	submissionLimitsOnce sync.Once
+	ipLimiter            *RateLimiter
+	emailLimiter         *RateLimiter
+)
+
+// CheckSubmissionRate counts s against the per-IP (SPAM_IP_LIMIT, default
+// 5/10m) and per-email (SPAM_EMAIL_LIMIT, default 3/1h) limits of its form
+func CheckSubmissionRate(s *Submission) error {
+	submissionLimitsOnce.Do(func() {
+		ipLimiter = NewRateLimiter(parseRateEnv("SPAM_IP_LIMIT", 5, 10*time.Minute))
+		emailLimiter = NewRateLimiter(parseRateEnv("SPAM_EMAIL_LIMIT", 3, time.Hour))
+	})
+
+	if s.IP != "" && !ipLimiter.Allow(s.Form+"|"+s.IP) {
+		return ErrRateLimited
+	}
+	if s.Email != "" && !emailLimiter.Allow(s.Form+"|"+strings.ToLower(s.Email)) {
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// parseRateEnv reads a limit such as "5/10m"; "0" or "off" disables it
+func parseRateEnv(name string, limit int, window time.Duration) (int, time.Duration) {
+	v := strings.TrimSpace(os.Getenv(name))
+	switch v {
+	case "":
+		return limit, window
+	case "0", "off":
+		return 0, window
+	}
+
+	n, w, ok := strings.Cut(v, "/")
+	count, err := strconv.Atoi(n)
+	if ok {
+		window, err = time.ParseDuration(w)
+	}
+	if err != nil || count < 0 || window <= 0 {
+		log.Printf("Invalid %s %q, using %d/%s", name, v, limit, window)
+		return limit, window
+	}
+	return count, window
+}
+
+// QuarantineSubmission stores a suspicious submission for admin review
+// instead of processing it. payload is the request, replayed on release.
+func QuarantineSubmission(s *Submission, verdict SpamVerdict, payload interface{}) (*models.QuarantinedSubmission, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &models.QuarantinedSubmission{
+		Form:    s.Form,
+		IP:      s.IP,
+		Email:   s.Email,
+		Payload: string(data),
+		Score:   verdict.Score,
+		Reasons: strings.Join(verdict.Reasons, ","),
+		Status:  models.QuarantinePending,
+	}
+	if err := database.DB.Create(q).Error; err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func envInt(name string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil {
+		return n
+	}
+	return fallback
+}
+
+func envFloat(name string, fallback float64) float64 {
+	if f, err := strconv.ParseFloat(os.Getenv(name), 64); err == nil {
+		return f
+	}
+	return fallback
+}
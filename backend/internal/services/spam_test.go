@@ -0,0 +1,38 @@
+package services
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScoreSubmissionFormToken(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	// A token issued a minute ago, as when a person fills the form
+	issued := strconv.FormatInt(time.Now().Add(-time.Minute).UnixMilli(), 10)
+	filled := issued + "." + formTokenSignature(issued)
+
+	tests := []struct {
+		name       string
+		sub        Submission
+		suspicious bool
+		reason     string
+	}{
+		{"filled by a person", Submission{FormToken: filled}, false, ""},
+		{"missing token", Submission{}, true, "missing_form_token"},
+		{"forged token", Submission{FormToken: issued + ".forged"}, true, "invalid_form_token"},
+		{"sent right away", Submission{FormToken: IssueFormToken()}, true, "filled_too_fast"},
+		{"honeypot filled", Submission{FormToken: filled, Honeypot: "https://spam.example"}, true, "honeypot"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict := ScoreSubmission(&tt.sub)
+			reasons := strings.Join(verdict.Reasons, ",")
+			if verdict.Suspicious() != tt.suspicious || !strings.Contains(reasons, tt.reason) {
+				t.Errorf("verdict = %+v, want suspicious %v with %q", verdict, tt.suspicious, tt.reason)
+			}
+		})
+	}
+}
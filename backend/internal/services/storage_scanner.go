@@ -1,10 +1,10 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"os"
-	"path/filepath"
+	"path"
 	"strings"
 
 	"github.com/mazong/angel_event/internal/database"
@@ -19,20 +19,16 @@ func ScanStorage() {
 	log.Println("Storage scan completed")
 }
 
-func scanRentals() {
-	cwd, _ := os.Getwd()
-	fmt.Printf("Current working directory: %s\n", cwd)
-
-	// Try absolute path if we can guess it, or just print what we are trying
-	storagePath := "../storage/location"
-	fmt.Printf("Scanning rentals in relative path: %s\n", storagePath)
-
-	absPath, _ := filepath.Abs(storagePath)
-	fmt.Printf("Absolute path: %s\n", absPath)
+// StorageScanJob picks up photos added to the storage folders
+func StorageScanJob(ctx context.Context) (string, error) {
+	ScanStorage()
+	return "", nil
+}
 
-	files, err := os.ReadDir(storagePath)
+func scanRentals() {
+	files, err := listStorageFiles("storage/location/")
 	if err != nil {
-		fmt.Printf("Could not read rental storage directory: %v\n", err)
+		log.Printf("Could not list rental storage: %v", err)
 		return
 	}
 	fmt.Printf("Found %d files in rental storage\n", len(files))
@@ -49,21 +45,22 @@ func scanRentals() {
 	}
 
 	for _, file := range files {
-		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+		name := strings.TrimPrefix(file.Key, "storage/location/")
+		if strings.Contains(name, "/") {
 			continue
 		}
 
 		// Check if exists
 		var count int64
 		// ImageURL format: /storage/location/filename
-		imageURL := fmt.Sprintf("/storage/location/%s", file.Name())
+		imageURL := fmt.Sprintf("/storage/location/%s", name)
 		database.DB.Model(&models.RentalItem{}).Where("image_url = ?", imageURL).Count(&count)
 		if count > 0 {
 			continue
 		}
 
 		// Determine category based on filename keywords
-		lowerName := strings.ToLower(file.Name())
+		lowerName := strings.ToLower(name)
 		catID := catMap["other"] // default
 
 		if strings.Contains(lowerName, "fleur") || strings.Contains(lowerName, "bouquet") {
@@ -85,7 +82,7 @@ func scanRentals() {
 		}
 
 		// Create Title from filename
-		title := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
+		title := strings.TrimSuffix(name, path.Ext(name))
 		title = strings.ReplaceAll(title, "_", " ")
 		title = strings.ReplaceAll(title, "-", " ")
 		// Capitalize first letter (simple)
@@ -105,7 +102,7 @@ func scanRentals() {
 		}
 
 		if err := database.DB.Create(&item).Error; err != nil {
-			log.Printf("Failed to import rental item %s: %v", file.Name(), err)
+			log.Printf("Failed to import rental item %s: %v", name, err)
 		} else {
 			log.Printf("Imported rental item: %s", title)
 		}
@@ -113,54 +110,50 @@ func scanRentals() {
 }
 
 func scanGallery() {
-	storageRoot := "../storage"
-	dirs, err := os.ReadDir(storageRoot)
+	files, err := listStorageFiles("storage/")
 	if err != nil {
-		log.Printf("Could not read storage root: %v", err)
+		log.Printf("Could not list storage: %v", err)
 		return
 	}
 
-	for _, dir := range dirs {
-		if !dir.IsDir() || strings.HasPrefix(dir.Name(), ".") || dir.Name() == "location" {
-			continue
-		}
-
-		// Map directory name to category enum/slug
-		// The directory names might not match GalleryCategory enum exactly, may need normalization
-		// But for now, let's assume valid categories or map common ones.
-		// Actually, GalleryImage uses Category field which is GalleryCategory (string).
-		// Let's use the directory name as the category, ensuring it's lowercase/slugified.
-
-		category := strings.ToLower(dir.Name())
-		// Fix common mismatches if necessary, e.g. "weeding" -> "wedding"
-		if category == "weeding" {
-			category = "wedding"
-		}
-		if category == "baby shower" {
-			category = "baby_shower"
-		}
-
-		scanGalleryDir(filepath.Join(storageRoot, dir.Name()), category)
-	}
-}
-
-func scanGalleryDir(path string, category string) {
-	files, err := os.ReadDir(path)
+	resolver, err := NewGalleryCategoryResolver()
 	if err != nil {
-		log.Printf("Could not read gallery dir %s: %v", path, err)
+		log.Printf("Could not load gallery categories: %v", err)
 		return
 	}
 
+	// Group the files sitting directly in each event folder
+	dirFiles := make(map[string][]string)
+	var dirs []string
 	for _, file := range files {
-		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+		dir, name, ok := strings.Cut(strings.TrimPrefix(file.Key, "storage/"), "/")
+		if !ok || strings.Contains(name, "/") || strings.HasPrefix(dir, ".") || dir == "location" {
+			continue
+		}
+		if _, seen := dirFiles[dir]; !seen {
+			dirs = append(dirs, dir)
+		}
+		dirFiles[dir] = append(dirFiles[dir], name)
+	}
+
+	for _, dir := range dirs {
+		// Directory names are mapped to gallery categories in the database
+		// (e.g. "weeding" -> "wedding"), see CategoryDirectory
+		categoryID, err := resolver.Resolve(dir)
+		if err != nil {
+			log.Printf("Skipping gallery dir %s: %v", dir, err)
 			continue
 		}
 
-		// Relative path for URL: /storage/category/filename (roughly)
-		// But we need to serve it. The static route is /storage -> ../storage
-		// So URL is /storage/dirName/fileName
-		dirName := filepath.Base(path)
-		imageURL := fmt.Sprintf("/storage/%s/%s", dirName, file.Name())
+		scanGalleryDir(dir, dirFiles[dir], categoryID)
+	}
+}
+
+func scanGalleryDir(dirName string, names []string, categoryID uint) {
+	for _, name := range names {
+		// The storage folder is served at /storage, so the URL mirrors the key:
+		// /storage/dirName/fileName
+		imageURL := fmt.Sprintf("/storage/%s/%s", dirName, name)
 
 		var count int64
 		database.DB.Model(&models.GalleryImage{}).Where("image_url = ?", imageURL).Count(&count)
@@ -169,7 +162,7 @@ func scanGalleryDir(path string, category string) {
 		}
 
 		// Create Title
-		title := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
+		title := strings.TrimSuffix(name, path.Ext(name))
 		title = strings.ReplaceAll(title, "_", " ")
 		title = strings.ReplaceAll(title, "-", " ")
 
@@ -177,17 +170,29 @@ func scanGalleryDir(path string, category string) {
 			Title:         title,
 			Description:   "Importé depuis le stockage",
 			ImageURL:      imageURL,
-			Category:      models.GalleryCategory(category), // Cast to enum
-			FileName:      file.Name(),
+			CategoryID:    categoryID,
+			FileName:      name,
 			IsFromStorage: true,
 			Featured:      false,
 			SortOrder:     0,
 		}
 
 		if err := database.DB.Create(&img).Error; err != nil {
-			log.Printf("Failed to import gallery image %s: %v", file.Name(), err)
+			log.Printf("Failed to import gallery image %s: %v", name, err)
 		} else {
-			log.Printf("Imported gallery image: %s (%s)", title, category)
+			log.Printf("Imported gallery image: %s (category #%d)", title, categoryID)
 		}
 	}
 }
+
+// listStorageFiles lists the visible files of the blob store under prefix
+func listStorageFiles(prefix string) ([]BlobInfo, error) {
+	var files []BlobInfo
+	err := Blobs().List(context.Background(), prefix, func(info BlobInfo) error {
+		if !strings.HasPrefix(path.Base(info.Key), ".") {
+			files = append(files, info)
+		}
+		return nil
+	})
+	return files, err
+}
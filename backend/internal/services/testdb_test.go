@@ -0,0 +1,39 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mazong/angel_event/internal/database"
+)
+
+// useTestDB points database.DB at a fresh migrated SQLite database for the
+// duration of the test
+func useTestDB(t *testing.T) {
+	t.Helper()
+	t.Setenv("DATABASE_PATH", filepath.Join(t.TempDir(), "test.db"))
+	t.Setenv("DB_LOG_LEVEL", "silent")
+
+	previous := database.DB
+	if err := database.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := database.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+		database.DB = previous
+	})
+}
+
+// useClock pins the current time seen by Today and CurrentMonth
+func useClock(t *testing.T, now time.Time) {
+	t.Helper()
+	previous := clock
+	clock = func() time.Time { return now }
+	t.Cleanup(func() { clock = previous })
+}
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"gorm.io/gorm"
+)
+
+// Timeline entry types
+const (
+	TimelineEmailSent     = "email_sent"
+	TimelineEmailReceived = "email_received"
+	TimelineStatusChange  = "status_change"
+	TimelinePayment       = "payment"
+	TimelineNote          = "note"
+	TimelineInquiry       = "inquiry"
+	TimelineTestimonial   = "testimonial"
+)
+
+// TimelineTypes lists every timeline entry type
+var TimelineTypes = []string{
+	TimelineEmailSent, TimelineEmailReceived, TimelineStatusChange,
+	TimelinePayment, TimelineNote, TimelineInquiry, TimelineTestimonial,
+}
+
+// TimelineEntry is one event of a client's history. Data holds the record
+// it comes from: an EmailLog, InboundEmail, BookingStatusChange, Payment,
+// ClientNote, Inquiry or Testimonial.
+type TimelineEntry struct {
+	Type       string      `json:"type"`
+	ID         uint        `json:"id"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Summary    string      `json:"summary"`
+	BookingID  *uint       `json:"booking_id,omitempty"`
+	UserID     *uint       `json:"user_id,omitempty"`
+	Data       interface{} `json:"data"`
+}
+
+// timelineSources selects the type, ID and time of the events of each
+// type, in the same columns since any of them may come first in the union;
+// every query takes the client ID as its only parameter
+var timelineSources = map[string]string{
+	TimelineEmailSent:     "SELECT 'email_sent' AS type, id, created_at AS occurred_at FROM email_logs WHERE client_id = ? AND deleted_at IS NULL",
+	TimelineEmailReceived: "SELECT 'email_received' AS type, id, created_at AS occurred_at FROM inbound_emails WHERE client_id = ? AND deleted_at IS NULL",
+	TimelineStatusChange:  "SELECT 'status_change' AS type, id, created_at AS occurred_at FROM booking_status_changes WHERE client_id = ?",
+	TimelinePayment:       "SELECT 'payment' AS type, id, created_at AS occurred_at FROM payments WHERE client_id = ? AND deleted_at IS NULL",
+	TimelineNote:          "SELECT 'note' AS type, id, created_at AS occurred_at FROM client_notes WHERE client_id = ? AND deleted_at IS NULL",
+	TimelineInquiry:       "SELECT 'inquiry' AS type, id, created_at AS occurred_at FROM inquiries WHERE client_id = ? AND deleted_at IS NULL",
+	TimelineTestimonial:   "SELECT 'testimonial' AS type, id, created_at AS occurred_at FROM testimonials WHERE client_id = ? AND deleted_at IS NULL",
+}
+
+// RecordStatusChange adds a booking status change to the client's history.
+// from is empty when the booking is created; userID is nil for changes
+// made by the client.
+func RecordStatusChange(db *gorm.DB, booking *models.Booking, from models.BookingStatus, userID *uint) error {
+	if from == booking.Status {
+		return nil
+	}
+	return db.Create(&models.BookingStatusChange{
+		BookingID:  booking.ID,
+		ClientID:   booking.ClientID,
+		FromStatus: from,
+		ToStatus:   booking.Status,
+		UserID:     userID,
+	}).Error
+}
+
+// TimelinePosition is the place of an entry in the timeline order: its
+// time as stored, then its type and ID to break ties
+type TimelinePosition struct {
+	OccurredAt string
+	Type       string
+	ID         uint
+}
+
+// TimelinePage selects a page of a client's history
+type TimelinePage struct {
+	Types  []string // entry types, all by default
+	Limit  int
+	Offset int
+	Oldest bool              // oldest first instead of newest first
+	After  *TimelinePosition // continue after this entry, instead of Offset
+}
+
+// ClientTimeline returns a page of a client's history and the number of
+// entries, with the position of the last entry when more follow
+func ClientTimeline(clientID uint, page TimelinePage) ([]TimelineEntry, int64, *TimelinePosition, error) {
+	types := page.Types
+	if len(types) == 0 {
+		types = TimelineTypes
+	}
+
+	var selects []string
+	var args []interface{}
+	for _, t := range types {
+		source, ok := timelineSources[t]
+		if !ok {
+			return nil, 0, nil, fmt.Errorf("unknown timeline type %q", t)
+		}
+		selects = append(selects, source)
+		args = append(args, clientID)
+	}
+	union := strings.Join(selects, " UNION ALL ")
+
+	var total int64
+	if err := database.DB.Raw("SELECT COUNT(*) FROM ("+union+")", args...).Scan(&total).Error; err != nil {
+		return nil, 0, nil, err
+	}
+
+	direction, cmp := "DESC", "<"
+	if page.Oldest {
+		direction, cmp = "ASC", ">"
+	}
+
+	// Timestamps may carry different UTC offsets; julianday compares instants
+	query := "SELECT type, id, CAST(occurred_at AS TEXT) AS occurred_at FROM (" + union + ")"
+	if page.After != nil {
+		query += fmt.Sprintf(" WHERE julianday(occurred_at) %[1]s julianday(?) OR "+
+			"(julianday(occurred_at) = julianday(?) AND (type %[1]s ? OR (type = ? AND id %[1]s ?)))", cmp)
+		args = append(args, page.After.OccurredAt, page.After.OccurredAt, page.After.Type, page.After.Type, page.After.ID)
+	}
+	query += fmt.Sprintf(" ORDER BY julianday(occurred_at) %[1]s, type %[1]s, id %[1]s LIMIT ?", direction)
+	// Fetch one extra entry to know whether another page exists
+	args = append(args, page.Limit+1)
+	if page.After == nil && page.Offset > 0 {
+		query += " OFFSET ?"
+		args = append(args, page.Offset)
+	}
+
+	var refs []TimelinePosition
+	if err := database.DB.Raw(query, args...).Scan(&refs).Error; err != nil {
+		return nil, 0, nil, err
+	}
+
+	var next *TimelinePosition
+	if len(refs) > page.Limit {
+		refs = refs[:page.Limit]
+		next = &refs[len(refs)-1]
+	}
+
+	ids := make(map[string][]uint)
+	for _, ref := range refs {
+		ids[ref.Type] = append(ids[ref.Type], ref.ID)
+	}
+	loaded, err := loadTimelineEntries(ids)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	entries := make([]TimelineEntry, 0, len(refs))
+	for _, ref := range refs {
+		if entry, ok := loaded[ref.Type+fmt.Sprint(ref.ID)]; ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, total, next, nil
+}
+
+// loadTimelineEntries fetches the records of a page, keyed by type and ID
+func loadTimelineEntries(ids map[string][]uint) (map[string]TimelineEntry, error) {
+	entries := make(map[string]TimelineEntry)
+	add := func(e TimelineEntry) {
+		entries[e.Type+fmt.Sprint(e.ID)] = e
+	}
+
+	if len(ids[TimelineEmailSent]) > 0 {
+		var logs []models.EmailLog
+		if err := database.DB.Find(&logs, ids[TimelineEmailSent]).Error; err != nil {
+			return nil, err
+		}
+		for _, l := range logs {
+			summary := "Email sent: " + l.Subject
+			if l.Status == "failed" {
+				summary = "Email failed: " + l.Subject
+			}
+			add(TimelineEntry{Type: TimelineEmailSent, ID: l.ID, OccurredAt: l.CreatedAt, Summary: summary, Data: l})
+		}
+	}
+
+	if len(ids[TimelineEmailReceived]) > 0 {
+		var emails []models.InboundEmail
+		if err := database.DB.Preload("Attachments").Find(&emails, ids[TimelineEmailReceived]).Error; err != nil {
+			return nil, err
+		}
+		for _, e := range emails {
+			add(TimelineEntry{Type: TimelineEmailReceived, ID: e.ID, OccurredAt: e.CreatedAt,
+				Summary: "Email received: " + e.Subject, BookingID: e.BookingID, Data: e})
+		}
+	}
+
+	if len(ids[TimelineStatusChange]) > 0 {
+		var changes []models.BookingStatusChange
+		if err := database.DB.Find(&changes, ids[TimelineStatusChange]).Error; err != nil {
+			return nil, err
+		}
+		for _, ch := range changes {
+			summary := fmt.Sprintf("Booking #%d %s", ch.BookingID, ch.ToStatus)
+			if ch.FromStatus == "" {
+				summary = fmt.Sprintf("Booking #%d created", ch.BookingID)
+			}
+			bookingID := ch.BookingID
+			add(TimelineEntry{Type: TimelineStatusChange, ID: ch.ID, OccurredAt: ch.CreatedAt,
+				Summary: summary, BookingID: &bookingID, UserID: ch.UserID, Data: ch})
+		}
+	}
+
+	if len(ids[TimelinePayment]) > 0 {
+		var payments []models.Payment
+		if err := database.DB.Find(&payments, ids[TimelinePayment]).Error; err != nil {
+			return nil, err
+		}
+		for _, p := range payments {
+			bookingID := p.BookingID
+			add(TimelineEntry{Type: TimelinePayment, ID: p.ID, OccurredAt: p.CreatedAt,
+				Summary:   fmt.Sprintf("%s of %.2f $ (%s) for booking #%d", p.Kind, p.Amount, p.Method, p.BookingID),
+				BookingID: &bookingID, UserID: p.UserID, Data: p})
+		}
+	}
+
+	if len(ids[TimelineNote]) > 0 {
+		var notes []models.ClientNote
+		if err := database.DB.Preload("User").Find(&notes, ids[TimelineNote]).Error; err != nil {
+			return nil, err
+		}
+		for _, n := range notes {
+			add(TimelineEntry{Type: TimelineNote, ID: n.ID, OccurredAt: n.CreatedAt,
+				Summary: "Note", UserID: n.UserID, Data: n})
+		}
+	}
+
+	if len(ids[TimelineInquiry]) > 0 {
+		var inquiries []models.Inquiry
+		if err := database.DB.Find(&inquiries, ids[TimelineInquiry]).Error; err != nil {
+			return nil, err
+		}
+		for _, i := range inquiries {
+			summary := "Inquiry"
+			if i.Subject != "" {
+				summary += ": " + i.Subject
+			}
+			add(TimelineEntry{Type: TimelineInquiry, ID: i.ID, OccurredAt: i.CreatedAt,
+				Summary: summary, BookingID: i.BookingID, Data: i})
+		}
+	}
+
+	if len(ids[TimelineTestimonial]) > 0 {
+		var testimonials []models.Testimonial
+		if err := database.DB.Find(&testimonials, ids[TimelineTestimonial]).Error; err != nil {
+			return nil, err
+		}
+		for _, t := range testimonials {
+			add(TimelineEntry{Type: TimelineTestimonial, ID: t.ID, OccurredAt: t.CreatedAt,
+				Summary: fmt.Sprintf("Testimonial (%d/5)", t.Rating), Data: t})
+		}
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+)
+
+func TestClientTimelinePages(t *testing.T) {
+	useTestDB(t)
+
+	client := models.Client{Name: "Ana", Email: "ana@example.com"}
+	if err := database.DB.Create(&client).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Entries of both types at the same instants, some written with
+	// another UTC offset
+	base := time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		at := base.Add(time.Duration(i/2) * time.Hour)
+		if i%2 == 1 {
+			at = at.In(BusinessLocation())
+		}
+		note := models.ClientNote{ClientID: client.ID, Body: "note", CreatedAt: at}
+		change := models.BookingStatusChange{ClientID: client.ID, BookingID: 1, ToStatus: models.BookingStatusConfirmed, CreatedAt: at}
+		if err := database.DB.Create(&note).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := database.DB.Create(&change).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, oldest := range []bool{false, true} {
+		all, total, next, err := ClientTimeline(client.ID, TimelinePage{Limit: 100, Oldest: oldest})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 8 || len(all) != 8 || next != nil {
+			t.Fatalf("oldest %v: %d entries of %d, next %v", oldest, len(all), total, next)
+		}
+
+		// Walking the pages by position gives the same entries, once each
+		var walked []TimelineEntry
+		page := TimelinePage{Limit: 3, Oldest: oldest}
+		for {
+			entries, _, next, err := ClientTimeline(client.ID, page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			walked = append(walked, entries...)
+			if next == nil {
+				break
+			}
+			page.After = next
+		}
+		if got, want := timelineKeys(walked), timelineKeys(all); got != want {
+			t.Errorf("oldest %v: pages = %s, want %s", oldest, got, want)
+		}
+	}
+}
+
+func timelineKeys(entries []TimelineEntry) string {
+	keys := make([]string, len(entries))
+	for i, e := range entries {
+		keys[i] = fmt.Sprintf("%s#%d@%s", e.Type, e.ID, e.OccurredAt.UTC().Format("15:04"))
+	}
+	return strings.Join(keys, " ")
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // decoders used to verify uploads
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	_ "golang.org/x/image/webp"
+)
+
+// ImageLimits bounds an accepted image of one MIME type
+type ImageLimits struct {
+	Ext       string // extension used for the stored file
+	MaxBytes  int64
+	MaxPixels int // width * height
+	MaxEdge   int // longest edge in pixels
+}
+
+// imageLimits lists the accepted image types, keyed by sniffed MIME type
+var imageLimits = map[string]ImageLimits{
+	"image/jpeg": {Ext: ".jpg", MaxBytes: 20 << 20, MaxPixels: 50_000_000, MaxEdge: 12000},
+	"image/png":  {Ext: ".png", MaxBytes: 20 << 20, MaxPixels: 40_000_000, MaxEdge: 10000},
+	"image/webp": {Ext: ".webp", MaxBytes: 15 << 20, MaxPixels: 40_000_000, MaxEdge: 10000},
+	"image/gif":  {Ext: ".gif", MaxBytes: 8 << 20, MaxPixels: 4_000_000, MaxEdge: 4000},
+}
+
+// MaxUploadBodySize is the largest request body accepted by the server,
+// leaving room for the other form fields next to the biggest image
+const MaxUploadBodySize = 21 << 20
+
+// UploadTarget is the blob key prefix uploads of one kind are stored under
+type UploadTarget struct {
+	Prefix string
+}
+
+// Upload folders
+var (
+	GalleryUploads = UploadTarget{Prefix: "uploads/gallery"}
+	RentalUploads  = UploadTarget{Prefix: "uploads/rentals"}
+)
+
+// UploadError is a rejected upload; its message is safe to show to the user
+type UploadError struct {
+	Message string
+}
+
+func (e *UploadError) Error() string {
+	return e.Message
+}
+
+// StoredUpload describes a validated file written to the blob store
+type StoredUpload struct {
+	Key         string
+	URL         string
+	FileName    string
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// SaveImageUpload validates an uploaded image by its content, not its name,
+// and stores it under a random name in the target folder. Rejections are
+// returned as *UploadError.
+func SaveImageUpload(ctx context.Context, file *multipart.FileHeader, target UploadTarget) (*StoredUpload, error) {
+	f, err := file.Open()
+	if err != nil {
+		return nil, &UploadError{Message: "Failed to read uploaded file"}
+	}
+	defer f.Close()
+
+	data, contentType, limits, err := readImageUpload(f)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check dimensions from the header before decoding the whole image,
+	// so oversized images are refused without allocating their pixels
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, &UploadError{Message: "File is not a valid image"}
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 ||
+		cfg.Width > limits.MaxEdge || cfg.Height > limits.MaxEdge ||
+		cfg.Width*cfg.Height > limits.MaxPixels {
+		return nil, &UploadError{Message: fmt.Sprintf(
+			"Image dimensions %dx%d exceed the limit of %d pixels per side and %d megapixels",
+			cfg.Width, cfg.Height, limits.MaxEdge, limits.MaxPixels/1_000_000)}
+	}
+
+	if _, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+		return nil, &UploadError{Message: "File is not a valid image"}
+	}
+
+	name, err := RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	filename := name + limits.Ext
+	key := target.Prefix + "/" + filename
+
+	if err := Blobs().Put(ctx, key, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+		return nil, fmt.Errorf("failed to save upload: %w", err)
+	}
+
+	return &StoredUpload{
+		Key:         key,
+		URL:         MediaURLForKey(key),
+		FileName:    filename,
+		ContentType: contentType,
+		Width:       cfg.Width,
+		Height:      cfg.Height,
+	}, nil
+}
+
+// readImageUpload reads the upload, sniffing its type from the magic bytes
+// and enforcing the size limit of that type
+func readImageUpload(r io.Reader) ([]byte, string, ImageLimits, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, "", ImageLimits{}, &UploadError{Message: "Uploaded file is empty"}
+	}
+	head = head[:n]
+
+	contentType := http.DetectContentType(head)
+	limits, ok := imageLimits[contentType]
+	if !ok {
+		return nil, "", ImageLimits{}, &UploadError{Message: "Invalid file type. Allowed: jpg, jpeg, png, gif, webp"}
+	}
+
+	// Read one byte past the limit to detect oversized files
+	rest, err := io.ReadAll(io.LimitReader(r, limits.MaxBytes-int64(n)+1))
+	if err != nil {
+		return nil, "", ImageLimits{}, &UploadError{Message: "Failed to read uploaded file"}
+	}
+	data := append(head, rest...)
+	if int64(len(data)) > limits.MaxBytes {
+		return nil, "", ImageLimits{}, &UploadError{Message: fmt.Sprintf(
+			"File is too large. Maximum for %s is %d MB",
+			strings.TrimPrefix(contentType, "image/"), limits.MaxBytes>>20)}
+	}
+
+	return data, contentType, limits, nil
+}
+
+// RemoveUpload deletes a file previously stored in target, given its URL.
+// URLs outside the target folder, such as default storage images, are left alone.
+func RemoveUpload(ctx context.Context, fileURL string, target UploadTarget) error {
+	key, err := BlobKeyForURL(fileURL)
+	if err != nil || !strings.HasPrefix(key, target.Prefix+"/") {
+		return nil
+	}
+	return Blobs().Delete(ctx, key)
+}
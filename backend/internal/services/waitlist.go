@@ -0,0 +1,356 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	"gorm.io/gorm"
+)
+
+// DefaultWaitlistClaimTTL is how long a notified client keeps a freed slot
+const DefaultWaitlistClaimTTL = 24 * time.Hour
+
+// waitlistTokenBytes is the size of waitlist entry tokens (192 bits)
+const waitlistTokenBytes = 24
+
+// ErrDateAvailable is returned when joining the waitlist of a date that
+// can be booked directly
+var ErrDateAvailable = errors.New("date is available")
+
+var (
+	waitlistClaimTTL     time.Duration
+	waitlistClaimTTLOnce sync.Once
+)
+
+// WaitlistClaimTTL returns the configured claim window (WAITLIST_CLAIM_TTL)
+func WaitlistClaimTTL() time.Duration {
+	waitlistClaimTTLOnce.Do(func() {
+		waitlistClaimTTL = ParseDurationEnv("WAITLIST_CLAIM_TTL", DefaultWaitlistClaimTTL)
+		if waitlistClaimTTL <= 0 {
+			waitlistClaimTTL = DefaultWaitlistClaimTTL
+		}
+	})
+	return waitlistClaimTTL
+}
+
+// JoinWaitlist adds entry to the waitlist of its date. A client already
+// waiting for the date gets their existing entry back, with created false.
+func JoinWaitlist(entry *models.WaitlistEntry) (result *models.WaitlistEntry, created bool, err error) {
+	err = WithAvailabilityLock(func() error {
+		var existing models.WaitlistEntry
+		err := database.DB.Where("date = ? AND email = ? AND status IN ?", entry.Date, entry.Email,
+			[]models.WaitlistStatus{models.WaitlistWaiting, models.WaitlistNotified}).
+			First(&existing).Error
+		if err == nil {
+			result = &existing
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		day, err := ResolveDate(entry.Date)
+		if err != nil {
+			return err
+		}
+		if day.Available {
+			return ErrDateAvailable
+		}
+
+		token, err := RandomToken(waitlistTokenBytes)
+		if err != nil {
+			return err
+		}
+		entry.Token = token
+		entry.Status = models.WaitlistWaiting
+		if err := database.DB.Create(entry).Error; err != nil {
+			return err
+		}
+		result, created = entry, true
+		return nil
+	})
+	return result, created, err
+}
+
+// LeaveWaitlist cancels an entry, giving back the slot it was offered
+func LeaveWaitlist(token string) (*models.WaitlistEntry, error) {
+	var entry models.WaitlistEntry
+	err := WithAvailabilityLock(func() error {
+		if err := database.DB.Where("token = ? AND status IN ?", token,
+			[]models.WaitlistStatus{models.WaitlistWaiting, models.WaitlistNotified}).
+			First(&entry).Error; err != nil {
+			return err
+		}
+		return cancelWaitlistEntry(&entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// CancelWaitlistEntry cancels an entry by ID (admin)
+func CancelWaitlistEntry(id uint) (*models.WaitlistEntry, error) {
+	var entry models.WaitlistEntry
+	err := WithAvailabilityLock(func() error {
+		if err := database.DB.First(&entry, id).Error; err != nil {
+			return err
+		}
+		return cancelWaitlistEntry(&entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func cancelWaitlistEntry(entry *models.WaitlistEntry) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if entry.Status == models.WaitlistNotified && entry.HoldID != nil {
+			if err := activeHolds(tx).Where("id = ?", *entry.HoldID).
+				Update("status", models.DateHoldReleased).Error; err != nil {
+				return err
+			}
+		}
+		entry.Status = models.WaitlistCancelled
+		return tx.Model(entry).Update("status", models.WaitlistCancelled).Error
+	})
+}
+
+// waitlistClaim is a notification to send once the availability lock is released
+type waitlistClaim struct {
+	entry     models.WaitlistEntry
+	holdToken string
+}
+
+// ProcessWaitlist expires lapsed claims on date, then offers each remaining
+// slot to the next waiting client, oldest first, with a claim hold lasting
+// WaitlistClaimTTL
+func ProcessWaitlist(date models.Date) error {
+	var claims []waitlistClaim
+	err := WithAvailabilityLock(func() error {
+		// Claims whose hold lapsed or was released go back to nobody; a
+		// converted hold already marked its entry claimed
+		if err := database.DB.Model(&models.WaitlistEntry{}).
+			Where("date = ? AND status = ?", date, models.WaitlistNotified).
+			Where("hold_id NOT IN (?)", activeHolds(database.DB).Select("date_holds.id")).
+			Update("status", models.WaitlistExpired).Error; err != nil {
+			return err
+		}
+
+		if date.Before(Today()) {
+			return nil
+		}
+
+		day, err := ResolveDate(date)
+		if err != nil {
+			return err
+		}
+		if !day.Available {
+			return nil
+		}
+
+		var waiting []models.WaitlistEntry
+		if err := database.DB.Where("date = ? AND status = ?", date, models.WaitlistWaiting).
+			Order("created_at ASC, id ASC").
+			Limit(day.Remaining).
+			Find(&waiting).Error; err != nil {
+			return err
+		}
+
+		for i := range waiting {
+			entry := &waiting[i]
+			var hold *models.DateHold
+			if err := database.DB.Transaction(func(tx *gorm.DB) error {
+				var err error
+				hold, err = createDateHold(tx, date, nil, entry.Email, "", WaitlistClaimTTL())
+				if err != nil {
+					return err
+				}
+
+				now := time.Now()
+				entry.Status = models.WaitlistNotified
+				entry.NotifiedAt = &now
+				entry.ClaimExpiresAt = &hold.ExpiresAt
+				entry.HoldID = &hold.ID
+				return tx.Save(entry).Error
+			}); err != nil {
+				return err
+			}
+			claims = append(claims, waitlistClaim{entry: *entry, holdToken: hold.Token})
+		}
+		return nil
+	})
+
+	for _, claim := range claims {
+		sendWaitlistClaim(claim)
+	}
+	return err
+}
+
+// ProcessWaitlists expires entries for past dates and processes every date
+// with clients waiting or holding a claim
+func ProcessWaitlists() error {
+	if err := database.DB.Model(&models.WaitlistEntry{}).
+		Where("date < ? AND status IN ?", Today(),
+			[]models.WaitlistStatus{models.WaitlistWaiting, models.WaitlistNotified}).
+		Update("status", models.WaitlistExpired).Error; err != nil {
+		return err
+	}
+
+	var dates []models.Date
+	if err := database.DB.Model(&models.WaitlistEntry{}).
+		Where("status IN ?", []models.WaitlistStatus{models.WaitlistWaiting, models.WaitlistNotified}).
+		Distinct("date").
+		Pluck("date", &dates).Error; err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, date := range dates {
+		if err := ProcessWaitlist(date); err != nil {
+			log.Printf("Waitlist processing failed for %s: %v", date, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// WaitlistClaimURL is the booking page link that converts a claim hold
+func WaitlistClaimURL(date models.Date, holdToken string) string {
+	q := url.Values{}
+	q.Set("date", date.String())
+	q.Set("hold", holdToken)
+	return FrontendURL("/reserver?" + q.Encode())
+}
+
+// FrontendURL is the link to path on the public site, the first of the
+// FRONTEND_URL origins
+func FrontendURL(path string) string {
+	base := strings.TrimSpace(strings.Split(envOr("FRONTEND_URL", "http://localhost:5173"), ",")[0])
+	return strings.TrimRight(base, "/") + path
+}
+
+func sendWaitlistClaim(claim waitlistClaim) {
+	entry := claim.entry
+	claimURL := WaitlistClaimURL(entry.Date, claim.holdToken)
+	expires := entry.ClaimExpiresAt.In(BusinessLocation()).Format("2 January 2006 15:04")
+
+	err := NewEmailService().SendWaitlistClaim(
+		entry.Email,
+		entry.Name,
+		string(entry.EventType),
+		entry.Date.Time().Format("2 January 2006"),
+		claimURL,
+		expires,
+		entry.Language,
+	)
+
+	emailLog := models.EmailLog{
+		To:      entry.Email,
+		Subject: WaitlistClaimSubject(entry.Language),
+		Type:    "waitlist_claim",
+		Status:  "sent",
+	}
+	if err != nil {
+		log.Printf("Failed to send waitlist claim to %s: %v", entry.Email, err)
+		emailLog.Status = "failed"
+		emailLog.Error = err.Error()
+	}
+	database.DB.Create(&emailLog)
+}
+
+// WaitlistDemand summarizes the waitlist of one date
+type WaitlistDemand struct {
+	Date     models.Date `json:"date"`
+	Waiting  int         `json:"waiting"`
+	Notified int         `json:"notified"`
+	Claimed  int         `json:"claimed"`
+	Expired  int         `json:"expired"`
+	// EventTypes counts clients still waiting or notified, per event type
+	EventTypes map[string]int `json:"event_types"`
+	MaxEvents  int            `json:"max_events"`
+	Remaining  int            `json:"remaining"`
+}
+
+// GetWaitlistDemand returns the waitlist of every date from from to to that
+// has entries, with its current capacity
+func GetWaitlistDemand(from, to models.Date) ([]WaitlistDemand, error) {
+	if to.Before(from) {
+		return nil, fmt.Errorf("end date is before start date")
+	}
+	if from.DaysUntil(to) > maxResolveDays {
+		return nil, fmt.Errorf("date range exceeds %d days", maxResolveDays)
+	}
+
+	var rows []struct {
+		Date      models.Date
+		EventType string
+		Status    models.WaitlistStatus
+		Count     int
+	}
+	if err := database.DB.Model(&models.WaitlistEntry{}).
+		Select("date, event_type, status, COUNT(*) AS count").
+		Where("date >= ? AND date <= ? AND status != ?", from, to, models.WaitlistCancelled).
+		Group("date, event_type, status").
+		Order("date ASC").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return []WaitlistDemand{}, nil
+	}
+
+	days, err := ResolveAvailability(from, to)
+	if err != nil {
+		return nil, err
+	}
+	capacity := make(map[string]DayAvailability, len(days))
+	for _, day := range days {
+		capacity[day.Date.String()] = day
+	}
+
+	var demand []WaitlistDemand
+	index := make(map[string]int)
+	for _, row := range rows {
+		key := row.Date.String()
+		i, ok := index[key]
+		if !ok {
+			day := capacity[key]
+			demand = append(demand, WaitlistDemand{
+				Date:       row.Date,
+				EventTypes: make(map[string]int),
+				MaxEvents:  day.MaxEvents,
+				Remaining:  day.Remaining,
+			})
+			i = len(demand) - 1
+			index[key] = i
+		}
+
+		d := &demand[i]
+		switch row.Status {
+		case models.WaitlistWaiting:
+			d.Waiting += row.Count
+		case models.WaitlistNotified:
+			d.Notified += row.Count
+		case models.WaitlistClaimed:
+			d.Claimed += row.Count
+		case models.WaitlistExpired:
+			d.Expired += row.Count
+		}
+		if row.Status == models.WaitlistWaiting || row.Status == models.WaitlistNotified {
+			d.EventTypes[row.EventType] += row.Count
+		}
+	}
+
+	return demand, nil
+}
@@ -0,0 +1,278 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // register decoders for gallery originals
+	"image/jpeg"
+	"image/png"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/mazong/angel_event/internal/database"
+	"github.com/mazong/angel_event/internal/models"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	variantPrefix   = "uploads/variants/gallery"
+	watermarkLogo   = "uploads/private/watermark/logo.png"
+	variantMaxSize  = 1600 // longest edge of the public display variant
+	thumbnailSize   = 400  // longest edge of the public thumbnail
+	variantQuality  = 85
+	watermarkMargin = 0.03 // relative to the shortest image edge
+)
+
+// variantMu serializes variant generation runs
+var variantMu sync.Mutex
+
+// GetWatermarkSetting returns the current watermark configuration
+func GetWatermarkSetting() (models.WatermarkSetting, error) {
+	var setting models.WatermarkSetting
+	err := database.DB.Order("id ASC").First(&setting).Error
+	return setting, err
+}
+
+// GenerateGalleryVariants renders the watermarked display and thumbnail
+// variants of a gallery image and records their URLs
+func GenerateGalleryVariants(img *models.GalleryImage, setting models.WatermarkSetting) error {
+	ctx := context.Background()
+
+	key, err := BlobKeyForURL(img.ImageURL)
+	if err != nil {
+		return err
+	}
+
+	src, err := decodeImageBlob(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to decode %s: %w", key, err)
+	}
+
+	var mark image.Image
+	if setting.Enabled {
+		if mark, err = loadWatermark(ctx, setting); err != nil {
+			return err
+		}
+	}
+
+	// Versioned names so browsers and CDNs never serve a stale watermark
+	display := fmt.Sprintf("%s/%d-v%d.jpg", variantPrefix, img.ID, setting.Version)
+	thumb := fmt.Sprintf("%s/%d-v%d-thumb.jpg", variantPrefix, img.ID, setting.Version)
+
+	if err := writeVariant(ctx, display, src, variantMaxSize, mark, setting); err != nil {
+		return err
+	}
+	if err := writeVariant(ctx, thumb, src, thumbnailSize, mark, setting); err != nil {
+		return err
+	}
+
+	oldPublic, oldThumb := img.PublicURL, img.ThumbnailURL
+	img.PublicURL = MediaURLForKey(display)
+	img.ThumbnailURL = MediaURLForKey(thumb)
+	img.VariantVersion = setting.Version
+
+	if err := database.DB.Model(img).Updates(map[string]interface{}{
+		"public_url":      img.PublicURL,
+		"thumbnail_url":   img.ThumbnailURL,
+		"variant_version": img.VariantVersion,
+	}).Error; err != nil {
+		return err
+	}
+
+	// Remove the previous generation
+	for _, old := range []string{oldPublic, oldThumb} {
+		if old != "" && old != img.PublicURL && old != img.ThumbnailURL {
+			if oldKey, err := BlobKeyForURL(old); err == nil {
+				Blobs().Delete(ctx, oldKey)
+			}
+		}
+	}
+
+	return nil
+}
+
+// RegenerateGalleryVariants renders variants for every gallery image whose
+// variants are missing or outdated, or for all images when force is set.
+// It returns the number of images processed and failed.
+func RegenerateGalleryVariants(force bool) (int, int, error) {
+	variantMu.Lock()
+	defer variantMu.Unlock()
+
+	setting, err := GetWatermarkSetting()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to load watermark settings: %w", err)
+	}
+
+	query := database.DB.Model(&models.GalleryImage{})
+	if !force {
+		query = query.Where("variant_version != ? OR public_url IS NULL OR public_url = ''", setting.Version)
+	}
+
+	var images []models.GalleryImage
+	if err := query.Find(&images).Error; err != nil {
+		return 0, 0, err
+	}
+
+	done, failed := 0, 0
+	for i := range images {
+		if err := GenerateGalleryVariants(&images[i], setting); err != nil {
+			log.Printf("Failed to generate variants for gallery image %d: %v", images[i].ID, err)
+			failed++
+			continue
+		}
+		done++
+	}
+
+	if done > 0 || failed > 0 {
+		log.Printf("Gallery variants generated: %d, failed: %d", done, failed)
+	}
+	return done, failed, nil
+}
+
+func decodeImageBlob(ctx context.Context, key string) (image.Image, error) {
+	r, _, err := Blobs().Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	img, _, err := image.Decode(r)
+	return img, err
+}
+
+// loadWatermark returns the logo, or the text rendered as an image
+func loadWatermark(ctx context.Context, setting models.WatermarkSetting) (image.Image, error) {
+	if setting.LogoPath != "" {
+		// Older settings stored a path relative to the backend folder
+		logo, err := decodeImageBlob(ctx, strings.TrimPrefix(setting.LogoPath, "./"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load watermark logo: %w", err)
+		}
+		return logo, nil
+	}
+
+	if setting.Text == "" {
+		return nil, nil
+	}
+	return renderText(setting.Text), nil
+}
+
+// renderText draws white text with a dark outline on a transparent canvas
+func renderText(text string) image.Image {
+	face := basicfont.Face7x13
+	width := font.MeasureString(face, text).Ceil() + 2
+	height := face.Metrics().Height.Ceil() + 2
+
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	baseline := face.Metrics().Ascent.Ceil() + 1
+
+	// Outline first, then the text on top, so it reads on light and dark photos
+	for _, offset := range []image.Point{{0, 1}, {2, 1}, {1, 0}, {1, 2}} {
+		d := font.Drawer{Dst: canvas, Src: image.NewUniform(color.RGBA{0, 0, 0, 160}), Face: face,
+			Dot: fixed.P(offset.X, baseline+offset.Y-1)}
+		d.DrawString(text)
+	}
+	d := font.Drawer{Dst: canvas, Src: image.White, Face: face, Dot: fixed.P(1, baseline)}
+	d.DrawString(text)
+
+	return canvas
+}
+
+// writeVariant scales src to fit maxSize, applies the watermark and stores a JPEG
+func writeVariant(ctx context.Context, key string, src image.Image, maxSize int, mark image.Image, setting models.WatermarkSetting) error {
+	dst := resizeToFit(src, maxSize)
+
+	if mark != nil {
+		applyWatermark(dst, mark, setting)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: variantQuality}); err != nil {
+		return err
+	}
+	return Blobs().Put(ctx, key, &buf, int64(buf.Len()), "image/jpeg")
+}
+
+// resizeToFit returns an RGBA copy of src whose longest edge is at most maxSize
+func resizeToFit(src image.Image, maxSize int) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > maxSize || h > maxSize {
+		if w >= h {
+			h = h * maxSize / w
+			w = maxSize
+		} else {
+			w = w * maxSize / h
+			h = maxSize
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, b, xdraw.Src, nil)
+	return dst
+}
+
+// applyWatermark draws the mark scaled to setting.Scale of the image width
+func applyWatermark(dst *image.RGBA, mark image.Image, setting models.WatermarkSetting) {
+	db := dst.Bounds()
+	mb := mark.Bounds()
+
+	scale := setting.Scale
+	if scale <= 0 || scale > 1 {
+		scale = 0.2
+	}
+	w := int(float64(db.Dx()) * scale)
+	h := w * mb.Dy() / mb.Dx()
+	if w <= 0 || h <= 0 {
+		return
+	}
+
+	scaled := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.ApproxBiLinear.Scale(scaled, scaled.Bounds(), mark, mb, xdraw.Over, nil)
+
+	margin := int(float64(min(db.Dx(), db.Dy())) * watermarkMargin)
+	var origin image.Point
+	switch setting.Position {
+	case models.WatermarkTopLeft:
+		origin = image.Pt(margin, margin)
+	case models.WatermarkTopRight:
+		origin = image.Pt(db.Dx()-w-margin, margin)
+	case models.WatermarkBottomLeft:
+		origin = image.Pt(margin, db.Dy()-h-margin)
+	case models.WatermarkCenter:
+		origin = image.Pt((db.Dx()-w)/2, (db.Dy()-h)/2)
+	default:
+		origin = image.Pt(db.Dx()-w-margin, db.Dy()-h-margin)
+	}
+
+	opacity := setting.Opacity
+	if opacity < 0 || opacity > 1 {
+		opacity = 0.5
+	}
+	mask := image.NewUniform(color.Alpha{A: uint8(opacity * 255)})
+
+	r := image.Rectangle{Min: origin, Max: origin.Add(image.Pt(w, h))}
+	draw.DrawMask(dst, r, scaled, image.Point{}, mask, image.Point{}, draw.Over)
+}
+
+// SaveWatermarkLogo stores an uploaded PNG logo outside the public folders
+// and returns its blob key
+func SaveWatermarkLogo(ctx context.Context, logo image.Image) (string, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, logo); err != nil {
+		return "", err
+	}
+	if err := Blobs().Put(ctx, watermarkLogo, &buf, int64(buf.Len()), "image/png"); err != nil {
+		return "", err
+	}
+	return watermarkLogo, nil
+}
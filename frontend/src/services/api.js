@@ -34,4 +34,19 @@ api.interceptors.response.use(
   }
 )
 
+// fetchAllPages loads every row of a paginated list, following next_cursor
+// from page to page
+export async function fetchAllPages(url, params = {}) {
+  const rows = []
+  let cursor = ''
+  do {
+    const pageParams = { limit: 100, ...params }
+    if (cursor) pageParams.cursor = cursor
+    const response = await api.get(url, { params: pageParams })
+    rows.push(...(response.data.data || []))
+    cursor = response.data.pagination?.next_cursor || ''
+  } while (cursor)
+  return rows
+}
+
 export default api
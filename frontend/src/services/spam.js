@@ -0,0 +1,28 @@
+import { ref, onMounted } from 'vue'
+import api from './api'
+
+// useSpamFields returns the anti-spam fields a public form sends along:
+// the "website" honeypot, which only bots fill, and a form token fetched
+// when the form is shown, which tells the server how long filling it took.
+// Call refresh after a submission so the next one gets a fresh token.
+export function useSpamFields() {
+  const website = ref('')
+  const formToken = ref('')
+
+  async function refresh() {
+    try {
+      const response = await api.get('/public/form-token')
+      formToken.value = response.data.form_token
+    } catch (err) {
+      console.error('Failed to load form token:', err)
+    }
+  }
+
+  function spamFields() {
+    return { website: website.value, form_token: formToken.value }
+  }
+
+  onMounted(refresh)
+
+  return { website, spamFields, refresh }
+}